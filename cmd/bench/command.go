@@ -0,0 +1,173 @@
+// Package bench provides the "bench" command, which measures hashing throughput on the
+// current machine by hashing a generated tree with several worker counts.
+package bench
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+	"github.com/lucho00cuba/mtc/internal/units"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/spf13/cobra"
+)
+
+// filesPerDir is the number of generated files placed in each directory of the bench tree.
+const filesPerDir = 100
+
+// benchCmd represents the bench command for measuring hashing throughput.
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure hashing throughput on this machine",
+	Long: `Measure hashing throughput on this machine.
+Generates a temporary tree of --files files of --file-size bytes each, hashes it once to warm
+the page cache, then hashes it with each worker count and reports the throughput in MB/s and
+files/s. Since the tree was just written, it is usually read from memory, so the results
+measure hashing rather than disk speed. The temporary tree is removed afterwards.`,
+	Example: `  # Benchmark with the default tree
+  mtc bench
+
+  # Many small files, a few worker counts
+  mtc bench --files 100000 --file-size 4K --workers 1,4,16`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log := logger.WithOperation("bench", "command", "bench")
+
+		// Read flags directly from command to ensure they're parsed correctly
+		files, err := cmd.Flags().GetInt("files")
+		if err != nil {
+			log.Warn("Failed to read files flag", "error", err)
+			files = 1000
+		}
+		fileSizeFlag, err := cmd.Flags().GetString("file-size")
+		if err != nil {
+			log.Warn("Failed to read file-size flag", "error", err)
+			fileSizeFlag = "64K"
+		}
+		workers, err := cmd.Flags().GetIntSlice("workers")
+		if err != nil {
+			log.Warn("Failed to read workers flag", "error", err)
+			workers = nil
+		}
+
+		if files < 1 {
+			return fmt.Errorf("--files must be at least 1")
+		}
+		fileSize, err := units.ParseSize(fileSizeFlag)
+		if err != nil {
+			return fmt.Errorf("--file-size: %w", err)
+		}
+		if len(workers) == 0 {
+			workers = defaultWorkerCounts(runtime.NumCPU())
+		}
+		for _, n := range workers {
+			if n < 1 {
+				return fmt.Errorf("--workers: worker counts must be at least 1, got %d", n)
+			}
+		}
+
+		tmpDir, err := os.MkdirTemp("", "mtc-bench-")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		defer func() {
+			if err := os.RemoveAll(tmpDir); err != nil {
+				log.Warn("Failed to remove temporary directory", "path", tmpDir, "error", err)
+			}
+		}()
+
+		log.Info("Generating bench tree", "files", files, "file_size", fileSize)
+		if err := createTree(tmpDir, files, fileSize); err != nil {
+			return err
+		}
+		total := int64(files) * fileSize
+
+		out := cmd.OutOrStdout()
+		if _, err := fmt.Fprintf(out, "Tree: %d files of %s (%s)\n", files, units.FormatSize(fileSize), units.FormatSize(total)); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+
+		// Warm up the page cache so the first measured run is not penalized
+		if _, err := merkle.NewEngineWithWorkers(merkle.DefaultMaxWorkers).HashPath(tmpDir); err != nil {
+			return fmt.Errorf("failed to hash bench tree: %w", err)
+		}
+
+		if _, err := fmt.Fprintf(out, "%7s  %12s  %10s  %12s\n", "workers", "duration", "MB/s", "files/s"); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		bestWorkers, bestRate := 0, 0.0
+		for _, n := range workers {
+			start := time.Now()
+			if _, err := merkle.NewEngineWithWorkers(n).HashPath(tmpDir); err != nil {
+				return fmt.Errorf("failed to hash bench tree: %w", err)
+			}
+			duration := time.Since(start)
+
+			seconds := max(duration.Seconds(), 1e-9)
+			mbPerSec := float64(total) / (1 << 20) / seconds
+			filesPerSec := float64(files) / seconds
+			log.Info("Bench run completed", "workers", n, "duration", duration, "mb_per_sec", mbPerSec, "files_per_sec", filesPerSec)
+			if mbPerSec > bestRate {
+				bestWorkers, bestRate = n, mbPerSec
+			}
+
+			if _, err := fmt.Fprintf(out, "%7d  %12s  %10.1f  %12.1f\n", n, duration.Round(time.Microsecond), mbPerSec, filesPerSec); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+		}
+
+		if _, err := fmt.Fprintf(out, "Fastest: workers=%d (%.1f MB/s)\n", bestWorkers, bestRate); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	},
+}
+
+// defaultWorkerCounts returns the worker counts benchmarked by default: powers of two up
+// to the number of CPUs, plus the engine's default and the number of CPUs themselves.
+func defaultWorkerCounts(cpus int) []int {
+	counts := []int{merkle.DefaultMaxWorkers, cpus}
+	for n := 1; n < cpus; n *= 2 {
+		counts = append(counts, n)
+	}
+	slices.Sort(counts)
+	return slices.Compact(counts)
+}
+
+// createTree generates files files of fileSize bytes at root, filesPerDir per directory.
+// Each file starts with its index so no two files have the same contents.
+func createTree(root string, files int, fileSize int64) error {
+	content := make([]byte, fileSize)
+	for i := range content {
+		content[i] = byte(i * 31)
+	}
+	for i := 0; i < files; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("d%04d", i/filesPerDir))
+		if i%filesPerDir == 0 {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create bench directory: %w", err)
+			}
+		}
+		if len(content) >= 8 {
+			binary.LittleEndian.PutUint64(content, uint64(i))
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%04d", i%filesPerDir)), content, 0644); err != nil {
+			return fmt.Errorf("failed to create bench file: %w", err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	benchCmd.Flags().Int("files", 1000, "Number of files in the generated tree")
+	benchCmd.Flags().String("file-size", "64K", "Size of each generated file, with an optional K, M or G suffix (e.g. 4K, 1M)")
+	benchCmd.Flags().IntSlice("workers", nil, "Comma-separated worker counts to benchmark (default: powers of two up to the number of CPUs, and the engine default)")
+	cmd.Register(benchCmd)
+}
@@ -0,0 +1,126 @@
+package bench
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+	"github.com/spf13/pflag"
+)
+
+func init() {
+	// Silence logger during tests - only show errors
+	logger.Init("error", "text", io.Discard)
+}
+
+// resetFlags restores the bench flags to their defaults between tests.
+func resetFlags(t *testing.T) {
+	t.Helper()
+	benchCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			if err := sv.Replace([]string{}); err != nil {
+				t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+			}
+		} else if err := f.Value.Set(f.DefValue); err != nil {
+			t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+		}
+		f.Changed = false
+	})
+}
+
+func TestBenchCmd_ReportsThroughput(t *testing.T) {
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"bench", "--files", "10", "--file-size", "1K", "--workers", "1,2"})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v, output: %s", err, buf.String())
+	}
+
+	output := buf.String()
+	if !strings.HasPrefix(output, "Tree: 10 files of 1 KB (10 KB)\n") {
+		t.Errorf("Output should describe the tree, got:\n%s", output)
+	}
+	rows := 0
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 || (fields[0] != "1" && fields[0] != "2") {
+			continue
+		}
+		rows++
+		if mbPerSec, err := strconv.ParseFloat(fields[2], 64); err != nil || mbPerSec <= 0 {
+			t.Errorf("Row %q should report a positive MB/s throughput", line)
+		}
+	}
+	if rows != 2 {
+		t.Errorf("Expected one row per worker count, got %d:\n%s", rows, output)
+	}
+	if !strings.Contains(output, "Fastest: ") {
+		t.Errorf("Output should report the fastest worker count, got:\n%s", output)
+	}
+}
+
+func TestBenchCmd_InvalidFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "no files", args: []string{"bench", "--files", "0"}},
+		{name: "invalid size", args: []string{"bench", "--file-size", "lots"}},
+		{name: "invalid workers", args: []string{"bench", "--workers", "0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(io.Discard)
+			rootCmd.SetArgs(tt.args)
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			if err := rootCmd.Execute(); err == nil {
+				t.Errorf("rootCmd.Execute(%v) expected error", tt.args)
+			}
+		})
+	}
+}
+
+func TestDefaultWorkerCounts(t *testing.T) {
+	got := defaultWorkerCounts(6)
+	want := []int{1, 2, 4, 6, merkle.DefaultMaxWorkers}
+	slices.Sort(want)
+	if !slices.Equal(got, slices.Compact(want)) {
+		t.Errorf("defaultWorkerCounts(6) = %v, want %v", got, want)
+	}
+}
+
+func TestCreateTree(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := createTree(tmpDir, filesPerDir+1, 16); err != nil {
+		t.Fatalf("createTree() error = %v", err)
+	}
+	dirs, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read tree: %v", err)
+	}
+	if len(dirs) != 2 {
+		t.Errorf("Expected 2 directories for %d files, got %d", filesPerDir+1, len(dirs))
+	}
+	size, err := merkle.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if size.Size != int64(filesPerDir+1)*16 {
+		t.Errorf("Tree size = %d, want %d", size.Size, (filesPerDir+1)*16)
+	}
+}
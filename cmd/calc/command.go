@@ -3,10 +3,15 @@
 package calc
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/lucho00cuba/mtc/internal/flags"
+	"github.com/lucho00cuba/mtc/internal/ignore"
 	"github.com/lucho00cuba/mtc/internal/logger"
 	"github.com/lucho00cuba/mtc/internal/merkle"
 
@@ -14,37 +19,125 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// errHashMismatch is returned when no expected hash matches. It is bound here because the
+// cmd package is shadowed by the command parameter inside RunE.
+var errHashMismatch = cmd.ErrHashMismatch
+
+// marshalJSON encodes the --format json result according to --pretty. It is bound here
+// because the cmd package is shadowed by the command parameter.
+var marshalJSON = cmd.MarshalJSON
+
+const (
+	// formatText is the --format value printing a human-readable line
+	formatText = "text"
+	// formatJSON is the --format value printing a jsonResult
+	formatJSON = "json"
+)
+
 // calcCmd represents the calc command for hash verification.
 var calcCmd = &cobra.Command{
-	Use:   "calc [path] [hash]",
+	Use:   "calc [path] [hash...]",
 	Short: "Verify that a file or directory matches the given hash",
 	Long: `Verify that a file or directory matches the given hash.
 Computes the Merkle root hash of the specified path and compares it with the provided hash.
+With several hashes, the path passes if it matches any of them, e.g. either the old or the
+new known-good hash during a rolling upgrade, and the matching one is reported.
+With --expected-file, the expected hash is read from the first line of a file, such as a
+".sha" sidecar file, and the hash arguments become optional.
+With --baseline-file, the path is compared against a list of named known-good hashes, e.g.
+one per release, and the name of the matching baseline is reported.
+With --verify-twice, the path is hashed a second time and the command fails if the two
+results disagree, before any comparison, guarding against transient memory or read errors.
+With --format json, the result is printed as a JSON object for scripts.
 Exits with code 0 if the hashes match, non-zero otherwise.`,
-	Args: cobra.ExactArgs(2),
+	Example: `  # Verify a directory against a known hash
+  mtc calc ./release 3f9a...c2e1
+
+  # Verify against the hash stored next to it
+  mtc calc ./release --expected-file release.sha
+
+  # Find out which release a deployed directory corresponds to
+  mtc calc /srv/app --baseline-file baselines.txt
+
+  # Print the result as JSON
+  mtc calc ./release 3f9a...c2e1 --format json`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if expectedFile, _ := cmd.Flags().GetString("expected-file"); expectedFile != "" {
+			return cobra.MinimumNArgs(1)(cmd, args)
+		}
+		if baselineFile, _ := cmd.Flags().GetString("baseline-file"); baselineFile != "" {
+			return cobra.MinimumNArgs(1)(cmd, args)
+		}
+		return cobra.MinimumNArgs(2)(cmd, args)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		path := args[0]
-		expectedHashStr := args[1]
-		log := logger.With("path", path, "command", "calc", "expected_hash", expectedHashStr)
+		hashArgs := args[1:]
+		expectedFile, err := cmd.Flags().GetString("expected-file")
+		if err != nil {
+			logger.WithOperation("calc", "command", "calc").Warn("Failed to read expected-file flag", "error", err)
+			expectedFile = ""
+		}
+		if expectedFile != "" {
+			arg, err := readExpectedFile(expectedFile)
+			if err != nil {
+				return err
+			}
+			hashArgs = append(hashArgs, arg)
+		}
+		log := logger.WithOperation("calc", "path", path, "command", "calc", "expected_hash", strings.Join(hashArgs, ","))
 
-		// Parse the expected hash from hex string
-		expectedHash, err := hex.DecodeString(expectedHashStr)
+		// Parse the expected hashes from hex strings
+		expected := make([]expectedHash, 0, len(hashArgs))
+		for _, arg := range hashArgs {
+			e, err := parseExpectedHash(arg)
+			if err != nil {
+				log.Error("Failed to parse expected hash", "error", err)
+				// Write error to stderr so it's visible to users
+				if _, writeErr := fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v\n", err); writeErr != nil {
+					log.Error("Failed to write error to stderr", "error", writeErr)
+				}
+				return err
+			}
+			expected = append(expected, e)
+		}
+		baselineFile, err := cmd.Flags().GetString("baseline-file")
 		if err != nil {
-			log.Error("Failed to parse expected hash", "error", err)
-			// Write error to stderr so it's visible to users
-			if _, writeErr := fmt.Fprintf(cmd.ErrOrStderr(), "Error: invalid hash format: %q (expected hexadecimal string)\n", expectedHashStr); writeErr != nil {
-				log.Error("Failed to write error to stderr", "error", writeErr)
+			log.Warn("Failed to read baseline-file flag", "error", err)
+			baselineFile = ""
+		}
+		if baselineFile != "" {
+			baselines, err := readBaselineFile(baselineFile)
+			if err != nil {
+				log.Error("Failed to read baseline file", "error", err)
+				return err
 			}
-			return fmt.Errorf("invalid hash format: %q (expected hexadecimal string): %w", expectedHashStr, err)
+			expected = append(expected, baselines...)
 		}
 
 		// Read flags directly from command to ensure they're parsed correctly
-		excludePatterns, err := cmd.Flags().GetStringArray("exclude")
+		verifyTwice, err := cmd.Flags().GetBool("verify-twice")
+		if err != nil {
+			log.Warn("Failed to read verify-twice flag", "error", err)
+			verifyTwice = false
+		}
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			log.Warn("Failed to read format flag", "error", err)
+			format = formatText
+		}
+		if format != formatText && format != formatJSON {
+			return fmt.Errorf("unsupported output format %q (supported: text, json)", format)
+		}
+		if locateDiff, _ := cmd.Flags().GetBool("locate-diff"); locateDiff && format == formatJSON {
+			return fmt.Errorf("--locate-diff cannot be used with --format json")
+		}
+		excludePatterns, err := flags.ExcludePatterns(cmd)
 		if err != nil {
 			log.Warn("Failed to read exclude patterns", "error", err)
 			excludePatterns = []string{}
 		}
-		customIgnoreFile, err := cmd.Flags().GetString("ignore-file")
+		customIgnoreFile, err := flags.IgnoreFile(cmd)
 		if err != nil {
 			log.Warn("Failed to read ignore-file flag", "error", err)
 			customIgnoreFile = ""
@@ -55,10 +148,38 @@ Exits with code 0 if the hashes match, non-zero otherwise.`,
 
 		// Always create engine with exclusions (automatically loads .mtcignore and .gitignore)
 		// Custom ignore file and exclude patterns are optional additions
-		engine, err := merkle.NewEngineWithExclusions(0, excludePatterns, path, true, customIgnoreFile)
+		newEngine := func() (*merkle.Engine, error) {
+			engine, err := merkle.NewEngineWithExclusions(0, excludePatterns, path, true, customIgnoreFile)
+			if err != nil {
+				log.Error("Failed to create engine with exclusions", "error", err)
+				return nil, fmt.Errorf("failed to create engine: %w", err)
+			}
+			if err := flags.ApplyIgnoreFileName(cmd, engine); err != nil {
+				return nil, err
+			}
+			if err := flags.ApplyHashing(cmd, engine); err != nil {
+				return nil, err
+			}
+			flags.ApplyIncludeRootName(cmd, engine)
+			if err := flags.ApplyAssume(cmd, engine); err != nil {
+				return nil, err
+			}
+			return engine, nil
+		}
+		engine, err := newEngine()
 		if err != nil {
-			log.Error("Failed to create engine with exclusions", "error", err)
-			return fmt.Errorf("failed to create engine: %w", err)
+			return err
+		}
+		defer flags.ReportDiagnostics(cmd, flags.ApplyReportDiagnostics(cmd, engine))
+		warned := make(map[string]bool)
+		for _, e := range expected {
+			if e.fingerprint == "" || warned[strings.ToLower(e.fingerprint)] {
+				continue
+			}
+			warned[strings.ToLower(e.fingerprint)] = true
+			if err := warnFingerprint(cmd, engine, e.fingerprint); err != nil {
+				return err
+			}
 		}
 		result, err := engine.HashPath(path)
 		if err != nil {
@@ -66,6 +187,27 @@ Exits with code 0 if the hashes match, non-zero otherwise.`,
 			return err
 		}
 
+		if verifyTwice {
+			// A fresh engine, so nothing such as a used-up byte budget carries over
+			second, err := newEngine()
+			if err != nil {
+				return err
+			}
+			again, err := second.HashPath(path)
+			if err != nil {
+				log.Error("Second hash computation failed", "error", err, "duration", time.Since(start))
+				return err
+			}
+			if !bytes.Equal(result.Hash, again.Hash) || result.Size != again.Size {
+				log.Error("Hash computations disagree", "first", fmt.Sprintf("%x", result.Hash), "second", fmt.Sprintf("%x", again.Hash))
+				if _, err := fmt.Fprintf(cmd.ErrOrStderr(), "Error: hashing %s twice gave different results, the data or this machine is unreliable\nFirst:  %x (%d bytes)\nSecond: %x (%d bytes)\n", path, result.Hash, result.Size, again.Hash, again.Size); err != nil {
+					log.Error("Failed to write error to stderr", "error", err)
+				}
+				return fmt.Errorf("--verify-twice: the two hash computations of %q disagree", path)
+			}
+			log.Debug("Second hash computation agrees", "duration", time.Since(start))
+		}
+
 		duration := time.Since(start)
 		computedHashStr := fmt.Sprintf("%x", result.Hash)
 		log.Info("Hash computation completed",
@@ -74,30 +216,32 @@ Exits with code 0 if the hashes match, non-zero otherwise.`,
 			"size", result.Size,
 		)
 
+		if format == formatJSON {
+			return writeJSONResult(cmd, path, result, computedHashStr, expected)
+		}
+
 		// Compare hashes
-		if len(result.Hash) != len(expectedHash) {
+		if len(expected) == 1 && len(result.Hash) != len(expected[0].hash) {
 			log.Error("Hash length mismatch",
 				"computed_length", len(result.Hash),
-				"expected_length", len(expectedHash),
+				"expected_length", len(expected[0].hash),
 			)
-			writeErr := writeHashLengthMismatchOutput(cmd, len(result.Hash), len(expectedHash), computedHashStr, expectedHashStr)
+			writeErr := writeHashLengthMismatchOutput(cmd, len(result.Hash), len(expected[0].hash), computedHashStr, expected[0].hex)
 			if writeErr != nil {
 				log.Error("Failed to write hash length mismatch output", "error", writeErr)
 			}
-			return fmt.Errorf("hash length mismatch")
+			return fmt.Errorf("hash length mismatch: %w", errHashMismatch)
 		}
 
-		match := true
-		for i := range result.Hash {
-			if result.Hash[i] != expectedHash[i] {
-				match = false
-				break
+		if i := matchExpected(result.Hash, expected); i >= 0 {
+			log.Info("Hash verification successful", "hash", computedHashStr, "matched", i+1)
+			line := fmt.Sprintf("Hash matches: %s", computedHashStr)
+			if expected[i].baseline != "" {
+				line += fmt.Sprintf(" (baseline %s)", expected[i].baseline)
+			} else if len(expected) > 1 {
+				line += fmt.Sprintf(" (expected hash %d of %d)", i+1, len(expected))
 			}
-		}
-
-		if match {
-			log.Info("Hash verification successful", "hash", computedHashStr)
-			if _, err := fmt.Fprintf(cmd.OutOrStdout(), "Hash matches: %s\n", computedHashStr); err != nil {
+			if _, err := fmt.Fprintln(cmd.OutOrStdout(), line); err != nil {
 				log.Error("Failed to write output to stdout", "error", err)
 				return fmt.Errorf("failed to write output: %w", err)
 			}
@@ -106,7 +250,6 @@ Exits with code 0 if the hashes match, non-zero otherwise.`,
 
 		log.Error("Hash verification failed",
 			"computed_hash", computedHashStr,
-			"expected_hash", expectedHashStr,
 		)
 		if _, err := fmt.Fprintf(cmd.OutOrStderr(), "Hash mismatch!\n"); err != nil {
 			log.Error("Failed to write output to stderr", "error", err)
@@ -116,14 +259,250 @@ Exits with code 0 if the hashes match, non-zero otherwise.`,
 			log.Error("Failed to write output to stderr", "error", err)
 			return fmt.Errorf("failed to write output: %w", err)
 		}
-		if _, err := fmt.Fprintf(cmd.OutOrStderr(), "Expected: %s\n", expectedHashStr); err != nil {
-			log.Error("Failed to write output to stderr", "error", err)
-			return fmt.Errorf("failed to write output: %w", err)
+		for _, e := range expected {
+			line := "Expected: " + e.hex
+			if e.baseline != "" {
+				line += fmt.Sprintf(" (baseline %s)", e.baseline)
+			}
+			if _, err := fmt.Fprintln(cmd.OutOrStderr(), line); err != nil {
+				log.Error("Failed to write output to stderr", "error", err)
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+		}
+		if locateDiff, err := cmd.Flags().GetBool("locate-diff"); err != nil {
+			log.Warn("Failed to read locate-diff flag", "error", err)
+		} else if locateDiff {
+			reference, err := cmd.Flags().GetString("reference")
+			if err != nil {
+				log.Warn("Failed to read reference flag", "error", err)
+				reference = ""
+			}
+			if err := writeLocateDiffOutput(cmd, path, result.Size, reference); err != nil {
+				log.Error("Failed to locate difference", "error", err)
+				return fmt.Errorf("failed to locate difference: %w", err)
+			}
 		}
-		return fmt.Errorf("hash mismatch")
+		return errHashMismatch
 	},
 }
 
+// jsonResult is the outcome of a verification as printed by --format json.
+type jsonResult struct {
+	Path     string `json:"path"`
+	Computed string `json:"computed"`
+	// Expected is the expected hash that matched or, without a match, the first one
+	Expected string `json:"expected"`
+	// ExpectedAny lists every expected hash when several were given
+	ExpectedAny []string `json:"expected_any,omitempty"`
+	Match       bool     `json:"match"`
+	Size        int64    `json:"size"`
+	// Baseline is the name of the matching --baseline-file entry
+	Baseline string `json:"baseline,omitempty"`
+}
+
+// writeJSONResult writes the outcome of a verification to stdout as a jsonResult.
+//
+// Parameters:
+//   - cmd: The Cobra command instance for accessing output streams
+//   - path: The verified path
+//   - result: The result computed for path
+//   - computed: The hexadecimal representation of the computed hash
+//   - expected: The expected hashes, at least one
+//
+// Returns errHashMismatch if no expected hash matches, so the exit code still reflects the
+// outcome, or an error if writing fails.
+func writeJSONResult(cmd *cobra.Command, path string, result merkle.Result, computed string, expected []expectedHash) error {
+	out := jsonResult{Path: path, Computed: computed, Expected: expected[0].hex, Size: result.Size}
+	if i := matchExpected(result.Hash, expected); i >= 0 {
+		out.Expected = expected[i].hex
+		out.Baseline = expected[i].baseline
+		out.Match = true
+	}
+	if len(expected) > 1 {
+		for _, e := range expected {
+			out.ExpectedAny = append(out.ExpectedAny, e.hex)
+		}
+	}
+
+	data, err := marshalJSON(out)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+	if _, err := cmd.OutOrStdout().Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if !out.Match {
+		return errHashMismatch
+	}
+	return nil
+}
+
+// expectedHash is a hash given on the command line, optionally tagged with the exclusion
+// fingerprint it was computed with, or a named baseline.
+type expectedHash struct {
+	hex         string
+	hash        []byte
+	fingerprint string
+	// baseline is the name of the --baseline-file entry, or "" for other hashes
+	baseline string
+}
+
+// parseExpectedHash parses a "<hex>" or "<hex>@<fingerprint>" argument.
+//
+// Returns the expected hash, or an error if the hash or fingerprint is not valid hexadecimal.
+func parseExpectedHash(arg string) (expectedHash, error) {
+	hexHash, fingerprint, tagged := strings.Cut(arg, "@")
+	hash, err := hex.DecodeString(hexHash)
+	if err != nil {
+		return expectedHash{}, fmt.Errorf("invalid hash format: %q (expected hexadecimal string): %w", hexHash, err)
+	}
+	if tagged {
+		if fp, err := hex.DecodeString(fingerprint); err != nil || len(fp) != ignore.FingerprintSize {
+			return expectedHash{}, fmt.Errorf("invalid exclusion fingerprint %q (expected %d hexadecimal characters)", fingerprint, 2*ignore.FingerprintSize)
+		}
+	}
+	return expectedHash{hex: hexHash, hash: hash, fingerprint: fingerprint}, nil
+}
+
+// readExpectedFile reads an expected hash from the first line of a file. Surrounding
+// whitespace is trimmed and anything after the first field is ignored, so sidecar files in
+// the "<hash>  <name>" layout of sha256sum work as well as files holding only the hash.
+//
+// Returns the hash argument, to be parsed like one given on the command line, or an error
+// if the file cannot be read or its first line is empty.
+func readExpectedFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read expected hash file: %w", err)
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("expected hash file %q has no hash on its first line", path)
+	}
+	return fields[0], nil
+}
+
+// readBaselineFile reads named baselines from a file holding one "<name> <hash>" pair per
+// line, such as one per release. Blank lines and lines starting with "#" are skipped; hashes
+// may carry an exclusion fingerprint like those given on the command line.
+//
+// Returns the baselines in file order, or an error if the file cannot be read, a line is
+// malformed, or it holds no baseline.
+func readBaselineFile(path string) ([]expectedHash, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline file: %w", err)
+	}
+	var baselines []expectedHash
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("baseline file %q line %d: expected \"<name> <hash>\", got %q", path, i+1, line)
+		}
+		e, err := parseExpectedHash(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("baseline file %q line %d: %w", path, i+1, err)
+		}
+		e.baseline = fields[0]
+		baselines = append(baselines, e)
+	}
+	if len(baselines) == 0 {
+		return nil, fmt.Errorf("baseline file %q holds no baselines", path)
+	}
+	return baselines, nil
+}
+
+// matchExpected returns the index of the first expected hash equal to computed, or -1.
+func matchExpected(computed []byte, expected []expectedHash) int {
+	for i, e := range expected {
+		if bytes.Equal(computed, e.hash) {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeLocateDiffOutput writes where a mismatching file diverges to stderr.
+// A hash alone cannot tell where contents differ, so without a reference file only
+// the computed size is reported. With a reference file, the size difference and the
+// offset of the first differing byte are reported as well.
+//
+// Parameters:
+//   - cmd: The Cobra command instance for accessing output streams
+//   - path: The path that failed verification
+//   - size: The size computed for path
+//   - reference: The path of a known-good copy of the file, or "" if none was given
+//
+// Returns an error if a file cannot be read or writing to stderr fails.
+func writeLocateDiffOutput(cmd *cobra.Command, path string, size int64, reference string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %q: %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		_, err := fmt.Fprintf(cmd.OutOrStderr(), "Locate diff: only available for single files\n")
+		return err
+	}
+
+	if reference == "" {
+		_, err := fmt.Fprintf(cmd.OutOrStderr(), "Size: %d bytes (no --reference given, first differing offset unknown)\n", size)
+		return err
+	}
+
+	refInfo, err := os.Stat(reference)
+	if err != nil {
+		return fmt.Errorf("failed to stat reference %q: %w", reference, err)
+	}
+	if refInfo.Size() == size {
+		if _, err := fmt.Fprintf(cmd.OutOrStderr(), "Size: %d bytes (same as reference)\n", size); err != nil {
+			return err
+		}
+	} else if _, err := fmt.Fprintf(cmd.OutOrStderr(), "Size: %d bytes (reference: %d bytes, %+d)\n", size, refInfo.Size(), size-refInfo.Size()); err != nil {
+		return err
+	}
+
+	offset, err := merkle.FirstDifference(path, reference)
+	if err != nil {
+		return err
+	}
+	if offset < 0 {
+		_, err := fmt.Fprintf(cmd.OutOrStderr(), "Contents identical to reference\n")
+		return err
+	}
+	_, err = fmt.Fprintf(cmd.OutOrStderr(), "First difference at byte offset %d\n", offset)
+	return err
+}
+
+// warnFingerprint writes a warning to stderr if the expected hash was computed with
+// exclusions other than the engine's, since a mismatch may then only reflect which
+// paths were excluded.
+//
+// Parameters:
+//   - cmd: The Cobra command instance for accessing output streams
+//   - engine: The engine that will compute the hash
+//   - expected: The exclusion fingerprint recorded with the expected hash
+//
+// Returns an error if the engine's exclusions cannot be fingerprinted or writing fails.
+func warnFingerprint(cmd *cobra.Command, engine *merkle.Engine, expected string) error {
+	current, err := engine.ExclusionFingerprint()
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint exclusions: %w", err)
+	}
+	if strings.EqualFold(current, expected) {
+		return nil
+	}
+	logger.WithOperation("calc", "command", "calc").Warn("Exclusion fingerprint mismatch", "expected", expected, "current", current)
+	if _, err := fmt.Fprintf(cmd.ErrOrStderr(), "Warning: the expected hash was computed with different exclusions (fingerprint %s, now %s); a mismatch may only reflect excluded paths\n", expected, current); err != nil {
+		return fmt.Errorf("failed to write warning: %w", err)
+	}
+	return nil
+}
+
 // writeHashLengthMismatchOutput writes hash length mismatch information to stderr.
 // It outputs the computed and expected hash lengths and values to help diagnose
 // verification failures. This is a helper function to improve error handling consistency.
@@ -151,8 +530,19 @@ func writeHashLengthMismatchOutput(cmd *cobra.Command, computedLen, expectedLen
 }
 
 func init() {
-	calcCmd.Flags().StringArrayP("exclude", "e", []string{}, "Exclude patterns (e.g., 'node_modules', '.git'). Can be specified multiple times.")
-	calcCmd.Flags().StringP("ignore-file", "i", "", "Path to a custom ignore file (takes highest priority). .mtcignore and .gitignore are always loaded automatically from the working directory.")
+	calcCmd.Flags().StringArrayP("exclude", "e", []string{}, "Exclude patterns (e.g., 'node_modules', '.git'). Can be specified multiple times. Defaults to the colon or newline separated patterns in $MTC_EXCLUDE.")
+	calcCmd.Flags().StringP("ignore-file", "i", "", "Path to a custom ignore file (takes highest priority). .mtcignore and .gitignore are always loaded automatically from the working directory. Defaults to $MTC_IGNORE_FILE.")
+	flags.AddIgnoreFileName(calcCmd)
+	flags.AddHashing(calcCmd)
+	flags.AddIncludeRootName(calcCmd)
+	flags.AddReportDiagnostics(calcCmd)
+	flags.AddAssume(calcCmd)
+	calcCmd.Flags().String("expected-file", "", "Read the expected hash from the first line of this file (e.g. a .sha sidecar file), in addition to any hash arguments")
+	calcCmd.Flags().String("baseline-file", "", "Compare against the named baselines in this file, one \"<name> <hash>\" pair per line (e.g. one per release), reporting the name of the one that matches. Blank lines and # comments are skipped")
+	calcCmd.Flags().String("format", formatText, "Output format: text, or json for a single object with the path, computed and expected hashes, match result and size. The exit code reflects the match either way")
+	calcCmd.Flags().Bool("verify-twice", false, "Hash the path twice and fail unless both computations agree before comparing, guarding against transient memory or read errors. The second pass may be served from the operating system's cache")
+	calcCmd.Flags().Bool("locate-diff", false, "On mismatch of a single file, report its size and, with --reference, how the size differs and the offset of the first differing byte")
+	calcCmd.Flags().String("reference", "", "Known-good copy of the file, compared byte by byte by --locate-diff")
 
 	cmd.Register(calcCmd)
 }
@@ -3,15 +3,20 @@ package calc
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/lucho00cuba/mtc/cmd"
 	"github.com/lucho00cuba/mtc/internal/logger"
 	"github.com/lucho00cuba/mtc/internal/merkle"
+	"github.com/spf13/pflag"
 )
 
 func init() {
@@ -179,10 +184,10 @@ func TestCalcCmd_InvalidArgs(t *testing.T) {
 		t.Error("calcCmd.Args() expected error for one arg")
 	}
 
-	// Test with too many args - should return error
-	err = calcCmd.Args(calcCmd, []string{"arg1", "arg2", "arg3"})
-	if err == nil {
-		t.Error("calcCmd.Args() expected error for too many args")
+	// Test with several expected hashes - should not error
+	err = calcCmd.Args(calcCmd, []string{"path", "hash1", "hash2"})
+	if err != nil {
+		t.Errorf("calcCmd.Args() unexpected error for several hashes: %v", err)
 	}
 
 	// Test with correct number of args - should not error
@@ -229,3 +234,450 @@ func TestCalcCmd_WithExcludeFlag(t *testing.T) {
 		t.Errorf("Output should indicate hash match, got stdout: %q, stderr: %q", buf.String(), errBuf.String())
 	}
 }
+
+func TestCalcCmd_TaggedHash(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "keep.txt"), []byte("keep"), 0644); err != nil {
+		t.Fatalf("Failed to create keep.txt: %v", err)
+	}
+
+	// Tag the expected hash with the fingerprint of "-e foo"
+	engine, err := merkle.NewEngineWithExclusions(0, []string{"foo"}, tmpDir, true, "")
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	result, err := engine.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to compute hash: %v", err)
+	}
+	fingerprint, err := engine.ExclusionFingerprint()
+	if err != nil {
+		t.Fatalf("ExclusionFingerprint() error = %v", err)
+	}
+	tagged := hex.EncodeToString(result.Hash) + "@" + fingerprint
+
+	tests := []struct {
+		name        string
+		exclude     string
+		wantWarning bool
+	}{
+		{name: "same exclusions", exclude: "foo", wantWarning: false},
+		{name: "different exclusions", exclude: "bar", wantWarning: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf, errBuf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetErr(&errBuf)
+			rootCmd.SetArgs([]string{"calc", "-e", tt.exclude, tmpDir, tagged})
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			// Neither excluded path exists, so the roots match either way
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v, stderr: %s", err, errBuf.String())
+			}
+			if got := strings.Contains(errBuf.String(), "different exclusions"); got != tt.wantWarning {
+				t.Errorf("Warning printed = %v, want %v (stderr: %q)", got, tt.wantWarning, errBuf.String())
+			}
+		})
+	}
+
+	// A malformed fingerprint is rejected
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetArgs([]string{"calc", tmpDir, hex.EncodeToString(result.Hash) + "@xyz"})
+	resetFlags(t)
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("rootCmd.Execute() expected error for a malformed fingerprint")
+	}
+}
+
+func TestCalcCmd_AnyMatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("new release"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	result, err := merkle.HashPath(testFile)
+	if err != nil {
+		t.Fatalf("Failed to compute hash: %v", err)
+	}
+	current := hex.EncodeToString(result.Hash)
+	old := strings.Repeat("ab", len(result.Hash))
+	other := strings.Repeat("cd", len(result.Hash))
+
+	tests := []struct {
+		name     string
+		expected []string
+		want     string
+		wantErr  bool
+	}{
+		{name: "matches second", expected: []string{old, current}, want: "Hash matches: " + current + " (expected hash 2 of 2)\n"},
+		{name: "matches first", expected: []string{current, old, other}, want: "Hash matches: " + current + " (expected hash 1 of 3)\n"},
+		{name: "matches none", expected: []string{old, other}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf, errBuf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetErr(&errBuf)
+			rootCmd.SetArgs(append([]string{"calc", testFile}, tt.expected...))
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			err := rootCmd.Execute()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("rootCmd.Execute() expected error when no hash matches")
+				}
+				// Every candidate is listed on mismatch
+				for _, e := range tt.expected {
+					if !strings.Contains(buf.String()+errBuf.String(), "Expected: "+e) {
+						t.Errorf("Mismatch output should list %s, got: %s", e, buf.String()+errBuf.String())
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalcCmd_ExpectedFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("release"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	result, err := merkle.HashPath(testFile)
+	if err != nil {
+		t.Fatalf("Failed to compute hash: %v", err)
+	}
+	current := hex.EncodeToString(result.Hash)
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "hash only", content: current + "\n"},
+		{name: "sha256sum layout", content: "  " + current + "  test.txt\nignored second line\n"},
+		{name: "wrong hash", content: strings.Repeat("ab", len(result.Hash)) + "\n", wantErr: true},
+		{name: "invalid hash", content: "not-a-hash\n", wantErr: true},
+		{name: "empty first line", content: "\n" + current + "\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sidecar := filepath.Join(t.TempDir(), "test.txt.sha")
+			if err := os.WriteFile(sidecar, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create sidecar file: %v", err)
+			}
+			var buf, errBuf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetErr(&errBuf)
+			rootCmd.SetArgs([]string{"calc", testFile, "--expected-file", sidecar})
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			err := rootCmd.Execute()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("rootCmd.Execute() expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+			if want := "Hash matches: " + current + "\n"; buf.String() != want {
+				t.Errorf("Output = %q, want %q", buf.String(), want)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		rootCmd := cmd.GetRootCmd()
+		rootCmd.SetOut(&bytes.Buffer{})
+		rootCmd.SetArgs([]string{"calc", testFile, "--expected-file", filepath.Join(tmpDir, "missing.sha")})
+		resetFlags(t)
+		t.Cleanup(func() { resetFlags(t) })
+		if err := rootCmd.Execute(); err == nil {
+			t.Error("rootCmd.Execute() expected error for a missing expected hash file")
+		}
+	})
+}
+
+func TestCalcCmd_BaselineFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "app.bin"), []byte("v2"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	result, err := merkle.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to compute hash: %v", err)
+	}
+	current := hex.EncodeToString(result.Hash)
+	other := func(b string) string { return strings.Repeat(b, len(result.Hash)) }
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "second baseline matches",
+			content: "# known releases\nv1.0 " + other("01") + "\n\nv2.0 " + current + "\nv3.0 " + other("03") + "\n",
+			want:    "Hash matches: " + current + " (baseline v2.0)\n",
+		},
+		{name: "no baseline matches", content: "v1.0 " + other("01") + "\nv3.0 " + other("03") + "\n", wantErr: true},
+		{name: "malformed line", content: "v1.0\n", wantErr: true},
+		{name: "invalid hash", content: "v1.0 not-a-hash\n", wantErr: true},
+		{name: "no baselines", content: "# nothing yet\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baselines := filepath.Join(t.TempDir(), "baselines.txt")
+			if err := os.WriteFile(baselines, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create baseline file: %v", err)
+			}
+			var buf, errBuf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetErr(&errBuf)
+			rootCmd.SetArgs([]string{"calc", tmpDir, "--baseline-file", baselines})
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			err := rootCmd.Execute()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("rootCmd.Execute() expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("Output = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCalcCmd_VerifyTwice(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("release"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	result, err := merkle.HashPath(testFile)
+	if err != nil {
+		t.Fatalf("Failed to compute hash: %v", err)
+	}
+	current := hex.EncodeToString(result.Hash)
+
+	execute := func(args ...string) (string, string, error) {
+		var buf, errBuf bytes.Buffer
+		rootCmd := cmd.GetRootCmd()
+		rootCmd.SetOut(&buf)
+		rootCmd.SetErr(&errBuf)
+		rootCmd.SetArgs(append([]string{"calc", "--verify-twice"}, args...))
+		resetFlags(t)
+		t.Cleanup(func() { resetFlags(t) })
+		err := rootCmd.Execute()
+		return buf.String(), errBuf.String(), err
+	}
+
+	t.Run("agreeing runs are compared", func(t *testing.T) {
+		stdout, _, err := execute(testFile, current)
+		if err != nil {
+			t.Fatalf("rootCmd.Execute() error = %v", err)
+		}
+		if want := "Hash matches: " + current + "\n"; stdout != want {
+			t.Errorf("Output = %q, want %q", stdout, want)
+		}
+
+		_, _, err = execute(testFile, strings.Repeat("ab", len(result.Hash)))
+		if !errors.Is(err, cmd.ErrHashMismatch) {
+			t.Errorf("rootCmd.Execute() error = %v, want a hash mismatch", err)
+		}
+	})
+
+	t.Run("disagreeing runs fail", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("the test hasher is a POSIX shell script")
+		}
+		// A hasher printing a random digest never agrees with itself
+		hasher := "cat >/dev/null; od -An -tx1 -N16 /dev/urandom | tr -d ' \\n'"
+		_, stderr, err := execute(testFile, current, "--hasher-cmd", hasher)
+		if err == nil || !strings.Contains(err.Error(), "--verify-twice") {
+			t.Fatalf("rootCmd.Execute() error = %v, want a --verify-twice error", err)
+		}
+		if errors.Is(err, cmd.ErrHashMismatch) {
+			t.Errorf("rootCmd.Execute() error = %v, want it to fail before comparing", err)
+		}
+		if !strings.Contains(stderr, "twice gave different results") {
+			t.Errorf("stderr = %q, want it to report the disagreement", stderr)
+		}
+	})
+}
+
+func TestCalcCmd_FormatJSON(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("release"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	result, err := merkle.HashPath(testFile)
+	if err != nil {
+		t.Fatalf("Failed to compute hash: %v", err)
+	}
+	current := hex.EncodeToString(result.Hash)
+	wrong := strings.Repeat("ab", len(result.Hash))
+
+	tests := []struct {
+		name      string
+		hashes    []string
+		wantMatch bool
+		expected  string
+	}{
+		{name: "match", hashes: []string{current}, wantMatch: true, expected: current},
+		{name: "mismatch", hashes: []string{wrong}, wantMatch: false, expected: wrong},
+		{name: "any match", hashes: []string{wrong, current}, wantMatch: true, expected: current},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetArgs(append([]string{"calc", "--format", "json", testFile}, tt.hashes...))
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			err := rootCmd.Execute()
+			if tt.wantMatch && err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+			if !tt.wantMatch && !errors.Is(err, cmd.ErrHashMismatch) {
+				t.Fatalf("rootCmd.Execute() error = %v, want a hash mismatch", err)
+			}
+
+			var got struct {
+				Path        string   `json:"path"`
+				Computed    string   `json:"computed"`
+				Expected    string   `json:"expected"`
+				ExpectedAny []string `json:"expected_any"`
+				Match       bool     `json:"match"`
+				Size        int64    `json:"size"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("Output is not JSON: %v\n%s", err, buf.String())
+			}
+			if got.Match != tt.wantMatch {
+				t.Errorf("match = %v, want %v", got.Match, tt.wantMatch)
+			}
+			if got.Path != testFile || got.Computed != current || got.Expected != tt.expected || got.Size != int64(len("release")) {
+				t.Errorf("result = %+v, want path %s, computed %s, expected %s and size 7", got, testFile, current, tt.expected)
+			}
+			if len(tt.hashes) > 1 && !slices.Equal(got.ExpectedAny, tt.hashes) {
+				t.Errorf("expected_any = %v, want %v", got.ExpectedAny, tt.hashes)
+			}
+		})
+	}
+
+	t.Run("locate-diff conflict", func(t *testing.T) {
+		rootCmd := cmd.GetRootCmd()
+		rootCmd.SetOut(&bytes.Buffer{})
+		rootCmd.SetArgs([]string{"calc", "--format", "json", "--locate-diff", testFile, current})
+		resetFlags(t)
+		t.Cleanup(func() { resetFlags(t) })
+		if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "--locate-diff") {
+			t.Errorf("rootCmd.Execute() error = %v, want a --locate-diff conflict", err)
+		}
+	})
+}
+
+func TestCalcCmd_LocateDiff(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("test content, modified"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reference := filepath.Join(tmpDir, "reference.txt")
+	if err := os.WriteFile(reference, []byte("test content"), 0644); err != nil {
+		t.Fatalf("Failed to create reference file: %v", err)
+	}
+	wrongHash := "0000000000000000000000000000000000000000000000000000000000000000"
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "without reference",
+			args: []string{"calc", testFile, wrongHash, "--locate-diff"},
+			want: []string{"Hash mismatch!", "Size: 22 bytes (no --reference given"},
+		},
+		{
+			name: "with reference",
+			args: []string{"calc", testFile, wrongHash, "--locate-diff", "--reference", reference},
+			want: []string{"Size: 22 bytes (reference: 12 bytes, +10)", "First difference at byte offset 12"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			var buf bytes.Buffer
+			var errBuf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetErr(&errBuf)
+			rootCmd.SetArgs(tt.args)
+
+			if err := rootCmd.Execute(); err == nil {
+				t.Error("rootCmd.Execute() expected error for mismatching hash")
+			}
+			output := buf.String() + errBuf.String()
+			for _, want := range tt.want {
+				if !strings.Contains(output, want) {
+					t.Errorf("Output should contain %q, got: %q", want, output)
+				}
+			}
+		})
+	}
+}
+
+// resetFlags restores the calc command's flags to their defaults, since the root
+// command is shared across tests and flag values otherwise leak between them.
+func resetFlags(t *testing.T) {
+	t.Helper()
+	calcCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			if err := sv.Replace([]string{}); err != nil {
+				t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+			}
+		} else if err := f.Value.Set(f.DefValue); err != nil {
+			t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+		}
+		f.Changed = false
+	})
+}
@@ -0,0 +1,196 @@
+// Package combine provides the "combine" command for merging the roots of several
+// independent trees into a single fingerprint.
+package combine
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lucho00cuba/mtc/internal/flags"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/spf13/cobra"
+)
+
+// combineCmd represents the combine command for merging several roots into one.
+var combineCmd = &cobra.Command{
+	Use:   "combine [hash-or-path]...",
+	Short: "Combine several hashes or paths into a single root",
+	Long: `Combine several hashes or paths into a single root.
+Each argument is either a hexadecimal root hash (as printed by "mtc hash") or a path, which
+is hashed first. The roots are combined the same way a directory combines its subdirectories:
+the BLAKE3 hash of each root's directory type byte and hash in turn. The combination is
+order-sensitive unless --unordered is given, in which case the roots are sorted before
+combining.
+With --threads N, path arguments are hashed at the same time by one shared pool of N
+workers instead of one after another.`,
+	Example: `  # Fingerprint several directories as one
+  mtc combine ./service-a ./service-b ./service-c
+
+  # Hash several large trees at once with 8 workers in total
+  mtc combine --threads 8 /mnt/disk1 /mnt/disk2 /mnt/disk3
+
+  # Combine known hashes regardless of their order
+  mtc combine --unordered 4f1c0a... 9d2e51...`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log := logger.WithOperation("combine", "inputs", len(args), "command", "combine")
+
+		// Read flags directly from command to ensure they're parsed correctly
+		unordered, err := cmd.Flags().GetBool("unordered")
+		if err != nil {
+			log.Warn("Failed to read unordered flag", "error", err)
+			unordered = false
+		}
+		excludePatterns, err := flags.ExcludePatterns(cmd)
+		if err != nil {
+			log.Warn("Failed to read exclude patterns", "error", err)
+			excludePatterns = []string{}
+		}
+		customIgnoreFile, err := flags.IgnoreFile(cmd)
+		if err != nil {
+			log.Warn("Failed to read ignore-file flag", "error", err)
+			customIgnoreFile = ""
+		}
+
+		threads, err := cmd.Flags().GetInt("threads")
+		if err != nil {
+			log.Warn("Failed to read threads flag", "error", err)
+			threads = 0
+		}
+		if threads < 0 {
+			return fmt.Errorf("--threads must not be negative, got %d", threads)
+		}
+
+		algorithm, err := flags.Algorithm(cmd)
+		if err != nil {
+			return err
+		}
+
+		log.Info("Starting combination")
+		start := time.Now()
+
+		// Hash arguments are used as is; paths get an engine each, hashed below
+		results := make([]merkle.Result, len(args))
+		engines := make([]*merkle.Engine, len(args))
+		var pool *merkle.Engine
+		for i, arg := range args {
+			if hash, ok := parseHash(arg, algorithm.Size()); ok {
+				results[i] = merkle.Result{Hash: hash}
+				continue
+			}
+
+			engine, err := merkle.NewEngineWithExclusions(threads, excludePatterns, arg, true, customIgnoreFile)
+			if err != nil {
+				log.Error("Failed to create engine with exclusions", "error", err)
+				return fmt.Errorf("failed to create engine: %w", err)
+			}
+			if err := flags.ApplyIgnoreFileName(cmd, engine); err != nil {
+				return err
+			}
+			if err := flags.ApplyHashing(cmd, engine); err != nil {
+				return err
+			}
+			if threads > 0 {
+				// All paths draw from the first engine's workers, so --threads bounds them together
+				if pool == nil {
+					pool = engine
+				}
+				engine.ShareWorkers(pool)
+			}
+			engines[i] = engine
+		}
+		if err := hashPaths(args, engines, results, threads > 0); err != nil {
+			return err
+		}
+
+		combined, err := algorithm.CombineResults(results, unordered)
+		if err != nil {
+			return fmt.Errorf("failed to combine hashes: %w", err)
+		}
+
+		log.Info("Combination completed",
+			"duration", time.Since(start),
+			"hash", fmt.Sprintf("%x", combined.Hash),
+			"unordered", unordered,
+		)
+
+		if _, err := fmt.Fprintf(cmd.OutOrStdout(), "%x\n", combined.Hash); err != nil {
+			log.Error("Failed to write output to stdout", "error", err)
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	},
+}
+
+// hashPaths hashes the path arguments that have an engine, storing each root in results
+// at the argument's index. With parallel, all paths are hashed at the same time; their
+// engines are expected to share one worker pool. The first failing argument's error is
+// returned.
+func hashPaths(args []string, engines []*merkle.Engine, results []merkle.Result, parallel bool) error {
+	errs := make([]error, len(args))
+	hash := func(i int) {
+		result, err := engines[i].HashPath(args[i])
+		if err != nil {
+			logger.WithOperation("combine", "path", args[i]).Error("Hash computation failed", "error", err)
+			errs[i] = err
+			return
+		}
+		results[i] = result
+	}
+
+	var wg sync.WaitGroup
+	for i := range args {
+		if engines[i] == nil {
+			continue
+		}
+		if !parallel {
+			hash(i)
+			if errs[i] != nil {
+				return errs[i]
+			}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hash(i)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseHash decodes arg as a root hash if it is a hexadecimal string of exactly
+// size bytes, the hash size of the selected algorithm. Anything else is treated as
+// a path by the caller.
+func parseHash(arg string, size int) ([]byte, bool) {
+	if len(arg) != 2*size {
+		return nil, false
+	}
+	hash, err := hex.DecodeString(arg)
+	if err != nil {
+		return nil, false
+	}
+	return hash, true
+}
+
+func init() {
+	combineCmd.Flags().Bool("unordered", false, "Sort the roots before combining them so the result does not depend on argument order")
+	combineCmd.Flags().StringArrayP("exclude", "e", []string{}, "Exclude patterns applied when hashing path arguments. Can be specified multiple times. Defaults to the colon or newline separated patterns in $MTC_EXCLUDE.")
+	combineCmd.Flags().StringP("ignore-file", "i", "", "Path to a custom ignore file applied when hashing path arguments. Defaults to $MTC_IGNORE_FILE.")
+	flags.AddIgnoreFileName(combineCmd)
+	combineCmd.Flags().Int("threads", 0, "Hash all path arguments at the same time with one pool of this many workers shared between them, so the total stays bounded however many paths are given. 0 hashes them one after another, each with the default worker count. Does not change the result.")
+	flags.AddHashing(combineCmd)
+
+	cmd.Register(combineCmd)
+}
@@ -0,0 +1,229 @@
+package combine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+	"github.com/spf13/pflag"
+)
+
+func init() {
+	// Silence logger during tests - only show errors
+	logger.Init("error", "text", io.Discard)
+}
+
+// hashes returns the hex roots of directories each holding a single file with the given content.
+func hashes(t *testing.T, contents ...string) []string {
+	t.Helper()
+	var out []string
+	for _, content := range contents {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		result, err := merkle.HashPath(dir)
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		out = append(out, fmt.Sprintf("%x", result.Hash))
+	}
+	return out
+}
+
+// run executes the combine command with the given arguments and returns its output.
+func run(t *testing.T, args ...string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs(append([]string{"combine"}, args...))
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute(%v) error = %v", args, err)
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+func TestCombineCmd_Ordered(t *testing.T) {
+	h := hashes(t, "a", "b", "c")
+
+	forward := run(t, h[0], h[1], h[2])
+	backward := run(t, h[2], h[1], h[0])
+	if forward == backward {
+		t.Error("Ordered combination should depend on argument order")
+	}
+	if again := run(t, h[0], h[1], h[2]); again != forward {
+		t.Errorf("Ordered combination is not deterministic: %s vs %s", forward, again)
+	}
+}
+
+func TestCombineCmd_Unordered(t *testing.T) {
+	h := hashes(t, "a", "b", "c")
+
+	forward := run(t, "--unordered", h[0], h[1], h[2])
+	backward := run(t, "--unordered", h[2], h[0], h[1])
+	if forward != backward {
+		t.Errorf("Unordered combination should not depend on argument order: %s vs %s", forward, backward)
+	}
+
+	// Unordered combination is the ordered combination of the sorted hashes
+	sorted := append([]string(nil), h...)
+	sort.Strings(sorted)
+	if ordered := run(t, sorted...); ordered != forward {
+		t.Errorf("Unordered combination = %s, want ordered combination of sorted hashes %s", forward, ordered)
+	}
+}
+
+func TestCombineCmd_PathsAndHashes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	result, err := merkle.HashPath(dir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	other := hashes(t, "other")[0]
+
+	viaPath := run(t, dir, other)
+	viaHash := run(t, fmt.Sprintf("%x", result.Hash), other)
+	if viaPath != viaHash {
+		t.Errorf("Combining a path should equal combining its hash: %s vs %s", viaPath, viaHash)
+	}
+
+	// A single root combines like a directory holding a single entry
+	if single := run(t, dir); single != fmt.Sprintf("%x", mustCombine(t, result)) {
+		t.Errorf("Combining a single root = %s, want hash of the root", single)
+	}
+}
+
+func TestCombineCmd_Algorithm(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	engine := merkle.NewEngine()
+	engine.SetAlgorithm(merkle.AlgorithmSHA3_512)
+	result, err := engine.HashPath(dir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	// A SHA3-512 root is 128 hexadecimal characters and is accepted as a hash
+	viaPath := run(t, "--algorithm", "sha3-512", dir)
+	viaHash := run(t, "--algorithm", "sha3-512", fmt.Sprintf("%x", result.Hash))
+	if viaPath != viaHash {
+		t.Errorf("Combining a path should equal combining its hash: %s vs %s", viaPath, viaHash)
+	}
+	if len(viaHash) != 2*merkle.AlgorithmSHA3_512.Size() {
+		t.Errorf("combined root has %d hex characters, want %d", len(viaHash), 2*merkle.AlgorithmSHA3_512.Size())
+	}
+}
+
+func TestCombineCmd_InvalidArgs(t *testing.T) {
+	if err := combineCmd.Args(combineCmd, []string{}); err == nil {
+		t.Error("combineCmd.Args() expected error for no args")
+	}
+
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetArgs([]string{"combine", "/nonexistent/path/that/does/not/exist"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("rootCmd.Execute() expected error for nonexistent path")
+	}
+}
+
+func TestCombineCmd_Threads(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test hasher is a POSIX shell script")
+	}
+
+	var paths []string
+	for i := 0; i < 3; i++ {
+		dir := t.TempDir()
+		for j := 0; j < 4; j++ {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d.txt", j)), []byte(fmt.Sprintf("%d-%d", i, j)), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+		}
+		paths = append(paths, dir)
+	}
+
+	// The hasher marks itself running in a directory and records how many hashers were
+	// running at once, so the peak shows how many files were hashed concurrently
+	running := t.TempDir()
+	peaks := filepath.Join(t.TempDir(), "peaks")
+	hasher := fmt.Sprintf(`cat >/dev/null; mkdir %[1]s/$$; ls %[1]s | wc -l >> %[2]s; sleep 0.05; rmdir %[1]s/$$; echo 00`, running, peaks)
+
+	sequential := run(t, append([]string{"--hasher-cmd", hasher}, paths...)...)
+	parallel := run(t, append([]string{"--hasher-cmd", hasher, "--threads", "2"}, paths...)...)
+	if parallel != sequential {
+		t.Errorf("combine --threads 2 = %s, want the sequential result %s", parallel, sequential)
+	}
+
+	if err := os.Remove(peaks); err != nil {
+		t.Fatalf("Failed to reset hasher log: %v", err)
+	}
+	run(t, append([]string{"--hasher-cmd", hasher, "--threads", "2"}, paths...)...)
+	data, err := os.ReadFile(peaks)
+	if err != nil {
+		t.Fatalf("Failed to read hasher log: %v", err)
+	}
+	counts := strings.Fields(string(data))
+	if len(counts) != 12 {
+		t.Fatalf("hasher ran %d times, want 12", len(counts))
+	}
+	for _, count := range counts {
+		if n, err := strconv.Atoi(count); err != nil || n > 2 {
+			t.Errorf("%s hashers ran at once with --threads 2, want at most 2", count)
+		}
+	}
+}
+
+func TestCombineCmd_NegativeThreads(t *testing.T) {
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetArgs([]string{"combine", "--threads", "-1", t.TempDir()})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "--threads") {
+		t.Errorf("rootCmd.Execute() error = %v, want a --threads error", err)
+	}
+}
+
+// mustCombine combines the given results in order.
+func mustCombine(t *testing.T, results ...merkle.Result) []byte {
+	t.Helper()
+	combined, err := merkle.CombineResults(results, false)
+	if err != nil {
+		t.Fatalf("CombineResults() error = %v", err)
+	}
+	return combined.Hash
+}
+
+// resetFlags restores all combine command flags to their defaults so that values
+// parsed by one test do not leak into the next.
+func resetFlags(t *testing.T) {
+	t.Helper()
+	combineCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			if err := sv.Replace([]string{}); err != nil {
+				t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+			}
+		} else if err := f.Value.Set(f.DefValue); err != nil {
+			t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+		}
+		f.Changed = false
+	})
+}
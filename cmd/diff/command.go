@@ -3,42 +3,281 @@
 package diff
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/lucho00cuba/mtc/internal/archive"
+	"github.com/lucho00cuba/mtc/internal/flags"
 	"github.com/lucho00cuba/mtc/internal/logger"
 	"github.com/lucho00cuba/mtc/internal/merkle"
+	"github.com/lucho00cuba/mtc/internal/units"
 
 	"github.com/lucho00cuba/mtc/cmd"
 	"github.com/spf13/cobra"
 )
 
+// errHashMismatch is returned by --hook when the roots differ. It is bound here because the
+// cmd package is shadowed by the command parameter inside RunE.
+var errHashMismatch = cmd.ErrHashMismatch
+
+// hookHashBytes is the number of bytes of each root printed by --hook, enough to tell
+// runs apart at a glance.
+const hookHashBytes = 6
+
+// progressInterval is how often --parallel-compare reports progress.
+const progressInterval = time.Second
+
 // diffCmd represents the diff command for directory comparison.
 var diffCmd = &cobra.Command{
 	Use:   "diff [pathA] [pathB]",
 	Short: "Compare two directory Merkle trees",
-	Args:  cobra.ExactArgs(2),
+	Long: `Compare two directory Merkle trees.
+With --files, the files that differ are listed after a root mismatch. --list-top-level is a
+cheaper hint: it only lists the immediate entries of the roots that differ.
+With --git-ref, compares a single working tree path against the tree recorded in a git ref
+and reports drifted files (modified, added or deleted). Only files git knows about are
+compared, so anything ignored by .gitignore is skipped automatically.
+When both paths are files, a mismatch also reports the size of each and the offset of the
+first differing byte.
+Either path may be a tar archive (.tar, .tar.gz or .tgz), whose contents are compared with
+the same node rules as a directory on disk, without extracting it. --archive-root selects a
+directory inside the archive, e.g. the top-level directory created by "tar czf src.tgz src".
+--hook is a preset for git pre-commit and pre-push hooks: it prints nothing and exits 0 when
+the trees match, and prints one line naming the paths and the command to investigate and
+exits 1 when they differ. Logging defaults to errors only. With --no-fail, the line is still
+printed when they differ but the exit code is 0, for pipelines that treat drift as a warning.
+--parallel-compare hashes both paths at the same time, each with its own workers, and
+reports the files and bytes hashed on each side to stderr every second while comparing
+huge trees.`,
+	Example: `  # Compare two directories
+  mtc diff ./backup-before ./backup-after
+
+  # List the files that differ
+  mtc diff ./backup-before ./backup-after --files
+
+  # Show which top-level directories differ
+  mtc diff ./backup-before ./backup-after --list-top-level
+
+  # Fail a git hook when the build output drifts from the baseline
+  mtc diff ./dist ./baseline --hook
+
+  # Check that an archive holds exactly the tree it was made from
+  mtc diff ./src src.tar.gz --archive-root src --files
+
+  # Detect uncommitted changes against the last commit
+  mtc diff . --git-ref HEAD`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if gitRef, _ := cmd.Flags().GetString("git-ref"); gitRef != "" {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(2)(cmd, args)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		pathA := args[0]
+		gitRef, err := cmd.Flags().GetString("git-ref")
+		if err != nil {
+			logger.WithOperation("diff", "command", "diff").Warn("Failed to read git-ref flag", "error", err)
+			gitRef = ""
+		}
+		showHashes, err := cmd.Flags().GetBool("show-hashes")
+		if err != nil {
+			logger.WithOperation("diff", "command", "diff").Warn("Failed to read show-hashes flag", "error", err)
+			showHashes = false
+		}
+		compact, err := cmd.Flags().GetBool("compact")
+		if err != nil {
+			logger.WithOperation("diff", "command", "diff").Warn("Failed to read compact flag", "error", err)
+			compact = false
+		}
+		files, err := cmd.Flags().GetBool("files")
+		if err != nil {
+			logger.WithOperation("diff", "command", "diff").Warn("Failed to read files flag", "error", err)
+			files = false
+		}
+		listTopLevel, err := cmd.Flags().GetBool("list-top-level")
+		if err != nil {
+			logger.WithOperation("diff", "command", "diff").Warn("Failed to read list-top-level flag", "error", err)
+			listTopLevel = false
+		}
+		hook, err := cmd.Flags().GetBool("hook")
+		if err != nil {
+			logger.WithOperation("diff", "command", "diff").Warn("Failed to read hook flag", "error", err)
+			hook = false
+		}
+		noFail, err := cmd.Flags().GetBool("no-fail")
+		if err != nil {
+			logger.WithOperation("diff", "command", "diff").Warn("Failed to read no-fail flag", "error", err)
+			noFail = false
+		}
+		parallel, err := cmd.Flags().GetBool("parallel-compare")
+		if err != nil {
+			logger.WithOperation("diff", "command", "diff").Warn("Failed to read parallel-compare flag", "error", err)
+			parallel = false
+		}
+		if hook {
+			for _, name := range []string{"compact", "show-hashes", "files", "list-top-level", "git-ref", "parallel-compare"} {
+				if cmd.Flags().Changed(name) {
+					return fmt.Errorf("--hook cannot be used with --%s", name)
+				}
+			}
+		}
+		if noFail && !hook {
+			return fmt.Errorf("--no-fail requires --hook, the only mode that exits non-zero when the trees differ")
+		}
+		if compact && showHashes {
+			return fmt.Errorf("--compact cannot be used with --show-hashes")
+		}
+		if compact && files {
+			return fmt.Errorf("--compact cannot be used with --files")
+		}
+		if listTopLevel && compact {
+			return fmt.Errorf("--list-top-level cannot be used with --compact")
+		}
+		if listTopLevel && files {
+			return fmt.Errorf("--list-top-level cannot be used with --files, which already lists every drifted file")
+		}
+		if parallel && listTopLevel {
+			return fmt.Errorf("--parallel-compare cannot be used with --list-top-level")
+		}
+		if parallel && gitRef != "" {
+			return fmt.Errorf("--parallel-compare cannot be used with --git-ref")
+		}
+		if err := flags.CheckGitRoot(cmd, args...); err != nil {
+			return err
+		}
+		if gitRef != "" {
+			if showHashes {
+				return fmt.Errorf("--show-hashes cannot be used with --git-ref")
+			}
+			if compact {
+				return fmt.Errorf("--compact cannot be used with --git-ref")
+			}
+			if files {
+				return fmt.Errorf("--files cannot be used with --git-ref, which always lists drifted files")
+			}
+			if listTopLevel {
+				return fmt.Errorf("--list-top-level cannot be used with --git-ref, which always lists drifted files")
+			}
+			if includeRootName, _ := cmd.Flags().GetBool("include-root-name"); includeRootName {
+				return fmt.Errorf("--include-root-name cannot be used with --git-ref")
+			}
+			return runGitDiff(cmd, pathA, gitRef)
+		}
+
 		pathB := args[1]
-		log := logger.With("pathA", pathA, "pathB", pathB, "command", "diff")
+		log := logger.WithOperation("diff", "pathA", pathA, "pathB", pathB, "command", "diff")
 
 		// Read flags directly from command to ensure they're parsed correctly
-		patterns, err := cmd.Flags().GetStringArray("exclude")
+		patterns, err := flags.ExcludePatterns(cmd)
 		if err != nil {
 			log.Warn("Failed to read exclude patterns", "error", err)
 			patterns = []string{}
 		}
-		customIgnoreFile, err := cmd.Flags().GetString("ignore-file")
+		customIgnoreFile, err := flags.IgnoreFile(cmd)
 		if err != nil {
 			log.Warn("Failed to read ignore-file flag", "error", err)
 			customIgnoreFile = ""
 		}
+		archiveRoot, err := cmd.Flags().GetString("archive-root")
+		if err != nil {
+			log.Warn("Failed to read archive-root flag", "error", err)
+			archiveRoot = "."
+		}
+		treeA, err := openTree(pathA, archiveRoot)
+		if err != nil {
+			return err
+		}
+		treeB, err := openTree(pathB, archiveRoot)
+		if err != nil {
+			return err
+		}
+		hasArchive := treeA.fsys != nil || treeB.fsys != nil
+		// A file never matches a directory; say so instead of leaving only a root mismatch
+		kindA, kindB := treeA.kind(), treeB.kind()
+		var typeMismatch string
+		if kindA != "" && kindB != "" && kindA != kindB {
+			typeMismatch = fmt.Sprintf("Type mismatch: A is a %s, B is a %s", kindA, kindB)
+			log.Warn("Paths are of different types", "typeA", kindA, "typeB", kindB)
+		}
+		if hasArchive {
+			if includeRootName, _ := cmd.Flags().GetBool("include-root-name"); includeRootName {
+				return fmt.Errorf("--include-root-name cannot be used when comparing an archive")
+			}
+			if listTopLevel {
+				return fmt.Errorf("--list-top-level cannot be used when comparing an archive; use --files instead")
+			}
+			if parallel {
+				return fmt.Errorf("--parallel-compare cannot be used when comparing an archive")
+			}
+		}
 
 		log.Info("Starting directory comparison")
 		start := time.Now()
 
-		diff, err := merkle.CompareWithExclusions(pathA, pathB, patterns, true, customIgnoreFile)
+		// Both engines get identical exclusions and hashing options for a fair comparison
+		engineA, err := merkle.NewEngineWithExclusions(0, patterns, pathA, true, customIgnoreFile)
+		if err != nil {
+			log.Error("Failed to create engine with exclusions", "error", err)
+			return fmt.Errorf("failed to create engine for path A: %w", err)
+		}
+		engineB, err := merkle.NewEngineWithExclusions(0, patterns, pathB, true, customIgnoreFile)
+		if err != nil {
+			log.Error("Failed to create engine with exclusions", "error", err)
+			return fmt.Errorf("failed to create engine for path B: %w", err)
+		}
+		for _, engine := range []*merkle.Engine{engineA, engineB} {
+			if err := flags.ApplyIgnoreFileName(cmd, engine); err != nil {
+				return err
+			}
+			if err := flags.ApplyHashing(cmd, engine); err != nil {
+				return err
+			}
+			flags.ApplyIncludeRootName(cmd, engine)
+		}
+		defer flags.ReportDiagnostics(cmd, flags.ApplyReportDiagnostics(cmd, engineA, engineB))
+
+		// Roots computed with different exclusions (e.g. differing .dockerignore files) may
+		// differ only because of them
+		fingerprintA, err := engineA.ExclusionFingerprint()
+		if err != nil {
+			return fmt.Errorf("failed to fingerprint exclusions for path A: %w", err)
+		}
+		fingerprintB, err := engineB.ExclusionFingerprint()
+		if err != nil {
+			return fmt.Errorf("failed to fingerprint exclusions for path B: %w", err)
+		}
+		if fingerprintA != fingerprintB {
+			log.Warn("Exclusion fingerprint mismatch", "fingerprintA", fingerprintA, "fingerprintB", fingerprintB)
+			// Hook output is reserved for the verdict; the warning is still logged
+			if !hook {
+				if _, err := fmt.Fprintf(cmd.ErrOrStderr(), "Warning: the paths are hashed with different exclusions (fingerprints %s and %s); differences may only reflect excluded paths\n", fingerprintA, fingerprintB); err != nil {
+					return fmt.Errorf("failed to write warning: %w", err)
+				}
+			}
+		}
+
+		var rootA, rootB merkle.Result
+		var diff []string
+		if hasArchive {
+			if rootA, err = treeA.hash(engineA); err == nil {
+				rootB, err = treeB.hash(engineB)
+			}
+			diff = merkle.CompareResults(rootA, rootB)
+		} else if listTopLevel {
+			rootA, rootB, diff, err = merkle.CompareTopLevel(pathA, pathB, engineA, engineB)
+		} else if parallel {
+			rootA, rootB, err = hashConcurrently(cmd.ErrOrStderr(), pathA, pathB, engineA, engineB)
+			diff = merkle.CompareResults(rootA, rootB)
+		} else {
+			rootA, rootB, diff, err = merkle.CompareRoots(pathA, pathB, engineA, engineB)
+		}
 		if err != nil {
 			log.Error("Comparison failed", "error", err, "duration", time.Since(start))
 			return err
@@ -50,21 +289,371 @@ var diffCmd = &cobra.Command{
 			"differences", len(diff),
 		)
 
-		// Output to stdout (for piping)
-		for _, d := range diff {
-			if _, err := fmt.Fprintln(cmd.OutOrStdout(), d); err != nil {
-				log.Error("Failed to write output to stdout", "error", err, "line", d)
-				return fmt.Errorf("failed to write output: %w", err)
+		if hook {
+			if bytes.Equal(rootA.Hash, rootB.Hash) {
+				return nil
 			}
+			return writeHookFailure(cmd, pathA, pathB, rootA, rootB, noFail)
 		}
+		if compact {
+			// A single greppable line instead of the detailed report
+			line := fmt.Sprintf("IDENTICAL %x", rootA.Hash)
+			if !bytes.Equal(rootA.Hash, rootB.Hash) {
+				line = fmt.Sprintf("DIFFER a=%x b=%x", rootA.Hash, rootB.Hash)
+			}
+			return writeDiff(cmd, []string{line})
+		}
+		if typeMismatch != "" {
+			diff = append([]string{typeMismatch}, diff...)
+		}
+		if !hasArchive && !bytes.Equal(rootA.Hash, rootB.Hash) {
+			// Two single files are both at hand, so the mismatch can be located exactly
+			located, err := locateFileDifference(pathA, pathB)
+			if err != nil {
+				log.Error("Failed to locate file difference", "error", err)
+				return err
+			}
+			diff = append(diff, located...)
+		}
+		if files && !bytes.Equal(rootA.Hash, rootB.Hash) {
+			if err := writeDiff(cmd, diff); err != nil {
+				return err
+			}
+			diff = nil
 
-		return nil
+			// Walk both trees again in sorted order, printing drifted files as they are found
+			emit := func(line string) error {
+				return writeDiff(cmd, []string{line})
+			}
+			var count int
+			if hasArchive {
+				fsysA, rootNameA := treeA.dirFS()
+				fsysB, rootNameB := treeB.dirFS()
+				count, err = merkle.DiffFS(fsysA, rootNameA, fsysB, rootNameB, engineA, engineB, emit)
+			} else {
+				count, err = merkle.StreamDiff(pathA, pathB, engineA, engineB, emit)
+			}
+			if err != nil {
+				log.Error("File comparison failed", "error", err)
+				return err
+			}
+			log.Info("File comparison completed", "drifted", count)
+		}
+		if showHashes {
+			// Record both roots even when they match, for auditing what was compared
+			diff = append(diff,
+				fmt.Sprintf("A: %x (size: %d) %s", rootA.Hash, rootA.Size, pathA),
+				fmt.Sprintf("B: %x (size: %d) %s", rootB.Hash, rootB.Size, pathB),
+			)
+		}
+		return writeDiff(cmd, diff)
 	},
 }
 
+// tree is a path being compared: a file or directory on disk, or a tar archive.
+type tree struct {
+	path string
+	// fsys holds the contents of an archive, and root the directory compared inside it;
+	// fsys is nil for paths on disk
+	fsys fs.FS
+	root string
+}
+
+// openTree prepares the comparison of path, reading it if it is a tar archive.
+//
+// Parameters:
+//   - path: The path to compare
+//   - archiveRoot: The directory compared inside the archive, if path is one
+//
+// Returns the tree, or an error if the archive cannot be read.
+func openTree(path, archiveRoot string) (tree, error) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || !archive.IsArchive(path) {
+		// Other errors are reported when the path is hashed
+		return tree{path: path}, nil
+	}
+	fsys, err := archive.Open(path)
+	if err != nil {
+		return tree{}, err
+	}
+	return tree{path: path, fsys: fsys, root: filepath.ToSlash(filepath.Clean(archiveRoot))}, nil
+}
+
+// hash computes the root of the tree with the given engine.
+func (t tree) hash(engine *merkle.Engine) (merkle.Result, error) {
+	if t.fsys == nil {
+		return engine.HashPath(t.path)
+	}
+	result, err := engine.HashFS(t.fsys, t.root)
+	if err != nil {
+		return merkle.Result{}, fmt.Errorf("failed to hash archive %q: %w", t.path, err)
+	}
+	return result, nil
+}
+
+// kind describes what the tree's root is: "file", "directory" or "special file". The root
+// of an archive is the directory or file selected inside it.
+//
+// Returns "" if the root cannot be examined; the error is reported when it is hashed.
+func (t tree) kind() string {
+	var info fs.FileInfo
+	var err error
+	if t.fsys != nil {
+		info, err = fs.Stat(t.fsys, t.root)
+	} else {
+		info, err = os.Stat(t.path)
+	}
+	switch {
+	case err != nil:
+		return ""
+	case info.IsDir():
+		return "directory"
+	case info.Mode().IsRegular():
+		return "file"
+	default:
+		return "special file"
+	}
+}
+
+// dirFS returns a file system holding the tree and the name of its root inside it, so
+// trees on disk and in archives can be compared file by file with merkle.DiffFS.
+func (t tree) dirFS() (fs.FS, string) {
+	if t.fsys != nil {
+		return t.fsys, t.root
+	}
+	if info, err := os.Stat(t.path); err == nil && !info.IsDir() {
+		return os.DirFS(filepath.Dir(t.path)), filepath.Base(t.path)
+	}
+	return os.DirFS(t.path), "."
+}
+
+// locateFileDifference reports where two differing files diverge: the size of each and
+// the offset of the first differing byte, found in a single streaming pass.
+//
+// Parameters:
+//   - pathA: The first path compared
+//   - pathB: The second path compared
+//
+// Returns the report lines, none unless both paths are regular files, or an error if
+// either file cannot be read.
+func locateFileDifference(pathA, pathB string) ([]string, error) {
+	infoA, errA := os.Stat(pathA)
+	infoB, errB := os.Stat(pathB)
+	if errA != nil || errB != nil || !infoA.Mode().IsRegular() || !infoB.Mode().IsRegular() {
+		return nil, nil
+	}
+	lines := []string{fmt.Sprintf("Size: A %d bytes, B %d bytes", infoA.Size(), infoB.Size())}
+	offset, err := merkle.FirstDifference(pathA, pathB)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		// The hashes differ through hashing options (e.g. --include-xattr), not contents
+		return append(lines, "Contents are identical"), nil
+	}
+	return append(lines, fmt.Sprintf("First difference at byte offset %d", offset)), nil
+}
+
+// runGitDiff compares the working tree at path against the tree of a git ref
+// and writes the drift report to stdout.
+//
+// Parameters:
+//   - cmd: The Cobra command instance for accessing flags and output streams
+//   - path: The working tree path to compare
+//   - gitRef: The git ref to compare against
+//
+// Returns an error if the comparison or writing the output fails.
+func runGitDiff(cmd *cobra.Command, path, gitRef string) error {
+	log := logger.WithOperation("diff", "path", path, "ref", gitRef, "command", "diff")
+
+	// Read flags directly from command to ensure they're parsed correctly
+	patterns, err := flags.ExcludePatterns(cmd)
+	if err != nil {
+		log.Warn("Failed to read exclude patterns", "error", err)
+		patterns = []string{}
+	}
+	customIgnoreFile, err := flags.IgnoreFile(cmd)
+	if err != nil {
+		log.Warn("Failed to read ignore-file flag", "error", err)
+		customIgnoreFile = ""
+	}
+
+	log.Info("Starting comparison against git ref")
+	start := time.Now()
+
+	engine, err := merkle.NewEngineWithExclusions(0, patterns, path, true, customIgnoreFile)
+	if err != nil {
+		log.Error("Failed to create engine with exclusions", "error", err)
+		return fmt.Errorf("failed to create engine: %w", err)
+	}
+	if err := flags.ApplyIgnoreFileName(cmd, engine); err != nil {
+		return err
+	}
+	if err := flags.ApplyHashing(cmd, engine); err != nil {
+		return err
+	}
+	defer flags.ReportDiagnostics(cmd, flags.ApplyReportDiagnostics(cmd, engine))
+
+	diff, err := engine.CompareGitRef(path, gitRef)
+	if err != nil {
+		log.Error("Comparison failed", "error", err, "duration", time.Since(start))
+		return err
+	}
+
+	log.Info("Comparison completed",
+		"duration", time.Since(start),
+		"differences", len(diff),
+	)
+
+	return writeDiff(cmd, diff)
+}
+
+// compareProgress counts the files and bytes hashed on each side of a --parallel-compare
+// run and writes them to stderr every interval until it is stopped.
+type compareProgress struct {
+	w     io.Writer
+	files [2]atomic.Int64
+	bytes [2]atomic.Int64
+
+	quit   chan struct{}
+	exited chan struct{}
+}
+
+// newCompareProgress starts reporting progress to w every interval.
+func newCompareProgress(w io.Writer, interval time.Duration) *compareProgress {
+	p := &compareProgress{w: w, quit: make(chan struct{}), exited: make(chan struct{})}
+	go func() {
+		defer close(p.exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.write()
+			case <-p.quit:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// track registers a file callback on engine counting its hashed files for the given side
+// (0 for A, 1 for B). Each engine serializes its own callbacks, so the counters are atomic
+// to aggregate both sides safely.
+func (p *compareProgress) track(engine *merkle.Engine, side int) {
+	engine.SetFileCallback(func(path string, result merkle.Result) {
+		p.files[side].Add(1)
+		p.bytes[side].Add(result.Size)
+	})
+}
+
+// finish stops periodic reporting and writes the final counts.
+func (p *compareProgress) finish() {
+	close(p.quit)
+	<-p.exited
+	p.write()
+}
+
+// write reports the current counts of both sides on one line. Progress is best effort,
+// so write errors are ignored.
+func (p *compareProgress) write() {
+	_, _ = fmt.Fprintf(p.w, "Progress: A %d files (%s), B %d files (%s)\n",
+		p.files[0].Load(), units.FormatSize(p.bytes[0].Load()),
+		p.files[1].Load(), units.FormatSize(p.bytes[1].Load()))
+}
+
+// hashConcurrently hashes both paths at the same time, reporting the combined progress of
+// both engines to w, like combine --threads hashes its arguments.
+//
+// Parameters:
+//   - w: The writer progress is reported to, normally stderr
+//   - pathA: The first path to hash
+//   - pathB: The second path to hash
+//   - engineA: The engine used to hash pathA
+//   - engineB: The engine used to hash pathB
+//
+// Returns the roots of both paths, or the first error, in argument order.
+func hashConcurrently(w io.Writer, pathA, pathB string, engineA, engineB *merkle.Engine) (merkle.Result, merkle.Result, error) {
+	progress := newCompareProgress(w, progressInterval)
+	progress.track(engineA, 0)
+	progress.track(engineB, 1)
+
+	var results [2]merkle.Result
+	var errs [2]error
+	var wg sync.WaitGroup
+	for i, job := range []struct {
+		path   string
+		engine *merkle.Engine
+	}{{pathA, engineA}, {pathB, engineB}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = job.engine.HashPath(job.path)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("failed to hash path %q: %w", job.path, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	progress.finish()
+
+	for _, err := range errs {
+		if err != nil {
+			return merkle.Result{}, merkle.Result{}, err
+		}
+	}
+	return results[0], results[1], nil
+}
+
+// writeHookFailure writes the single line --hook prints when the roots differ, to stderr
+// where git shows hook output, naming both paths and the command that lists the drifted
+// files.
+//
+// Returns errHashMismatch so the command exits with code 1, nil with noFail so it exits
+// with code 0, or an error if writing fails.
+func writeHookFailure(cmd *cobra.Command, pathA, pathB string, rootA, rootB merkle.Result, noFail bool) error {
+	line := fmt.Sprintf("mtc: %s does not match %s (%x != %x); run \"mtc diff %s %s --files\" to list the differing files",
+		pathA, pathB, rootA.Hash[:min(hookHashBytes, len(rootA.Hash))], rootB.Hash[:min(hookHashBytes, len(rootB.Hash))], pathA, pathB)
+	if _, err := fmt.Fprintln(cmd.ErrOrStderr(), line); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if noFail {
+		return nil
+	}
+	return fmt.Errorf("%s does not match %s: %w", pathA, pathB, errHashMismatch)
+}
+
+// writeDiff writes the difference messages to stdout, one per line.
+func writeDiff(cmd *cobra.Command, diff []string) error {
+	// Output to stdout (for piping)
+	for _, d := range diff {
+		if _, err := fmt.Fprintln(cmd.OutOrStdout(), d); err != nil {
+			logger.WithOperation("diff", "command", "diff").Error("Failed to write output to stdout", "error", err, "line", d)
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	return nil
+}
+
 func init() {
-	diffCmd.Flags().StringArrayP("exclude", "e", []string{}, "Exclude patterns (e.g., 'node_modules', '.git'). Can be specified multiple times.")
-	diffCmd.Flags().StringP("ignore-file", "i", "", "Path to a custom ignore file (takes highest priority). .mtcignore and .gitignore are always loaded automatically from the working directory.")
+	diffCmd.Flags().StringArrayP("exclude", "e", []string{}, "Exclude patterns (e.g., 'node_modules', '.git'). Can be specified multiple times. Defaults to the colon or newline separated patterns in $MTC_EXCLUDE.")
+	diffCmd.Flags().StringP("ignore-file", "i", "", "Path to a custom ignore file (takes highest priority). .mtcignore and .gitignore are always loaded automatically from the working directory. Defaults to $MTC_IGNORE_FILE.")
+	flags.AddIgnoreFileName(diffCmd)
+	diffCmd.Flags().String("git-ref", "", "Compare the single given path against the tree of this git ref (branch, tag or commit)")
+	diffCmd.Flags().Bool("compact", false, "Print a single line instead of the detailed report: \"IDENTICAL <hash>\" or \"DIFFER a=<hash> b=<hash>\"")
+	diffCmd.Flags().Bool("files", false, "When the roots differ, also list every added, deleted or modified file, streaming both trees in sorted order without loading them into memory")
+	diffCmd.Flags().Bool("list-top-level", false, "When the roots differ, also list which immediate entries of the roots differ, as a quick hint of where the trees drifted without walking them again")
+	diffCmd.Flags().Bool("hook", false, "Git hook preset: print nothing and exit 0 when the trees match, or one actionable line to stderr and exit 1 when they differ; logs only errors unless -v or --log-level is given")
+	_ = diffCmd.Flags().SetAnnotation("hook", cmd.QuietFlagAnnotation, []string{"true"})
+	diffCmd.Flags().Bool("no-fail", false, "With --hook, exit 0 even when the trees differ, still printing the mismatch line to stderr as a warning")
+	diffCmd.Flags().String("archive-root", ".", "Directory inside a tar archive given as a path to compare against the other path (default: the whole archive)")
+	diffCmd.Flags().Bool("parallel-compare", false, "Hash both paths at the same time, each with its own workers, and report the files and bytes hashed on each side to stderr every second")
+	diffCmd.Flags().Bool("show-hashes", false, "Always print the root hash and size of both paths after the result, even when they match")
+	flags.AddHashing(diffCmd)
+	flags.AddIncludeRootName(diffCmd)
+	flags.AddReportDiagnostics(diffCmd)
+	flags.AddRequireGitRoot(diffCmd)
 
 	cmd.Register(diffCmd)
 }
@@ -1,15 +1,22 @@
 package diff
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/lucho00cuba/mtc/cmd"
 	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+	"github.com/spf13/pflag"
 )
 
 func init() {
@@ -101,6 +108,682 @@ func TestDiffCmd_Different(t *testing.T) {
 	}
 }
 
+func TestDiffCmd_FilesLocateDifference(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := bytes.Repeat([]byte("a"), 200)
+	fileA := filepath.Join(tmpDir, "a.bin")
+	if err := os.WriteFile(fileA, content, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	changed := bytes.Clone(content)
+	changed[100] = 'b'
+	fileB := filepath.Join(tmpDir, "b.bin")
+	if err := os.WriteFile(fileB, append(changed, 'c'), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"diff", fileA, fileB})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	output := buf.String()
+	for _, want := range []string{"Root mismatch", "Size: A 200 bytes, B 201 bytes", "First difference at byte offset 100"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Output should contain %q, got: %q", want, output)
+		}
+	}
+}
+
+func TestDiffCmd_ParallelCompare(t *testing.T) {
+	tmpDir := t.TempDir()
+	dirA := filepath.Join(tmpDir, "a")
+	dirB := filepath.Join(tmpDir, "b")
+	for dir, names := range map[string][]string{dirA: {"one.txt", "two.txt", "sub/three.txt"}, dirB: {"one.txt", "two.txt"}} {
+		for _, name := range names {
+			p := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			if err := os.WriteFile(p, []byte("0123456789"), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+		}
+	}
+
+	var buf, errBuf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetErr(&errBuf)
+	rootCmd.SetArgs([]string{"diff", "--parallel-compare", dirA, dirB})
+	resetFlags(t)
+	t.Cleanup(func() {
+		rootCmd.SetErr(nil)
+		resetFlags(t)
+	})
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "Root mismatch") {
+		t.Errorf("Output should report the root mismatch, got:\n%s", buf.String())
+	}
+	lines := strings.Split(strings.TrimSpace(errBuf.String()), "\n")
+	if want := "Progress: A 3 files (30 B), B 2 files (20 B)"; lines[len(lines)-1] != want {
+		t.Errorf("Final progress line = %q, want %q", lines[len(lines)-1], want)
+	}
+}
+
+func TestDiffCmd_ParallelCompareConflicts(t *testing.T) {
+	dir := t.TempDir()
+	for _, flag := range []string{"--hook", "--list-top-level"} {
+		t.Run(flag, func(t *testing.T) {
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(io.Discard)
+			rootCmd.SetArgs([]string{"diff", "--parallel-compare", flag, dir, dir})
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			if err := rootCmd.Execute(); err == nil {
+				t.Errorf("rootCmd.Execute() expected error for --parallel-compare with %s", flag)
+			}
+		})
+	}
+}
+
+func TestDiffCmd_TypeMismatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "config")
+	if err := os.WriteFile(file, []byte("config"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	dir := filepath.Join(tmpDir, "dir")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config"), []byte("config"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "file and directory", args: []string{"diff", file, dir}, want: "Type mismatch: A is a file, B is a directory\n"},
+		{name: "directory and file", args: []string{"diff", dir, file}, want: "Type mismatch: A is a directory, B is a file\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetArgs(tt.args)
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+			if !strings.HasPrefix(buf.String(), tt.want) {
+				t.Errorf("Output should start with %q, got:\n%s", tt.want, buf.String())
+			}
+			if !strings.Contains(buf.String(), "Root mismatch") {
+				t.Errorf("Output should still report the root mismatch, got:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+func TestDiffCmd_ShowHashes(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir1 := filepath.Join(tmpDir, "dir1")
+	dir2 := filepath.Join(tmpDir, "dir2")
+	for _, dir := range []string{dir1, dir2} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("same content"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	result, err := merkle.HashPath(dir1)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"diff", "--show-hashes", dir1, dir2})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "No differences") {
+		t.Errorf("Output should indicate no differences, got: %q", output)
+	}
+	for _, want := range []string{
+		fmt.Sprintf("A: %x (size: 12) %s", result.Hash, dir1),
+		fmt.Sprintf("B: %x (size: 12) %s", result.Hash, dir2),
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Output should contain %q, got: %q", want, output)
+		}
+	}
+}
+
+func TestDiffCmd_Compact(t *testing.T) {
+	tmpDir := t.TempDir()
+	contents := map[string]string{"dir1": "same content", "dir2": "same content", "dir3": "other content"}
+	for dir, content := range contents {
+		if err := os.Mkdir(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(tmpDir, dir, "file.txt"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	hashes := make(map[string]string)
+	for dir := range contents {
+		result, err := merkle.HashPath(filepath.Join(tmpDir, dir))
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		hashes[dir] = fmt.Sprintf("%x", result.Hash)
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{name: "identical", a: "dir1", b: "dir2", want: "IDENTICAL " + hashes["dir1"]},
+		{name: "differing", a: "dir1", b: "dir3", want: "DIFFER a=" + hashes["dir1"] + " b=" + hashes["dir3"]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetArgs([]string{"diff", "--compact", filepath.Join(tmpDir, tt.a), filepath.Join(tmpDir, tt.b)})
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want+"\n" {
+				t.Errorf("Output = %q, want the single line %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffCmd_Hook(t *testing.T) {
+	tmpDir := t.TempDir()
+	contents := map[string]string{"dir1": "same content", "dir2": "same content", "dir3": "other content"}
+	for dir, content := range contents {
+		if err := os.Mkdir(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(tmpDir, dir, "file.txt"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	run := func(t *testing.T, a, b string) (string, string, error) {
+		t.Helper()
+		var buf, errBuf bytes.Buffer
+		rootCmd := cmd.GetRootCmd()
+		rootCmd.SetOut(&buf)
+		rootCmd.SetErr(&errBuf)
+		rootCmd.SetArgs([]string{"diff", "--hook", filepath.Join(tmpDir, a), filepath.Join(tmpDir, b)})
+		resetFlags(t)
+		t.Cleanup(func() { resetFlags(t) })
+		err := rootCmd.Execute()
+		return buf.String(), errBuf.String(), err
+	}
+
+	t.Run("match", func(t *testing.T) {
+		stdout, stderr, err := run(t, "dir1", "dir2")
+		if err != nil {
+			t.Fatalf("rootCmd.Execute() error = %v", err)
+		}
+		if stdout != "" || stderr != "" {
+			t.Errorf("Output should be empty on match, got stdout %q and stderr %q", stdout, stderr)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		stdout, stderr, err := run(t, "dir1", "dir3")
+		if !errors.Is(err, cmd.ErrHashMismatch) {
+			t.Fatalf("rootCmd.Execute() error = %v, want a hash mismatch", err)
+		}
+		if stdout != "" {
+			t.Errorf("Stdout should be empty, got %q", stdout)
+		}
+		if strings.Count(stderr, "\n") != 1 || !strings.HasSuffix(stderr, "\n") {
+			t.Fatalf("Stderr should be a single line, got %q", stderr)
+		}
+		if !strings.Contains(stderr, "does not match") || !strings.Contains(stderr, "--files") {
+			t.Errorf("Message should name the mismatch and how to investigate it, got %q", stderr)
+		}
+	})
+
+	t.Run("no-fail", func(t *testing.T) {
+		var buf, errBuf bytes.Buffer
+		rootCmd := cmd.GetRootCmd()
+		rootCmd.SetOut(&buf)
+		rootCmd.SetErr(&errBuf)
+		rootCmd.SetArgs([]string{"diff", "--hook", "--no-fail", filepath.Join(tmpDir, "dir1"), filepath.Join(tmpDir, "dir3")})
+		resetFlags(t)
+		t.Cleanup(func() { resetFlags(t) })
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("rootCmd.Execute() error = %v, want exit 0 with --no-fail", err)
+		}
+		if buf.String() != "" {
+			t.Errorf("Stdout should be empty, got %q", buf.String())
+		}
+		if stderr := errBuf.String(); strings.Count(stderr, "\n") != 1 || !strings.Contains(stderr, "does not match") {
+			t.Errorf("Stderr should still hold the mismatch line, got %q", stderr)
+		}
+	})
+
+	t.Run("no-fail without hook", func(t *testing.T) {
+		rootCmd := cmd.GetRootCmd()
+		rootCmd.SetOut(&bytes.Buffer{})
+		rootCmd.SetArgs([]string{"diff", "--no-fail", filepath.Join(tmpDir, "dir1"), filepath.Join(tmpDir, "dir3")})
+		resetFlags(t)
+		t.Cleanup(func() { resetFlags(t) })
+		if err := rootCmd.Execute(); err == nil {
+			t.Error("rootCmd.Execute() expected error for --no-fail without --hook")
+		}
+	})
+
+	t.Run("conflicting flags", func(t *testing.T) {
+		var buf bytes.Buffer
+		rootCmd := cmd.GetRootCmd()
+		rootCmd.SetOut(&buf)
+		rootCmd.SetArgs([]string{"diff", "--hook", "--compact", filepath.Join(tmpDir, "dir1"), filepath.Join(tmpDir, "dir2")})
+		resetFlags(t)
+		t.Cleanup(func() { resetFlags(t) })
+		if err := rootCmd.Execute(); err == nil {
+			t.Error("rootCmd.Execute() expected error for --hook with --compact")
+		}
+	})
+}
+
+func TestDiffCmd_Files(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"a/same.txt":     "same",
+		"b/same.txt":     "same",
+		"a/changed.txt":  "before",
+		"b/changed.txt":  "after",
+		"a/sub/new.txt":  "new",
+		"b/old.txt":      "old",
+		"a/sub/keep.txt": "keep",
+		"b/sub/keep.txt": "keep",
+	}
+	for name, content := range files {
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"diff", "--files", filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "b")})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	output := buf.String()
+	if !strings.HasPrefix(output, "Root mismatch:") {
+		t.Errorf("Output should start with the root mismatch, got:\n%s", output)
+	}
+	want := "modified: changed.txt\ndeleted: old.txt\nadded: sub/new.txt\n"
+	if !strings.HasSuffix(output, want) {
+		t.Errorf("Output should end with the drifted files\n%s\ngot:\n%s", want, output)
+	}
+
+	rootCmd.SetArgs([]string{"diff", "--files", "--compact", filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "b")})
+	resetFlags(t)
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("rootCmd.Execute() expected error for --files with --compact")
+	}
+}
+
+func TestDiffCmd_ListTopLevel(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, side := range []string{"a", "b"} {
+		for _, dir := range []string{"docs", "src", "tests", "vendor"} {
+			p := filepath.Join(tmpDir, side, dir, "file.txt")
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			if err := os.WriteFile(p, []byte(dir), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+		}
+	}
+	// Only one top-level directory differs, deep inside
+	deep := filepath.Join(tmpDir, "b", "src", "pkg", "inner", "main.go")
+	if err := os.MkdirAll(filepath.Dir(deep), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(deep, []byte("package inner"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"diff", "--list-top-level", filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "b")})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	output := buf.String()
+	if !strings.HasPrefix(output, "Root mismatch:") {
+		t.Errorf("Output should start with the root mismatch, got:\n%s", output)
+	}
+	if !strings.HasSuffix(output, "\nmodified: src/\n") {
+		t.Errorf("Output should pinpoint only src/, got:\n%s", output)
+	}
+
+	buf.Reset()
+	rootCmd.SetArgs([]string{"diff", "--list-top-level", filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "a")})
+	resetFlags(t)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	if got := buf.String(); got != "No differences detected\n" {
+		t.Errorf("Identical trees output = %q, want only the no-differences message", got)
+	}
+
+	rootCmd.SetArgs([]string{"diff", "--list-top-level", "--files", filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "b")})
+	resetFlags(t)
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("rootCmd.Execute() expected error for --list-top-level with --files")
+	}
+}
+
+func TestDiffCmd_RelativePaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	// The trees sit at different depths, and B is given with a trailing separator
+	pathA := filepath.Join(tmpDir, "a")
+	pathB := filepath.Join(tmpDir, "nested", "deeper", "b")
+	files := map[string]string{
+		"a/src/main.go":   "package main // A",
+		"b/src/main.go":   "package main // B",
+		"a/src/only_a.go": "package main",
+		"b/docs/only_b":   "docs",
+	}
+	for name, content := range files {
+		root, rel, _ := strings.Cut(name, "/")
+		dir := pathA
+		if root == "b" {
+			dir = pathB
+		}
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"diff", "--files", pathA, pathB + string(filepath.Separator)})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	output := buf.String()
+	want := "deleted: docs/only_b\nmodified: src/main.go\nadded: src/only_a.go\n"
+	if !strings.HasSuffix(output, want) {
+		t.Errorf("Output should end with the tree-relative drifted files\n%s\ngot:\n%s", want, output)
+	}
+	if strings.Contains(output, tmpDir) {
+		t.Errorf("Output should not contain absolute paths, got:\n%s", output)
+	}
+}
+
+// writeTarGz archives the contents of dir as a gzip-compressed tar file at path.
+func writeTarGz(t *testing.T, dir, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	if err := tw.AddFS(os.DirFS(dir)); err != nil {
+		t.Fatalf("Failed to archive %s: %v", dir, err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to close tar writer: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close gzip writer: %v", err)
+	}
+}
+
+func TestDiffCmd_Archive(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "src")
+	for name, content := range map[string]string{
+		"main.go":        "package main",
+		"pkg/util.go":    "package pkg",
+		"docs/README.md": "# docs",
+	} {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	good := filepath.Join(tmpDir, "good.tar.gz")
+	writeTarGz(t, src, good)
+
+	// The tampered archive holds a modified copy of the tree
+	tampered := filepath.Join(tmpDir, "tampered")
+	if err := os.CopyFS(tampered, os.DirFS(src)); err != nil {
+		t.Fatalf("Failed to copy tree: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tampered, "pkg", "util.go"), []byte("package pkg // backdoor"), 0644); err != nil {
+		t.Fatalf("Failed to tamper with file: %v", err)
+	}
+	bad := filepath.Join(tmpDir, "bad.tgz")
+	writeTarGz(t, tampered, bad)
+
+	// The nested archive holds the tree under a top-level directory, like "tar czf src.tgz src"
+	parent := filepath.Join(tmpDir, "parent")
+	if err := os.CopyFS(filepath.Join(parent, "src"), os.DirFS(src)); err != nil {
+		t.Fatalf("Failed to copy tree: %v", err)
+	}
+	nested := filepath.Join(tmpDir, "nested.tar.gz")
+	writeTarGz(t, parent, nested)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "identical", args: []string{"diff", src, good}, want: "No differences detected\n"},
+		{name: "identical reversed", args: []string{"diff", "--compact", good, src}, want: "IDENTICAL "},
+		{name: "tampered", args: []string{"diff", "--files", src, bad}, want: "Root mismatch:"},
+		{name: "archive root", args: []string{"diff", "--archive-root", "src", src, nested}, want: "No differences detected\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetArgs(tt.args)
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+			if !strings.HasPrefix(buf.String(), tt.want) {
+				t.Errorf("Output should start with %q, got:\n%s", tt.want, buf.String())
+			}
+			if tt.name == "tampered" && !strings.HasSuffix(buf.String(), "\nmodified: pkg/util.go\n") {
+				t.Errorf("Output should list the tampered file, got:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+func TestDiffCmd_ArchiveMemberOrder(t *testing.T) {
+	tmpDir := t.TempDir()
+	members := []struct {
+		name string
+		body string
+	}{
+		{name: "src/"},
+		{name: "src/main.go", body: "package main"},
+		{name: "src/pkg/"},
+		{name: "src/pkg/util.go", body: "package pkg"},
+		{name: "README.md", body: "# readme"},
+	}
+
+	// The same members written front to back and back to front, so the reversed archive
+	// lists every file before its directory, as some tools do
+	write := func(name string, reverse bool) string {
+		t.Helper()
+		path := filepath.Join(tmpDir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("Failed to create archive: %v", err)
+		}
+		defer f.Close()
+		tw := tar.NewWriter(f)
+		for i := range members {
+			m := members[i]
+			if reverse {
+				m = members[len(members)-1-i]
+			}
+			hdr := &tar.Header{Name: m.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(m.body))}
+			if strings.HasSuffix(m.name, "/") {
+				hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatalf("Failed to write header %q: %v", m.name, err)
+			}
+			if _, err := tw.Write([]byte(m.body)); err != nil {
+				t.Fatalf("Failed to write body %q: %v", m.name, err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatalf("Failed to close tar writer: %v", err)
+		}
+		return path
+	}
+	forward := write("forward.tar", false)
+	reversed := write("reversed.tar", true)
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"diff", "--show-hashes", forward, reversed})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v, output:\n%s", err, buf.String())
+	}
+	if !strings.Contains(buf.String(), "No differences detected") {
+		t.Errorf("Archives with members in a different order should have equal roots, got:\n%s", buf.String())
+	}
+}
+
+func TestDiffCmd_FollowSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	shared := filepath.Join(tmpDir, "shared.txt")
+	if err := os.WriteFile(shared, []byte("config"), 0644); err != nil {
+		t.Fatalf("Failed to create shared file: %v", err)
+	}
+
+	// A holds a real file, B a symlink to a file with the same content
+	dirA, dirB := filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "b")
+	for _, dir := range []string{dirA, dirB} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dirA, "config.txt"), []byte("config"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Symlink(shared, filepath.Join(dirB, "config.txt")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		equal bool
+	}{
+		{name: "links as links", args: []string{"diff", dirA, dirB}, equal: false},
+		{name: "followed links", args: []string{"diff", "--follow-symlinks", dirA, dirB}, equal: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetErr(&bytes.Buffer{})
+			rootCmd.SetArgs(tt.args)
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+			if got := strings.Contains(buf.String(), "No differences detected"); got != tt.equal {
+				t.Errorf("Output:\n%s\nwant equal roots: %v", buf.String(), tt.equal)
+			}
+		})
+	}
+}
+
 func TestDiffCmd_Nonexistent(t *testing.T) {
 	tmpDir := t.TempDir()
 	nonexistent := filepath.Join(tmpDir, "nonexistent")
@@ -206,6 +889,53 @@ func TestDiffCmd_WithIgnoreFileFlag(t *testing.T) {
 	}
 }
 
+func TestDiffCmd_GitRef(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in PATH")
+	}
+
+	repo := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repo, "file.txt"), []byte("committed"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=mtc", "-c", "user.email=mtc@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	run := func() string {
+		t.Helper()
+		resetFlags(t)
+		t.Cleanup(func() { resetFlags(t) })
+
+		var buf bytes.Buffer
+		rootCmd := cmd.GetRootCmd()
+		rootCmd.SetOut(&buf)
+		rootCmd.SetArgs([]string{"diff", repo, "--git-ref", "HEAD"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("rootCmd.Execute() error = %v", err)
+		}
+		return buf.String()
+	}
+
+	if output := run(); !strings.Contains(output, "No differences") {
+		t.Errorf("Clean checkout should report no differences, got: %q", output)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, "file.txt"), []byte("uncommitted"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	output := run()
+	if !strings.Contains(output, "Root mismatch") || !strings.Contains(output, "modified: file.txt") {
+		t.Errorf("Dirty checkout should report drift, got: %q", output)
+	}
+}
+
 func TestDiffCmd_InvalidArgs(t *testing.T) {
 	// Verify that Args validator is set
 	if diffCmd.Args == nil {
@@ -236,3 +966,19 @@ func TestDiffCmd_InvalidArgs(t *testing.T) {
 		t.Errorf("diffCmd.Args() unexpected error for valid args: %v", err)
 	}
 }
+
+// resetFlags restores all diff command flags to their defaults so that values
+// parsed by one test do not leak into the next.
+func resetFlags(t *testing.T) {
+	t.Helper()
+	diffCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			if err := sv.Replace([]string{}); err != nil {
+				t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+			}
+		} else if err := f.Value.Set(f.DefValue); err != nil {
+			t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+		}
+		f.Changed = false
+	})
+}
@@ -0,0 +1,86 @@
+// Package diffmanifest provides the "diff-manifest" command for comparing two manifest
+// files entry by entry, without access to the trees they describe.
+package diffmanifest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/spf13/cobra"
+)
+
+// diffManifestCmd represents the diff-manifest command for comparing two manifests.
+var diffManifestCmd = &cobra.Command{
+	Use:   "diff-manifest [manifest-a] [manifest-b]",
+	Short: "Compare two manifest files entry by entry",
+	Long: `Compare two manifest files entry by entry.
+Reads two manifests written by "mtc manifest", in any of its output formats (JSON, YAML or
+TOML), and reports the entries that differ, keyed on path: "added" for entries only in the
+first manifest, "deleted" for entries only in the second and "modified" for entries whose
+hash, size or type differ. No tree is read, so snapshots taken at different times or on
+different machines can be compared. Both manifests must use the same algorithm, and either
+both or neither must have hashed names.`,
+	Example: `  # Compare today's snapshot against last week's
+  mtc diff-manifest today.manifest.json last-week.manifest.json`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fileA, fileB := args[0], args[1]
+		log := logger.WithOperation("diff_manifest", "manifestA", fileA, "manifestB", fileB, "command", "diff-manifest")
+
+		manifestA, err := readManifest(fileA)
+		if err != nil {
+			log.Error("Failed to load manifest", "error", err)
+			return err
+		}
+		manifestB, err := readManifest(fileB)
+		if err != nil {
+			log.Error("Failed to load manifest", "error", err)
+			return err
+		}
+
+		diff, err := merkle.CompareManifests(manifestA, manifestB)
+		if err != nil {
+			log.Error("Manifest comparison failed", "error", err)
+			return err
+		}
+		log.Info("Manifest comparison completed", "entriesA", len(manifestA.Entries), "entriesB", len(manifestB.Entries))
+
+		for _, line := range diff {
+			if _, err := fmt.Fprintln(cmd.OutOrStdout(), line); err != nil {
+				log.Error("Failed to write output to stdout", "error", err)
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+		}
+		return nil
+	},
+}
+
+// readManifest reads and parses a manifest file in any supported format.
+//
+// Parameters:
+//   - name: The manifest file to read
+//
+// Returns the manifest, or an error if it cannot be read, parsed or has an unsupported version.
+func readManifest(name string) (*merkle.Manifest, error) {
+	data, err := os.ReadFile(filepath.Clean(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest file %s: %w", name, err)
+	}
+	manifest, err := merkle.ParseManifest(data, merkle.DetectManifestFormat(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest file %s: %w", name, err)
+	}
+	if manifest.Version != merkle.ManifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d in %s (expected %d)", manifest.Version, name, merkle.ManifestVersion)
+	}
+	return manifest, nil
+}
+
+func init() {
+	cmd.Register(diffManifestCmd)
+}
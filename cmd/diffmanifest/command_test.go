@@ -0,0 +1,95 @@
+package diffmanifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+)
+
+func init() {
+	// Silence logger during tests - only show errors
+	logger.Init("error", "text", io.Discard)
+}
+
+// writeManifest records the manifest of root in a file named name, returning its path.
+func writeManifest(t *testing.T, root, name string) string {
+	t.Helper()
+	manifest, err := merkle.NewEngine().BuildManifest(root)
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Failed to encode manifest: %v", err)
+	}
+	manifestFile := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(manifestFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+	return manifestFile
+}
+
+// run executes the diff-manifest command and returns its output and error.
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs(append([]string{"diff-manifest"}, args...))
+	err := rootCmd.Execute()
+	return buf.String(), err
+}
+
+func TestDiffManifestCmd(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub/c.txt"} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	before := writeManifest(t, root, "before.json")
+
+	output, err := run(t, before, before)
+	if err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	if strings.TrimSpace(output) != "No differences detected" {
+		t.Errorf("Output for identical manifests = %q, want no differences", output)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "sub", "b.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	after := writeManifest(t, root, "after.json")
+
+	output, err = run(t, after, before)
+	if err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if !strings.HasPrefix(output, "Root mismatch:") || lines[len(lines)-1] != "modified: sub/b.txt" || strings.Count(output, ": sub/") != 1 {
+		t.Errorf("Output should report the root mismatch and only sub/b.txt as modified, got: %q", output)
+	}
+}
+
+func TestDiffManifestCmd_InvalidManifest(t *testing.T) {
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+	if err := os.WriteFile(invalid, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := run(t, invalid, invalid); err == nil {
+		t.Error("rootCmd.Execute() expected error for an unparsable manifest")
+	}
+}
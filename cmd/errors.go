@@ -0,0 +1,83 @@
+// Package cmd (errors.go) provides machine-parseable error reporting.
+// With --error-format json, the error that ends a command is written to stderr as a
+// single JSON object holding its message and a stable code derived from the error,
+// so scripts can branch on the kind of failure instead of parsing free text.
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"syscall"
+)
+
+// Error codes reported with --error-format json.
+const (
+	// CodePathNotFound reports a path that does not exist.
+	CodePathNotFound = "path_not_found"
+	// CodePermissionDenied reports a path that cannot be accessed.
+	CodePermissionDenied = "permission_denied"
+	// CodeNotADirectory reports a path component that is not a directory.
+	CodeNotADirectory = "not_a_directory"
+	// CodeHashMismatch reports a computed hash that differs from the expected one.
+	CodeHashMismatch = "hash_mismatch"
+	// CodeError reports any other error.
+	CodeError = "error"
+)
+
+// ErrHashMismatch is returned (possibly wrapped) by commands whose computed hash does
+// not match the expected one.
+var ErrHashMismatch = errors.New("hash mismatch")
+
+// errorFormat stores the error format flag value (text or json).
+var errorFormat string
+
+// jsonError is the JSON representation of an error written with --error-format json.
+type jsonError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// ErrorCode returns the stable code of an error, derived from the errors it wraps.
+//
+// Parameters:
+//   - err: The error to classify
+//
+// Returns one of the Code constants.
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrHashMismatch):
+		return CodeHashMismatch
+	case errors.Is(err, fs.ErrNotExist):
+		return CodePathNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return CodePermissionDenied
+	case errors.Is(err, syscall.ENOTDIR):
+		return CodeNotADirectory
+	default:
+		return CodeError
+	}
+}
+
+// ReportError writes the error that ended a command according to --error-format. In
+// json mode it writes a single {"error": ..., "code": ...} line; in text mode (the
+// default) nothing is written, since errors are already reported through the logs.
+//
+// Parameters:
+//   - w: The writer to report to, normally stderr
+//   - err: The error to report
+//
+// Returns an error if writing fails.
+func ReportError(w io.Writer, err error) error {
+	if err == nil || errorFormat != "json" {
+		return nil
+	}
+	data, marshalErr := json.Marshal(jsonError{Error: err.Error(), Code: ErrorCode(err)})
+	if marshalErr != nil {
+		return fmt.Errorf("failed to encode error: %w", marshalErr)
+	}
+	_, writeErr := fmt.Fprintln(w, string(data))
+	return writeErr
+}
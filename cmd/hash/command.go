@@ -3,12 +3,23 @@
 package hash
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/lucho00cuba/mtc/internal/flags"
 	"github.com/lucho00cuba/mtc/internal/logger"
 	"github.com/lucho00cuba/mtc/internal/merkle"
+	"github.com/lucho00cuba/mtc/internal/metrics"
+	"github.com/lucho00cuba/mtc/internal/units"
 
 	"github.com/lucho00cuba/mtc/cmd"
 	"github.com/spf13/cobra"
@@ -21,19 +32,128 @@ var hashCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		path := args[0]
-		log := logger.With("path", path, "command", "hash")
+		log := logger.WithOperation("hash", "path", path, "command", "hash")
 
 		// Read flags directly from command to ensure they're parsed correctly
-		excludePatterns, err := cmd.Flags().GetStringArray("exclude")
+		excludePatterns, err := flags.ExcludePatterns(cmd)
 		if err != nil {
 			log.Warn("Failed to read exclude patterns", "error", err)
 			excludePatterns = []string{}
 		}
-		customIgnoreFile, err := cmd.Flags().GetString("ignore-file")
+		customIgnoreFile, err := flags.IgnoreFile(cmd)
 		if err != nil {
 			log.Warn("Failed to read ignore-file flag", "error", err)
 			customIgnoreFile = ""
 		}
+		noPath, err := cmd.Flags().GetBool("no-path")
+		if err != nil {
+			log.Warn("Failed to read no-path flag", "error", err)
+			noPath = false
+		}
+		perFile, err := cmd.Flags().GetBool("per-file")
+		if err != nil {
+			log.Warn("Failed to read per-file flag", "error", err)
+			perFile = false
+		}
+		ordered, err := cmd.Flags().GetBool("ordered")
+		if err != nil {
+			log.Warn("Failed to read ordered flag", "error", err)
+			ordered = false
+		}
+		if ordered && !perFile {
+			return fmt.Errorf("--ordered requires --per-file")
+		}
+		allDirs, err := cmd.Flags().GetBool("all-dirs")
+		if err != nil {
+			log.Warn("Failed to read all-dirs flag", "error", err)
+			allDirs = false
+		}
+		if allDirs && perFile {
+			return fmt.Errorf("--all-dirs cannot be used with --per-file")
+		}
+		summaryOnly, err := cmd.Flags().GetBool("summary-only")
+		if err != nil {
+			log.Warn("Failed to read summary-only flag", "error", err)
+			summaryOnly = false
+		}
+		if summaryOnly && perFile {
+			return fmt.Errorf("--summary-only cannot be used with --per-file")
+		}
+		if summaryOnly && allDirs {
+			return fmt.Errorf("--summary-only cannot be used with --all-dirs")
+		}
+		verboseFooter, err := cmd.Flags().GetBool("verbose-footer")
+		if err != nil {
+			log.Warn("Failed to read verbose-footer flag", "error", err)
+			verboseFooter = false
+		}
+		if summaryOnly && verboseFooter {
+			return fmt.Errorf("--summary-only cannot be used with --verbose-footer")
+		}
+		metricsAddr, err := cmd.Flags().GetString("metrics-addr")
+		if err != nil {
+			log.Warn("Failed to read metrics-addr flag", "error", err)
+			metricsAddr = ""
+		}
+		metricsLinger, err := cmd.Flags().GetDuration("metrics-linger")
+		if err != nil {
+			log.Warn("Failed to read metrics-linger flag", "error", err)
+			metricsLinger = 0
+		}
+		progress, err := cmd.Flags().GetString("progress")
+		if err != nil {
+			log.Warn("Failed to read progress flag", "error", err)
+			progress = ""
+		}
+		if progress != "" && progress != "json" && progress != "bar" {
+			return fmt.Errorf("--progress: unsupported format %q (supported: json, bar)", progress)
+		}
+		progressInterval, err := cmd.Flags().GetDuration("progress-interval")
+		if err != nil {
+			log.Warn("Failed to read progress-interval flag", "error", err)
+			progressInterval = 500 * time.Millisecond
+		}
+		warnThreshold, err := cmd.Flags().GetString("warn-threshold")
+		if err != nil {
+			log.Warn("Failed to read warn-threshold flag", "error", err)
+			warnThreshold = "0"
+		}
+		warnBytes, err := units.ParseSize(warnThreshold)
+		if err != nil {
+			return fmt.Errorf("--warn-threshold: %w", err)
+		}
+		assumeYes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			log.Warn("Failed to read yes flag", "error", err)
+			assumeYes = false
+		}
+		tagged, err := cmd.Flags().GetBool("tagged")
+		if err != nil {
+			log.Warn("Failed to read tagged flag", "error", err)
+			tagged = false
+		}
+		gitChanged, err := cmd.Flags().GetBool("git-changed")
+		if err != nil {
+			log.Warn("Failed to read git-changed flag", "error", err)
+			gitChanged = false
+		}
+		changedSince, err := cmd.Flags().GetString("changed-since")
+		if err != nil {
+			log.Warn("Failed to read changed-since flag", "error", err)
+			changedSince = ""
+		}
+		checksumFile, err := cmd.Flags().GetString("checksum-file")
+		if err != nil {
+			log.Warn("Failed to read checksum-file flag", "error", err)
+			checksumFile = ""
+		}
+		if progressInterval <= 0 {
+			return fmt.Errorf("--progress-interval must be positive, got %s", progressInterval)
+		}
+
+		if err := flags.CheckGitRoot(cmd, path); err != nil {
+			return err
+		}
 
 		log.Info("Starting hash computation")
 		start := time.Now()
@@ -46,6 +166,21 @@ var hashCmd = &cobra.Command{
 		}
 
 		isDir := pathInfo.IsDir()
+		if gitChanged && allDirs {
+			return fmt.Errorf("--all-dirs cannot be used with --git-changed")
+		}
+		if gitChanged && !isDir {
+			return fmt.Errorf("--git-changed requires a directory inside a git working tree, got %q", path)
+		}
+		if changedSince != "" && gitChanged {
+			return fmt.Errorf("--changed-since cannot be used with --git-changed")
+		}
+		if changedSince != "" && allDirs {
+			return fmt.Errorf("--all-dirs cannot be used with --changed-since")
+		}
+		if changedSince != "" && !isDir {
+			return fmt.Errorf("--changed-since requires a directory inside a git working tree, got %q", path)
+		}
 
 		// Always create engine with exclusions (automatically loads .mtcignore and .gitignore)
 		// Custom ignore file and exclude patterns are optional additions
@@ -54,17 +189,204 @@ var hashCmd = &cobra.Command{
 			log.Error("Failed to create engine with exclusions", "error", err)
 			return fmt.Errorf("failed to create engine: %w", err)
 		}
-		result, err := engine.HashPath(path)
+		if err := flags.ApplyIgnoreFileName(cmd, engine); err != nil {
+			return err
+		}
+		if err := flags.ApplyHashing(cmd, engine); err != nil {
+			return err
+		}
+		flags.ApplyIncludeRootName(cmd, engine)
+		if err := flags.ApplyAssume(cmd, engine); err != nil {
+			return err
+		}
+		defer flags.ReportDiagnostics(cmd, flags.ApplyReportDiagnostics(cmd, engine))
+
+		// Ask before hashing a tree much larger than expected, e.g. an accidental "mtc hash /"
+		if warnBytes > 0 && !assumeYes && !gitChanged && changedSince == "" && isTerminal(cmd.InOrStdin()) {
+			est, err := engine.EstimatePath(path, warnBytes)
+			if err != nil {
+				log.Warn("Failed to estimate tree size", "error", err)
+			} else if est.Partial {
+				prompt := fmt.Sprintf("%s holds more than %s (%d+ files); hashing it may take a long time. Continue? [y/N] ",
+					path, units.FormatSize(warnBytes), est.Files)
+				ok, err := confirm(cmd.InOrStdin(), cmd.ErrOrStderr(), prompt)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("aborted: %s exceeds --warn-threshold %s", path, units.FormatSize(warnBytes))
+				}
+			}
+		}
+
+		if metricsAddr != "" {
+			registry := metrics.NewRegistry()
+			engine.SetMetrics(registry)
+			server, err := metrics.Serve(metricsAddr, registry)
+			if err != nil {
+				log.Error("Failed to start metrics server", "error", err)
+				return err
+			}
+			log.Info("Serving metrics", "addr", server.Addr())
+			defer func() {
+				// Keep serving after the run so the final values can be scraped
+				time.Sleep(metricsLinger)
+				if err := server.Close(); err != nil {
+					log.Warn("Failed to stop metrics server", "error", err)
+				}
+			}()
+		}
+
+		// With --per-file, stream "<hash>  <relpath>" lines as files complete, or buffer
+		// them with --ordered to print them sorted once hashing finishes
+		var fileLines []fileLine
+		var streamErr error
+		var onFile func(filePath string, fileResult merkle.Result)
+		absRoot, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("failed to resolve absolute path for %q: %w", path, err)
+		}
+		relPath := func(filePath string) string {
+			if isDir {
+				if r, err := filepath.Rel(absRoot, filePath); err == nil {
+					return filepath.ToSlash(r)
+				}
+			}
+			return filepath.Base(filePath)
+		}
+		if perFile {
+			onFile = func(filePath string, fileResult merkle.Result) {
+				rel := relPath(filePath)
+				if ordered {
+					fileLines = append(fileLines, fileLine{hash: fileResult.Hash, path: rel})
+					return
+				}
+				if streamErr == nil {
+					_, streamErr = fmt.Fprintf(cmd.OutOrStdout(), "%x  %s\n", fileResult.Hash, rel)
+				}
+			}
+		}
+
+		// With --progress, report progress to stderr while hashing: NDJSON events for
+		// frontends, or a progress bar for people
+		var reporter progressSink
+		switch progress {
+		case "json":
+			reporter = newProgressReporter(cmd.ErrOrStderr(), progressInterval)
+		case "bar":
+			// Pre-scan the tree so the bar can show a percentage; git modes hash a subset
+			var total int64
+			if !gitChanged && changedSince == "" {
+				if est, err := engine.EstimatePath(path, 0); err != nil {
+					log.Warn("Failed to count files for the progress bar", "error", err)
+				} else {
+					total = est.Files
+				}
+			}
+			reporter = newBarReporter(cmd.ErrOrStderr(), progressInterval, total, isTerminal(cmd.ErrOrStderr()))
+		}
+		if reporter != nil {
+			defer reporter.stop()
+		}
+
+		// With --checksum-file, collect a coreutils-style line for every file
+		var checksumLines []fileLine
+		if checksumFile != "" && !engine.ContentLeaves() {
+			return fmt.Errorf("--checksum-file cannot be used with --chunk-size, --include-xattr, --structure-only, --byte-budget, --head-bytes, --strip-bom or --hasher-cmd, which make file hashes differ from plain digests")
+		}
+		if onFile != nil || reporter != nil || checksumFile != "" {
+			engine.SetFileCallback(func(filePath string, fileResult merkle.Result) {
+				if reporter != nil {
+					reporter.fileDone(relPath(filePath), fileResult)
+				}
+				if checksumFile != "" {
+					checksumLines = append(checksumLines, fileLine{hash: fileResult.Hash, path: relPath(filePath)})
+				}
+				if onFile != nil {
+					onFile(filePath, fileResult)
+				}
+			})
+		}
+
+		// With chunking enabled, regular files also report their chunk hashes
+		var result merkle.Result
+		var chunks []merkle.Result
+		var dirs map[string]merkle.Result
+		chunkSize, err := cmd.Flags().GetString("chunk-size")
+		if err != nil {
+			log.Warn("Failed to read chunk-size flag", "error", err)
+			chunkSize = "0"
+		}
+		chunkBytes, err := units.ParseSize(chunkSize)
+		if err != nil {
+			return fmt.Errorf("--chunk-size: %w", err)
+		}
+		linkInfo, err := os.Lstat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat path %q: %w", path, err)
+		}
+		switch {
+		case gitChanged:
+			// Only the files git reports as changed contribute to the root
+			var changed []string
+			result, changed, err = engine.HashGitChanged(path)
+			if err == nil {
+				log.Info("Hashed changed files", "files", len(changed))
+			}
+		case changedSince != "":
+			// Only the files changed since the ref contribute to the root
+			var changed []string
+			result, changed, err = engine.HashGitChangedSince(path, changedSince)
+			if err == nil {
+				log.Info("Hashed changed files", "files", len(changed), "since", changedSince)
+			}
+		case chunkBytes > 0 && linkInfo.Mode().IsRegular():
+			result, chunks, err = engine.HashChunks(path)
+		case allDirs:
+			result, dirs, err = engine.HashAllDirs(path)
+		default:
+			result, err = engine.HashPath(path)
+		}
 		if err != nil {
 			log.Error("Hash computation failed", "error", err, "duration", time.Since(start))
 			return err
 		}
 
+		if reporter != nil {
+			if err := reporter.finish(result); err != nil {
+				log.Error("Failed to write progress to stderr", "error", err)
+				return err
+			}
+		}
+		if checksumFile != "" {
+			if err := writeChecksumFile(checksumFile, path, isDir, checksumLines); err != nil {
+				log.Error("Failed to write checksum file", "error", err)
+				return err
+			}
+		}
+		if streamErr != nil {
+			log.Error("Failed to write output to stdout", "error", streamErr)
+			return fmt.Errorf("failed to write output: %w", streamErr)
+		}
+		if err := writeFileLines(cmd, fileLines); err != nil {
+			log.Error("Failed to write output to stdout", "error", err)
+			return err
+		}
+		// With --all-dirs, print a "<hash>  <relpath>" line for every directory
+		dirLines := make([]fileLine, 0, len(dirs))
+		for rel, dirResult := range dirs {
+			dirLines = append(dirLines, fileLine{hash: dirResult.Hash, path: rel})
+		}
+		if err := writeFileLines(cmd, dirLines); err != nil {
+			log.Error("Failed to write output to stdout", "error", err)
+			return err
+		}
+
 		duration := time.Since(start)
 		log.Info("Hash computation completed",
 			"duration", duration,
 			"hash", fmt.Sprintf("%x", result.Hash),
-			"size", formatSize(result.Size),
+			"size", result.Size,
 		)
 
 		// Output to stdout (for piping)
@@ -72,55 +394,436 @@ var hashCmd = &cobra.Command{
 		if isDir {
 			pathType = "d"
 		}
-		if _, err := fmt.Fprintf(cmd.OutOrStdout(), "%s (%s): %x (size: %s)\n",
-			path, pathType, result.Hash, formatSize(result.Size)); err != nil {
+		root := fmt.Sprintf("%x", result.Hash)
+		if tagged {
+			// Record the exclusions the root was computed with, so calc can detect a mismatch
+			fingerprint, err := engine.ExclusionFingerprint()
+			if err != nil {
+				return fmt.Errorf("failed to fingerprint exclusions: %w", err)
+			}
+			root += "@" + fingerprint
+		}
+		if summaryOnly {
+			// Just the root, for capturing into a variable
+			if _, err := fmt.Fprintln(cmd.OutOrStdout(), root); err != nil {
+				log.Error("Failed to write output to stdout", "error", err)
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			return nil
+		}
+		line := fmt.Sprintf("(%s): %s (size: %s)", pathType, root, units.FormatSize(result.Size))
+		if !noPath {
+			// The path is omitted with --no-path so output is stable across machines
+			line = path + " " + line
+		}
+		if _, err := fmt.Fprintln(cmd.OutOrStdout(), line); err != nil {
 			log.Error("Failed to write output to stdout", "error", err)
 			return fmt.Errorf("failed to write output: %w", err)
 		}
+
+		offset := int64(0)
+		for i, chunk := range chunks {
+			if _, err := fmt.Fprintf(cmd.OutOrStdout(), "  chunk %d: %x (offset: %d, size: %d)\n", i, chunk.Hash, offset, chunk.Size); err != nil {
+				log.Error("Failed to write output to stdout", "error", err)
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			offset += chunk.Size
+		}
+
+		if verboseFooter {
+			// Record how the root was produced, for reproducibility audits
+			patterns, err := engine.ExclusionPatterns()
+			if err != nil {
+				return fmt.Errorf("failed to collect exclusions: %w", err)
+			}
+			if _, err := fmt.Fprintf(cmd.OutOrStdout(), "# algorithm=%s format=v%d workers=%d excludes=%d\n",
+				engine.Algorithm(), merkle.FormatVersion, engine.Workers(), len(patterns)); err != nil {
+				log.Error("Failed to write output to stdout", "error", err)
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+		}
 		return nil
 	},
 }
 
-// formatSize formats a size in bytes to a human-readable string.
-// It automatically selects the most appropriate unit (B, KB, MB, GB, TB, PB, EB)
-// based on the size value. Uses binary (1024-based) units.
+// fileLine is a per-file output line buffered by --ordered.
+type fileLine struct {
+	hash []byte
+	path string
+}
+
+// writeFileLines writes buffered per-file lines sorted by path, comparing paths one
+// segment at a time so files are listed in the same depth-first order the tree is hashed.
 //
-// The function uses 1 decimal place for MB and above, and shows integers for KB
-// when the decimal part is zero.
+// Parameters:
+//   - cmd: The Cobra command instance for accessing output streams
+//   - lines: The buffered lines to write
+//
+// Returns an error if writing to stdout fails.
+func writeFileLines(cmd *cobra.Command, lines []fileLine) error {
+	sort.Slice(lines, func(i, j int) bool {
+		return pathLess(lines[i].path, lines[j].path)
+	})
+	for _, l := range lines {
+		if _, err := fmt.Fprintf(cmd.OutOrStdout(), "%x  %s\n", l.hash, l.path); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	return nil
+}
+
+// isTerminal reports whether stream, an input or output stream, is an interactive terminal.
+func isTerminal(stream any) bool {
+	f, ok := stream.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm writes prompt to out and reads a line from in. Only "y" or "yes" (in any case)
+// confirm; anything else, including end of input, declines.
 //
 // Parameters:
-//   - bytes: The size in bytes to format
+//   - in: The input to read the answer from
+//   - out: The output to write the prompt to
+//   - prompt: The question to ask
 //
-// Returns a formatted string like "1.5 MB" or "512 B".
-func formatSize(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
+// Returns whether the user confirmed, or an error if writing the prompt or reading fails.
+func confirm(in io.Reader, out io.Writer, prompt string) (bool, error) {
+	if _, err := io.WriteString(out, prompt); err != nil {
+		return false, fmt.Errorf("failed to write prompt: %w", err)
+	}
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read answer: %w", err)
 	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
 
-	units := []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
-	size := float64(bytes)
-	exp := 0
+// writeChecksumFile writes one "<hex>  <path>" line per file, in the format of coreutils
+// checksum tools, so "sha256sum -c" (or the matching tool for another algorithm) can
+// verify the files later. Paths are the hashed path itself for a single file, or joined
+// to it for the files of a directory, so the file is checked from the same working directory.
+//
+// Parameters:
+//   - name: The checksum file to write
+//   - root: The path argument that was hashed
+//   - isDir: Whether root is a directory
+//   - lines: The collected per-file hashes, with paths relative to root
+//
+// Returns an error if the file cannot be written.
+func writeChecksumFile(name, root string, isDir bool, lines []fileLine) error {
+	sort.Slice(lines, func(i, j int) bool {
+		return pathLess(lines[i].path, lines[j].path)
+	})
+	var b strings.Builder
+	for _, l := range lines {
+		p := root
+		if isDir {
+			p = filepath.Join(root, filepath.FromSlash(l.path))
+		}
+		fmt.Fprintf(&b, "%x  %s\n", l.hash, p)
+	}
+	if err := os.WriteFile(filepath.Clean(name), []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write checksum file %s: %w", name, err)
+	}
+	return nil
+}
+
+// progressEvent is a periodic NDJSON progress event written by --progress=json.
+type progressEvent struct {
+	Event string `json:"event"`
+	Files int64  `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// doneEvent is the final NDJSON event written by --progress=json once hashing completes.
+type doneEvent struct {
+	Event string `json:"event"`
+	Root  string `json:"root"`
+	Size  int64  `json:"size"`
+}
+
+// progressSink receives the files hashed while --progress is set and reports progress.
+type progressSink interface {
+	// fileDone records a hashed file, given by its path relative to the hashed path.
+	fileDone(rel string, result merkle.Result)
+	// finish stops reporting and reports the final state for the root result.
+	finish(result merkle.Result) error
+	// stop ends periodic reporting. It is safe to call more than once.
+	stop()
+}
 
-	for size >= unit && exp < len(units)-1 {
-		size /= unit
-		exp++
+// progressReporter counts hashed files and bytes and writes them as NDJSON progress
+// events every interval until it is stopped.
+type progressReporter struct {
+	w     io.Writer
+	files atomic.Int64
+	bytes atomic.Int64
+	// mu serializes writes and guards err
+	mu  sync.Mutex
+	err error
+	// quit stops the ticker goroutine, which closes exited when it returns
+	quit     chan struct{}
+	exited   chan struct{}
+	stopOnce sync.Once
+}
+
+// newProgressReporter starts a reporter writing a progress event to w every interval.
+func newProgressReporter(w io.Writer, interval time.Duration) *progressReporter {
+	p := &progressReporter{w: w, quit: make(chan struct{}), exited: make(chan struct{})}
+	go func() {
+		defer close(p.exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.emitProgress()
+			case <-p.quit:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// fileDone records a hashed file.
+func (p *progressReporter) fileDone(_ string, result merkle.Result) {
+	p.files.Add(1)
+	p.bytes.Add(result.Size)
+}
+
+// stop ends the periodic events. It is safe to call more than once.
+func (p *progressReporter) stop() {
+	p.stopOnce.Do(func() {
+		close(p.quit)
+		<-p.exited
+	})
+}
+
+// finish stops the periodic events and writes a last progress event with the final
+// counts followed by the done event for the root.
+//
+// Parameters:
+//   - result: The root result
+//
+// Returns the first error encountered while writing events.
+func (p *progressReporter) finish(result merkle.Result) error {
+	p.stop()
+	p.emitProgress()
+	p.emit(doneEvent{Event: "done", Root: fmt.Sprintf("%x", result.Hash), Size: result.Size})
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return fmt.Errorf("failed to write progress: %w", p.err)
+	}
+	return nil
+}
+
+// emitProgress writes a progress event with the current counts.
+func (p *progressReporter) emitProgress() {
+	p.emit(progressEvent{Event: "progress", Files: p.files.Load(), Bytes: p.bytes.Load()})
+}
+
+// emit writes event as a single JSON line. After the first write error, events are dropped.
+func (p *progressReporter) emit(event any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		p.err = err
+		return
+	}
+	_, p.err = p.w.Write(append(data, '\n'))
+}
+
+// barWidth is the number of cells of the --progress=bar bar.
+const barWidth = 30
+
+// maxBarPathLen is the number of characters of the current file shown by --progress=bar.
+const maxBarPathLen = 40
+
+// barReporter draws a progress bar with the percentage of files hashed, the throughput and
+// the current file, redrawn in place every interval. Without a terminal to redraw on, it
+// writes a plain progress line every interval instead.
+type barReporter struct {
+	w     io.Writer
+	tty   bool
+	total int64
+	start time.Time
+	files atomic.Int64
+	bytes atomic.Int64
+	// current is the path of the last hashed file
+	current atomic.Value
+	// mu serializes writes and guards err
+	mu  sync.Mutex
+	err error
+	// quit stops the ticker goroutine, which closes exited when it returns
+	quit     chan struct{}
+	exited   chan struct{}
+	stopOnce sync.Once
+}
+
+// newBarReporter starts a reporter drawing progress to w every interval.
+//
+// Parameters:
+//   - w: The stream to draw on, usually stderr
+//   - interval: The time between redraws
+//   - total: The number of files expected from a pre-scan, or 0 if unknown
+//   - tty: Whether w is a terminal; if not, plain lines are written instead of a bar
+func newBarReporter(w io.Writer, interval time.Duration, total int64, tty bool) *barReporter {
+	b := &barReporter{w: w, tty: tty, total: total, start: time.Now(), quit: make(chan struct{}), exited: make(chan struct{})}
+	b.current.Store("")
+	go func() {
+		defer close(b.exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				b.draw(false)
+			case <-b.quit:
+				return
+			}
+		}
+	}()
+	return b
+}
+
+// fileDone records a hashed file.
+func (b *barReporter) fileDone(rel string, result merkle.Result) {
+	b.files.Add(1)
+	b.bytes.Add(result.Size)
+	b.current.Store(rel)
+}
+
+// stop ends the periodic redraws. It is safe to call more than once.
+func (b *barReporter) stop() {
+	b.stopOnce.Do(func() {
+		close(b.quit)
+		<-b.exited
+	})
+}
+
+// finish stops the periodic redraws and draws the final state, ending the bar's line.
+//
+// Returns the first error encountered while drawing.
+func (b *barReporter) finish(merkle.Result) error {
+	b.stop()
+	b.draw(true)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return fmt.Errorf("failed to write progress: %w", b.err)
+	}
+	return nil
+}
+
+// draw writes the current progress: on a terminal, the bar over the previous one, ending
+// the line if final; otherwise a plain line. After the first write error, nothing is drawn.
+func (b *barReporter) draw(final bool) {
+	files, bytes := b.files.Load(), b.bytes.Load()
+	elapsed := time.Since(b.start).Seconds()
+	rate := int64(0)
+	if elapsed > 0 {
+		rate = int64(float64(bytes) / elapsed)
+	}
+	count := fmt.Sprintf("%d files", files)
+	if b.total > 0 {
+		count = fmt.Sprintf("%d/%d files", files, b.total)
+	}
+
+	var line string
+	if b.tty {
+		line = fmt.Sprintf("\r\x1b[K%s %s  %s  %s/s  %s", b.bar(files), count, units.FormatSize(bytes), units.FormatSize(rate), shortenPath(b.current.Load().(string)))
+		if final {
+			line += "\n"
+		}
+	} else {
+		line = fmt.Sprintf("Progress: %s (%s, %s/s)\n", count, units.FormatSize(bytes), units.FormatSize(rate))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return
 	}
+	_, b.err = io.WriteString(b.w, line)
+}
 
-	// Use 1 decimal place for MB and above, but for KB show as integer if decimal is zero
-	if exp == 1 { // KB
-		if size == float64(int64(size)) {
-			return fmt.Sprintf("%.0f %s", size, units[exp])
+// bar renders the bar and percentage for files hashed out of the pre-scan total. The
+// total is a pre-scan estimate, so the percentage is capped at 100. Without a total, only
+// an empty bar is drawn.
+func (b *barReporter) bar(files int64) string {
+	if b.total <= 0 {
+		return "[" + strings.Repeat("-", barWidth) + "]"
+	}
+	percent := min(files*100/b.total, 100)
+	filled := int(percent * barWidth / 100)
+	return fmt.Sprintf("[%s%s] %3d%%", strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled), percent)
+}
+
+// shortenPath keeps the last maxBarPathLen characters of path, marking the cut with "...".
+func shortenPath(path string) string {
+	runes := []rune(path)
+	if len(runes) <= maxBarPathLen {
+		return path
+	}
+	return "..." + string(runes[len(runes)-maxBarPathLen+3:])
+}
+
+// pathLess reports whether slash-separated path a sorts before b, comparing segments in order.
+// The root, ".", sorts before every other path.
+func pathLess(a, b string) bool {
+	if a == "." || b == "." {
+		return a == "." && b != "."
+	}
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
 		}
-		return fmt.Sprintf("%.1f %s", size, units[exp])
 	}
-	// For MB and above, always show 1 decimal place
-	return fmt.Sprintf("%.1f %s", size, units[exp])
+	return len(as) < len(bs)
 }
 
 func init() {
-	hashCmd.Flags().StringArrayP("exclude", "e", []string{}, "Exclude patterns (e.g., 'node_modules', '.git'). Can be specified multiple times.")
-	hashCmd.Flags().StringP("ignore-file", "i", "", "Path to a custom ignore file (takes highest priority). .mtcignore and .gitignore are always loaded automatically from the working directory.")
+	hashCmd.Flags().StringArrayP("exclude", "e", []string{}, "Exclude patterns (e.g., 'node_modules', '.git'). Can be specified multiple times. Defaults to the colon or newline separated patterns in $MTC_EXCLUDE.")
+	hashCmd.Flags().StringP("ignore-file", "i", "", "Path to a custom ignore file (takes highest priority). .mtcignore and .gitignore are always loaded automatically from the working directory. Defaults to $MTC_IGNORE_FILE.")
+	flags.AddIgnoreFileName(hashCmd)
+	hashCmd.Flags().Bool("no-path", false, "Omit the path from the output line, printing only the type, hash and size")
+	hashCmd.Flags().Bool("summary-only", false, "Print only the hex root hash and a newline, without path, type, size or chunk lines, e.g. for HASH=$(mtc hash . --summary-only). Warnings are suppressed unless -v or --log-level is given")
+	_ = hashCmd.Flags().SetAnnotation("summary-only", cmd.QuietFlagAnnotation, []string{"true"})
+	hashCmd.Flags().Bool("verbose-footer", false, "After the result, print a \"# algorithm=<name> format=v<n> workers=<n> excludes=<n>\" line recording how the hash was produced, for reproducibility audits")
+	hashCmd.Flags().Bool("tagged", false, "Print the root as <hash>@<fingerprint>, where the fingerprint identifies the exclusion patterns in effect, so calc can warn when verifying with different exclusions")
+	hashCmd.Flags().String("changed-since", "", "Hash only the files changed since a git commit, branch or tag (plus untracked files not ignored), combined into a root as if they were the whole tree")
+	hashCmd.Flags().Bool("git-changed", false, "Hash only the files git reports as changed (modified, added, renamed or untracked and not ignored), combined into a root as if they were the whole tree")
+	hashCmd.Flags().Bool("per-file", false, "Print a \"<hash>  <relpath>\" line for every file as soon as it is hashed, before the root line")
+	hashCmd.Flags().Bool("all-dirs", false, "Print a \"<hash>  <relpath>\" line for every directory in the tree (\".\" for the root), sorted by path, before the root line, e.g. to cache results at every level")
+	hashCmd.Flags().Bool("ordered", false, "With --per-file, buffer the per-file lines and print them sorted by path once hashing finishes")
+	hashCmd.Flags().String("metrics-addr", "", "Serve hashing statistics in Prometheus text format at http://<addr>/metrics while hashing (e.g. :9090)")
+	hashCmd.Flags().Duration("metrics-linger", 0, "Keep serving metrics for this long after hashing completes (e.g. 30s), so final values can be scraped")
+	hashCmd.Flags().String("warn-threshold", "100G", "Before hashing, estimate the tree's size from directory entries and ask for confirmation on a terminal if it exceeds this size (e.g. 500G). 0 disables the check")
+	hashCmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation when the tree exceeds --warn-threshold")
+	hashCmd.Flags().String("checksum-file", "", "Write a \"<hex>  <path>\" line per file in coreutils format, so that with --algorithm sha256 \"sha256sum -c\" can verify them. Directory roots are not included, as they are not plain file digests")
+	hashCmd.Flags().String("progress", "", "Report progress on stderr while hashing. \"json\" writes newline-delimited JSON events: {\"event\":\"progress\",\"files\":N,\"bytes\":M} periodically, then {\"event\":\"done\",\"root\":\"...\",\"size\":M}. \"bar\" draws a progress bar with the percentage of files hashed (from a pre-scan), throughput and current file, or writes plain progress lines when stderr is not a terminal")
+	hashCmd.Flags().Duration("progress-interval", 500*time.Millisecond, "Interval between --progress events")
+	flags.AddHashing(hashCmd)
+	flags.AddIncludeRootName(hashCmd)
+	flags.AddReportDiagnostics(hashCmd)
+	flags.AddAssume(hashCmd)
+	flags.AddRequireGitRoot(hashCmd)
 
 	cmd.Register(hashCmd)
 }
@@ -2,14 +2,26 @@ package hash
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/lucho00cuba/mtc/internal/ignore"
 	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+	"github.com/lucho00cuba/mtc/version"
+	"github.com/spf13/pflag"
 )
 
 func init() {
@@ -17,64 +29,6 @@ func init() {
 	logger.Init("error", "text", io.Discard)
 }
 
-func TestFormatSize(t *testing.T) {
-	tests := []struct {
-		name  string
-		bytes int64
-		want  string
-	}{
-		{
-			name:  "zero bytes",
-			bytes: 0,
-			want:  "0 B",
-		},
-		{
-			name:  "less than 1KB",
-			bytes: 512,
-			want:  "512 B",
-		},
-		{
-			name:  "exactly 1KB",
-			bytes: 1024,
-			want:  "1 KB",
-		},
-		{
-			name:  "1.5KB",
-			bytes: 1536,
-			want:  "1.5 KB",
-		},
-		{
-			name:  "1MB",
-			bytes: 1024 * 1024,
-			want:  "1.0 MB",
-		},
-		{
-			name:  "1.5MB",
-			bytes: 1024 * 1024 * 1.5,
-			want:  "1.5 MB",
-		},
-		{
-			name:  "1GB",
-			bytes: 1024 * 1024 * 1024,
-			want:  "1.0 GB",
-		},
-		{
-			name:  "large size",
-			bytes: 1024 * 1024 * 1024 * 5,
-			want:  "5.0 GB",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := formatSize(tt.bytes)
-			if got != tt.want {
-				t.Errorf("formatSize(%d) = %q, want %q", tt.bytes, got, tt.want)
-			}
-		})
-	}
-}
-
 func TestHashCmd_File(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "test.txt")
@@ -176,6 +130,35 @@ func TestHashCmd_WithExcludeFlag(t *testing.T) {
 	}
 }
 
+func TestHashCmd_ExcludeEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "keep.txt"), []byte("keep"), 0644); err != nil {
+		t.Fatalf("Failed to create keep.txt: %v", err)
+	}
+	expected, err := merkle.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "exclude.txt"), []byte("exclude"), 0644); err != nil {
+		t.Fatalf("Failed to create exclude.txt: %v", err)
+	}
+	t.Setenv("MTC_EXCLUDE", "exclude.txt:other.txt")
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"hash", tmpDir})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	if output := buf.String(); !strings.Contains(output, fmt.Sprintf("%x", expected.Hash)) {
+		t.Errorf("Output should contain hash %x of the tree without exclude.txt, got: %q", expected.Hash, output)
+	}
+}
+
 func TestHashCmd_WithIgnoreFileFlag(t *testing.T) {
 	tmpDir := t.TempDir()
 	if err := os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("test"), 0644); err != nil {
@@ -208,6 +191,1116 @@ func TestHashCmd_WithIgnoreFileFlag(t *testing.T) {
 	}
 }
 
+func TestHashCmd_NoPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"hash", "--no-path", tmpDir})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	result, err := merkle.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	output := buf.String()
+	if strings.Contains(output, tmpDir) {
+		t.Errorf("Output should not contain the path with --no-path, got: %q", output)
+	}
+	if !strings.HasPrefix(output, "(d): ") {
+		t.Errorf("Output should start with the type, got: %q", output)
+	}
+	if !strings.Contains(output, fmt.Sprintf("%x", result.Hash)) {
+		t.Errorf("Output should contain hash %x, got: %q", result.Hash, output)
+	}
+}
+
+func TestHashCmd_SummaryOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"hash", "--summary-only", tmpDir})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	result, err := merkle.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if want := fmt.Sprintf("%x\n", result.Hash); buf.String() != want {
+		t.Errorf("Output = %q, want exactly %q", buf.String(), want)
+	}
+}
+
+func TestHashCmd_SummaryOnlyQuietsWarnings(t *testing.T) {
+	tmpDir := t.TempDir()
+	// Case-colliding names make the engine log a warning
+	for _, name := range []string{"A", "a"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	// Logs go to os.Stdout, so capture it instead of the command's writer
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe() error = %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	t.Cleanup(func() { os.Stdout = stdout })
+
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(nil)
+	t.Cleanup(func() { rootCmd.SetOut(&bytes.Buffer{}) })
+	rootCmd.SetArgs([]string{"hash", "--summary-only", tmpDir})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	execErr := rootCmd.Execute()
+	os.Stdout = stdout
+	_ = w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("io.ReadAll() error = %v", err)
+	}
+	if execErr != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", execErr)
+	}
+
+	result, err := merkle.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if want := fmt.Sprintf("%x\n", result.Hash); string(out) != want {
+		t.Errorf("Stdout = %q, want exactly %q", out, want)
+	}
+}
+
+func TestHashCmd_SummaryOnlyWithPerFile(t *testing.T) {
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&bytes.Buffer{})
+	rootCmd.SetArgs([]string{"hash", "--summary-only", "--per-file", t.TempDir()})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("rootCmd.Execute() expected error for --summary-only with --per-file")
+	}
+}
+
+func TestHashCmd_VerboseFooter(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		algorithm string
+		excludes  []string
+	}{
+		{name: "defaults", algorithm: "blake3"},
+		{name: "settings", args: []string{"--algorithm", "sha256", "-e", "*.log", "-e", "tmp"}, algorithm: "sha256", excludes: []string{"*.log", "tmp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetArgs(append([]string{"hash", "--verbose-footer", "--no-path", tmpDir}, tt.args...))
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+
+			// Ignore files discovered from the working directory count as exclusions too
+			engine, err := merkle.NewEngineWithExclusions(0, tt.excludes, tmpDir, true, "")
+			if err != nil {
+				t.Fatalf("NewEngineWithExclusions() error = %v", err)
+			}
+			patterns, err := engine.ExclusionPatterns()
+			if err != nil {
+				t.Fatalf("ExclusionPatterns() error = %v", err)
+			}
+			want := fmt.Sprintf("# algorithm=%s format=v2 workers=%d excludes=%d", tt.algorithm, merkle.DefaultMaxWorkers, len(patterns))
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) != 2 || !strings.HasPrefix(lines[0], "(d): ") {
+				t.Fatalf("Output = %q, want the result line then the footer", buf.String())
+			}
+			if lines[1] != want {
+				t.Errorf("Footer = %q, want %q", lines[1], want)
+			}
+		})
+	}
+
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&bytes.Buffer{})
+	rootCmd.SetArgs([]string{"hash", "--verbose-footer", "--summary-only", tmpDir})
+	resetFlags(t)
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("rootCmd.Execute() expected error for --verbose-footer with --summary-only")
+	}
+}
+
+func TestHashCmd_ChunkSize(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "large.bin")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("a", 2500)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"hash", "--chunk-size", "1K", testFile})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	engine := merkle.NewEngine()
+	engine.SetChunkSize(1024)
+	result, chunks, err := engine.HashChunks(testFile)
+	if err != nil {
+		t.Fatalf("HashChunks() error = %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, fmt.Sprintf("%x", result.Hash)) {
+		t.Errorf("Output should contain file hash %x, got: %q", result.Hash, output)
+	}
+	for i, chunk := range chunks {
+		want := fmt.Sprintf("chunk %d: %x (offset: %d, size: %d)", i, chunk.Hash, int64(i)*1024, chunk.Size)
+		if !strings.Contains(output, want) {
+			t.Errorf("Output should contain %q, got: %q", want, output)
+		}
+	}
+}
+
+func TestHashCmd_Assume(t *testing.T) {
+	tmpDir := t.TempDir()
+	sub := filepath.Join(tmpDir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	full, err := merkle.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	subtree, err := merkle.HashPath(sub)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"hash", "--assume", fmt.Sprintf("sub=%x", subtree.Hash), tmpDir})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), fmt.Sprintf("%x", full.Hash)) {
+		t.Errorf("Output should contain full hash %x, got: %q", full.Hash, buf.String())
+	}
+}
+
+func TestHashCmd_PerFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := []string{"a.txt", "b/c.txt", "b/d/e.txt", "b.txt", "f.txt"}
+	for _, name := range files {
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "streamed", args: []string{"hash", "--per-file", "--workers-per-level", tmpDir}},
+		{name: "ordered", args: []string{"hash", "--per-file", "--ordered", "--workers-per-level", tmpDir}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetArgs(tt.args)
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			var paths []string
+			for _, line := range lines[:len(lines)-1] {
+				hash, rel, ok := strings.Cut(line, "  ")
+				if !ok || len(hash) != 64 {
+					t.Fatalf("Malformed per-file line %q", line)
+				}
+				result, err := merkle.HashPath(filepath.Join(tmpDir, filepath.FromSlash(rel)))
+				if err != nil {
+					t.Fatalf("HashPath() error = %v", err)
+				}
+				if hash != fmt.Sprintf("%x", result.Hash) {
+					t.Errorf("Per-file hash of %s = %s, want %x", rel, hash, result.Hash)
+				}
+				paths = append(paths, rel)
+			}
+			if len(paths) != len(files) {
+				t.Errorf("Got %d per-file lines, want %d: %q", len(paths), len(files), buf.String())
+			}
+			if !strings.Contains(lines[len(lines)-1], "(d): ") {
+				t.Errorf("Last line should be the root, got: %q", lines[len(lines)-1])
+			}
+			if tt.name == "ordered" && strings.Join(paths, ",") != "a.txt,b/c.txt,b/d/e.txt,b.txt,f.txt" {
+				t.Errorf("Ordered per-file lines = %v, want sorted by path", paths)
+			}
+		})
+	}
+}
+
+func TestHashCmd_OrderedRequiresPerFile(t *testing.T) {
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(io.Discard)
+	rootCmd.SetArgs([]string{"hash", "--ordered", t.TempDir()})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("rootCmd.Execute() expected error for --ordered without --per-file")
+	}
+}
+
+func TestHashCmd_AllDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := []string{"a.txt", "b/c.txt", "b/d/e.txt", "b/d/f/g.txt", "-h/i.txt", "skip/j.txt"}
+	for _, name := range files {
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"hash", "--all-dirs", "--workers-per-level", "-e", "skip", tmpDir})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var paths []string
+	for _, line := range lines[:len(lines)-1] {
+		hash, rel, ok := strings.Cut(line, "  ")
+		if !ok || len(hash) != 64 {
+			t.Fatalf("Malformed directory line %q", line)
+		}
+		dir := filepath.Join(tmpDir, filepath.FromSlash(rel))
+		engine, err := merkle.NewEngineWithExclusions(0, []string{"skip"}, dir, false, "")
+		if err != nil {
+			t.Fatalf("NewEngineWithExclusions() error = %v", err)
+		}
+		result, err := engine.HashPath(dir)
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		if hash != fmt.Sprintf("%x", result.Hash) {
+			t.Errorf("directory %s: printed hash %s, independent HashPath %x", rel, hash, result.Hash)
+		}
+		paths = append(paths, rel)
+	}
+	want := []string{".", "-h", "b", "b/d", "b/d/f"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("directory lines = %v, want %v", paths, want)
+	}
+	if root := lines[len(lines)-1]; !strings.Contains(root, "(d): "+strings.Fields(lines[0])[0]) {
+		t.Errorf("root line %q does not match the \".\" line %q", root, lines[0])
+	}
+}
+
+func TestHashCmd_AllDirsConflicts(t *testing.T) {
+	for _, flag := range []string{"--per-file", "--summary-only"} {
+		t.Run(flag, func(t *testing.T) {
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(io.Discard)
+			rootCmd.SetArgs([]string{"hash", "--all-dirs", flag, t.TempDir()})
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			if err := rootCmd.Execute(); err == nil {
+				t.Errorf("rootCmd.Execute() expected error for --all-dirs with %s", flag)
+			}
+		})
+	}
+}
+
+func TestHashCmd_NoSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Symlink("test.txt", filepath.Join(tmpDir, "link")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{name: "allowed", args: []string{"hash", tmpDir}},
+		{name: "rejected", args: []string{"hash", "--no-symlinks", tmpDir}, wantErr: true},
+		{name: "excluded", args: []string{"hash", "--no-symlinks", "-e", "link", tmpDir}},
+		{name: "with follow", args: []string{"hash", "--no-symlinks", "--follow-symlinks", tmpDir}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(io.Discard)
+			rootCmd.SetArgs(tt.args)
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			err := rootCmd.Execute()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("rootCmd.Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHashCmd_SymlinkRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	target := filepath.Join(tmpDir, "target")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(target, "test.txt"), []byte("test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	link := filepath.Join(tmpDir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	expected, err := merkle.HashPath(target)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantHash bool
+		wantSize string
+	}{
+		{name: "resolved by default", args: []string{"hash", link}, wantHash: true, wantSize: "(size: 12 B)"},
+		{name: "leaf without resolution", args: []string{"hash", "--resolve-root=false", link}, wantHash: false, wantSize: "(size: 0 B)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetArgs(tt.args)
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+			output := buf.String()
+			if got := strings.Contains(output, fmt.Sprintf("%x", expected.Hash)); got != tt.wantHash {
+				t.Errorf("Output contains target hash = %v, want %v, got: %q", got, tt.wantHash, output)
+			}
+			if !strings.Contains(output, tt.wantSize) {
+				t.Errorf("Output should contain %q, got: %q", tt.wantSize, output)
+			}
+		})
+	}
+}
+
+func TestHashCmd_MetricsEndpoint(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Reserve a free port for the metrics server
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	addr := listener.Addr().String()
+	if err := listener.Close(); err != nil {
+		t.Fatalf("Failed to release the port: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"hash", "--metrics-addr", addr, "--metrics-linger", "2s", tmpDir})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	done := make(chan error, 1)
+	go func() { done <- rootCmd.Execute() }()
+
+	// Scrape until the run has completed and the file is counted
+	var body string
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && !strings.Contains(body, "mtc_files_hashed_total 1") {
+		time.Sleep(20 * time.Millisecond)
+		resp, err := http.Get("http://" + addr + "/metrics")
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err == nil {
+			body = string(data)
+		}
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	for _, want := range []string{"mtc_files_hashed_total 1", "mtc_bytes_read_total 12", "mtc_errors_total 0", "mtc_file_hash_duration_seconds_count 1"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Metrics should contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestHashCmd_ProgressJSON(t *testing.T) {
+	tmpDir := t.TempDir()
+	contents := map[string]string{"a.txt": "alpha", "b/c.txt": "charlie", "b/d.txt": "delta"}
+	for name, content := range contents {
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&stderr)
+	t.Cleanup(func() { rootCmd.SetErr(nil) })
+	rootCmd.SetArgs([]string{"hash", "--progress", "json", "--progress-interval", "1ms", "--no-path", tmpDir})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("Expected at least a progress and a done event, got %q", stderr.String())
+	}
+	var lastFiles, lastBytes int64
+	for _, line := range lines[:len(lines)-1] {
+		var event struct {
+			Event string `json:"event"`
+			Files int64  `json:"files"`
+			Bytes int64  `json:"bytes"`
+		}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("Malformed progress event %q: %v", line, err)
+		}
+		if event.Event != "progress" {
+			t.Fatalf("Event = %q, want progress", event.Event)
+		}
+		if event.Files < lastFiles || event.Bytes < lastBytes {
+			t.Errorf("Progress went backwards: %q", line)
+		}
+		lastFiles, lastBytes = event.Files, event.Bytes
+	}
+	if lastFiles != 3 || lastBytes != 17 {
+		t.Errorf("Final progress = %d files, %d bytes, want 3 files, 17 bytes", lastFiles, lastBytes)
+	}
+
+	var done struct {
+		Event string `json:"event"`
+		Root  string `json:"root"`
+		Size  int64  `json:"size"`
+	}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &done); err != nil {
+		t.Fatalf("Malformed done event %q: %v", lines[len(lines)-1], err)
+	}
+	want, err := merkle.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if done.Event != "done" || done.Root != fmt.Sprintf("%x", want.Hash) || done.Size != 17 {
+		t.Errorf("Done event = %+v, want root %x and size 17", done, want.Hash)
+	}
+	if !strings.Contains(stdout.String(), done.Root) {
+		t.Errorf("Stdout should still contain the root line, got %q", stdout.String())
+	}
+}
+
+func TestHashCmd_ProgressBar(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("content"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	// stderr is a buffer, not a terminal: the bar is suppressed in favor of plain lines
+	var stdout, stderr bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&stderr)
+	t.Cleanup(func() { rootCmd.SetErr(nil) })
+	rootCmd.SetArgs([]string{"hash", "--progress", "bar", "--progress-interval", "1ms", "--no-path", tmpDir})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	if strings.ContainsAny(stderr.String(), "\r\x1b#") {
+		t.Errorf("Progress on a non-terminal = %q, want no bar", stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	if last := lines[len(lines)-1]; !strings.HasPrefix(last, "Progress: 3/3 files (21 B, ") {
+		t.Errorf("Last progress line = %q, want 3/3 files and 21 B", last)
+	}
+	if !strings.HasPrefix(stdout.String(), "(d): ") {
+		t.Errorf("Output = %q, want the usual result line", stdout.String())
+	}
+}
+
+func TestBarReporter(t *testing.T) {
+	var buf bytes.Buffer
+	b := newBarReporter(&buf, time.Hour, 4, true)
+	b.fileDone("a.txt", merkle.Result{Size: 10})
+	long := strings.Repeat("d/", 30) + "last.txt"
+	b.fileDone(long, merkle.Result{Size: 20})
+	if err := b.finish(merkle.Result{}); err != nil {
+		t.Fatalf("finish() error = %v", err)
+	}
+
+	out := buf.String()
+	if !strings.HasPrefix(out, "\r\x1b[K[###############---------------]  50% 2/4 files  30 B  ") || !strings.HasSuffix(out, "\n") {
+		t.Errorf("Bar = %q, want a half-full bar redrawn in place and ended by a newline", out)
+	}
+	if !strings.HasSuffix(out, "  ..."+long[len(long)-maxBarPathLen+3:]+"\n") {
+		t.Errorf("Bar = %q, want the current file shortened to its last %d characters", out, maxBarPathLen)
+	}
+}
+
+func TestHashCmd_ProgressInvalidFormat(t *testing.T) {
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetArgs([]string{"hash", "--progress", "xml", t.TempDir()})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("rootCmd.Execute() expected error for an unsupported progress format")
+	}
+}
+
+func TestHashCmd_RequireGitRoot(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatalf("Failed to create .git: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "non-repo dir", path: t.TempDir(), wantErr: true},
+		{name: "repo root", path: repo, wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetArgs([]string{"hash", "--require-git-root", tt.path})
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			err := rootCmd.Execute()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("rootCmd.Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHashCmd_GitChanged(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in PATH")
+	}
+
+	repo := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte("committed"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=mtc", "-c", "user.email=mtc@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(repo, "b.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to modify b.txt: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"hash", "--git-changed", "--per-file", "--no-path", repo})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	// Only b.txt contributes: the root is that of a tree holding just the changed file
+	expected := t.TempDir()
+	if err := os.WriteFile(filepath.Join(expected, "b.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to create b.txt: %v", err)
+	}
+	want, err := merkle.HashPath(expected)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	file, err := merkle.HashPath(filepath.Join(expected, "b.txt"))
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Output = %q, want one per-file line and the root line", buf.String())
+	}
+	if wantLine := fmt.Sprintf("%x  b.txt", file.Hash); lines[0] != wantLine {
+		t.Errorf("Per-file line = %q, want %q", lines[0], wantLine)
+	}
+	if !strings.Contains(lines[1], fmt.Sprintf("%x", want.Hash)) {
+		t.Errorf("Root line = %q, want root %x", lines[1], want.Hash)
+	}
+}
+
+func TestHashCmd_ChangedSince(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in PATH")
+	}
+
+	repo := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte("committed"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=mtc", "-c", "user.email=mtc@example.com", "commit", "-q", "-m", "initial"},
+		{"tag", "v1"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(repo, "b.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to modify b.txt: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"hash", "--changed-since", "v1", "--per-file", "--no-path", repo})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	// Only b.txt contributes
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "  b.txt") {
+		t.Fatalf("Output = %q, want a per-file line for b.txt and the root line", buf.String())
+	}
+
+	rootCmd.SetArgs([]string{"hash", "--changed-since", "v1", "--git-changed", repo})
+	resetFlags(t)
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "--git-changed") {
+		t.Errorf("rootCmd.Execute() error = %v, want a --git-changed conflict", err)
+	}
+}
+
+func TestHashCmd_ChecksumFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{"a.txt": "alpha\n", "sub/b.txt": "bravo\n"}
+	for name, content := range files {
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{
+			name: "single file",
+			path: filepath.Join(tmpDir, "a.txt"),
+			want: []string{fmt.Sprintf("%x  %s", sha256.Sum256([]byte("alpha\n")), filepath.Join(tmpDir, "a.txt"))},
+		},
+		{
+			name: "directory",
+			path: tmpDir,
+			want: []string{
+				fmt.Sprintf("%x  %s", sha256.Sum256([]byte("alpha\n")), filepath.Join(tmpDir, "a.txt")),
+				fmt.Sprintf("%x  %s", sha256.Sum256([]byte("bravo\n")), filepath.Join(tmpDir, "sub", "b.txt")),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "SHA256SUMS")
+			var buf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetArgs([]string{"hash", "--algorithm", "sha256", "--checksum-file", out, tt.path})
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatalf("Failed to read checksum file: %v", err)
+			}
+			if got := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Checksum file = %q, want %q", got, tt.want)
+			}
+
+			// The file validates with the real tool, when available
+			if _, err := exec.LookPath("sha256sum"); err == nil {
+				if output, err := exec.Command("sha256sum", "-c", out).CombinedOutput(); err != nil {
+					t.Errorf("sha256sum -c failed: %v\n%s", err, output)
+				}
+			}
+		})
+	}
+}
+
+func TestHashCmd_ChecksumFileRequiresContentLeaves(t *testing.T) {
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetArgs([]string{"hash", "--algorithm", "sha256", "--structure-only", "--checksum-file", filepath.Join(t.TempDir(), "out"), t.TempDir()})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("rootCmd.Execute() expected error for --checksum-file with --structure-only")
+	}
+}
+
+func TestHashCmd_WarnThreshold(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "data.bin"), make([]byte, 4096), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "yes skips the prompt", args: []string{"hash", "--warn-threshold", "1K", "--yes", tmpDir}},
+		{name: "no prompt without a terminal", args: []string{"hash", "--warn-threshold", "1K", tmpDir}},
+		{name: "disabled", args: []string{"hash", "--warn-threshold", "0", tmpDir}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&stdout)
+			rootCmd.SetErr(&stderr)
+			rootCmd.SetIn(strings.NewReader("n\n"))
+			t.Cleanup(func() {
+				rootCmd.SetErr(nil)
+				rootCmd.SetIn(nil)
+			})
+			rootCmd.SetArgs(tt.args)
+			resetFlags(t)
+			t.Cleanup(func() { resetFlags(t) })
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+			if strings.Contains(stderr.String(), "Continue?") {
+				t.Errorf("Unexpected prompt: %q", stderr.String())
+			}
+			if !strings.Contains(stdout.String(), "(d):") {
+				t.Errorf("Expected the root line, got %q", stdout.String())
+			}
+		})
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{input: "y\n", want: true},
+		{input: "YES\n", want: true},
+		{input: " yes ", want: true},
+		{input: "n\n", want: false},
+		{input: "\n", want: false},
+		{input: "", want: false},
+		{input: "maybe\n", want: false},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		got, err := confirm(strings.NewReader(tt.input), &out, "Continue? ")
+		if err != nil {
+			t.Fatalf("confirm(%q) error = %v", tt.input, err)
+		}
+		if got != tt.want {
+			t.Errorf("confirm(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+		if out.String() != "Continue? " {
+			t.Errorf("confirm(%q) wrote %q, want the prompt", tt.input, out.String())
+		}
+	}
+}
+
+func TestHashCmd_Tagged(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to create a.txt: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"hash", "--tagged", "--no-path", "-e", "foo", tmpDir})
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	fields := strings.Fields(buf.String())
+	if len(fields) < 2 {
+		t.Fatalf("Unexpected output: %q", buf.String())
+	}
+	hash, fingerprint, ok := strings.Cut(fields[1], "@")
+	if !ok {
+		t.Fatalf("Root %q is not tagged", fields[1])
+	}
+	if len(hash) != 64 {
+		t.Errorf("Hash %q should be 64 hexadecimal characters", hash)
+	}
+	if len(fingerprint) != 2*ignore.FingerprintSize {
+		t.Errorf("Fingerprint %q should be %d hexadecimal characters", fingerprint, 2*ignore.FingerprintSize)
+	}
+}
+
+func TestHashCmd_ErrorFormatJSON(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	var buf, errBuf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"hash", "--error-format", "json", missing})
+	resetFlags(t)
+	t.Cleanup(func() {
+		resetFlags(t)
+		resetPersistentFlags(t, rootCmd.PersistentFlags())
+		logger.Init("error", "text", io.Discard)
+	})
+
+	err := rootCmd.Execute()
+	if err == nil {
+		t.Fatal("rootCmd.Execute() expected error for nonexistent path")
+	}
+	if err := cmd.ReportError(&errBuf, err); err != nil {
+		t.Fatalf("ReportError() error = %v", err)
+	}
+
+	var reported struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	if err := json.Unmarshal(errBuf.Bytes(), &reported); err != nil {
+		t.Fatalf("Error output is not valid JSON: %v\n%s", err, errBuf.String())
+	}
+	if reported.Code != cmd.CodePathNotFound {
+		t.Errorf("Error code = %q, want %q", reported.Code, cmd.CodePathNotFound)
+	}
+	if !strings.Contains(reported.Error, missing) {
+		t.Errorf("Error message = %q, want it to name %s", reported.Error, missing)
+	}
+}
+
+func TestHashCmd_Profiling(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	outDir := t.TempDir()
+	traceFile := filepath.Join(outDir, "mtc.trace")
+	cpuProfile := filepath.Join(outDir, "cpu.pprof")
+	memProfile := filepath.Join(outDir, "mem.pprof")
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"hash", "--trace", traceFile, "--cpuprofile", cpuProfile, "--memprofile", memProfile, tmpDir})
+	resetFlags(t)
+	t.Cleanup(func() {
+		resetFlags(t)
+		resetPersistentFlags(t, rootCmd.PersistentFlags())
+	})
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	for _, path := range []string{traceFile, cpuProfile, memProfile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("Profile %s was not written: %v", filepath.Base(path), err)
+			continue
+		}
+		if info.Size() == 0 {
+			t.Errorf("Profile %s is empty", filepath.Base(path))
+		}
+	}
+}
+
+func TestHashCmd_JSONLogFields(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	logFile := filepath.Join(t.TempDir(), "mtc.log")
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"hash", "--log-format", "json", "--log-level", "info", "--log-output", logFile, testFile})
+	resetFlags(t)
+	t.Cleanup(func() {
+		resetFlags(t)
+		resetPersistentFlags(t, rootCmd.PersistentFlags())
+		logger.Init("error", "text", io.Discard)
+	})
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+
+	var completed map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Log line is not valid JSON %q: %v", line, err)
+		}
+		if entry[logger.FieldVersion] != version.VERSION {
+			t.Errorf("Log line missing %s: %q", logger.FieldVersion, line)
+		}
+		if entry["msg"] == "Hash computation completed" {
+			completed = entry
+		}
+	}
+	if completed == nil {
+		t.Fatalf("Completion log line not found in: %s", data)
+	}
+	if completed[logger.FieldOperation] != "hash" {
+		t.Errorf("Expected %s=hash, got %v", logger.FieldOperation, completed[logger.FieldOperation])
+	}
+	if size, ok := completed[logger.FieldSize].(float64); !ok || size != float64(len("test content")) {
+		t.Errorf("Expected numeric %s=%d, got %v (%T)", logger.FieldSize, len("test content"), completed[logger.FieldSize], completed[logger.FieldSize])
+	}
+}
+
 func TestHashCmd_InvalidArgs(t *testing.T) {
 	// Verify that Args validator is set
 	if hashCmd.Args == nil {
@@ -232,3 +1325,31 @@ func TestHashCmd_InvalidArgs(t *testing.T) {
 		t.Errorf("hashCmd.Args() unexpected error for valid args: %v", err)
 	}
 }
+
+// resetFlags restores all hash command flags to their defaults so that values
+// parsed by one test do not leak into the next.
+func resetFlags(t *testing.T) {
+	t.Helper()
+	hashCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			if err := sv.Replace([]string{}); err != nil {
+				t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+			}
+		} else if err := f.Value.Set(f.DefValue); err != nil {
+			t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+		}
+		f.Changed = false
+	})
+}
+
+// resetPersistentFlags restores the root command's persistent flags (log level,
+// format and output) to their defaults.
+func resetPersistentFlags(t *testing.T, fs *pflag.FlagSet) {
+	t.Helper()
+	fs.VisitAll(func(f *pflag.Flag) {
+		if err := f.Value.Set(f.DefValue); err != nil {
+			t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+		}
+		f.Changed = false
+	})
+}
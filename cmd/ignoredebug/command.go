@@ -0,0 +1,163 @@
+// Package ignoredebug provides the "ignore-debug" command for inspecting the
+// exclusion patterns that apply to a path and explaining match decisions.
+package ignoredebug
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/lucho00cuba/mtc/internal/flags"
+	"github.com/lucho00cuba/mtc/internal/ignore"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/spf13/cobra"
+)
+
+// ignoreDebugCmd represents the ignore-debug command for listing effective ignore patterns.
+var ignoreDebugCmd = &cobra.Command{
+	Use:   "ignore-debug [path]",
+	Short: "List the effective ignore patterns for a path",
+	Long: `List the effective ignore patterns for a path.
+Prints every pattern that would be loaded when hashing the path (from -e, the custom
+ignore file, .mtcignore and .gitignore) together with its source. With --check, reports
+whether the given path, relative to the root, would be excluded and which rule decided it.
+The verdict is the one hashing reaches: the directories above the path are checked first,
+and the hashing flags (e.g. --ignore-precedence, --dockerignore, --exclude-deeper-than,
+--exclude-size) apply as they do for "hash".`,
+	Example: `  # List all patterns that apply when hashing the current directory
+  mtc ignore-debug .
+
+  # Explain why a file is (or isn't) excluded
+  mtc ignore-debug ./project --check build/output.log -e "*.log"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		log := logger.WithOperation("ignore_debug", "path", path, "command", "ignore-debug")
+
+		// Read flags directly from command to ensure they're parsed correctly
+		excludePatterns, err := flags.ExcludePatterns(cmd)
+		if err != nil {
+			log.Warn("Failed to read exclude patterns", "error", err)
+			excludePatterns = []string{}
+		}
+		customIgnoreFile, err := flags.IgnoreFile(cmd)
+		if err != nil {
+			log.Warn("Failed to read ignore-file flag", "error", err)
+			customIgnoreFile = ""
+		}
+		ignoreFileName, err := flags.IgnoreFileName(cmd)
+		if err != nil {
+			return err
+		}
+		check, err := cmd.Flags().GetString("check")
+		if err != nil {
+			log.Warn("Failed to read check flag", "error", err)
+			check = ""
+		}
+
+		sourced, err := ignore.CollectPatterns(excludePatterns, path, true, customIgnoreFile, ignoreFileName)
+		if err != nil {
+			log.Error("Failed to collect ignore patterns", "error", err)
+			return fmt.Errorf("failed to collect ignore patterns: %w", err)
+		}
+
+		out := cmd.OutOrStdout()
+		if _, err := fmt.Fprintf(out, "Patterns (%d):\n", len(sourced)); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		for _, sp := range sourced {
+			if _, err := fmt.Fprintf(out, "  %s\t(%s)\n", sp.Pattern, sp.Source); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+		}
+
+		if check == "" {
+			return nil
+		}
+
+		engine, err := merkle.NewEngineWithExclusions(0, excludePatterns, path, true, customIgnoreFile)
+		if err != nil {
+			log.Error("Failed to create engine with exclusions", "error", err)
+			return fmt.Errorf("failed to create engine: %w", err)
+		}
+		if err := flags.ApplyIgnoreFileName(cmd, engine); err != nil {
+			return err
+		}
+		if err := flags.ApplyHashing(cmd, engine); err != nil {
+			return err
+		}
+		exclusion, err := engine.ExplainExclusion(check)
+		if err != nil {
+			log.Error("Failed to explain exclusion", "error", err)
+			return fmt.Errorf("--check: %w", err)
+		}
+
+		verdict := "included"
+		if exclusion.Excluded {
+			verdict = "excluded"
+		}
+		line := fmt.Sprintf("Check %s: %s", check, verdict)
+		if reason := describe(sourced, exclusion); reason != "" {
+			if exclusion.Excluded && exclusion.Path != filepath.ToSlash(filepath.Clean(check)) {
+				reason = "directory " + exclusion.Path + ", " + reason
+			}
+			line += " (" + reason + ")"
+		}
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	},
+}
+
+// describe returns what decided an exclusion verdict, e.g. the pattern and its source,
+// or an empty string if no rule applied.
+func describe(sourced []ignore.SourcedPattern, exclusion merkle.Exclusion) string {
+	switch exclusion.Rule {
+	case merkle.ExclusionPattern:
+		if source := sourceOf(sourced, exclusion.Pattern); source != "" {
+			return fmt.Sprintf("pattern %q from %s", exclusion.Pattern, source)
+		}
+		return fmt.Sprintf("pattern %q", exclusion.Pattern)
+	case merkle.ExclusionDockerignore:
+		return fmt.Sprintf("pattern %q from .dockerignore", exclusion.Pattern)
+	case merkle.ExclusionDepth:
+		return "--exclude-deeper-than"
+	case merkle.ExclusionOtherFilesystem:
+		return "--one-filesystem"
+	case merkle.ExclusionMarkerDir:
+		return "--marker-dir"
+	case merkle.ExclusionShallow:
+		return "--recursive=false"
+	case merkle.ExclusionContentClass:
+		return "--text-only or --binary-only"
+	case merkle.ExclusionEmptyFile:
+		return "--exclude-empty-files"
+	case merkle.ExclusionSize:
+		return "size rule"
+	}
+	return ""
+}
+
+// sourceOf returns the source of the first collected pattern equal to raw.
+func sourceOf(sourced []ignore.SourcedPattern, raw string) string {
+	for _, sp := range sourced {
+		if strings.TrimSpace(sp.Pattern) == raw {
+			return sp.Source
+		}
+	}
+	return ""
+}
+
+func init() {
+	ignoreDebugCmd.Flags().StringArrayP("exclude", "e", []string{}, "Exclude patterns (e.g., 'node_modules', '.git'). Can be specified multiple times. Defaults to the colon or newline separated patterns in $MTC_EXCLUDE.")
+	ignoreDebugCmd.Flags().StringP("ignore-file", "i", "", "Path to a custom ignore file (takes highest priority). .mtcignore and .gitignore are always loaded automatically from the working directory. Defaults to $MTC_IGNORE_FILE.")
+	flags.AddIgnoreFileName(ignoreDebugCmd)
+	flags.AddHashing(ignoreDebugCmd)
+	ignoreDebugCmd.Flags().String("check", "", "Path relative to the root to test against the loaded patterns")
+
+	cmd.Register(ignoreDebugCmd)
+}
@@ -0,0 +1,191 @@
+package ignoredebug
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/lucho00cuba/mtc/internal/logger"
+)
+
+func init() {
+	// Silence logger during tests - only show errors
+	logger.Init("error", "text", io.Discard)
+}
+
+func TestIgnoreDebugCmd_ListsPatternsAndVerdict(t *testing.T) {
+	tmpDir := t.TempDir()
+	mtcIgnore := filepath.Join(tmpDir, ".mtcignore")
+	if err := os.WriteFile(mtcIgnore, []byte("*.log\n!keep.log\n"), 0644); err != nil {
+		t.Fatalf("Failed to create .mtcignore: %v", err)
+	}
+	gitIgnore := filepath.Join(tmpDir, ".gitignore")
+	if err := os.WriteFile(gitIgnore, []byte("dist/\n"), 0644); err != nil {
+		t.Fatalf("Failed to create .gitignore: %v", err)
+	}
+
+	// Ignore files are discovered from the working directory
+	oldWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer func() {
+		if err := os.Chdir(oldWd); err != nil {
+			t.Errorf("Failed to restore working directory: %v", err)
+		}
+	}()
+
+	tests := []struct {
+		name  string
+		check string
+		want  string
+	}{
+		{
+			name:  "excluded by ignore file",
+			check: "logs/app.log",
+			want:  `Check logs/app.log: excluded (pattern "*.log" from ` + mtcIgnore + ")",
+		},
+		{
+			name:  "re-included by negation",
+			check: "keep.log",
+			want:  `Check keep.log: included (pattern "!keep.log" from ` + mtcIgnore + ")",
+		},
+		{
+			name:  "excluded by command line",
+			check: "node_modules/pkg/index.js",
+			want:  `Check node_modules/pkg/index.js: excluded (directory node_modules, pattern "node_modules" from --exclude)`,
+		},
+		{
+			name:  "excluded by parent directory",
+			check: "dist/app.js",
+			want:  `Check dist/app.js: excluded (directory dist, pattern "dist/" from ` + gitIgnore + ")",
+		},
+		{
+			name:  "not matched",
+			check: "src/main.go",
+			want:  "Check src/main.go: included",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetArgs([]string{"ignore-debug", tmpDir, "-e", "node_modules", "--check", tt.check})
+			t.Cleanup(func() { resetFlags(t) })
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+
+			output := buf.String()
+			for _, want := range []string{
+				"node_modules\t(--exclude)",
+				"*.log\t(" + mtcIgnore + ")",
+				"!keep.log\t(" + mtcIgnore + ")",
+				"dist/\t(" + gitIgnore + ")",
+				tt.want,
+			} {
+				if !strings.Contains(output, want) {
+					t.Errorf("Output should contain %q, got: %q", want, output)
+				}
+			}
+		})
+	}
+}
+
+func TestIgnoreDebugCmd_HashingFlags(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "build", "deep"), 0755); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "build", "out.log"), []byte("log"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "file under excluded directory",
+			args: []string{"-e", "build/", "--check", "build/out.log"},
+			want: `Check build/out.log: excluded (directory build, pattern "build/" from --exclude)`,
+		},
+		{
+			name: "negation of the file does not re-include it",
+			args: []string{"-e", "build/", "-e", "!out.log", "--check", "build/out.log"},
+			want: `Check build/out.log: excluded (directory build, pattern "build/" from --exclude)`,
+		},
+		{
+			name: "depth limit",
+			args: []string{"--exclude-deeper-than", "1", "--check", "build/deep/x.txt"},
+			want: "Check build/deep/x.txt: excluded (directory build/deep, --exclude-deeper-than)",
+		},
+		{
+			name: "size rule",
+			args: []string{"--exclude-size", ">2", "--check", "build/out.log"},
+			want: "Check build/out.log: excluded (size rule)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rootCmd := cmd.GetRootCmd()
+			rootCmd.SetOut(&buf)
+			rootCmd.SetArgs(append([]string{"ignore-debug", tmpDir}, tt.args...))
+			t.Cleanup(func() { resetFlags(t) })
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("rootCmd.Execute() error = %v", err)
+			}
+			if !strings.Contains(buf.String(), tt.want) {
+				t.Errorf("Output should contain %q, got: %q", tt.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestIgnoreDebugCmd_InvalidArgs(t *testing.T) {
+	if err := ignoreDebugCmd.Args(ignoreDebugCmd, []string{}); err == nil {
+		t.Error("ignoreDebugCmd.Args() expected error for no args")
+	}
+	if err := ignoreDebugCmd.Args(ignoreDebugCmd, []string{"path"}); err != nil {
+		t.Errorf("ignoreDebugCmd.Args() unexpected error for valid args: %v", err)
+	}
+}
+
+// resetFlags restores the command flags to their defaults so that values
+// parsed in one test do not leak into the next.
+func resetFlags(t *testing.T) {
+	t.Helper()
+	if err := ignoreDebugCmd.Flags().Set("check", ""); err != nil {
+		t.Errorf("Failed to reset check flag: %v", err)
+	}
+	exclude, ok := ignoreDebugCmd.Flags().Lookup("exclude").Value.(interface{ Replace([]string) error })
+	if !ok {
+		t.Fatal("exclude flag does not support Replace")
+	}
+	if err := exclude.Replace([]string{}); err != nil {
+		t.Errorf("Failed to reset exclude flag: %v", err)
+	}
+	if err := ignoreDebugCmd.Flags().Set("exclude-deeper-than", "0"); err != nil {
+		t.Errorf("Failed to reset exclude-deeper-than flag: %v", err)
+	}
+	excludeSize, ok := ignoreDebugCmd.Flags().Lookup("exclude-size").Value.(interface{ Replace([]string) error })
+	if !ok {
+		t.Fatal("exclude-size flag does not support Replace")
+	}
+	if err := excludeSize.Replace([]string{}); err != nil {
+		t.Errorf("Failed to reset exclude-size flag: %v", err)
+	}
+}
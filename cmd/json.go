@@ -0,0 +1,21 @@
+package cmd
+
+import "encoding/json"
+
+// pretty stores the --pretty flag value.
+var pretty bool
+
+// MarshalJSON encodes a JSON document printed by a command: compact by default, so it
+// is easy for machines to consume, or indented for human reading with --pretty. Streams
+// of one JSON object per line, such as progress events and error reports, stay compact.
+//
+// Parameters:
+//   - v: The value to encode
+//
+// Returns the encoded document, or an error if v cannot be encoded.
+func MarshalJSON(v any) ([]byte, error) {
+	if pretty {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,263 @@
+// Package manifest provides the "manifest" command for recording the hash and size
+// of every file in a tree, so the tree can later be verified entry by entry.
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lucho00cuba/mtc/internal/flags"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/spf13/cobra"
+)
+
+// marshalJSON encodes the manifest according to --pretty. It is bound here because the cmd
+// package is shadowed by the command parameter inside RunE.
+var marshalJSON = cmd.MarshalJSON
+
+// manifestCmd represents the manifest command for listing the hashes of a tree.
+var manifestCmd = &cobra.Command{
+	Use:   "manifest [path]",
+	Short: "Write a JSON manifest of every file hash in a tree",
+	Long: `Write a JSON manifest of every file hash in a tree.
+Hashes the tree and prints its root hash and total size together with the path, type,
+hash and size of every file and symlink. The manifest can be checked later with
+"mtc verify", fully or by re-hashing a random sample of its entries. With --fingerprint,
+only a short hash of the manifest is printed. --output-format writes the same fields as
+YAML or TOML instead of JSON.
+--hash-names replaces file and directory names with hashes for sharing a manifest without
+revealing them, keeping content hashes and sizes; --redact-depth keeps the first N levels of
+each path readable. Such a manifest cannot be verified against a tree, but two manifests
+built with the same options can be compared, e.g. with --fingerprint.
+--output-dir splits the manifest of a huge tree into shards named after the first
+--shard-by hex digits of a hash of each entry's path, like git's loose objects, and writes
+them with an index.json that "mtc verify" reads when given the directory.`,
+	Example: `  # Record a manifest of a dataset
+  mtc manifest /data/archive > archive.manifest.json
+
+  # Write the manifest as YAML
+  mtc manifest /data/archive --output-format yaml > archive.manifest.yaml
+
+  # Share a manifest without revealing names below the top-level directories
+  mtc manifest /data/archive --hash-names --redact-depth 1 > archive.manifest.json
+
+  # Compare two trees' manifests by a single value
+  mtc manifest /data/archive --fingerprint
+
+  # Verify 10% of the entries later
+  mtc verify archive.manifest.json /data/archive --sample 0.1
+
+  # Shard the manifest of a huge tree into up to 256 files
+  mtc manifest /data/archive --output-dir archive.manifest --shard-by 2`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		log := logger.WithOperation("manifest", "path", path, "command", "manifest")
+
+		// Read flags directly from command to ensure they're parsed correctly
+		excludePatterns, err := flags.ExcludePatterns(cmd)
+		if err != nil {
+			log.Warn("Failed to read exclude patterns", "error", err)
+			excludePatterns = []string{}
+		}
+		customIgnoreFile, err := flags.IgnoreFile(cmd)
+		if err != nil {
+			log.Warn("Failed to read ignore-file flag", "error", err)
+			customIgnoreFile = ""
+		}
+		fingerprint, err := cmd.Flags().GetBool("fingerprint")
+		if err != nil {
+			log.Warn("Failed to read fingerprint flag", "error", err)
+			fingerprint = false
+		}
+		outputFormat, err := cmd.Flags().GetString("output-format")
+		if err != nil {
+			log.Warn("Failed to read output-format flag", "error", err)
+			outputFormat = string(merkle.ManifestJSON)
+		}
+		format, err := merkle.ParseManifestFormat(outputFormat)
+		if err != nil {
+			return fmt.Errorf("--output-format: %w", err)
+		}
+		hashNames, err := cmd.Flags().GetBool("hash-names")
+		if err != nil {
+			log.Warn("Failed to read hash-names flag", "error", err)
+			hashNames = false
+		}
+		redactDepth, err := cmd.Flags().GetInt("redact-depth")
+		if err != nil {
+			log.Warn("Failed to read redact-depth flag", "error", err)
+			redactDepth = 0
+		}
+		if cmd.Flags().Changed("redact-depth") && !hashNames {
+			return fmt.Errorf("--redact-depth requires --hash-names")
+		}
+		if redactDepth < 0 {
+			return fmt.Errorf("--redact-depth must not be negative, got %d", redactDepth)
+		}
+		outputDir, err := cmd.Flags().GetString("output-dir")
+		if err != nil {
+			log.Warn("Failed to read output-dir flag", "error", err)
+			outputDir = ""
+		}
+		shardBy, err := cmd.Flags().GetInt("shard-by")
+		if err != nil {
+			log.Warn("Failed to read shard-by flag", "error", err)
+			shardBy = 2
+		}
+		if cmd.Flags().Changed("shard-by") && outputDir == "" {
+			return fmt.Errorf("--shard-by requires --output-dir")
+		}
+		if outputDir != "" && fingerprint {
+			return fmt.Errorf("--output-dir cannot be used with --fingerprint")
+		}
+		if shardBy < 1 || shardBy > merkle.MaxShardBy {
+			return fmt.Errorf("--shard-by must be between 1 and %d, got %d", merkle.MaxShardBy, shardBy)
+		}
+
+		log.Info("Starting manifest generation")
+		start := time.Now()
+
+		engine, err := merkle.NewEngineWithExclusions(0, excludePatterns, path, true, customIgnoreFile)
+		if err != nil {
+			log.Error("Failed to create engine with exclusions", "error", err)
+			return fmt.Errorf("failed to create engine: %w", err)
+		}
+		if err := flags.ApplyIgnoreFileName(cmd, engine); err != nil {
+			return err
+		}
+		if err := flags.ApplyHashing(cmd, engine); err != nil {
+			return err
+		}
+		manifest, err := engine.BuildManifest(path)
+		if err != nil {
+			log.Error("Manifest generation failed", "error", err, "duration", time.Since(start))
+			return err
+		}
+
+		log.Info("Manifest generation completed",
+			"duration", time.Since(start),
+			"hash", manifest.Root,
+			"size", manifest.Size,
+			"entries", len(manifest.Entries),
+		)
+
+		if hashNames {
+			if err := manifest.HashNames(redactDepth); err != nil {
+				return fmt.Errorf("--redact-depth: %w", err)
+			}
+		}
+
+		if fingerprint {
+			value, err := manifest.Fingerprint()
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintln(cmd.OutOrStdout(), value); err != nil {
+				log.Error("Failed to write output to stdout", "error", err)
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			return nil
+		}
+
+		if outputDir != "" {
+			index, err := writeShards(outputDir, manifest, shardBy, format)
+			if err != nil {
+				log.Error("Failed to write manifest shards", "error", err)
+				return err
+			}
+			log.Info("Wrote manifest shards", "dir", outputDir, "shards", len(index.Shards))
+			if _, err := fmt.Fprintf(cmd.OutOrStdout(), "Wrote %d entries in %d shards to %s\n", index.Entries, len(index.Shards), outputDir); err != nil {
+				log.Error("Failed to write output to stdout", "error", err)
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			return nil
+		}
+
+		data, err := encodeManifest(manifest, format)
+		if err != nil {
+			return err
+		}
+		if _, err := cmd.OutOrStdout().Write(data); err != nil {
+			log.Error("Failed to write output to stdout", "error", err)
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	},
+}
+
+// encodeManifest encodes a manifest in the given format, JSON according to --pretty.
+//
+// Returns the encoded manifest ending with a newline, or an error if encoding fails.
+func encodeManifest(manifest *merkle.Manifest, format merkle.ManifestFormat) ([]byte, error) {
+	switch format {
+	case merkle.ManifestYAML:
+		return manifest.EncodeYAML(), nil
+	case merkle.ManifestTOML:
+		return manifest.EncodeTOML(), nil
+	default:
+		encoded, err := marshalJSON(manifest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode manifest: %w", err)
+		}
+		return append(encoded, '\n'), nil
+	}
+}
+
+// writeShards splits a manifest into shards and writes them, in the given format, to dir
+// together with their index. The index is written last, so a directory holding an index
+// holds every shard it lists.
+//
+// Parameters:
+//   - dir: The directory to write to, created if needed
+//   - manifest: The manifest to split
+//   - shardBy: The number of hex digits of the path hash shards are named after
+//   - format: The encoding of the shards
+//
+// Returns the index written, or an error if encoding or writing fails.
+func writeShards(dir string, manifest *merkle.Manifest, shardBy int, format merkle.ManifestFormat) (*merkle.ManifestIndex, error) {
+	index, shards, err := manifest.Shard(shardBy, string(format))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	for _, s := range index.Shards {
+		data, err := encodeManifest(shards[s.Prefix], format)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(dir, s.File), data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write shard: %w", err)
+		}
+	}
+	data, err := marshalJSON(index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest index: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, merkle.ManifestIndexFile), append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write manifest index: %w", err)
+	}
+	return index, nil
+}
+
+func init() {
+	manifestCmd.Flags().StringArrayP("exclude", "e", []string{}, "Exclude patterns (e.g., 'node_modules', '.git'). Can be specified multiple times. Defaults to the colon or newline separated patterns in $MTC_EXCLUDE.")
+	manifestCmd.Flags().StringP("ignore-file", "i", "", "Path to a custom ignore file (takes highest priority). .mtcignore and .gitignore are always loaded automatically from the working directory. Defaults to $MTC_IGNORE_FILE.")
+	flags.AddIgnoreFileName(manifestCmd)
+	manifestCmd.Flags().String("output-format", string(merkle.ManifestJSON), "Encoding of the manifest: json, yaml or toml. All formats hold the same fields and can be checked with \"mtc verify\"")
+	manifestCmd.Flags().Bool("fingerprint", false, "Print only a short hash of the manifest instead of the manifest itself, so two manifests can be compared by a single value")
+	manifestCmd.Flags().Bool("hash-names", false, "Replace file and directory names in entry paths with hashes, keeping content hashes, so the manifest can be shared without revealing names")
+	manifestCmd.Flags().Int("redact-depth", 0, "With --hash-names, keep the first N components of each path readable and hash only the names below them")
+	manifestCmd.Flags().String("output-dir", "", "Write the manifest to this directory as shards named after the first --shard-by hex digits of each entry's path hash, plus an index.json, instead of to stdout. \"mtc verify\" accepts the directory in place of a manifest file")
+	manifestCmd.Flags().Int("shard-by", 2, "With --output-dir, the number of hex digits of the path hash shards are named after, from 1 (up to 16 shards) to 4 (up to 65536)")
+	flags.AddHashing(manifestCmd)
+
+	cmd.Register(manifestCmd)
+}
@@ -0,0 +1,342 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+)
+
+func init() {
+	// Silence logger during tests - only show errors
+	logger.Init("error", "text", io.Discard)
+}
+
+func TestManifestCmd_Directory(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, filepath.FromSlash(name)), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"manifest", tmpDir})
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	var manifest merkle.Manifest
+	if err := json.Unmarshal(buf.Bytes(), &manifest); err != nil {
+		t.Fatalf("Output is not a valid manifest: %v\n%s", err, buf.String())
+	}
+	root, err := merkle.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if manifest.Root != fmt.Sprintf("%x", root.Hash) {
+		t.Errorf("Manifest root = %s, want %x", manifest.Root, root.Hash)
+	}
+	if manifest.Version != merkle.ManifestVersion {
+		t.Errorf("Manifest version = %d, want %d", manifest.Version, merkle.ManifestVersion)
+	}
+	if len(manifest.Entries) != 2 || manifest.Entries[0].Path != "a.txt" || manifest.Entries[1].Path != "sub/b.txt" {
+		t.Errorf("Manifest entries = %+v, want a.txt and sub/b.txt", manifest.Entries)
+	}
+}
+
+func TestManifestCmd_Pretty(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	rootCmd := cmd.GetRootCmd()
+	t.Cleanup(func() {
+		if err := rootCmd.PersistentFlags().Set("pretty", "false"); err != nil {
+			t.Errorf("Failed to reset pretty flag: %v", err)
+		}
+	})
+
+	run := func(args ...string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		rootCmd.SetOut(&buf)
+		rootCmd.SetArgs(append([]string{"manifest"}, args...))
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("rootCmd.Execute() error = %v", err)
+		}
+		return buf.String()
+	}
+
+	compact := run(tmpDir)
+	if strings.Count(compact, "\n") != 1 || strings.Contains(compact, "  ") {
+		t.Errorf("Manifest should be a single compact line by default, got:\n%s", compact)
+	}
+	indented := run("--pretty", tmpDir)
+	if !strings.Contains(indented, "\n  \"root\": ") {
+		t.Errorf("Manifest should be indented with --pretty, got:\n%s", indented)
+	}
+
+	var a, b merkle.Manifest
+	if err := json.Unmarshal([]byte(compact), &a); err != nil {
+		t.Fatalf("Compact output is not a valid manifest: %v", err)
+	}
+	if err := json.Unmarshal([]byte(indented), &b); err != nil {
+		t.Fatalf("Pretty output is not a valid manifest: %v", err)
+	}
+	if a.Root != b.Root {
+		t.Errorf("Compact and pretty manifests differ: %s vs %s", a.Root, b.Root)
+	}
+}
+
+func TestManifestCmd_OutputFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	rootCmd := cmd.GetRootCmd()
+	t.Cleanup(func() {
+		if err := manifestCmd.Flags().Set("output-format", "json"); err != nil {
+			t.Errorf("Failed to reset output-format flag: %v", err)
+		}
+	})
+
+	run := func(args ...string) (string, error) {
+		t.Helper()
+		var buf bytes.Buffer
+		rootCmd.SetOut(&buf)
+		rootCmd.SetArgs(append([]string{"manifest"}, args...))
+		err := rootCmd.Execute()
+		return buf.String(), err
+	}
+
+	want, err := merkle.NewEngine().BuildManifest(tmpDir)
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+	for _, format := range []merkle.ManifestFormat{merkle.ManifestYAML, merkle.ManifestTOML} {
+		output, err := run("--output-format", string(format), tmpDir)
+		if err != nil {
+			t.Fatalf("rootCmd.Execute() with --output-format %s error = %v", format, err)
+		}
+		got, err := merkle.ParseManifest([]byte(output), format)
+		if err != nil {
+			t.Fatalf("Output is not a valid %s manifest: %v\n%s", format, err, output)
+		}
+		if got.Root != want.Root || len(got.Entries) != 1 || got.Entries[0] != want.Entries[0] {
+			t.Errorf("%s manifest = %+v, want %+v", format, got, want)
+		}
+	}
+
+	if _, err := run("--output-format", "xml", tmpDir); err == nil {
+		t.Error("rootCmd.Execute() expected error for an unknown output format")
+	}
+}
+
+func TestManifestCmd_HashNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "private"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "private", "salaries.csv"), []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	rootCmd := cmd.GetRootCmd()
+	t.Cleanup(func() {
+		for name, value := range map[string]string{"hash-names": "false", "redact-depth": "0"} {
+			if err := manifestCmd.Flags().Set(name, value); err != nil {
+				t.Errorf("Failed to reset %s flag: %v", name, err)
+			}
+			manifestCmd.Flags().Lookup(name).Changed = false
+		}
+	})
+
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"manifest", "--hash-names", "--redact-depth", "1", tmpDir})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	var got merkle.Manifest
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Output is not a valid manifest: %v\n%s", err, buf.String())
+	}
+	want, err := merkle.NewEngine().BuildManifest(tmpDir)
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+	if len(got.Entries) != 1 || !got.HashedNames {
+		t.Fatalf("Manifest = %+v, want one entry with hashed names", got)
+	}
+	entry := got.Entries[0]
+	if !strings.HasPrefix(entry.Path, "private/") || strings.Contains(entry.Path, "salaries") {
+		t.Errorf("Path = %q, want the directory kept and the file name hashed", entry.Path)
+	}
+	if entry.Hash != want.Entries[0].Hash || got.Root != want.Root {
+		t.Errorf("Hashing names changed content hashes: got %+v, want %+v", got, want)
+	}
+}
+
+func TestManifestCmd_RedactDepthRequiresHashNames(t *testing.T) {
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&bytes.Buffer{})
+	rootCmd.SetArgs([]string{"manifest", "--redact-depth", "1", t.TempDir()})
+	t.Cleanup(func() {
+		if err := manifestCmd.Flags().Set("redact-depth", "0"); err != nil {
+			t.Errorf("Failed to reset redact-depth flag: %v", err)
+		}
+		manifestCmd.Flags().Lookup("redact-depth").Changed = false
+	})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("rootCmd.Execute() expected error for --redact-depth without --hash-names")
+	}
+}
+
+func TestManifestCmd_OutputDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	for i := range 20 {
+		if err := os.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("file%02d.txt", i)), []byte{byte(i)}, 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	outDir := filepath.Join(t.TempDir(), "shards")
+	rootCmd := cmd.GetRootCmd()
+	t.Cleanup(func() {
+		for name, value := range map[string]string{"output-dir": "", "shard-by": "2"} {
+			if err := manifestCmd.Flags().Set(name, value); err != nil {
+				t.Errorf("Failed to reset %s flag: %v", name, err)
+			}
+			manifestCmd.Flags().Lookup(name).Changed = false
+		}
+	})
+
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"manifest", "--output-dir", outDir, "--shard-by", "1", tmpDir})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, merkle.ManifestIndexFile))
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	var index merkle.ManifestIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("Index is not valid JSON: %v\n%s", err, data)
+	}
+	if index.ShardBy != 1 || index.Entries != 20 {
+		t.Errorf("Index = %+v, want 20 entries sharded by 1 digit", index)
+	}
+	if want := fmt.Sprintf("Wrote 20 entries in %d shards to %s\n", len(index.Shards), outDir); buf.String() != want {
+		t.Errorf("Output = %q, want %q", buf.String(), want)
+	}
+
+	// The shards reassemble into the manifest of the whole tree
+	shards := make(map[string]*merkle.Manifest)
+	for _, s := range index.Shards {
+		data, err := os.ReadFile(filepath.Join(outDir, s.File))
+		if err != nil {
+			t.Fatalf("Failed to read shard: %v", err)
+		}
+		var shard merkle.Manifest
+		if err := json.Unmarshal(data, &shard); err != nil {
+			t.Fatalf("Shard %s is not a valid manifest: %v", s.File, err)
+		}
+		shards[s.Prefix] = &shard
+	}
+	assembled, err := merkle.AssembleShards(&index, shards)
+	if err != nil {
+		t.Fatalf("AssembleShards() error = %v", err)
+	}
+	want, err := merkle.NewEngine().BuildManifest(tmpDir)
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+	if !slices.Equal(assembled.Entries, want.Entries) || assembled.Root != want.Root {
+		t.Errorf("Reassembled manifest = %+v, want %+v", assembled, want)
+	}
+}
+
+func TestManifestCmd_ShardByRequiresOutputDir(t *testing.T) {
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&bytes.Buffer{})
+	rootCmd.SetArgs([]string{"manifest", "--shard-by", "3", t.TempDir()})
+	t.Cleanup(func() {
+		if err := manifestCmd.Flags().Set("shard-by", "2"); err != nil {
+			t.Errorf("Failed to reset shard-by flag: %v", err)
+		}
+		manifestCmd.Flags().Lookup("shard-by").Changed = false
+	})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("rootCmd.Execute() expected error for --shard-by without --output-dir")
+	}
+}
+
+func TestManifestCmd_InvalidArgs(t *testing.T) {
+	if err := manifestCmd.Args(manifestCmd, []string{}); err == nil {
+		t.Error("manifestCmd.Args() expected error for no args")
+	}
+	if err := manifestCmd.Args(manifestCmd, []string{"a", "b"}); err == nil {
+		t.Error("manifestCmd.Args() expected error for too many args")
+	}
+}
+
+func TestManifestCmd_Fingerprint(t *testing.T) {
+	newTree := func(t *testing.T, contents string) string {
+		t.Helper()
+		dir := t.TempDir()
+		if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		return dir
+	}
+	fingerprint := func(t *testing.T, dir string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		rootCmd := cmd.GetRootCmd()
+		rootCmd.SetOut(&buf)
+		rootCmd.SetArgs([]string{"manifest", "--fingerprint", dir})
+		t.Cleanup(func() {
+			if err := manifestCmd.Flags().Set("fingerprint", "false"); err != nil {
+				t.Errorf("Failed to reset fingerprint flag: %v", err)
+			}
+		})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("rootCmd.Execute() error = %v", err)
+		}
+		return strings.TrimSpace(buf.String())
+	}
+
+	a := fingerprint(t, newTree(t, "b"))
+	if len(a) != 2*merkle.ManifestFingerprintSize {
+		t.Errorf("Fingerprint = %q, want %d hexadecimal characters", a, 2*merkle.ManifestFingerprintSize)
+	}
+	if b := fingerprint(t, newTree(t, "b")); a != b {
+		t.Errorf("Identical trees fingerprint differently: %s vs %s", a, b)
+	}
+	if c := fingerprint(t, newTree(t, "changed")); a == c {
+		t.Errorf("Changed tree has the same fingerprint %s", a)
+	}
+}
@@ -0,0 +1,118 @@
+// Package cmd (profile.go) provides optional profiling of a command run. --trace writes
+// a Go execution trace for 'go tool trace', and --cpuprofile and --memprofile write pprof
+// profiles, to investigate where hashing time goes (CPU, I/O waits or scheduling).
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+var (
+	// traceOutput stores the --trace flag value: the file receiving a Go execution trace.
+	traceOutput string
+
+	// cpuProfileOutput stores the --cpuprofile flag value: the file receiving a CPU profile.
+	cpuProfileOutput string
+
+	// memProfileOutput stores the --memprofile flag value: the file receiving a heap profile.
+	memProfileOutput string
+
+	// traceFile and cpuProfileFile hold the files being written while profiling is active.
+	traceFile      *os.File
+	cpuProfileFile *os.File
+
+	// memProfilePath is the heap profile still to be written when profiling stops.
+	memProfilePath string
+)
+
+// startProfiling starts the execution trace and CPU profile requested with --trace and
+// --cpuprofile, and arms the heap profile requested with --memprofile. It is called once
+// the logger is configured, so the whole command run is captured. Anything already
+// started is stopped again if a later step fails.
+//
+// Returns an error if an output file cannot be created or profiling cannot start.
+func startProfiling() error {
+	if traceOutput != "" {
+		f, err := os.Create(traceOutput)
+		if err != nil {
+			return fmt.Errorf("error creating trace file %s: %w", traceOutput, err)
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			return fmt.Errorf("error starting execution trace: %w", err)
+		}
+		traceFile = f
+	}
+
+	if cpuProfileOutput != "" {
+		f, err := os.Create(cpuProfileOutput)
+		if err != nil {
+			_ = stopProfiling()
+			return fmt.Errorf("error creating CPU profile %s: %w", cpuProfileOutput, err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			_ = stopProfiling()
+			return fmt.Errorf("error starting CPU profile: %w", err)
+		}
+		cpuProfileFile = f
+	}
+	memProfilePath = memProfileOutput
+	return nil
+}
+
+// stopProfiling stops any execution trace or CPU profile started by startProfiling and
+// writes the heap profile requested with --memprofile. It is safe to call more than once:
+// only the first call after a run does anything, so Execute can call it again to cover
+// commands that failed before the post-run hook.
+//
+// Returns the first error encountered while finishing the outputs.
+func stopProfiling() error {
+	var errs []error
+	if traceFile != nil {
+		trace.Stop()
+		if err := traceFile.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing trace file: %w", err))
+		}
+		traceFile = nil
+	}
+
+	if cpuProfileFile != nil {
+		pprof.StopCPUProfile()
+		if err := cpuProfileFile.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing CPU profile: %w", err))
+		}
+		cpuProfileFile = nil
+	}
+
+	if memProfilePath != "" {
+		if err := writeMemProfile(memProfilePath); err != nil {
+			errs = append(errs, err)
+		}
+		memProfilePath = ""
+	}
+	return errors.Join(errs...)
+}
+
+// writeMemProfile writes a heap profile to path, after a garbage collection so it
+// reflects live memory at the end of the run.
+func writeMemProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating memory profile %s: %w", path, err)
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing memory profile: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing memory profile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Package prove provides the "prove" command for generating Merkle inclusion proofs
+// that show a file's hash is part of a directory tree with a given root hash.
+package prove
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lucho00cuba/mtc/internal/flags"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/spf13/cobra"
+)
+
+// marshalJSON encodes the proof according to --pretty. It is bound here because the cmd
+// package is shadowed by the command parameter inside RunE.
+var marshalJSON = cmd.MarshalJSON
+
+// proveCmd represents the prove command for generating inclusion proofs.
+var proveCmd = &cobra.Command{
+	Use:   "prove [root-path] [file]",
+	Short: "Generate a Merkle inclusion proof for a file",
+	Long: `Generate a Merkle inclusion proof for a file.
+Hashes the tree at root-path and prints, as JSON, the root hash, the file's leaf hash and
+the sibling hashes at every level from the file up to the root. The proof can be checked
+with "mtc verify-proof" without access to the rest of the tree. It shows that the file's
+hash is part of the root; the recorded path is informational, as directory hashes do not
+cover entry names.`,
+	Example: `  # Prove that a file belongs to a project tree
+  mtc prove ./project ./project/src/main.go > main.proof.json
+
+  # Verify the proof later against the file and a trusted root hash
+  mtc verify-proof main.proof.json ./main.go --root abc123...`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rootPath := args[0]
+		target := args[1]
+		log := logger.WithOperation("prove", "path", rootPath, "target", target, "command", "prove")
+
+		// Read flags directly from command to ensure they're parsed correctly
+		excludePatterns, err := flags.ExcludePatterns(cmd)
+		if err != nil {
+			log.Warn("Failed to read exclude patterns", "error", err)
+			excludePatterns = []string{}
+		}
+		customIgnoreFile, err := flags.IgnoreFile(cmd)
+		if err != nil {
+			log.Warn("Failed to read ignore-file flag", "error", err)
+			customIgnoreFile = ""
+		}
+
+		log.Info("Starting proof generation")
+		start := time.Now()
+
+		engine, err := merkle.NewEngineWithExclusions(0, excludePatterns, rootPath, true, customIgnoreFile)
+		if err != nil {
+			log.Error("Failed to create engine with exclusions", "error", err)
+			return fmt.Errorf("failed to create engine: %w", err)
+		}
+		if err := flags.ApplyIgnoreFileName(cmd, engine); err != nil {
+			return err
+		}
+		if err := flags.ApplyHashing(cmd, engine); err != nil {
+			return err
+		}
+		proof, err := engine.Prove(rootPath, target)
+		if err != nil {
+			log.Error("Proof generation failed", "error", err, "duration", time.Since(start))
+			return err
+		}
+
+		log.Info("Proof generation completed",
+			"duration", time.Since(start),
+			"root_hash", proof.Root,
+			"steps", len(proof.Steps),
+		)
+
+		data, err := marshalJSON(proof)
+		if err != nil {
+			return fmt.Errorf("failed to encode proof: %w", err)
+		}
+		if _, err := fmt.Fprintln(cmd.OutOrStdout(), string(data)); err != nil {
+			log.Error("Failed to write output to stdout", "error", err)
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	proveCmd.Flags().StringArrayP("exclude", "e", []string{}, "Exclude patterns (e.g., 'node_modules', '.git'). Can be specified multiple times. Defaults to the colon or newline separated patterns in $MTC_EXCLUDE.")
+	proveCmd.Flags().StringP("ignore-file", "i", "", "Path to a custom ignore file (takes highest priority). .mtcignore and .gitignore are always loaded automatically from the working directory. Defaults to $MTC_IGNORE_FILE.")
+	flags.AddIgnoreFileName(proveCmd)
+	flags.AddHashing(proveCmd)
+
+	cmd.Register(proveCmd)
+}
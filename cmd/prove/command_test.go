@@ -0,0 +1,84 @@
+package prove
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+)
+
+func init() {
+	// Silence logger during tests - only show errors
+	logger.Init("error", "text", io.Discard)
+}
+
+func TestProveCmd_NestedFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	nested := filepath.Join(tmpDir, "src", "pkg")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("Failed to create nested directories: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "README.md"), []byte("readme"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	target := filepath.Join(nested, "main.go")
+	if err := os.WriteFile(target, []byte("package main"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"prove", tmpDir, target})
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	var proof merkle.Proof
+	if err := json.Unmarshal(buf.Bytes(), &proof); err != nil {
+		t.Fatalf("Output is not a valid proof: %v\n%s", err, buf.String())
+	}
+	if proof.Path != "src/pkg/main.go" {
+		t.Errorf("Proof path = %q, want %q", proof.Path, "src/pkg/main.go")
+	}
+	if len(proof.Steps) != 3 {
+		t.Errorf("Proof steps = %d, want 3", len(proof.Steps))
+	}
+	if err := merkle.VerifyProof(&proof); err != nil {
+		t.Errorf("VerifyProof() error = %v", err)
+	}
+}
+
+func TestProveCmd_OutsideRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "root")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatalf("Failed to create root: %v", err)
+	}
+	outside := filepath.Join(tmpDir, "outside.txt")
+	if err := os.WriteFile(outside, []byte("outside"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetArgs([]string{"prove", root, outside})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("rootCmd.Execute() expected error for file outside root")
+	}
+}
+
+func TestProveCmd_InvalidArgs(t *testing.T) {
+	if err := proveCmd.Args(proveCmd, []string{"root"}); err == nil {
+		t.Error("proveCmd.Args() expected error for one arg")
+	}
+	if err := proveCmd.Args(proveCmd, []string{"root", "file"}); err != nil {
+		t.Errorf("proveCmd.Args() unexpected error for valid args: %v", err)
+	}
+}
@@ -8,10 +8,12 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/lucho00cuba/mtc/internal/logger"
 	"github.com/lucho00cuba/mtc/version"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -30,6 +32,9 @@ var (
 	// quiet stores the quiet mode flag value.
 	quiet bool
 
+	// logAttrs stores the key=value pairs added to every log line.
+	logAttrs []string
+
 	// logFile stores the opened log file handle when logging to a file.
 	logFile *os.File
 )
@@ -72,6 +77,15 @@ directory checksums using Merkle Trees. It provides a set of commands to interac
 			// Default to warn level when no verbose flag is set
 			// This means Info and Debug logs won't be shown unless -v or -vv is used
 			level = "warn"
+			if quietByDefault(cmd) {
+				level = "error"
+			}
+		}
+
+		if errorFormat != "text" && errorFormat != "json" {
+			invalid := errorFormat
+			errorFormat = "text"
+			return fmt.Errorf("invalid error format %q (supported: text, json)", invalid)
 		}
 
 		// Determine log output destination
@@ -102,9 +116,17 @@ directory checksums using Merkle Trees. It provides a set of commands to interac
 
 		// Initialize logger
 		logger.Init(level, logFormat, output)
-		return nil
+		attrs, err := parseLogAttrs(logAttrs)
+		if err != nil {
+			return err
+		}
+		logger.AddAttrs(attrs...)
+		return startProfiling()
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		if err := stopProfiling(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error finishing profile: %v\n", err)
+		}
 		// Close log file if it was opened
 		if logFile != nil {
 			if err := logFile.Close(); err != nil {
@@ -118,6 +140,42 @@ directory checksums using Merkle Trees. It provides a set of commands to interac
 	},
 }
 
+// parseLogAttrs parses --log-attr values of the form key=value into slog key-value pairs.
+// The value may be empty and may itself contain "=".
+//
+// Parameters:
+//   - pairs: The flag values, in the order given
+//
+// Returns the alternating keys and values, or an error for a value without "=" or with an
+// empty key.
+func parseLogAttrs(pairs []string) ([]any, error) {
+	attrs := make([]any, 0, 2*len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --log-attr %q (expected key=value)", pair)
+		}
+		attrs = append(attrs, key, value)
+	}
+	return attrs, nil
+}
+
+// QuietFlagAnnotation marks a boolean command flag that selects a quiet preset, such as
+// diff --hook: while it is set, the log level defaults to error instead of warn. An
+// explicit --log-level or -v still takes precedence.
+const QuietFlagAnnotation = "mtc_quiet"
+
+// quietByDefault reports whether a flag annotated with QuietFlagAnnotation is set on cmd.
+func quietByDefault(cmd *cobra.Command) bool {
+	found := false
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if _, ok := f.Annotations[QuietFlagAnnotation]; ok && f.Value.String() == "true" {
+			found = true
+		}
+	})
+	return found
+}
+
 // Register adds a subcommand to the root command.
 // This function is called by subcommand packages during their init() functions
 // to register themselves with the root command.
@@ -139,10 +197,19 @@ func GetRootCmd() *cobra.Command {
 
 // Execute executes the root command and handles errors.
 // It is the main entry point for the CLI application and should be called
-// from the main package. On failure, it exits with code 1.
+// from the main package. On failure, it reports the error according to --error-format
+// and exits with code 1.
 // Cobra already prints error messages, so this function only handles exit codes.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	// The post-run hook is skipped when a command fails, so finish any profile here
+	if profErr := stopProfiling(); profErr != nil {
+		fmt.Fprintf(os.Stderr, "Error finishing profile: %v\n", profErr)
+	}
+	if err != nil {
+		if reportErr := ReportError(os.Stderr, err); reportErr != nil {
+			fmt.Fprintf(os.Stderr, "Error reporting failure: %v\n", reportErr)
+		}
 		os.Exit(1)
 	}
 }
@@ -180,6 +247,14 @@ Use "{{.CommandPath}} [command] --help" for more information about a command.{{e
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "", "Set the logging level (debug, info, warn, error). Default: warn (only warnings and errors)")
 	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Set the logging format (text, json). Default: text")
 	rootCmd.PersistentFlags().StringVar(&logOutput, "log-output", "stdout", "Set the log output destination (stdout or a filename). Default: stdout")
+	rootCmd.PersistentFlags().StringArrayVar(&logAttrs, "log-attr", nil, "Add a key=value attribute to every log line, e.g. --log-attr run_id=42 to correlate logs across a pipeline. Can be specified multiple times")
 	rootCmd.PersistentFlags().CountVarP(&verbose, "verbose", "v", "Enable verbose output: -v for info level, -vv for debug level")
+	rootCmd.PersistentFlags().StringVar(&errorFormat, "error-format", "text", "Set the format of the error reported when a command fails (text, json). With json, a {\"error\":...,\"code\":...} line is written to stderr")
+	rootCmd.PersistentFlags().BoolVar(&pretty, "pretty", false, "Indent JSON documents (manifests, proofs) for human reading. Default: compact")
 	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Suppress non-error output (equivalent to --log-level=error)")
+
+	// Add persistent flags for profiling
+	rootCmd.PersistentFlags().StringVar(&traceOutput, "trace", "", "Write a Go execution trace of the run to this file, viewable with 'go tool trace'")
+	rootCmd.PersistentFlags().StringVar(&cpuProfileOutput, "cpuprofile", "", "Write a CPU profile of the run to this file, viewable with 'go tool pprof'")
+	rootCmd.PersistentFlags().StringVar(&memProfileOutput, "memprofile", "", "Write a heap profile taken at the end of the run to this file, viewable with 'go tool pprof'")
 }
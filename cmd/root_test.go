@@ -2,7 +2,14 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 
 	"github.com/lucho00cuba/mtc/internal/logger"
@@ -84,3 +91,120 @@ func containsMiddle(s, substr string) bool {
 	}
 	return false
 }
+
+func TestErrorCode(t *testing.T) {
+	_, notFound := os.Stat(filepath.Join(t.TempDir(), "missing"))
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "not found", err: fmt.Errorf("failed to stat path: %w", notFound), want: CodePathNotFound},
+		{name: "permission", err: &fs.PathError{Op: "open", Path: "x", Err: fs.ErrPermission}, want: CodePermissionDenied},
+		{name: "not a directory", err: &fs.PathError{Op: "open", Path: "x", Err: syscall.ENOTDIR}, want: CodeNotADirectory},
+		{name: "hash mismatch", err: fmt.Errorf("hash length mismatch: %w", ErrHashMismatch), want: CodeHashMismatch},
+		{name: "other", err: errors.New("boom"), want: CodeError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorCode(tt.err); got != tt.want {
+				t.Errorf("ErrorCode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReportError(t *testing.T) {
+	t.Cleanup(func() { errorFormat = "text" })
+
+	var buf bytes.Buffer
+	errorFormat = "text"
+	if err := ReportError(&buf, ErrHashMismatch); err != nil {
+		t.Fatalf("ReportError() error = %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("ReportError() in text mode wrote %q, want nothing", buf.String())
+	}
+
+	errorFormat = "json"
+	if err := ReportError(&buf, ErrHashMismatch); err != nil {
+		t.Fatalf("ReportError() error = %v", err)
+	}
+	if want := `{"error":"hash mismatch","code":"hash_mismatch"}` + "\n"; buf.String() != want {
+		t.Errorf("ReportError() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	t.Cleanup(func() { pretty = false })
+	value := map[string]any{"root": "abc", "entries": []string{"a.txt"}}
+
+	pretty = false
+	compact, err := MarshalJSON(value)
+	if err != nil {
+		t.Fatalf("MarshalJSON() error = %v", err)
+	}
+	if want := `{"entries":["a.txt"],"root":"abc"}`; string(compact) != want {
+		t.Errorf("MarshalJSON() = %s, want %s", compact, want)
+	}
+
+	pretty = true
+	indented, err := MarshalJSON(value)
+	if err != nil {
+		t.Fatalf("MarshalJSON() with --pretty error = %v", err)
+	}
+	if !bytes.Contains(indented, []byte("\n  \"root\": \"abc\"")) {
+		t.Errorf("MarshalJSON() with --pretty should indent, got:\n%s", indented)
+	}
+}
+
+func TestRootCmd_LogAttr(t *testing.T) {
+	t.Cleanup(func() {
+		logAttrs, logFormat, logOutput = nil, "text", "stdout"
+		logger.Init("error", "text", io.Discard)
+	})
+
+	probeCmd := &cobra.Command{
+		Use: "log-attr-probe",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger.WithOperation("probe").Warn("Probe line")
+			return nil
+		},
+	}
+	Register(probeCmd)
+	t.Cleanup(func() { rootCmd.RemoveCommand(probeCmd) })
+
+	logPath := filepath.Join(t.TempDir(), "mtc.log")
+	rootCmd.SetArgs([]string{"log-attr-probe", "--log-format", "json", "--log-output", logPath,
+		"--log-attr", "run_id=42", "--log-attr", "job=build=7"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	var line map[string]any
+	if err := json.Unmarshal(data, &line); err != nil {
+		t.Fatalf("Log output is not a single JSON line: %v (%q)", err, data)
+	}
+	if line["run_id"] != "42" || line["job"] != "build=7" || line["operation"] != "probe" {
+		t.Errorf("Log line should carry run_id=42, job=build=7 and its operation, got: %v", line)
+	}
+}
+
+func TestParseLogAttrs(t *testing.T) {
+	attrs, err := parseLogAttrs([]string{"run_id=42", "empty="})
+	if err != nil {
+		t.Fatalf("parseLogAttrs() error = %v", err)
+	}
+	if want := []any{"run_id", "42", "empty", ""}; fmt.Sprint(attrs) != fmt.Sprint(want) {
+		t.Errorf("parseLogAttrs() = %v, want %v", attrs, want)
+	}
+	for _, invalid := range []string{"run_id", "=42"} {
+		if _, err := parseLogAttrs([]string{invalid}); err == nil {
+			t.Errorf("parseLogAttrs(%q) expected error", invalid)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Package selftest provides the "selftest" command, which checks that hashing is
+// deterministic on the current machine by hashing a generated tree in several ways.
+package selftest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/spf13/cobra"
+)
+
+// selftestCmd represents the selftest command for verifying hashing determinism.
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Verify that hashing is deterministic on this machine",
+	Long: `Verify that hashing is deterministic on this machine.
+First checks that every hash algorithm still produces baked-in known answers for fixed inputs,
+catching a dependency update that changed their output. Then generates a temporary tree
+(nested directories, empty files and directories, symlinks and non-ASCII names) and hashes
+it repeatedly: twice in a row, with different worker counts, with adaptive scheduling, and
+as a copy whose entries were created in reverse order so the filesystem lists them
+differently. Every run must produce the same root, and an inclusion
+proof for a nested file must verify against it. Exits with a non-zero code on any mismatch.`,
+	Example: `  # Sanity check after installing or upgrading mtc
+  mtc selftest`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log := logger.WithOperation("selftest", "command", "selftest")
+
+		tmpDir, err := os.MkdirTemp("", "mtc-selftest-")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		defer func() {
+			if err := os.RemoveAll(tmpDir); err != nil {
+				log.Warn("Failed to remove temporary directory", "path", tmpDir, "error", err)
+			}
+		}()
+
+		treeA := filepath.Join(tmpDir, "a")
+		treeB := filepath.Join(tmpDir, "b")
+		if err := createTree(treeA, false); err != nil {
+			return err
+		}
+		if err := createTree(treeB, true); err != nil {
+			return err
+		}
+
+		reference, err := merkle.NewEngineWithWorkers(merkle.DefaultMaxWorkers).HashPath(treeA)
+		if err != nil {
+			return fmt.Errorf("failed to hash test tree: %w", err)
+		}
+
+		failed := 0
+		// The hash implementations must still produce the outputs earlier versions did
+		status := "ok"
+		if err := merkle.KnownAnswerTest(); err != nil {
+			failed++
+			status = fmt.Sprintf("FAIL (%v)", err)
+			log.Error("Self-test check failed", "check", knownAnswersCheck, "error", err)
+		}
+		if _, err := fmt.Fprintf(cmd.OutOrStdout(), "%-24s %s\n", knownAnswersCheck, status); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+
+		for _, c := range checks(treeA, treeB) {
+			got, err := c.run()
+			status := "ok"
+			switch {
+			case err != nil:
+				status = fmt.Sprintf("FAIL (%v)", err)
+			case !bytes.Equal(got, reference.Hash):
+				status = fmt.Sprintf("FAIL (root %x, want %x)", got, reference.Hash)
+			}
+			if status != "ok" {
+				failed++
+				log.Error("Self-test check failed", "check", c.name, "error", status)
+			}
+			if _, err := fmt.Fprintf(cmd.OutOrStdout(), "%-24s %s\n", c.name, status); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+		}
+
+		if failed > 0 {
+			if _, err := fmt.Fprintf(cmd.OutOrStdout(), "Self-test failed: %d check(s) produced a different result\n", failed); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			return fmt.Errorf("self-test failed: hashing is not deterministic or does not match the known answers")
+		}
+		if _, err := fmt.Fprintf(cmd.OutOrStdout(), "Self-test passed: %x\n", reference.Hash); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	},
+}
+
+// knownAnswersCheck is the name of the check comparing hashes of fixed inputs with
+// baked-in values (see merkle.KnownAnswerTest).
+const knownAnswersCheck = "known answers"
+
+// check is a single self-test run, which must reproduce the reference root.
+type check struct {
+	name string
+	run  func() ([]byte, error)
+}
+
+// checks returns the self-test runs for the generated trees a and b, where b has the
+// same contents as a but was created in reverse order.
+func checks(a, b string) []check {
+	hashWith := func(path string, configure func(*merkle.Engine)) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			engine := merkle.NewEngineWithWorkers(merkle.DefaultMaxWorkers)
+			if configure != nil {
+				configure(engine)
+			}
+			result, err := engine.HashPath(path)
+			return result.Hash, err
+		}
+	}
+
+	return []check{
+		{name: "repeat", run: hashWith(a, nil)},
+		{name: "single worker", run: func() ([]byte, error) {
+			result, err := merkle.NewEngineWithWorkers(1).HashPath(a)
+			return result.Hash, err
+		}},
+		{name: "adaptive scheduling", run: hashWith(a, func(e *merkle.Engine) { e.SetAdaptiveScheduling(true) })},
+		{name: "creation order", run: hashWith(b, nil)},
+		{name: "inclusion proof", run: func() ([]byte, error) {
+			proof, err := merkle.NewEngine().Prove(a, filepath.Join(a, "src", "pkg", "util.go"))
+			if err != nil {
+				return nil, err
+			}
+			if err := merkle.VerifyProof(proof); err != nil {
+				return nil, err
+			}
+			return hex.DecodeString(proof.Root)
+		}},
+	}
+}
+
+// testTree lists the generated files by slash-separated path, with their contents.
+// Names mix case, punctuation and non-ASCII characters to exercise ordering.
+var testTree = map[string]string{
+	"README.md":            "# self-test\n",
+	"Makefile":             "all:\n\tgo build ./...\n",
+	"empty.txt":            "",
+	"src/main.go":          "package main\n\nfunc main() {}\n",
+	"src/pkg/util.go":      "package pkg\n",
+	"src/pkg/util_test.go": "package pkg\n",
+	"src/z-last.txt":       strings.Repeat("z", 10000),
+	"data/über.bin":        "\x00\x01\x02\x03",
+	"data/a b.txt":         "space in name",
+	"data/nested/deep/x":   strings.Repeat("deep", 2048),
+}
+
+// createTree generates the self-test tree at root. With reverse set, directories and
+// files are created in reverse order, which changes the raw listing order on many
+// filesystems without changing the tree.
+func createTree(root string, reverse bool) error {
+	names := make([]string, 0, len(testTree))
+	for name := range testTree {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if reverse {
+		slices.Reverse(names)
+	}
+
+	dirs := []string{"empty-dir", "src/pkg", "data/nested/deep"}
+	if reverse {
+		slices.Reverse(dirs)
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(dir)), 0755); err != nil {
+			return fmt.Errorf("failed to create test directory: %w", err)
+		}
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte(testTree[name]), 0644); err != nil {
+			return fmt.Errorf("failed to create test file: %w", err)
+		}
+	}
+	// Symlinks are optional: some platforms do not allow creating them
+	_ = os.Symlink("src/main.go", filepath.Join(root, "link"))
+	return nil
+}
+
+func init() {
+	cmd.Register(selftestCmd)
+}
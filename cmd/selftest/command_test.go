@@ -0,0 +1,72 @@
+package selftest
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+)
+
+func init() {
+	// Silence logger during tests - only show errors
+	logger.Init("error", "text", io.Discard)
+}
+
+func TestSelftestCmd_Passes(t *testing.T) {
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"selftest"})
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v, output: %s", err, buf.String())
+	}
+
+	output := buf.String()
+	if strings.Contains(output, "FAIL") {
+		t.Errorf("Self-test reported a failure: %s", output)
+	}
+	if !strings.Contains(output, "Self-test passed: ") {
+		t.Errorf("Output should report success, got: %q", output)
+	}
+	if !strings.HasPrefix(output, knownAnswersCheck) {
+		t.Errorf("Output should start with the known-answer check, got: %q", output)
+	}
+	// The known-answer check runs in addition to the tree checks
+	if got, want := strings.Count(output, " ok\n"), len(checks("", ""))+1; got != want {
+		t.Errorf("Expected %d passing checks, got %d: %q", want, got, output)
+	}
+}
+
+func TestCreateTree_ReverseIsIdentical(t *testing.T) {
+	tmpDir := t.TempDir()
+	a := filepath.Join(tmpDir, "a")
+	b := filepath.Join(tmpDir, "b")
+	if err := createTree(a, false); err != nil {
+		t.Fatalf("createTree() error = %v", err)
+	}
+	if err := createTree(b, true); err != nil {
+		t.Fatalf("createTree() reverse error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(a, "empty-dir")); err != nil {
+		t.Errorf("Expected empty directory in test tree: %v", err)
+	}
+
+	rootA, err := merkle.HashPath(a)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	rootB, err := merkle.HashPath(b)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !bytes.Equal(rootA.Hash, rootB.Hash) || rootA.Size != rootB.Size {
+		t.Errorf("Trees created in different orders hash differently: %x vs %x", rootA.Hash, rootB.Hash)
+	}
+}
@@ -0,0 +1,85 @@
+// Package size provides the "size" command for computing the total size of a file
+// or directory after exclusions, without hashing any contents.
+package size
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lucho00cuba/mtc/internal/flags"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+	"github.com/lucho00cuba/mtc/internal/units"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/spf13/cobra"
+)
+
+// sizeCmd represents the size command for computing the total size of a tree.
+var sizeCmd = &cobra.Command{
+	Use:   "size [path]",
+	Short: "Compute the total size of a file or directory without hashing",
+	Long: `Compute the total size of a file or directory without hashing.
+Walks the tree applying the same exclusions as "mtc hash" (-e, the custom ignore file,
+.mtcignore and .gitignore) and sums file sizes from directory entries only, so no file
+is opened. The reported total matches the size printed by "mtc hash".`,
+	Example: `  # Total size of a project, excluding dependencies
+  mtc size ./project -e node_modules`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		log := logger.WithOperation("size", "path", path, "command", "size")
+
+		// Read flags directly from command to ensure they're parsed correctly
+		excludePatterns, err := flags.ExcludePatterns(cmd)
+		if err != nil {
+			log.Warn("Failed to read exclude patterns", "error", err)
+			excludePatterns = []string{}
+		}
+		customIgnoreFile, err := flags.IgnoreFile(cmd)
+		if err != nil {
+			log.Warn("Failed to read ignore-file flag", "error", err)
+			customIgnoreFile = ""
+		}
+
+		log.Info("Starting size computation")
+		start := time.Now()
+
+		pathInfo, err := os.Stat(path)
+		if err != nil {
+			log.Error("Failed to get path info", "error", err)
+			return fmt.Errorf("failed to stat path %q: %w", path, err)
+		}
+
+		engine, err := merkle.NewEngineWithExclusions(0, excludePatterns, path, true, customIgnoreFile)
+		if err != nil {
+			log.Error("Failed to create engine with exclusions", "error", err)
+			return fmt.Errorf("failed to create engine: %w", err)
+		}
+		total, err := engine.SizePath(path)
+		if err != nil {
+			log.Error("Size computation failed", "error", err, "duration", time.Since(start))
+			return err
+		}
+
+		log.Info("Size computation completed", "duration", time.Since(start), "size", total)
+
+		pathType := "f"
+		if pathInfo.IsDir() {
+			pathType = "d"
+		}
+		if _, err := fmt.Fprintf(cmd.OutOrStdout(), "%s (%s): %s (%d bytes)\n", path, pathType, units.FormatSize(total), total); err != nil {
+			log.Error("Failed to write output to stdout", "error", err)
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	sizeCmd.Flags().StringArrayP("exclude", "e", []string{}, "Exclude patterns (e.g., 'node_modules', '.git'). Can be specified multiple times. Defaults to the colon or newline separated patterns in $MTC_EXCLUDE.")
+	sizeCmd.Flags().StringP("ignore-file", "i", "", "Path to a custom ignore file (takes highest priority). .mtcignore and .gitignore are always loaded automatically from the working directory. Defaults to $MTC_IGNORE_FILE.")
+
+	cmd.Register(sizeCmd)
+}
@@ -0,0 +1,106 @@
+package size
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+	"github.com/spf13/pflag"
+)
+
+func init() {
+	// Silence logger during tests - only show errors
+	logger.Init("error", "text", io.Discard)
+}
+
+func TestSizeCmd_MatchesHashSize(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "src", "vendor"), 0755); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	files := map[string]string{
+		"README.md":          "readme",
+		"src/main.go":        "package main",
+		"src/vendor/lib.go":  "package lib // excluded",
+		"src/vendor/big.bin": strings.Repeat("x", 4096),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	if err := os.Symlink("README.md", filepath.Join(tmpDir, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"size", "-e", "vendor", tmpDir})
+	t.Cleanup(func() { resetFlags(t) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	engine, err := merkle.NewEngineWithExclusions(0, []string{"vendor"}, tmpDir, true, "")
+	if err != nil {
+		t.Fatalf("NewEngineWithExclusions() error = %v", err)
+	}
+	result, err := engine.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	want := fmt.Sprintf("(%d bytes)", result.Size)
+	output := buf.String()
+	if !strings.Contains(output, want) {
+		t.Errorf("Output should contain %q, got: %q", want, output)
+	}
+	if !strings.HasPrefix(output, tmpDir+" (d): ") {
+		t.Errorf("Output should start with the path and type, got: %q", output)
+	}
+}
+
+func TestSizeCmd_Nonexistent(t *testing.T) {
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetArgs([]string{"size", "/nonexistent/path/that/does/not/exist"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("rootCmd.Execute() expected error for nonexistent path")
+	}
+}
+
+func TestSizeCmd_InvalidArgs(t *testing.T) {
+	if err := sizeCmd.Args(sizeCmd, []string{}); err == nil {
+		t.Error("sizeCmd.Args() expected error for no args")
+	}
+	if err := sizeCmd.Args(sizeCmd, []string{"a", "b"}); err == nil {
+		t.Error("sizeCmd.Args() expected error for too many args")
+	}
+	if err := sizeCmd.Args(sizeCmd, []string{"path"}); err != nil {
+		t.Errorf("sizeCmd.Args() unexpected error for valid args: %v", err)
+	}
+}
+
+// resetFlags restores all size command flags to their defaults so that values
+// parsed by one test do not leak into the next.
+func resetFlags(t *testing.T) {
+	t.Helper()
+	sizeCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			if err := sv.Replace([]string{}); err != nil {
+				t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+			}
+		} else if err := f.Value.Set(f.DefValue); err != nil {
+			t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+		}
+		f.Changed = false
+	})
+}
@@ -0,0 +1,98 @@
+// Package tree provides the "tree" command for listing a file or directory as the
+// objects of another tool's tree format, such as git tree objects.
+package tree
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lucho00cuba/mtc/internal/flags"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/spf13/cobra"
+)
+
+// formatGit is the --format value listing git tree objects.
+const formatGit = "git"
+
+// treeCmd represents the tree command for listing a tree in another tool's format.
+var treeCmd = &cobra.Command{
+	Use:   "tree [path]",
+	Short: "List a file or directory as git tree objects",
+	Long: `List a file or directory as git tree objects.
+With --format git (the default), every entry is printed like a line of "git ls-tree -r -t":
+mode, object type, object ID and path, each tree before its contents. The first line is the
+root, whose ID equals what "git write-tree" records for the same files, so the output can be
+checked with "git cat-file -p <id>". Object IDs are git's SHA-1 over git's own serialization,
+not mtc hashes. Exclusions (-e, the custom ignore file, .mtcignore and .gitignore) apply;
+special files, ".git" directories and directories without any entries are skipped, as git
+cannot store them.`,
+	Example: `  # Compute the git tree ID of a build output
+  mtc tree ./dist | head -n 1
+
+  # Check it against the tree recorded in a commit
+  git rev-parse HEAD:dist`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		log := logger.WithOperation("tree", "path", path, "command", "tree")
+
+		// Read flags directly from command to ensure they're parsed correctly
+		excludePatterns, err := flags.ExcludePatterns(cmd)
+		if err != nil {
+			log.Warn("Failed to read exclude patterns", "error", err)
+			excludePatterns = []string{}
+		}
+		customIgnoreFile, err := flags.IgnoreFile(cmd)
+		if err != nil {
+			log.Warn("Failed to read ignore-file flag", "error", err)
+			customIgnoreFile = ""
+		}
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			log.Warn("Failed to read format flag", "error", err)
+			format = formatGit
+		}
+		if format != formatGit {
+			return fmt.Errorf("unsupported tree format %q (supported: git)", format)
+		}
+
+		log.Info("Starting git tree computation")
+		start := time.Now()
+
+		engine, err := merkle.NewEngineWithExclusions(0, excludePatterns, path, true, customIgnoreFile)
+		if err != nil {
+			log.Error("Failed to create engine with exclusions", "error", err)
+			return fmt.Errorf("failed to create engine: %w", err)
+		}
+		if err := flags.ApplyIgnoreFileName(cmd, engine); err != nil {
+			return err
+		}
+		root, entries, err := engine.GitTree(path)
+		if err != nil {
+			log.Error("Git tree computation failed", "error", err, "duration", time.Since(start))
+			return err
+		}
+
+		log.Info("Git tree computation completed", "duration", time.Since(start), "entries", len(entries), "hash", fmt.Sprintf("%x", root.OID))
+
+		for _, entry := range append([]merkle.GitTreeEntry{root}, entries...) {
+			if _, err := fmt.Fprintln(cmd.OutOrStdout(), entry); err != nil {
+				log.Error("Failed to write output to stdout", "error", err)
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	treeCmd.Flags().StringArrayP("exclude", "e", []string{}, "Exclude patterns (e.g., 'node_modules', '.git'). Can be specified multiple times. Defaults to the colon or newline separated patterns in $MTC_EXCLUDE.")
+	treeCmd.Flags().StringP("ignore-file", "i", "", "Path to a custom ignore file (takes highest priority). .mtcignore and .gitignore are always loaded automatically from the working directory. Defaults to $MTC_IGNORE_FILE.")
+	flags.AddIgnoreFileName(treeCmd)
+	treeCmd.Flags().String("format", formatGit, "Tree format to list (supported: git)")
+
+	cmd.Register(treeCmd)
+}
@@ -0,0 +1,86 @@
+package tree
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/spf13/pflag"
+)
+
+func init() {
+	// Silence logger during tests - only show errors
+	logger.Init("error", "text", io.Discard)
+}
+
+// run executes the tree command and returns its output and error.
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs(append([]string{"tree"}, args...))
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	err := rootCmd.Execute()
+	return buf.String(), err
+}
+
+func TestTreeCmd_GitObjectIDs(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "hello.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "skip.log"), []byte("log"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	output, err := run(t, "-e", "*.log", tmpDir)
+	if err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	// IDs as reported by "git hash-object" and "git mktree" for the same contents
+	want := "040000 tree aaa96ced2d9a1c8e72c56b253a0e2fe78393feb7\t.\n" +
+		"100644 blob ce013625030ba8dba906f756967f9e9ca394464a\thello.txt\n"
+	if output != want {
+		t.Errorf("Output = %q, want %q", output, want)
+	}
+}
+
+func TestTreeCmd_EmptyDirectory(t *testing.T) {
+	output, err := run(t, t.TempDir())
+	if err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	// Git's well-known empty tree
+	if want := "040000 tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\t.\n"; output != want {
+		t.Errorf("Output = %q, want %q", output, want)
+	}
+}
+
+func TestTreeCmd_UnsupportedFormat(t *testing.T) {
+	if _, err := run(t, "--format", "svn", t.TempDir()); err == nil {
+		t.Error("rootCmd.Execute() expected error for unsupported format")
+	}
+}
+
+// resetFlags restores all tree command flags to their defaults so that values
+// parsed by one test do not leak into the next.
+func resetFlags(t *testing.T) {
+	t.Helper()
+	treeCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			if err := sv.Replace([]string{}); err != nil {
+				t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+			}
+		} else if err := f.Value.Set(f.DefValue); err != nil {
+			t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+		}
+		f.Changed = false
+	})
+}
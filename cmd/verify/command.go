@@ -0,0 +1,165 @@
+// Package verify provides the "verify" command for checking a tree against a
+// manifest, either completely or by re-hashing a random sample of its entries.
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lucho00cuba/mtc/internal/flags"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd represents the verify command for checking a tree against a manifest.
+var verifyCmd = &cobra.Command{
+	Use:   "verify [manifest-file] [path]",
+	Short: "Verify a tree against a manifest, optionally by random sampling",
+	Long: `Verify a tree against a manifest, optionally by random sampling.
+Re-hashes the entries of a manifest written by "mtc manifest", in any of its output
+formats (JSON, YAML or TOML), and reports entries that are missing or modified. The
+manifest file may also be a directory of shards written by "mtc manifest --output-dir". With --sample, only that fraction of the entries is re-hashed, chosen
+at random; the seed is printed so the same sample can be checked again with --seed. This
+trades completeness for speed on very large trees.`,
+	Example: `  # Verify every entry
+  mtc verify archive.manifest.json /data/archive
+
+  # Re-hash a reproducible 10% sample
+  mtc verify archive.manifest.json /data/archive --sample 0.1 --seed 42`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifestFile := args[0]
+		path := args[1]
+		log := logger.WithOperation("verify", "manifest", manifestFile, "path", path, "command", "verify")
+
+		// Read flags directly from command to ensure they're parsed correctly
+		sample, err := cmd.Flags().GetFloat64("sample")
+		if err != nil {
+			log.Warn("Failed to read sample flag", "error", err)
+			sample = 1
+		}
+		seed, err := cmd.Flags().GetInt64("seed")
+		if err != nil {
+			log.Warn("Failed to read seed flag", "error", err)
+			seed = 0
+		}
+		if !cmd.Flags().Changed("seed") {
+			seed = time.Now().UnixNano()
+		}
+
+		manifest, err := readManifest(manifestFile)
+		if err != nil {
+			log.Error("Failed to read manifest", "error", err)
+			return err
+		}
+		if manifest.Version != merkle.ManifestVersion {
+			return fmt.Errorf("unsupported manifest version %d (expected %d)", manifest.Version, merkle.ManifestVersion)
+		}
+
+		log.Info("Starting manifest verification", "sample", sample, "seed", seed)
+		start := time.Now()
+
+		engine := merkle.NewEngine()
+		if err := flags.ApplyHashing(cmd, engine); err != nil {
+			return err
+		}
+		report, err := engine.VerifyManifest(manifest, path, sample, seed)
+		if err != nil {
+			log.Error("Manifest verification failed", "error", err, "duration", time.Since(start))
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		for _, failure := range report.Failures {
+			if _, err := fmt.Fprintln(out, failure); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+		}
+
+		log.Info("Manifest verification completed",
+			"duration", time.Since(start),
+			"checked", len(report.Checked),
+			"total", report.Total,
+			"failures", len(report.Failures),
+		)
+
+		if len(report.Failures) > 0 {
+			if _, err := fmt.Fprintf(out, "Verification failed: %d of %d checked entries differ (seed %d)\n", len(report.Failures), len(report.Checked), seed); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			return fmt.Errorf("%d entries do not match the manifest", len(report.Failures))
+		}
+		if _, err := fmt.Fprintf(out, "Verified %d of %d entries (seed %d): OK\n", len(report.Checked), report.Total, seed); err != nil {
+			log.Error("Failed to write output to stdout", "error", err)
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	},
+}
+
+// readManifest reads the manifest in the given file or, if it is a directory, reassembles
+// the sharded manifest it holds from its index and shards.
+//
+// Returns the manifest, or an error if it cannot be read or parsed.
+func readManifest(name string) (*merkle.Manifest, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest file %s: %w", name, err)
+	}
+	if !info.IsDir() {
+		return parseManifestFile(name)
+	}
+
+	indexFile := filepath.Join(name, merkle.ManifestIndexFile)
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest index %s: %w", indexFile, err)
+	}
+	var index merkle.ManifestIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest index %s: %w", indexFile, err)
+	}
+	shards := make(map[string]*merkle.Manifest, len(index.Shards))
+	for _, s := range index.Shards {
+		if s.File != filepath.Base(s.File) {
+			return nil, fmt.Errorf("manifest index %s names shard %q outside its directory", indexFile, s.File)
+		}
+		shard, err := parseManifestFile(filepath.Join(name, s.File))
+		if err != nil {
+			return nil, err
+		}
+		shards[s.Prefix] = shard
+	}
+	manifest, err := merkle.AssembleShards(&index, shards)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sharded manifest %s: %w", name, err)
+	}
+	return manifest, nil
+}
+
+// parseManifestFile reads and parses a single manifest file in any of its formats.
+func parseManifestFile(name string) (*merkle.Manifest, error) {
+	data, err := os.ReadFile(filepath.Clean(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest file %s: %w", name, err)
+	}
+	manifest, err := merkle.ParseManifest(data, merkle.DetectManifestFormat(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest file %s: %w", name, err)
+	}
+	return manifest, nil
+}
+
+func init() {
+	verifyCmd.Flags().Float64("sample", 1, "Fraction of manifest entries to re-hash, chosen at random (e.g. 0.1 for 10%). 1 checks every entry.")
+	verifyCmd.Flags().Int64("seed", 0, "Seed for choosing the sample, to reproduce a previous run. Random if not set.")
+	flags.AddHashing(verifyCmd)
+
+	cmd.Register(verifyCmd)
+}
@@ -0,0 +1,207 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+	"github.com/spf13/pflag"
+)
+
+func init() {
+	// Silence logger during tests - only show errors
+	logger.Init("error", "text", io.Discard)
+}
+
+// writeManifest creates a tree of files and writes its manifest, returning both paths.
+func writeManifest(t *testing.T, files int) (string, string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "tree")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for i := 0; i < files; i++ {
+		name := filepath.Join(root, "file"+string(rune('a'+i))+".txt")
+		if err := os.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	manifest, err := merkle.NewEngine().BuildManifest(root)
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Failed to encode manifest: %v", err)
+	}
+	manifestFile := filepath.Join(tmpDir, "tree.manifest.json")
+	if err := os.WriteFile(manifestFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+	return manifestFile, root
+}
+
+// run executes the verify command and returns its output and error.
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs(append([]string{"verify"}, args...))
+	resetFlags(t)
+	t.Cleanup(func() { resetFlags(t) })
+
+	err := rootCmd.Execute()
+	return buf.String(), err
+}
+
+func TestVerifyCmd_Full(t *testing.T) {
+	manifestFile, root := writeManifest(t, 5)
+
+	output, err := run(t, manifestFile, root)
+	if err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	if !strings.Contains(output, "Verified 5 of 5 entries") {
+		t.Errorf("Output should report all entries verified, got: %q", output)
+	}
+}
+
+func TestVerifyCmd_SampleDetectsCorruption(t *testing.T) {
+	manifestFile, root := writeManifest(t, 20)
+
+	output, err := run(t, manifestFile, root, "--sample", "0.25", "--seed", "7")
+	if err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	if !strings.Contains(output, "Verified 5 of 20 entries (seed 7): OK") {
+		t.Errorf("Output should report the sample, got: %q", output)
+	}
+
+	// Find the entries the seed selects and corrupt one of them
+	data, err := os.ReadFile(manifestFile)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	var manifest merkle.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	report, err := merkle.NewEngine().VerifyManifest(&manifest, root, 0.25, 7)
+	if err != nil {
+		t.Fatalf("VerifyManifest() error = %v", err)
+	}
+	corrupted := report.Checked[len(report.Checked)-1]
+	if err := os.WriteFile(filepath.Join(root, corrupted), []byte("corrupted"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt file: %v", err)
+	}
+
+	output, err = run(t, manifestFile, root, "--sample", "0.25", "--seed", "7")
+	if err == nil {
+		t.Fatal("rootCmd.Execute() expected error for corrupted sampled file")
+	}
+	if !strings.Contains(output, "modified: "+corrupted) {
+		t.Errorf("Output should report the corrupted file, got: %q", output)
+	}
+}
+
+func TestVerifyCmd_TOMLManifest(t *testing.T) {
+	jsonFile, root := writeManifest(t, 3)
+	data, err := os.ReadFile(jsonFile)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	manifest, err := merkle.ParseManifest(data, merkle.ManifestJSON)
+	if err != nil {
+		t.Fatalf("ParseManifest() error = %v", err)
+	}
+	manifestFile := filepath.Join(t.TempDir(), "tree.manifest.toml")
+	if err := os.WriteFile(manifestFile, manifest.EncodeTOML(), 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	output, err := run(t, manifestFile, root)
+	if err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	if !strings.Contains(output, "Verified 3 of 3 entries") {
+		t.Errorf("Output should report all entries verified, got: %q", output)
+	}
+}
+
+func TestVerifyCmd_ShardedManifest(t *testing.T) {
+	jsonFile, root := writeManifest(t, 12)
+	data, err := os.ReadFile(jsonFile)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	manifest, err := merkle.ParseManifest(data, merkle.ManifestJSON)
+	if err != nil {
+		t.Fatalf("ParseManifest() error = %v", err)
+	}
+	index, shards, err := manifest.Shard(1, "toml")
+	if err != nil {
+		t.Fatalf("Shard() error = %v", err)
+	}
+	shardDir := t.TempDir()
+	for _, s := range index.Shards {
+		if err := os.WriteFile(filepath.Join(shardDir, s.File), shards[s.Prefix].EncodeTOML(), 0644); err != nil {
+			t.Fatalf("Failed to write shard: %v", err)
+		}
+	}
+	indexData, err := json.Marshal(index)
+	if err != nil {
+		t.Fatalf("Failed to encode index: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(shardDir, merkle.ManifestIndexFile), indexData, 0644); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+
+	output, err := run(t, shardDir, root)
+	if err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	if !strings.Contains(output, "Verified 12 of 12 entries") {
+		t.Errorf("Output should report all entries verified, got: %q", output)
+	}
+
+	// A missing shard fails instead of silently verifying fewer entries
+	if err := os.Remove(filepath.Join(shardDir, index.Shards[0].File)); err != nil {
+		t.Fatalf("Failed to remove shard: %v", err)
+	}
+	if _, err := run(t, shardDir, root); err == nil {
+		t.Error("rootCmd.Execute() expected error for a missing shard")
+	}
+}
+
+func TestVerifyCmd_InvalidSample(t *testing.T) {
+	manifestFile, root := writeManifest(t, 2)
+	if _, err := run(t, manifestFile, root, "--sample", "2"); err == nil {
+		t.Error("rootCmd.Execute() expected error for sample fraction above 1")
+	}
+}
+
+// resetFlags restores all verify command flags to their defaults so that values
+// parsed by one test do not leak into the next.
+func resetFlags(t *testing.T) {
+	t.Helper()
+	verifyCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			if err := sv.Replace([]string{}); err != nil {
+				t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+			}
+		} else if err := f.Value.Set(f.DefValue); err != nil {
+			t.Errorf("Failed to reset flag %s: %v", f.Name, err)
+		}
+		f.Changed = false
+	})
+}
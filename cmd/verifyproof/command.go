@@ -0,0 +1,101 @@
+// Package verifyproof provides the "verify-proof" command for checking Merkle
+// inclusion proofs produced by the "prove" command.
+package verifyproof
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/spf13/cobra"
+)
+
+// verifyProofCmd represents the verify-proof command for checking inclusion proofs.
+var verifyProofCmd = &cobra.Command{
+	Use:   "verify-proof [proof-file] [file]",
+	Short: "Verify a Merkle inclusion proof",
+	Long: `Verify a Merkle inclusion proof.
+Recomputes the root hash from the proof's leaf and sibling hashes and checks it against the
+root recorded in the proof. If a file is given, its hash must match the proof's leaf. Use
+--root to require the proof to be anchored to a trusted root hash.
+A valid proof shows that the leaf hash is part of the root. Directory hashes do not cover
+entry names, so the path recorded in the proof is not verified: the same contents at another
+path of the tree would verify as well.
+Exits with code 0 if the proof is valid, non-zero otherwise.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		proofFile := args[0]
+		log := logger.WithOperation("verify_proof", "proof", proofFile, "command", "verify-proof")
+
+		expectedRoot, err := cmd.Flags().GetString("root")
+		if err != nil {
+			log.Warn("Failed to read root flag", "error", err)
+			expectedRoot = ""
+		}
+
+		data, err := os.ReadFile(filepath.Clean(proofFile))
+		if err != nil {
+			log.Error("Failed to read proof file", "error", err)
+			return fmt.Errorf("failed to read proof file %s: %w", proofFile, err)
+		}
+		var proof merkle.Proof
+		if err := json.Unmarshal(data, &proof); err != nil {
+			log.Error("Failed to parse proof file", "error", err)
+			return fmt.Errorf("failed to parse proof file %s: %w", proofFile, err)
+		}
+
+		if expectedRoot != "" {
+			if _, err := hex.DecodeString(expectedRoot); err != nil {
+				return fmt.Errorf("invalid hash format: %q (expected hexadecimal string): %w", expectedRoot, err)
+			}
+			if !strings.EqualFold(expectedRoot, proof.Root) {
+				log.Error("Proof root mismatch", "proof_root", proof.Root, "expected_root", expectedRoot)
+				return fmt.Errorf("proof root %s does not match expected root %s", proof.Root, expectedRoot)
+			}
+		}
+
+		if len(args) == 2 {
+			algorithm, err := merkle.ParseAlgorithm(proof.Algorithm)
+			if err != nil {
+				log.Error("Invalid proof algorithm", "error", err)
+				return fmt.Errorf("invalid proof file %s: %w", proofFile, err)
+			}
+			engine := merkle.NewEngine()
+			engine.SetAlgorithm(algorithm)
+			leaf, err := engine.HashPath(args[1])
+			if err != nil {
+				log.Error("Failed to hash file", "error", err)
+				return err
+			}
+			if hex.EncodeToString(leaf.Hash) != strings.ToLower(proof.Leaf) {
+				log.Error("Leaf mismatch", "computed", fmt.Sprintf("%x", leaf.Hash), "proof_leaf", proof.Leaf)
+				return fmt.Errorf("file %s does not match proof leaf: computed %x, expected %s", args[1], leaf.Hash, proof.Leaf)
+			}
+		}
+
+		if err := merkle.VerifyProof(&proof); err != nil {
+			log.Error("Proof verification failed", "error", err)
+			return fmt.Errorf("invalid proof: %w", err)
+		}
+
+		log.Info("Proof verified", "root", proof.Root, "path", proof.Path)
+		if _, err := fmt.Fprintf(cmd.OutOrStdout(), "Proof valid: leaf %s is included in root %s (path %s not verified)\n", proof.Leaf, proof.Root, proof.Path); err != nil {
+			log.Error("Failed to write output to stdout", "error", err)
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	verifyProofCmd.Flags().String("root", "", "Trusted root hash the proof must be anchored to")
+
+	cmd.Register(verifyProofCmd)
+}
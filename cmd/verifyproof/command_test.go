@@ -0,0 +1,141 @@
+package verifyproof
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+)
+
+func init() {
+	// Silence logger during tests - only show errors
+	logger.Init("error", "text", io.Discard)
+}
+
+// writeProof builds a tree with a nested file, writes a proof for it and
+// returns the proof file path, the proven file and the proof.
+func writeProof(t *testing.T) (string, string, *merkle.Proof) {
+	t.Helper()
+	return writeProofWith(t, merkle.AlgorithmBLAKE3)
+}
+
+// writeProofWith is writeProof with a proof made using the given algorithm.
+func writeProofWith(t *testing.T, algorithm merkle.Algorithm) (string, string, *merkle.Proof) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "root")
+	nested := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("Failed to create nested directories: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sibling.txt"), []byte("sibling"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	target := filepath.Join(nested, "file.txt")
+	if err := os.WriteFile(target, []byte("proven content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	engine := merkle.NewEngine()
+	engine.SetAlgorithm(algorithm)
+	proof, err := engine.Prove(root, target)
+	if err != nil {
+		t.Fatalf("Prove() error = %v", err)
+	}
+	data, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatalf("Failed to encode proof: %v", err)
+	}
+	proofFile := filepath.Join(tmpDir, "proof.json")
+	if err := os.WriteFile(proofFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write proof: %v", err)
+	}
+	return proofFile, target, proof
+}
+
+func TestVerifyProofCmd_Valid(t *testing.T) {
+	proofFile, target, proof := writeProof(t)
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"verify-proof", proofFile, target, "--root", proof.Root})
+	t.Cleanup(func() { _ = verifyProofCmd.Flags().Set("root", "") })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "Proof valid: leaf "+proof.Leaf+" is included in root "+proof.Root) {
+		t.Errorf("Output should report a valid proof, got: %q", buf.String())
+	}
+	if !strings.Contains(buf.String(), "(path a/b/file.txt not verified)") {
+		t.Errorf("Output should say the path is not verified, got: %q", buf.String())
+	}
+}
+
+func TestVerifyProofCmd_Algorithm(t *testing.T) {
+	proofFile, target, proof := writeProofWith(t, merkle.AlgorithmSHA256)
+	if proof.Algorithm != string(merkle.AlgorithmSHA256) {
+		t.Fatalf("proof.Algorithm = %q, want %q", proof.Algorithm, merkle.AlgorithmSHA256)
+	}
+
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"verify-proof", proofFile, target})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "Proof valid: leaf "+proof.Leaf+" is included in root "+proof.Root) {
+		t.Errorf("Output should report a valid proof, got: %q", buf.String())
+	}
+}
+
+func TestVerifyProofCmd_Invalid(t *testing.T) {
+	proofFile, target, proof := writeProof(t)
+
+	t.Run("different file", func(t *testing.T) {
+		other := filepath.Join(t.TempDir(), "other.txt")
+		if err := os.WriteFile(other, []byte("other content"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		rootCmd := cmd.GetRootCmd()
+		rootCmd.SetArgs([]string{"verify-proof", proofFile, other})
+		if err := rootCmd.Execute(); err == nil {
+			t.Error("rootCmd.Execute() expected error for file not matching the leaf")
+		}
+	})
+
+	t.Run("untrusted root", func(t *testing.T) {
+		rootCmd := cmd.GetRootCmd()
+		rootCmd.SetArgs([]string{"verify-proof", proofFile, target, "--root", strings.Repeat("00", merkle.HashSize)})
+		t.Cleanup(func() { _ = verifyProofCmd.Flags().Set("root", "") })
+		if err := rootCmd.Execute(); err == nil {
+			t.Error("rootCmd.Execute() expected error for root mismatch")
+		}
+	})
+
+	t.Run("tampered sibling", func(t *testing.T) {
+		proof.Steps[len(proof.Steps)-1].After = []string{strings.Repeat("11", merkle.HashSize)}
+		data, err := json.Marshal(proof)
+		if err != nil {
+			t.Fatalf("Failed to encode proof: %v", err)
+		}
+		tamperedFile := filepath.Join(t.TempDir(), "tampered.json")
+		if err := os.WriteFile(tamperedFile, data, 0644); err != nil {
+			t.Fatalf("Failed to write proof: %v", err)
+		}
+		rootCmd := cmd.GetRootCmd()
+		rootCmd.SetArgs([]string{"verify-proof", tamperedFile, target})
+		if err := rootCmd.Execute(); err == nil {
+			t.Error("rootCmd.Execute() expected error for tampered proof")
+		}
+	})
+}
@@ -0,0 +1,77 @@
+// Package version provides the "version" command for printing build information,
+// as a human-readable line or as JSON for recording the exact binary used.
+package version
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+	buildinfo "github.com/lucho00cuba/mtc/version"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/spf13/cobra"
+)
+
+// marshalJSON encodes the --json output according to --pretty. It is bound here because the
+// cmd package is shadowed by the command parameter inside RunE.
+var marshalJSON = cmd.MarshalJSON
+
+// versionInfo is the build information printed by --json.
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+}
+
+// versionCmd represents the version command for printing build information.
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version, commit and build date of mtc",
+	Long: `Print the version, commit and build date of mtc.
+Without flags, prints the same line as "mtc --version". With --json, prints a JSON object
+with the version, commit, build date and the Go version the binary was built with, so CI
+can record exactly which binary produced a hash.`,
+	Example: `  # Record the binary used by a CI job
+  mtc version --json > mtc-version.json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log := logger.WithOperation("version", "command", "version")
+
+		asJSON, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			log.Warn("Failed to read json flag", "error", err)
+			asJSON = false
+		}
+
+		if !asJSON {
+			if _, err := fmt.Fprintf(cmd.OutOrStdout(), "mtc %s (%s) %s\n", buildinfo.VERSION, buildinfo.COMMIT, buildinfo.DATE); err != nil {
+				log.Error("Failed to write output to stdout", "error", err)
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			return nil
+		}
+
+		data, err := marshalJSON(versionInfo{
+			Version:   buildinfo.VERSION,
+			Commit:    buildinfo.COMMIT,
+			Date:      buildinfo.DATE,
+			GoVersion: runtime.Version(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode version: %w", err)
+		}
+		if _, err := cmd.OutOrStdout().Write(append(data, '\n')); err != nil {
+			log.Error("Failed to write output to stdout", "error", err)
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	versionCmd.Flags().Bool("json", false, "Print a JSON object with the version, commit, build date and Go version")
+
+	cmd.Register(versionCmd)
+}
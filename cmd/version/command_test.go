@@ -0,0 +1,67 @@
+package version
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/lucho00cuba/mtc/cmd"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	buildinfo "github.com/lucho00cuba/mtc/version"
+)
+
+func init() {
+	// Silence logger during tests - only show errors
+	logger.Init("error", "text", io.Discard)
+}
+
+func TestVersionCmd(t *testing.T) {
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"version"})
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+	if want := "mtc " + buildinfo.VERSION + " (" + buildinfo.COMMIT + ") " + buildinfo.DATE + "\n"; buf.String() != want {
+		t.Errorf("Output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestVersionCmd_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	rootCmd := cmd.GetRootCmd()
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"version", "--json"})
+	t.Cleanup(func() {
+		if err := versionCmd.Flags().Set("json", "false"); err != nil {
+			t.Errorf("Failed to reset json flag: %v", err)
+		}
+	})
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rootCmd.Execute() error = %v", err)
+	}
+
+	var got map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Output is not a JSON object of strings: %v\n%s", err, buf.String())
+	}
+	want := map[string]string{
+		"version":    buildinfo.VERSION,
+		"commit":     buildinfo.COMMIT,
+		"date":       buildinfo.DATE,
+		"go_version": runtime.Version(),
+	}
+	if len(got) != len(want) {
+		t.Errorf("Output fields = %v, want exactly %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("Output %s = %q, want %q", key, got[key], value)
+		}
+	}
+}
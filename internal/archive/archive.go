@@ -0,0 +1,327 @@
+// Package archive provides read-only access to the tree stored in a tar archive, optionally
+// gzip-compressed, as an fs.FS. The archive is read once and its contents are held in
+// memory, so it can be hashed with merkle.Engine.HashFS and compared against a directory
+// on disk without being extracted.
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// gzipMagic are the first bytes of a gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// IsArchive reports whether path names a tar archive, judging by its extension:
+// .tar, .tar.gz or .tgz.
+func IsArchive(path string) bool {
+	name := strings.ToLower(path)
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// FS is the tree stored in a tar archive. Directories that are not recorded in the
+// archive but hold recorded entries are implied, as when the archive is extracted.
+// Directory listings are sorted by name whatever order the members were written in, so
+// archives of the same files hash alike. It implements fs.ReadDirFS, fs.StatFS and
+// ReadLink, so symlinks can be hashed.
+type FS struct {
+	nodes map[string]*node
+}
+
+// node is a file, directory, symlink or special file of an FS.
+type node struct {
+	name    string
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte
+	target  string
+	// children lists the names of a directory's entries, sorted
+	children []string
+}
+
+// Open reads the tar archive at path, decompressing it if it is gzip-compressed.
+//
+// Parameters:
+//   - path: The path of the archive
+//
+// Returns the archive's tree, or an error if it cannot be read or is not a valid tar archive.
+func Open(path string) (*FS, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive %q: %w", path, err)
+	}
+	defer f.Close()
+
+	fsys, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %q: %w", path, err)
+	}
+	return fsys, nil
+}
+
+// Read reads a tar archive from r, decompressing it if it is gzip-compressed.
+//
+// Parameters:
+//   - r: The archive contents
+//
+// Returns the archive's tree, or an error if it is not a valid tar archive, or an entry
+// escapes the archive root or is a hard link to a missing file.
+func Read(r io.Reader) (*FS, error) {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if magic, err := br.Peek(len(gzipMagic)); err == nil && bytes.Equal(magic, gzipMagic) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress: %w", err)
+		}
+		defer zr.Close()
+		src = zr
+	}
+
+	fsys := &FS{nodes: map[string]*node{
+		".": {name: ".", mode: fs.ModeDir | 0755},
+	}}
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := fsys.add(hdr, tr); err != nil {
+			return nil, err
+		}
+	}
+	fsys.link()
+	return fsys, nil
+}
+
+// cleanName converts the name of a tar entry to an fs.FS path: "./dir/file", "/dir/file"
+// and "dir/file" all become "dir/file", and the root itself becomes ".".
+func cleanName(name string) (string, error) {
+	clean := path.Clean(strings.TrimLeft(name, "/"))
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("entry %q escapes the archive root", name)
+	}
+	return clean, nil
+}
+
+// add records the entry described by hdr, reading its contents from r. A later entry
+// with the same name replaces an earlier one, as when the archive is extracted.
+func (fsys *FS) add(hdr *tar.Header, r io.Reader) error {
+	name, err := cleanName(hdr.Name)
+	if err != nil {
+		return err
+	}
+	n := &node{name: name, modTime: hdr.ModTime}
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		n.mode = fs.ModeDir | 0755
+	case tar.TypeSymlink:
+		n.mode = fs.ModeSymlink | 0777
+		n.target = hdr.Linkname
+	case tar.TypeLink:
+		targetName, err := cleanName(hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		target, ok := fsys.nodes[targetName]
+		if !ok || !target.mode.IsRegular() {
+			return fmt.Errorf("hard link %q points to missing file %q", hdr.Name, hdr.Linkname)
+		}
+		n.mode = target.mode
+		n.data = target.data
+	case tar.TypeChar:
+		n.mode = fs.ModeDevice | fs.ModeCharDevice
+	case tar.TypeBlock:
+		n.mode = fs.ModeDevice
+	case tar.TypeFifo:
+		n.mode = fs.ModeNamedPipe
+	case tar.TypeReg, tar.TypeGNUSparse:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("failed to read entry %q: %w", hdr.Name, err)
+		}
+		n.mode = 0644
+		n.data = data
+	default:
+		// Metadata-only entries, such as global PAX headers, hold no file
+		return nil
+	}
+	if name == "." {
+		if !n.mode.IsDir() {
+			return fmt.Errorf("entry %q replaces the archive root", hdr.Name)
+		}
+		return nil
+	}
+	fsys.nodes[name] = n
+
+	// Imply the parent directories, replacing anything else recorded under their names
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if parent, ok := fsys.nodes[dir]; ok && parent.mode.IsDir() {
+			break
+		}
+		fsys.nodes[dir] = &node{name: dir, mode: fs.ModeDir | 0755}
+	}
+	return nil
+}
+
+// link fills the children of every directory once all entries are recorded. Entries
+// whose parent was later replaced by a non-directory are dropped.
+func (fsys *FS) link() {
+	for name := range fsys.nodes {
+		if name == "." {
+			continue
+		}
+		parent := fsys.nodes[path.Dir(name)]
+		if parent != nil && parent.mode.IsDir() {
+			parent.children = append(parent.children, path.Base(name))
+		}
+	}
+	for _, n := range fsys.nodes {
+		sort.Strings(n.children)
+	}
+}
+
+// lookup returns the node named name, or an fs.PathError for op if there is none.
+func (fsys *FS) lookup(op, name string) (*node, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	n, ok := fsys.nodes[name]
+	if !ok || !fsys.reachable(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return n, nil
+}
+
+// reachable reports whether every parent of name is a directory.
+func (fsys *FS) reachable(name string) bool {
+	for dir := path.Dir(name); name != "." && dir != "."; dir = path.Dir(dir) {
+		if n, ok := fsys.nodes[dir]; !ok || !n.mode.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// Open opens the named file, directory or special file. Symlinks are not followed.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	n, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.mode.IsDir() {
+		entries, err := fsys.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &openDir{node: n, entries: entries}, nil
+	}
+	return &openFile{node: n, Reader: bytes.NewReader(n.data)}, nil
+}
+
+// Stat returns the information of the named entry, without following symlinks.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	n, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{n}, nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by name.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries := make([]fs.DirEntry, 0, len(n.children))
+	for _, child := range n.children {
+		entries = append(entries, fs.FileInfoToDirEntry(fileInfo{fsys.nodes[path.Join(name, child)]}))
+	}
+	return entries, nil
+}
+
+// ReadLink returns the target of the named symlink.
+func (fsys *FS) ReadLink(name string) (string, error) {
+	n, err := fsys.lookup("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	if n.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return n.target, nil
+}
+
+// fileInfo describes a node.
+type fileInfo struct {
+	n *node
+}
+
+func (fi fileInfo) Name() string       { return path.Base(fi.n.name) }
+func (fi fileInfo) Size() int64        { return int64(len(fi.n.data)) }
+func (fi fileInfo) Mode() fs.FileMode  { return fi.n.mode }
+func (fi fileInfo) ModTime() time.Time { return fi.n.modTime }
+func (fi fileInfo) IsDir() bool        { return fi.n.mode.IsDir() }
+func (fi fileInfo) Sys() any           { return nil }
+
+// openFile is an open file or special file.
+type openFile struct {
+	node *node
+	*bytes.Reader
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) { return fileInfo{f.node}, nil }
+func (f *openFile) Close() error               { return nil }
+
+// openDir is an open directory.
+type openDir struct {
+	node    *node
+	entries []fs.DirEntry
+}
+
+func (d *openDir) Stat() (fs.FileInfo, error) { return fileInfo{d.node}, nil }
+func (d *openDir) Close() error               { return nil }
+
+func (d *openDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir returns the next n entries of the directory, or all remaining ones if n <= 0.
+func (d *openDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,126 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// entry is a tar entry written by buildTar.
+type entry struct {
+	name     string
+	typeflag byte
+	body     string
+	linkname string
+}
+
+// buildTar writes the given entries as a tar archive, gzip-compressed if compress is set.
+func buildTar(t *testing.T, entries []entry, compress bool) []byte {
+	t.Helper()
+	var raw bytes.Buffer
+	tw := tar.NewWriter(&raw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.linkname, Mode: 0644, Size: int64(len(e.body))}
+		if e.typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("Failed to write header %q: %v", e.name, err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatalf("Failed to write body %q: %v", e.name, err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to close tar writer: %v", err)
+	}
+	if !compress {
+		return raw.Bytes()
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write(raw.Bytes()); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close gzip writer: %v", err)
+	}
+	return gz.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	entries := []entry{
+		{name: "./", typeflag: tar.TypeDir},
+		{name: "./src/", typeflag: tar.TypeDir},
+		{name: "./src/main.go", typeflag: tar.TypeReg, body: "package main"},
+		{name: "docs/readme.md", typeflag: tar.TypeReg, body: "# docs"},
+		{name: "./link", typeflag: tar.TypeSymlink, linkname: "src/main.go"},
+		{name: "./hard", typeflag: tar.TypeLink, linkname: "./src/main.go"},
+		{name: "./pipe", typeflag: tar.TypeFifo},
+	}
+
+	for _, compress := range []bool{false, true} {
+		fsys, err := Read(bytes.NewReader(buildTar(t, entries, compress)))
+		if err != nil {
+			t.Fatalf("Read(compress=%v) error = %v", compress, err)
+		}
+		if err := fstest.TestFS(fsys, "src/main.go", "docs/readme.md", "hard", "link", "pipe"); err != nil {
+			t.Errorf("TestFS(compress=%v) error = %v", compress, err)
+		}
+
+		data, err := fs.ReadFile(fsys, "hard")
+		if err != nil || string(data) != "package main" {
+			t.Errorf("Hard link contents = %q, %v; want the linked file's", data, err)
+		}
+		target, err := fsys.ReadLink("link")
+		if err != nil || target != "src/main.go" {
+			t.Errorf("ReadLink(link) = %q, %v; want src/main.go", target, err)
+		}
+		info, err := fsys.Stat("pipe")
+		if err != nil || info.Mode().Type() != fs.ModeNamedPipe {
+			t.Errorf("Stat(pipe) = %v, %v; want a named pipe", info, err)
+		}
+	}
+}
+
+func TestRead_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []entry
+	}{
+		{name: "escaping entry", entries: []entry{{name: "../evil", typeflag: tar.TypeReg, body: "x"}}},
+		{name: "dangling hard link", entries: []entry{{name: "hard", typeflag: tar.TypeLink, linkname: "missing"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(bytes.NewReader(buildTar(t, tt.entries, false))); err == nil {
+				t.Error("Read() expected error")
+			}
+		})
+	}
+
+	if _, err := Read(bytes.NewReader([]byte("not a tar archive"))); err == nil {
+		t.Error("Read() expected error for invalid data")
+	}
+}
+
+func TestIsArchive(t *testing.T) {
+	for name, want := range map[string]bool{
+		"src.tar":     true,
+		"src.tar.gz":  true,
+		"SRC.TGZ":     true,
+		"src.zip":     false,
+		"src":         false,
+		"tarball.txt": false,
+	} {
+		if got := IsArchive(name); got != want {
+			t.Errorf("IsArchive(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
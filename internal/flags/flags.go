@@ -0,0 +1,685 @@
+// Package flags provides the command-line flags shared by every command that
+// computes Merkle roots. Registering the same set on each command ensures a hash
+// produced by one command can be reproduced and verified by another.
+package flags
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lucho00cuba/mtc/internal/ignore"
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+	"github.com/lucho00cuba/mtc/internal/units"
+	"github.com/spf13/cobra"
+)
+
+// AddHashing registers the flags that control how paths are hashed on the given command.
+// Most of them change the resulting root; performance flags such as --max-read-rate do not.
+//
+// Parameters:
+//   - c: The command to register the flags on
+func AddHashing(c *cobra.Command) {
+	c.Flags().String("algorithm", string(merkle.AlgorithmBLAKE3), "Node hash algorithm: blake3, sha256, sha3-256 or sha3-512. Used for every file and directory node. Changes the root hash.")
+	c.Flags().Bool("text-only", false, "Only hash text files (files without NUL bytes in their first 512 bytes). Changes the root hash.")
+	c.Flags().Bool("binary-only", false, "Only hash binary files (files with NUL bytes in their first 512 bytes). Changes the root hash.")
+	c.MarkFlagsMutuallyExclusive("text-only", "binary-only")
+	c.Flags().Bool("include-xattr", false, "Include each file's extended attributes (sorted name=value pairs) in its hash (Linux only). Changes the root hash.")
+	c.Flags().Bool("include-hardlinks", false, "Include the hardlink structure in the hash: files sharing an inode within the tree are marked with their link group, so trees differing only in which files are hardlinked hash differently (Unix only). Changes the root hash if hardlinks are present.")
+	c.Flags().Bool("one-filesystem", false, "Do not descend into directories on other filesystems, such as /proc or network mounts (Unix only). Changes the root hash if mount points are skipped.")
+	c.Flags().String("ignore-precedence", "", "Comma-separated pattern sources in priority order, highest first (custom, cli, mtcignore, gitignore; unlisted ones follow in that order). The highest-priority source with a matching pattern decides, so its negations can re-include paths other sources exclude and vice versa. Changes the root hash if decisions change.")
+	c.Flags().Bool("dockerignore", false, "Also exclude paths matched by the .dockerignore file in the hashed directory, with Docker's semantics (patterns anchored at that directory, last match wins). Changes the root hash if paths are excluded.")
+	c.Flags().Bool("resolve-root", true, "If the path argument is itself a symlink, hash the tree it points to. With --resolve-root=false, it is hashed as a leaf holding its target string (size 0). Symlinks inside the tree are never followed.")
+	c.Flags().Bool("resolve-root-realpath", false, "Check that hashed files are inside the root by comparing real paths (all symlinks resolved), so a root reached through a symlinked path, such as /tmp on macOS, does not reject its own files. Does not change the root hash.")
+	c.Flags().Bool("strict-case", false, "Fail when a directory holds entries whose names differ only by case (e.g. File.txt and file.txt), which cannot coexist on macOS or Windows. Without it, such collisions are only logged as warnings.")
+	c.Flags().Int("entries-limit", 0, "Fail when a single directory holds more than this many entries, protecting against pathological trees. 0 means unlimited.")
+	c.Flags().Bool("truncate", false, "With --entries-limit, warn and hash only the first entries of an oversized directory, in sorted order, instead of failing. Changes the root hash if a directory is truncated.")
+	c.Flags().Int("exclude-deeper-than", 0, "Exclude every entry nested more than this many levels below the root (its direct children are at depth 1). Directories at the limit are hashed without their contents. 0 means no limit. Changes the root hash of deeper trees.")
+	c.Flags().Bool("exclude-empty-files", false, "Skip zero-byte files (placeholders such as .gitkeep) inside directories. Changes the root hash if empty files are present.")
+	c.Flags().StringArray("exclude-size", []string{}, "Skip files inside directories whose size matches a condition such as '>100M' or '<=1K' (operators >, >=, <, <=, =). Can be specified multiple times; a file matching any condition is skipped. Changes the root hash if matching files are present.")
+	c.Flags().StringArray("marker-dir", []string{}, "Hash directories with this name (e.g. .git) as a marker noting their presence, without reading their contents, so churn inside them does not change the root. Can be specified multiple times. Changes the root hash if such directories are present.")
+	c.Flags().Bool("structure-only", false, "Hash only the tree's structure (entry names, types and symlink targets), not file contents, to detect layout changes independently of edits. Changes the root hash.")
+	c.Flags().Bool("recursive", true, "Descend into subdirectories. With --recursive=false, subdirectories are hashed by name only, fingerprinting just the top-level layout and files. Changes the root hash.")
+	c.Flags().Bool("normalize-unicode", false, "Order entries by the Unicode NFC form of their names so trees from macOS (NFD) and Linux (NFC) hash identically. May change the root hash.")
+	c.Flags().String("chunk-size", "0", "Split files larger than this size (e.g. 4M) into fixed-size chunks hashed separately; the file hash becomes the hash of its chunk hashes. 0 disables chunking. Changes the root hash.")
+	c.Flags().String("hasher-cmd", "", "Hash file contents with this shell command instead of BLAKE3: each file is piped to its stdin and the hex digest it prints becomes the leaf hash (e.g. 'sha256sum'). Runs with your privileges on every file; only use trusted programs. Changes the root hash.")
+	c.Flags().String("byte-budget", "0", "Stop reading file contents once this many bytes (e.g. 10G) have been read; later files, in sorted order, are hashed from their name and size. 0 means unlimited. Changes the root hash once exceeded.")
+	c.Flags().String("head-bytes", "0", "Quick fingerprint: hash only the first this many bytes (e.g. 64K) of each larger file, plus its size. Smaller files are hashed in full. Not an integrity check: changes past the head go unnoticed. 0 hashes whole files. Changes the root hash.")
+	c.Flags().Bool("follow-symlinks", false, "Hash symlinks to files and directories as what they point to instead of as their target path, so a link and a copy of its target hash alike. Dangling links are still hashed as links. Changes the root hash if symlinks are present.")
+	c.Flags().Bool("no-symlinks", false, "Fail if the tree holds any symlink, for archival hashes free of symlink ambiguity across platforms. Resolve or exclude links to hash such a tree. Does not change the root hash.")
+	c.Flags().Bool("deterministic-symlink-content", false, "Hash each symlink from the absolute real path it finally resolves to, following the whole chain of links, instead of its target as stored, so links reaching the same file hash alike. Contents are not read. Changes the root hash if symlinks are present.")
+	c.MarkFlagsMutuallyExclusive("follow-symlinks", "no-symlinks", "deterministic-symlink-content")
+	c.Flags().Bool("ignore-vanished", false, "Leave out files and directories removed while the tree is walked, with a warning, instead of failing. Useful on live trees; the root reflects the tree without them.")
+	c.Flags().Bool("strip-bom", false, "Skip a leading UTF-8 byte order mark of text files (no NUL byte in their first 512 bytes) before hashing, so files differing only by a BOM hash alike. Binary files are hashed unchanged. Changes the root hash if such files are present.")
+	c.Flags().String("max-read-rate", "0", "Limit total read bandwidth in bytes per second, accepting K, M, G and T suffixes (e.g. 50M). 0 means unlimited.")
+	c.Flags().Int("limit-open-files", 0, "Hold at most this many files and directories open at once while hashing, independently of the worker count, to stay under the system's descriptor limit. 0 uses half the soft open files limit (ulimit -n) where it is known. Does not change the root hash.")
+	c.Flags().Bool("low-memory", false, "Write each entry's hash straight into its directory's hash instead of collecting a directory's results first, lowering peak memory on huge directories. Only applies without --workers-per-level. Does not change the root hash.")
+	c.Flags().Bool("workers-per-level", false, "Hash subdirectories as well as files concurrently, sharing the worker budget across every level of the tree (adaptive scheduling). Speeds up deep trees without changing the root hash.")
+}
+
+// ApplyHashing configures an engine from the flags registered by AddHashing.
+//
+// Parameters:
+//   - c: The command whose flags were parsed
+//   - engine: The engine to configure
+//
+// Returns an error if a flag value is invalid.
+func ApplyHashing(c *cobra.Command, engine *merkle.Engine) error {
+	log := logger.WithOperation("apply_flags", "command", c.Name())
+
+	algorithm, err := Algorithm(c)
+	if err != nil {
+		return err
+	}
+	engine.SetAlgorithm(algorithm)
+
+	textOnly, err := c.Flags().GetBool("text-only")
+	if err != nil {
+		log.Warn("Failed to read text-only flag", "error", err)
+		textOnly = false
+	}
+	binaryOnly, err := c.Flags().GetBool("binary-only")
+	if err != nil {
+		log.Warn("Failed to read binary-only flag", "error", err)
+		binaryOnly = false
+	}
+
+	includeXattr, err := c.Flags().GetBool("include-xattr")
+	if err != nil {
+		log.Warn("Failed to read include-xattr flag", "error", err)
+		includeXattr = false
+	}
+
+	switch {
+	case textOnly && binaryOnly:
+		return fmt.Errorf("--text-only and --binary-only cannot be used together")
+	case textOnly:
+		engine.SetContentClass(merkle.ContentTextOnly)
+	case binaryOnly:
+		engine.SetContentClass(merkle.ContentBinaryOnly)
+	}
+
+	if err := engine.SetIncludeXattr(includeXattr); err != nil {
+		return fmt.Errorf("--include-xattr: %w", err)
+	}
+
+	includeHardlinks, err := c.Flags().GetBool("include-hardlinks")
+	if err != nil {
+		log.Warn("Failed to read include-hardlinks flag", "error", err)
+		includeHardlinks = false
+	}
+	if err := engine.SetIncludeHardlinks(includeHardlinks); err != nil {
+		return fmt.Errorf("--include-hardlinks: %w", err)
+	}
+
+	oneFilesystem, err := c.Flags().GetBool("one-filesystem")
+	if err != nil {
+		log.Warn("Failed to read one-filesystem flag", "error", err)
+		oneFilesystem = false
+	}
+	if err := engine.SetOneFilesystem(oneFilesystem); err != nil {
+		return fmt.Errorf("--one-filesystem: %w", err)
+	}
+
+	ignorePrecedence, err := c.Flags().GetString("ignore-precedence")
+	if err != nil {
+		log.Warn("Failed to read ignore-precedence flag", "error", err)
+		ignorePrecedence = ""
+	}
+	precedence, err := ignore.ParsePrecedence(ignorePrecedence)
+	if err != nil {
+		return fmt.Errorf("--ignore-precedence: %w", err)
+	}
+	if precedence != nil {
+		if err := engine.SetIgnorePrecedence(precedence); err != nil {
+			return fmt.Errorf("--ignore-precedence: %w", err)
+		}
+	}
+
+	dockerignore, err := c.Flags().GetBool("dockerignore")
+	if err != nil {
+		log.Warn("Failed to read dockerignore flag", "error", err)
+		dockerignore = false
+	}
+	if err := engine.SetDockerignore(dockerignore); err != nil {
+		return fmt.Errorf("--dockerignore: %w", err)
+	}
+
+	strictCase, err := c.Flags().GetBool("strict-case")
+	if err != nil {
+		log.Warn("Failed to read strict-case flag", "error", err)
+		strictCase = false
+	}
+	engine.SetStrictCase(strictCase)
+
+	entriesLimit, err := c.Flags().GetInt("entries-limit")
+	if err != nil {
+		log.Warn("Failed to read entries-limit flag", "error", err)
+		entriesLimit = 0
+	}
+	if entriesLimit < 0 {
+		return fmt.Errorf("--entries-limit must not be negative, got %d", entriesLimit)
+	}
+	truncate, err := c.Flags().GetBool("truncate")
+	if err != nil {
+		log.Warn("Failed to read truncate flag", "error", err)
+		truncate = false
+	}
+	if truncate && entriesLimit == 0 {
+		return fmt.Errorf("--truncate requires --entries-limit")
+	}
+	engine.SetEntriesLimit(entriesLimit, truncate)
+
+	resolveRoot, err := c.Flags().GetBool("resolve-root")
+	if err != nil {
+		log.Warn("Failed to read resolve-root flag", "error", err)
+		resolveRoot = true
+	}
+	engine.SetResolveRoot(resolveRoot)
+
+	resolveRootRealpath, err := c.Flags().GetBool("resolve-root-realpath")
+	if err != nil {
+		log.Warn("Failed to read resolve-root-realpath flag", "error", err)
+		resolveRootRealpath = false
+	}
+	engine.SetResolveRootRealpath(resolveRootRealpath)
+
+	excludeDeeperThan, err := c.Flags().GetInt("exclude-deeper-than")
+	if err != nil {
+		log.Warn("Failed to read exclude-deeper-than flag", "error", err)
+		excludeDeeperThan = 0
+	}
+	if excludeDeeperThan < 0 {
+		return fmt.Errorf("--exclude-deeper-than must not be negative, got %d", excludeDeeperThan)
+	}
+	engine.SetExcludeDeeperThan(excludeDeeperThan)
+
+	excludeEmptyFiles, err := c.Flags().GetBool("exclude-empty-files")
+	if err != nil {
+		log.Warn("Failed to read exclude-empty-files flag", "error", err)
+		excludeEmptyFiles = false
+	}
+	engine.SetExcludeEmptyFiles(excludeEmptyFiles)
+
+	excludeSize, err := c.Flags().GetStringArray("exclude-size")
+	if err != nil {
+		log.Warn("Failed to read exclude-size flag", "error", err)
+		excludeSize = nil
+	}
+	var sizeRules []ignore.SizeRule
+	for _, value := range excludeSize {
+		rule, err := ignore.ParseSizeRule(value)
+		if err != nil {
+			return fmt.Errorf("--exclude-size: %w", err)
+		}
+		sizeRules = append(sizeRules, rule)
+	}
+	engine.SetExcludeSize(sizeRules)
+
+	markerDirs, err := c.Flags().GetStringArray("marker-dir")
+	if err != nil {
+		log.Warn("Failed to read marker-dir flag", "error", err)
+		markerDirs = nil
+	}
+	for _, name := range markerDirs {
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("--marker-dir: %q is not a directory name", name)
+		}
+	}
+	engine.SetMarkerDirs(markerDirs)
+
+	structureOnly, err := c.Flags().GetBool("structure-only")
+	if err != nil {
+		log.Warn("Failed to read structure-only flag", "error", err)
+		structureOnly = false
+	}
+	engine.SetStructureOnly(structureOnly)
+
+	recursive, err := c.Flags().GetBool("recursive")
+	if err != nil {
+		log.Warn("Failed to read recursive flag", "error", err)
+		recursive = true
+	}
+	engine.SetRecursive(recursive)
+
+	normalizeUnicode, err := c.Flags().GetBool("normalize-unicode")
+	if err != nil {
+		log.Warn("Failed to read normalize-unicode flag", "error", err)
+		normalizeUnicode = false
+	}
+	engine.SetNormalizeUnicode(normalizeUnicode)
+
+	chunkSize, err := c.Flags().GetString("chunk-size")
+	if err != nil {
+		log.Warn("Failed to read chunk-size flag", "error", err)
+		chunkSize = "0"
+	}
+	chunkBytes, err := units.ParseSize(chunkSize)
+	if err != nil {
+		return fmt.Errorf("--chunk-size: %w", err)
+	}
+	engine.SetChunkSize(chunkBytes)
+
+	hasherCmd, err := c.Flags().GetString("hasher-cmd")
+	if err != nil {
+		log.Warn("Failed to read hasher-cmd flag", "error", err)
+		hasherCmd = ""
+	}
+	if hasherCmd != "" {
+		if chunkBytes > 0 {
+			return fmt.Errorf("--hasher-cmd cannot be used with --chunk-size")
+		}
+		if includeXattr {
+			return fmt.Errorf("--hasher-cmd cannot be used with --include-xattr")
+		}
+		log.Warn("Hashing file contents with an external command", "hasher_cmd", hasherCmd)
+	}
+	engine.SetHasherCmd(hasherCmd)
+
+	byteBudget, err := c.Flags().GetString("byte-budget")
+	if err != nil {
+		log.Warn("Failed to read byte-budget flag", "error", err)
+		byteBudget = "0"
+	}
+	budget, err := units.ParseSize(byteBudget)
+	if err != nil {
+		return fmt.Errorf("--byte-budget: %w", err)
+	}
+	engine.SetByteBudget(budget)
+
+	headBytesFlag, err := c.Flags().GetString("head-bytes")
+	if err != nil {
+		log.Warn("Failed to read head-bytes flag", "error", err)
+		headBytesFlag = "0"
+	}
+	headBytes, err := units.ParseSize(headBytesFlag)
+	if err != nil {
+		return fmt.Errorf("--head-bytes: %w", err)
+	}
+	if headBytes > 0 {
+		if chunkBytes > 0 {
+			return fmt.Errorf("--head-bytes cannot be used with --chunk-size")
+		}
+		if hasherCmd != "" {
+			return fmt.Errorf("--head-bytes cannot be used with --hasher-cmd")
+		}
+	}
+	engine.SetHeadBytes(headBytes)
+
+	followSymlinks, err := c.Flags().GetBool("follow-symlinks")
+	if err != nil {
+		log.Warn("Failed to read follow-symlinks flag", "error", err)
+		followSymlinks = false
+	}
+	engine.SetFollowSymlinks(followSymlinks)
+
+	noSymlinks, err := c.Flags().GetBool("no-symlinks")
+	if err != nil {
+		log.Warn("Failed to read no-symlinks flag", "error", err)
+		noSymlinks = false
+	}
+	if noSymlinks && followSymlinks {
+		return fmt.Errorf("--no-symlinks cannot be used with --follow-symlinks")
+	}
+	engine.SetNoSymlinks(noSymlinks)
+
+	resolveSymlinks, err := c.Flags().GetBool("deterministic-symlink-content")
+	if err != nil {
+		log.Warn("Failed to read deterministic-symlink-content flag", "error", err)
+		resolveSymlinks = false
+	}
+	if resolveSymlinks && (followSymlinks || noSymlinks) {
+		return fmt.Errorf("--deterministic-symlink-content cannot be used with --follow-symlinks or --no-symlinks")
+	}
+	engine.SetResolveSymlinks(resolveSymlinks)
+
+	ignoreVanished, err := c.Flags().GetBool("ignore-vanished")
+	if err != nil {
+		log.Warn("Failed to read ignore-vanished flag", "error", err)
+		ignoreVanished = false
+	}
+	engine.SetIgnoreVanished(ignoreVanished)
+
+	stripBOM, err := c.Flags().GetBool("strip-bom")
+	if err != nil {
+		log.Warn("Failed to read strip-bom flag", "error", err)
+		stripBOM = false
+	}
+	engine.SetStripBOM(stripBOM)
+
+	maxReadRate, err := c.Flags().GetString("max-read-rate")
+	if err != nil {
+		log.Warn("Failed to read max-read-rate flag", "error", err)
+		maxReadRate = "0"
+	}
+	rate, err := units.ParseSize(maxReadRate)
+	if err != nil {
+		return fmt.Errorf("--max-read-rate: %w", err)
+	}
+	engine.SetMaxReadRate(rate)
+
+	openFiles, err := c.Flags().GetInt("limit-open-files")
+	if err != nil {
+		log.Warn("Failed to read limit-open-files flag", "error", err)
+		openFiles = 0
+	}
+	if openFiles < 0 {
+		return fmt.Errorf("--limit-open-files must not be negative, got %d", openFiles)
+	}
+	engine.SetOpenFilesLimit(openFiles)
+
+	workersPerLevel, err := c.Flags().GetBool("workers-per-level")
+	if err != nil {
+		log.Warn("Failed to read workers-per-level flag", "error", err)
+		workersPerLevel = false
+	}
+	engine.SetAdaptiveScheduling(workersPerLevel)
+
+	lowMemory, err := c.Flags().GetBool("low-memory")
+	if err != nil {
+		log.Warn("Failed to read low-memory flag", "error", err)
+		lowMemory = false
+	}
+	engine.SetLowMemory(lowMemory)
+
+	return nil
+}
+
+// Algorithm returns the node hash algorithm selected by --algorithm.
+//
+// Parameters:
+//   - c: The command whose flags were parsed
+//
+// Returns the algorithm, or an error if the name is not supported.
+func Algorithm(c *cobra.Command) (merkle.Algorithm, error) {
+	name, err := c.Flags().GetString("algorithm")
+	if err != nil {
+		logger.WithOperation("apply_flags", "command", c.Name()).Warn("Failed to read algorithm flag", "error", err)
+		name = ""
+	}
+	algorithm, err := merkle.ParseAlgorithm(name)
+	if err != nil {
+		return "", fmt.Errorf("--algorithm: %w", err)
+	}
+	return algorithm, nil
+}
+
+// AddAssume registers the --assume flag, which substitutes precomputed hashes for
+// subtrees, on the given command.
+//
+// Parameters:
+//   - c: The command to register the flag on
+func AddAssume(c *cobra.Command) {
+	c.Flags().StringArray("assume", []string{}, "Use a known hash for a subtree instead of hashing it, as <relpath>=<hex> relative to the hashed path. Can be specified multiple times.")
+}
+
+// ApplyAssume configures an engine with the assumed hashes given by --assume.
+//
+// Parameters:
+//   - c: The command whose flags were parsed
+//   - engine: The engine to configure
+//
+// Returns an error if an assumption is malformed.
+func ApplyAssume(c *cobra.Command, engine *merkle.Engine) error {
+	values, err := c.Flags().GetStringArray("assume")
+	if err != nil {
+		logger.WithOperation("apply_flags", "command", c.Name()).Warn("Failed to read assume flag", "error", err)
+		values = []string{}
+	}
+	assumed, err := ParseAssume(values, engine.Algorithm().Size())
+	if err != nil {
+		return fmt.Errorf("--assume: %w", err)
+	}
+	if err := engine.SetAssumedHashes(assumed); err != nil {
+		return fmt.Errorf("--assume: %w", err)
+	}
+	return nil
+}
+
+// AddIncludeRootName registers the --include-root-name flag, which mixes the base name
+// of each hashed path into its root.
+//
+// Parameters:
+//   - c: The command to register the flag on
+func AddIncludeRootName(c *cobra.Command) {
+	c.Flags().Bool("include-root-name", false, "Mix the base name of the hashed path into the root, so renaming the top-level directory changes the hash. Paths with different names then never match. Changes the root hash.")
+}
+
+// ApplyIncludeRootName configures an engine from the flag registered by AddIncludeRootName.
+//
+// Parameters:
+//   - c: The command whose flags were parsed
+//   - engine: The engine to configure
+func ApplyIncludeRootName(c *cobra.Command, engine *merkle.Engine) {
+	include, err := c.Flags().GetBool("include-root-name")
+	if err != nil {
+		logger.WithOperation("apply_flags", "command", c.Name()).Warn("Failed to read include-root-name flag", "error", err)
+		include = false
+	}
+	engine.SetIncludeRootName(include)
+}
+
+// AddIgnoreFileName registers the --ignore-file-name flag, which changes the name of the
+// ignore file loaded automatically from the working directory and its parents.
+//
+// Parameters:
+//   - c: The command to register the flag on
+func AddIgnoreFileName(c *cobra.Command) {
+	c.Flags().String("ignore-file-name", "", "Name of the ignore file loaded automatically from the working directory and its parents (e.g. .checksumignore), instead of .mtcignore and .gitignore. Must be a simple filename.")
+}
+
+// IgnoreFileName returns the name of the ignore file loaded automatically, from the flag
+// registered by AddIgnoreFileName; empty means .mtcignore and .gitignore.
+//
+// Parameters:
+//   - c: The command whose flags were parsed
+//
+// Returns the name, or an error if it is not a simple filename.
+func IgnoreFileName(c *cobra.Command) (string, error) {
+	name, err := c.Flags().GetString("ignore-file-name")
+	if err != nil {
+		logger.WithOperation("apply_flags", "command", c.Name()).Warn("Failed to read ignore-file-name flag", "error", err)
+		name = ""
+	}
+	if err := ignore.ValidateIgnoreFileName(name); err != nil {
+		return "", fmt.Errorf("--ignore-file-name: %w", err)
+	}
+	return name, nil
+}
+
+// ApplyIgnoreFileName configures an engine's ignore file discovery from the flag
+// registered by AddIgnoreFileName.
+//
+// Parameters:
+//   - c: The command whose flags were parsed
+//   - engine: The engine to configure
+//
+// Returns an error if the name is not a simple filename or an ignore file cannot be loaded.
+func ApplyIgnoreFileName(c *cobra.Command, engine *merkle.Engine) error {
+	name, err := IgnoreFileName(c)
+	if err != nil {
+		return err
+	}
+	if err := engine.SetIgnoreFileName(name); err != nil {
+		return fmt.Errorf("--ignore-file-name: %w", err)
+	}
+	return nil
+}
+
+// Environment variables seeding the exclusion flags, for runs where flags are awkward to
+// pass, such as containers. A flag given explicitly replaces its variable.
+const (
+	// ExcludeEnv holds exclude patterns separated by colons or newlines, used when no
+	// --exclude is given.
+	ExcludeEnv = "MTC_EXCLUDE"
+	// IgnoreFileEnv holds the path of a custom ignore file, used when --ignore-file is not
+	// given.
+	IgnoreFileEnv = "MTC_IGNORE_FILE"
+)
+
+// ExcludePatterns returns the --exclude patterns of c or, when the flag is not given, the
+// patterns in the MTC_EXCLUDE environment variable. Empty patterns are dropped.
+//
+// Parameters:
+//   - c: The command whose flags were parsed
+//
+// Returns the patterns, or an error if the flag cannot be read.
+func ExcludePatterns(c *cobra.Command) ([]string, error) {
+	if c.Flags().Changed("exclude") {
+		return c.Flags().GetStringArray("exclude")
+	}
+	var patterns []string
+	for _, pattern := range strings.FieldsFunc(os.Getenv(ExcludeEnv), func(r rune) bool { return r == ':' || r == '\n' }) {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if patterns == nil {
+		return c.Flags().GetStringArray("exclude")
+	}
+	return patterns, nil
+}
+
+// IgnoreFile returns the --ignore-file path of c or, when the flag is not given, the path in
+// the MTC_IGNORE_FILE environment variable.
+//
+// Parameters:
+//   - c: The command whose flags were parsed
+//
+// Returns the path (empty for none), or an error if the flag cannot be read.
+func IgnoreFile(c *cobra.Command) (string, error) {
+	if !c.Flags().Changed("ignore-file") {
+		if path := strings.TrimSpace(os.Getenv(IgnoreFileEnv)); path != "" {
+			return path, nil
+		}
+	}
+	return c.Flags().GetString("ignore-file")
+}
+
+// AddRequireGitRoot registers the --require-git-root flag, which guards against hashing
+// a subdirectory of a repository when a whole-repository hash was intended.
+//
+// Parameters:
+//   - c: The command to register the flag on
+func AddRequireGitRoot(c *cobra.Command) {
+	c.Flags().Bool("require-git-root", false, "Fail unless each path is the top level of a git repository (contains .git)")
+}
+
+// CheckGitRoot enforces --require-git-root for the given paths.
+//
+// Parameters:
+//   - c: The command whose flags were parsed
+//   - paths: The paths the command will hash
+//
+// Returns an error naming the first path that is not a git repository root, if the flag is set.
+func CheckGitRoot(c *cobra.Command, paths ...string) error {
+	required, err := c.Flags().GetBool("require-git-root")
+	if err != nil {
+		logger.WithOperation("apply_flags", "command", c.Name()).Warn("Failed to read require-git-root flag", "error", err)
+		required = false
+	}
+	if !required {
+		return nil
+	}
+	for _, path := range paths {
+		if !isGitRoot(path) {
+			return fmt.Errorf("--require-git-root: %q is not the top level of a git repository (no .git found)", path)
+		}
+	}
+	return nil
+}
+
+// isGitRoot reports whether path is a directory containing a .git entry. The entry may be
+// a directory, or a file pointing elsewhere as in linked worktrees and submodules.
+func isGitRoot(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(path, ".git"))
+	return err == nil
+}
+
+// AddReportDiagnostics registers the --report-diagnostics flag, which collects the
+// warnings met while hashing and summarizes them once the command finishes.
+//
+// Parameters:
+//   - c: The command to register the flag on
+func AddReportDiagnostics(c *cobra.Command) {
+	c.Flags().Bool("report-diagnostics", false, "Collect warnings met while hashing (skipped special files, files changed during read, close failures, case collisions, truncated directories) and print a summary to stderr at the end")
+}
+
+// ApplyReportDiagnostics makes the given engines collect diagnostics if the flag
+// registered by AddReportDiagnostics is set. All engines share one collector.
+//
+// Parameters:
+//   - c: The command whose flags were parsed
+//   - engines: The engines to configure
+//
+// Returns the collector to pass to ReportDiagnostics, or nil if the flag is not set.
+func ApplyReportDiagnostics(c *cobra.Command, engines ...*merkle.Engine) *merkle.Diagnostics {
+	report, err := c.Flags().GetBool("report-diagnostics")
+	if err != nil {
+		logger.WithOperation("apply_flags", "command", c.Name()).Warn("Failed to read report-diagnostics flag", "error", err)
+		report = false
+	}
+	if !report {
+		return nil
+	}
+	diagnostics := &merkle.Diagnostics{}
+	for _, engine := range engines {
+		engine.SetDiagnostics(diagnostics)
+	}
+	return diagnostics
+}
+
+// ReportDiagnostics prints the summary of the collected diagnostics to the command's
+// stderr, followed by one line per diagnostic. It does nothing if d is nil.
+//
+// Parameters:
+//   - c: The command to report on
+//   - d: The collector returned by ApplyReportDiagnostics
+func ReportDiagnostics(c *cobra.Command, d *merkle.Diagnostics) {
+	if d == nil {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Diagnostics: %s\n", d.Summary())
+	for _, item := range d.Items() {
+		fmt.Fprintf(&b, "  %s: %s (%s)\n", item.Kind, item.Path, item.Detail)
+	}
+	if _, err := io.WriteString(c.ErrOrStderr(), b.String()); err != nil {
+		logger.WithOperation("report_diagnostics", "command", c.Name()).Warn("Failed to write diagnostics", "error", err)
+	}
+}
+
+// ParseAssume parses assumed subtree hashes of the form <relpath>=<hex>.
+//
+// Parameters:
+//   - values: The raw flag values
+//   - size: The hash size in bytes of the engine's algorithm
+//
+// Returns a map from relative path to decoded hash, or an error if a value is malformed,
+// the hash is not a hexadecimal hash of the given size, or a path is given twice.
+func ParseAssume(values []string, size int) (map[string][]byte, error) {
+	assumed := make(map[string][]byte, len(values))
+	for _, v := range values {
+		rel, hexHash, ok := strings.Cut(v, "=")
+		if !ok || rel == "" {
+			return nil, fmt.Errorf("invalid assumption %q (expected <relpath>=<hex>)", v)
+		}
+		hash, err := hex.DecodeString(hexHash)
+		if err != nil || len(hash) != size {
+			return nil, fmt.Errorf("invalid hash in %q (expected %d hexadecimal characters)", v, 2*size)
+		}
+		if _, dup := assumed[rel]; dup {
+			return nil, fmt.Errorf("path %q is assumed more than once", rel)
+		}
+		assumed[rel] = hash
+	}
+	return assumed, nil
+}
@@ -0,0 +1,281 @@
+package flags
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/merkle"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	// Silence logger during tests - only show errors
+	logger.Init("error", "text", io.Discard)
+}
+
+// newCommand returns a command with the hashing flags registered and the given arguments parsed.
+func newCommand(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+	c := &cobra.Command{Use: "test"}
+	AddHashing(c)
+	if err := c.ParseFlags(args); err != nil {
+		t.Fatalf("ParseFlags(%v) error = %v", args, err)
+	}
+	return c
+}
+
+func TestApplyHashing(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{name: "defaults", args: nil, wantErr: false},
+		{name: "text only", args: []string{"--text-only"}, wantErr: false},
+		{name: "binary only", args: []string{"--binary-only"}, wantErr: false},
+		{name: "text and binary only", args: []string{"--text-only", "--binary-only"}, wantErr: true},
+		{name: "hasher cmd", args: []string{"--hasher-cmd", "sha256sum"}, wantErr: false},
+		{name: "hasher cmd with chunk size", args: []string{"--hasher-cmd", "sha256sum", "--chunk-size", "1M"}, wantErr: true},
+		{name: "byte budget", args: []string{"--byte-budget", "10M"}, wantErr: false},
+		{name: "invalid byte budget", args: []string{"--byte-budget", "lots"}, wantErr: true},
+		{name: "head bytes", args: []string{"--head-bytes", "64K"}, wantErr: false},
+		{name: "invalid head bytes", args: []string{"--head-bytes", "lots"}, wantErr: true},
+		{name: "head bytes with chunk size", args: []string{"--head-bytes", "64K", "--chunk-size", "1M"}, wantErr: true},
+		{name: "max read rate", args: []string{"--max-read-rate", "50M"}, wantErr: false},
+		{name: "invalid max read rate", args: []string{"--max-read-rate", "fast"}, wantErr: true},
+		{name: "workers per level", args: []string{"--workers-per-level"}, wantErr: false},
+		{name: "one filesystem", args: []string{"--one-filesystem"}, wantErr: !merkle.OneFilesystemSupported},
+		{name: "include hardlinks", args: []string{"--include-hardlinks"}, wantErr: !merkle.HardlinksSupported},
+		{name: "ignore precedence", args: []string{"--ignore-precedence", "cli,gitignore"}, wantErr: false},
+		{name: "invalid ignore precedence", args: []string{"--ignore-precedence", "cli,unknown"}, wantErr: true},
+		{name: "no root resolution", args: []string{"--resolve-root=false"}, wantErr: false},
+		{name: "realpath root check", args: []string{"--resolve-root-realpath"}, wantErr: false},
+		{name: "dockerignore", args: []string{"--dockerignore"}, wantErr: false},
+		{name: "strict case", args: []string{"--strict-case"}, wantErr: false},
+		{name: "low memory", args: []string{"--low-memory"}, wantErr: false},
+		{name: "entries limit", args: []string{"--entries-limit", "1000"}, wantErr: false},
+		{name: "entries limit with truncation", args: []string{"--entries-limit", "1000", "--truncate"}, wantErr: false},
+		{name: "negative entries limit", args: []string{"--entries-limit", "-1"}, wantErr: true},
+		{name: "truncate without entries limit", args: []string{"--truncate"}, wantErr: true},
+		{name: "exclude deeper than", args: []string{"--exclude-deeper-than", "3"}, wantErr: false},
+		{name: "negative exclude deeper than", args: []string{"--exclude-deeper-than", "-1"}, wantErr: true},
+		{name: "exclude empty files", args: []string{"--exclude-empty-files"}, wantErr: false},
+		{name: "exclude size", args: []string{"--exclude-size", ">100M", "--exclude-size", "<=1K"}, wantErr: false},
+		{name: "invalid exclude size", args: []string{"--exclude-size", "100M"}, wantErr: true},
+		{name: "structure only", args: []string{"--structure-only"}, wantErr: false},
+		{name: "not recursive", args: []string{"--recursive=false"}, wantErr: false},
+		{name: "normalize unicode", args: []string{"--normalize-unicode"}, wantErr: false},
+		{name: "chunk size", args: []string{"--chunk-size", "4M"}, wantErr: false},
+		{name: "invalid chunk size", args: []string{"--chunk-size", "-1"}, wantErr: true},
+		{name: "sha3-256 algorithm", args: []string{"--algorithm", "sha3-256"}, wantErr: false},
+		{name: "sha3-512 algorithm", args: []string{"--algorithm", "SHA3-512"}, wantErr: false},
+		{name: "unknown algorithm", args: []string{"--algorithm", "md5"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCommand(t, tt.args...)
+			err := ApplyHashing(c, merkle.NewEngine())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ApplyHashing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckGitRoot(t *testing.T) {
+	plain := t.TempDir()
+	repo := t.TempDir()
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatalf("Failed to create .git: %v", err)
+	}
+	sub := filepath.Join(repo, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		path    string
+		wantErr bool
+	}{
+		{name: "not required", args: nil, path: plain, wantErr: false},
+		{name: "non-repo dir", args: []string{"--require-git-root"}, path: plain, wantErr: true},
+		{name: "repo root", args: []string{"--require-git-root"}, path: repo, wantErr: false},
+		{name: "repo subdirectory", args: []string{"--require-git-root"}, path: sub, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &cobra.Command{Use: "test"}
+			AddRequireGitRoot(c)
+			if err := c.ParseFlags(tt.args); err != nil {
+				t.Fatalf("ParseFlags(%v) error = %v", tt.args, err)
+			}
+			err := CheckGitRoot(c, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckGitRoot(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyIgnoreFileName(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, content := range map[string]string{".mtcignore": "*.log\n", ".checksumignore": "build/\n"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	t.Chdir(tmpDir)
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", args: nil, want: "*.log"},
+		{name: "simple filename", args: []string{"--ignore-file-name", ".checksumignore"}, want: "build/"},
+		{name: "path separator", args: []string{"--ignore-file-name", "dir/.checksumignore"}, wantErr: true},
+		{name: "traversal", args: []string{"--ignore-file-name", "../.checksumignore"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &cobra.Command{Use: "test"}
+			AddIgnoreFileName(c)
+			if err := c.ParseFlags(tt.args); err != nil {
+				t.Fatalf("ParseFlags(%v) error = %v", tt.args, err)
+			}
+			engine, err := merkle.NewEngineWithExclusions(0, nil, tmpDir, true, "")
+			if err != nil {
+				t.Fatalf("NewEngineWithExclusions() error = %v", err)
+			}
+			err = ApplyIgnoreFileName(c, engine)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyIgnoreFileName(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			patterns, err := engine.ExclusionPatterns()
+			if err != nil {
+				t.Fatalf("ExclusionPatterns() error = %v", err)
+			}
+			if !slices.Contains(patterns, tt.want) {
+				t.Errorf("ExclusionPatterns() = %v, want %q loaded", patterns, tt.want)
+			}
+		})
+	}
+}
+
+func TestExclusionEnv(t *testing.T) {
+	tests := []struct {
+		name         string
+		exclude      string
+		ignoreFile   string
+		args         []string
+		wantPatterns []string
+		wantFile     string
+	}{
+		{name: "unset", wantPatterns: []string{}},
+		{name: "colon separated", exclude: "node_modules:*.log", wantPatterns: []string{"node_modules", "*.log"}},
+		{name: "newline separated", exclude: "node_modules\n\n *.log \n", wantPatterns: []string{"node_modules", "*.log"}},
+		{name: "ignore file", ignoreFile: "/etc/mtc.ignore", wantPatterns: []string{}, wantFile: "/etc/mtc.ignore"},
+		{name: "flags override", exclude: "node_modules", ignoreFile: "/etc/mtc.ignore", args: []string{"-e", "dist", "-i", "custom.ignore"}, wantPatterns: []string{"dist"}, wantFile: "custom.ignore"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ExcludeEnv, tt.exclude)
+			t.Setenv(IgnoreFileEnv, tt.ignoreFile)
+			c := &cobra.Command{Use: "test"}
+			c.Flags().StringArrayP("exclude", "e", []string{}, "")
+			c.Flags().StringP("ignore-file", "i", "", "")
+			if err := c.ParseFlags(tt.args); err != nil {
+				t.Fatalf("ParseFlags(%v) error = %v", tt.args, err)
+			}
+
+			patterns, err := ExcludePatterns(c)
+			if err != nil {
+				t.Fatalf("ExcludePatterns() error = %v", err)
+			}
+			if !slices.Equal(patterns, tt.wantPatterns) {
+				t.Errorf("ExcludePatterns() = %q, want %q", patterns, tt.wantPatterns)
+			}
+			file, err := IgnoreFile(c)
+			if err != nil {
+				t.Fatalf("IgnoreFile() error = %v", err)
+			}
+			if file != tt.wantFile {
+				t.Errorf("IgnoreFile() = %q, want %q", file, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestParseAssume(t *testing.T) {
+	valid := strings.Repeat("ab", merkle.HashSize)
+	tests := []struct {
+		name    string
+		values  []string
+		want    int
+		wantErr bool
+	}{
+		{name: "none", values: nil, want: 0},
+		{name: "single", values: []string{"src/vendor=" + valid}, want: 1},
+		{name: "multiple", values: []string{"a=" + valid, "b/c=" + valid}, want: 2},
+		{name: "missing separator", values: []string{"src"}, wantErr: true},
+		{name: "empty path", values: []string{"=" + valid}, wantErr: true},
+		{name: "not hex", values: []string{"src=xyz"}, wantErr: true},
+		{name: "wrong length", values: []string{"src=abcd"}, wantErr: true},
+		{name: "duplicate", values: []string{"a=" + valid, "a=" + valid}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAssume(tt.values, merkle.HashSize)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAssume(%v) error = %v, wantErr %v", tt.values, err, tt.wantErr)
+			}
+			if !tt.wantErr && len(got) != tt.want {
+				t.Errorf("ParseAssume(%v) returned %d entries, want %d", tt.values, len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestReportDiagnostics(t *testing.T) {
+	c := &cobra.Command{Use: "test"}
+	AddReportDiagnostics(c)
+	engine := merkle.NewEngine()
+	if d := ApplyReportDiagnostics(c, engine); d != nil {
+		t.Errorf("ApplyReportDiagnostics() without the flag = %v, want nil", d)
+	}
+
+	if err := c.ParseFlags([]string{"--report-diagnostics"}); err != nil {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+	d := ApplyReportDiagnostics(c, engine)
+	if d == nil {
+		t.Fatal("ApplyReportDiagnostics() with the flag returned nil")
+	}
+	if _, err := engine.HashPath(t.TempDir()); err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	c.SetErr(&buf)
+	ReportDiagnostics(c, d)
+	if got := buf.String(); got != "Diagnostics: none\n" {
+		t.Errorf("ReportDiagnostics() wrote %q, want %q", got, "Diagnostics: none\n")
+	}
+}
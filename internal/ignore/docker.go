@@ -0,0 +1,132 @@
+// Package ignore (docker.go) provides .dockerignore support.
+// Docker interprets its ignore file differently from .gitignore: patterns are anchored at
+// the root of the build context (a bare "foo" only matches "foo" at the top level, not
+// "a/foo"), a leading "/" is redundant, "**" matches any number of directories, a trailing
+// "/" does not restrict a pattern to directories, and the last matching pattern decides,
+// so a later "!" pattern re-includes paths and a later pattern can exclude them again.
+package ignore
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// DockerignoreFile is the name of Docker's ignore file.
+const DockerignoreFile = ".dockerignore"
+
+// DockerMatcher matches paths relative to the build context root against .dockerignore
+// patterns, using Docker's semantics.
+type DockerMatcher struct {
+	patterns []dockerPattern
+}
+
+type dockerPattern struct {
+	// raw is the original pattern string
+	raw string
+	// isNegation is true if pattern starts with !
+	isNegation bool
+	// segments are the cleaned, slash-separated path segments to match from the root
+	segments []string
+}
+
+// LoadDockerignore loads the patterns of the .dockerignore file in rootPath.
+// A missing file yields no patterns and no error.
+//
+// Parameters:
+//   - rootPath: The build context root holding the .dockerignore file
+//
+// Returns the pattern strings and any error encountered while reading the file.
+func LoadDockerignore(rootPath string) ([]string, error) {
+	return LoadIgnoreFile(rootPath, DockerignoreFile)
+}
+
+// NewDockerMatcher creates a matcher from .dockerignore patterns. Each pattern is cleaned
+// like a path and stripped of a leading "/"; empty lines and "#" comments are ignored.
+//
+// Parameters:
+//   - patterns: The .dockerignore patterns in file order
+//
+// Returns a new DockerMatcher instance ready to use.
+func NewDockerMatcher(patterns []string) *DockerMatcher {
+	dm := &DockerMatcher{patterns: make([]dockerPattern, 0, len(patterns))}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+		pat := dockerPattern{raw: p}
+		if strings.HasPrefix(p, "!") {
+			pat.isNegation = true
+			p = strings.TrimSpace(strings.TrimPrefix(p, "!"))
+		}
+		p = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(p)), "/")
+		if p == "" || p == "." {
+			continue
+		}
+		pat.segments = strings.Split(p, "/")
+		dm.patterns = append(dm.patterns, pat)
+	}
+	return dm
+}
+
+// Match returns true if the path, relative to the build context root, is excluded.
+func (dm *DockerMatcher) Match(path string, isDir bool) bool {
+	excluded, _ := dm.Explain(path, isDir)
+	return excluded
+}
+
+// Explain reports whether the path is excluded and which pattern decided it: the last
+// pattern matching the path or one of its parent directories. The returned pattern is
+// empty when nothing matched.
+//
+// Parameters:
+//   - path: The path to check, relative to the build context root
+//   - isDir: Whether the path represents a directory (unused: Docker does not distinguish)
+//
+// Returns whether the path is excluded and the raw pattern responsible for the verdict.
+func (dm *DockerMatcher) Explain(path string, isDir bool) (bool, string) {
+	path = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "/")
+	if path == "" || path == "." {
+		return false, ""
+	}
+	pathSegments := strings.Split(path, "/")
+
+	excluded, decisive := false, ""
+	for _, pat := range dm.patterns {
+		if pat.Match(pathSegments) {
+			excluded, decisive = !pat.isNegation, pat.raw
+		}
+	}
+	return excluded, decisive
+}
+
+// Match checks if the pattern matches the path or one of its parent directories,
+// anchored at the root.
+func (p *dockerPattern) Match(pathSegments []string) bool {
+	for n := 1; n <= len(pathSegments); n++ {
+		if matchAnchored(pathSegments[:n], p.segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAnchored checks if pattern segments match all path segments, with "**" matching
+// any number of segments (including none).
+func matchAnchored(pathSegs, patSegs []string) bool {
+	if len(patSegs) == 0 {
+		return len(pathSegs) == 0
+	}
+	if patSegs[0] == globDoubleStar {
+		for i := 0; i <= len(pathSegs); i++ {
+			if matchAnchored(pathSegs[i:], patSegs[1:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(pathSegs) == 0 || !matchSegment(pathSegs[0], patSegs[0]) {
+		return false
+	}
+	return matchAnchored(pathSegs[1:], patSegs[1:])
+}
@@ -0,0 +1,47 @@
+// Package ignore (fingerprint.go) provides fingerprints of exclusion pattern sets.
+// Two roots are only comparable if they were computed with the same exclusions; a
+// fingerprint recorded next to a root lets a later comparison detect when they were not.
+package ignore
+
+import (
+	"encoding/hex"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zeebo/blake3"
+)
+
+// FingerprintSize is the number of bytes of a fingerprint (16 hexadecimal characters).
+const FingerprintSize = 8
+
+// Fingerprint returns a short, stable identifier of a set of exclusion patterns: the
+// first FingerprintSize bytes, in hexadecimal, of the BLAKE3 hash of the patterns after
+// trimming them, converting separators to "/", dropping empty lines, comments and
+// duplicates, and sorting them. Neither the order of the patterns nor the source they
+// were loaded from affects it.
+//
+// Parameters:
+//   - patterns: The exclusion patterns
+//
+// Returns the fingerprint as a hexadecimal string.
+func Fingerprint(patterns []string) string {
+	seen := make(map[string]bool, len(patterns))
+	normalized := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		p = filepath.ToSlash(strings.TrimSpace(p))
+		if p == "" || strings.HasPrefix(p, "#") || seen[p] {
+			continue
+		}
+		seen[p] = true
+		normalized = append(normalized, p)
+	}
+	sort.Strings(normalized)
+
+	h := blake3.New()
+	for _, p := range normalized {
+		_, _ = h.WriteString(p)
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:FingerprintSize])
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/lucho00cuba/mtc/internal/logger"
@@ -17,8 +18,59 @@ import (
 const (
 	// globDoubleStar represents the "**" pattern that matches any number of directories
 	globDoubleStar = "**"
+
+	// SourceCommandLine is the source reported for patterns given with -e/--exclude.
+	SourceCommandLine = "--exclude"
 )
 
+// defaultIgnoreFiles are the ignore files discovered automatically, highest priority first.
+var defaultIgnoreFiles = []string{".mtcignore", ".gitignore"}
+
+// ValidateIgnoreFileName checks a name for the ignore file discovered automatically, which
+// replaces .mtcignore and .gitignore (see FindIgnoreFiles). An empty name keeps the default.
+//
+// Parameters:
+//   - name: The ignore file name (e.g., ".checksumignore"); it must be a simple filename
+//
+// Returns an error if the name contains a path separator or directory traversal.
+func ValidateIgnoreFileName(name string) error {
+	if name == "" {
+		return nil
+	}
+	return validateFilename(name)
+}
+
+// ignoreFileNames returns the ignore files discovered automatically for the given name,
+// highest priority first: .mtcignore and .gitignore if it is empty, or only files with it.
+func ignoreFileNames(name string) ([]string, error) {
+	if name == "" {
+		return defaultIgnoreFiles, nil
+	}
+	if err := validateFilename(name); err != nil {
+		return nil, err
+	}
+	return []string{name}, nil
+}
+
+// validateFilename ensures filename is a simple filename, without path separators or
+// directory traversal, so it cannot point outside the directory it is joined with.
+func validateFilename(filename string) error {
+	if filename == "." || strings.Contains(filename, "..") || strings.Contains(filename, string(filepath.Separator)) || filepath.Clean(filename) != filename {
+		return fmt.Errorf("invalid filename: %s", filename)
+	}
+	return nil
+}
+
+// SourcedPattern is an exclusion pattern together with the place it was loaded from.
+// Source is SourceCommandLine for command-line patterns, or the path of the
+// ignore file the pattern was read from.
+type SourcedPattern struct {
+	// Pattern is the raw pattern string as written by the user.
+	Pattern string
+	// Source describes where the pattern came from.
+	Source string
+}
+
 // Matcher determines if a path should be excluded from hashing.
 // Implementations of this interface provide pattern matching functionality
 // to filter files and directories during hash computation.
@@ -34,6 +86,13 @@ type Matcher interface {
 	Match(path string, isDir bool) bool
 }
 
+// Explainer is implemented by matchers that can tell which pattern decided a verdict.
+type Explainer interface {
+	// Explain reports whether the path is excluded and the raw pattern responsible for
+	// the verdict, which is empty when nothing matched.
+	Explain(path string, isDir bool) (bool, string)
+}
+
 // PatternMatcher matches paths against exclusion patterns.
 // Supports patterns similar to .gitignore:
 // - Exact matches: "node_modules"
@@ -41,6 +100,8 @@ type Matcher interface {
 // - Glob patterns: "*.log", "**/build"
 type PatternMatcher struct {
 	patterns []pattern
+	// sizeRules are the size-based patterns ("@size >100M"), matched by MatchSize
+	sizeRules []SizeRule
 }
 
 type pattern struct {
@@ -62,6 +123,7 @@ type pattern struct {
 //   - Directory-only: "node_modules/" (matches directories only)
 //   - Glob patterns: "*.log", "**/build"
 //   - Negation: "!important.log" (un-excludes previously excluded paths)
+//   - Size rules: "@size >100M" (excludes files by size, see MatchSize)
 //
 // Empty lines and lines starting with "#" are treated as comments and ignored.
 //
@@ -79,6 +141,12 @@ func NewPatternMatcher(patterns []string) *PatternMatcher {
 		if p == "" || strings.HasPrefix(p, "#") {
 			continue // Skip empty lines and comments
 		}
+		if condition, ok := sizeCondition(p); ok {
+			if rule, ok := compileSizeRule(p, condition); ok {
+				pm.sizeRules = append(pm.sizeRules, rule)
+			}
+			continue
+		}
 
 		pat := pattern{
 			raw: p,
@@ -134,6 +202,37 @@ func (pm *PatternMatcher) Match(path string, isDir bool) bool {
 	return matched
 }
 
+// Explain reports whether the path is excluded and which pattern decided it.
+// It applies the same rules as Match: when a negation pattern matches, the path
+// is not excluded and the negation is reported; otherwise the last matching
+// exclusion pattern is reported. The returned pattern is empty when nothing matched.
+//
+// Parameters:
+//   - path: The path to check (relative or absolute)
+//   - isDir: Whether the path represents a directory
+//
+// Returns whether the path is excluded and the raw pattern responsible for the verdict.
+func (pm *PatternMatcher) Explain(path string, isDir bool) (bool, string) {
+	path = filepath.ToSlash(path)
+	pathSegments := strings.Split(path, "/")
+
+	var exclusion, negation string
+	for _, pat := range pm.patterns {
+		if pat.Match(pathSegments, isDir) {
+			if pat.isNegation {
+				negation = pat.raw
+			} else {
+				exclusion = pat.raw
+			}
+		}
+	}
+
+	if negation != "" {
+		return false, negation
+	}
+	return exclusion != "", exclusion
+}
+
 // Match checks if the pattern matches the path segments.
 func (p *pattern) Match(pathSegments []string, isDir bool) bool {
 	// Directory-only patterns don't match files
@@ -157,34 +256,56 @@ func (p *pattern) Match(pathSegments []string, isDir bool) bool {
 }
 
 // matchSegments performs pattern matching on path segments.
+//
+// Patterns without "**" match wherever their segments appear consecutively in the path.
+// Patterns with "**" follow .gitignore and must match up to the end of the path, where
+// "**" stands for any number of directories:
+//   - "**/b" matches b at any depth ("b", "x/b", "x/y/b")
+//   - "a/**" matches everything inside an a directory ("a/x", "a/x/y"), but not a itself
+//   - "a/**/b" matches b anywhere below a ("a/b", "a/x/b", "a/x/y/b")
+//
+// A pattern that does not start with "**" may begin at any level, like "node_modules" does.
+// Entries below a matched directory are excluded with it, since it is never walked.
 func (p *pattern) matchSegments(pathSegments []string) bool {
 	patSegs := p.segments
+	if !slices.Contains(patSegs, globDoubleStar) {
+		return matchSegmentsAt(pathSegments, patSegs)
+	}
 
-	// Handle patterns starting with ** (match any number of directories)
-	if len(patSegs) > 0 && patSegs[0] == globDoubleStar {
-		// ** matches everything, so check if remaining pattern matches
-		if len(patSegs) == 1 {
+	// A leading ** absorbs any prefix, so the whole path must match
+	if patSegs[0] == globDoubleStar {
+		return matchDoubleStar(pathSegments, patSegs)
+	}
+	for i := range pathSegments {
+		if matchDoubleStar(pathSegments[i:], patSegs) {
 			return true
 		}
-		// Try matching remaining pattern at any position
-		remainingPat := patSegs[1:]
-		for i := 0; i <= len(pathSegments); i++ {
-			if matchSegmentsAt(pathSegments[i:], remainingPat) {
+	}
+	return false
+}
+
+// matchDoubleStar checks if pattern segments match all path segments, with "**" matching
+// any number of segments. A trailing "**" matches at least one segment, so "a/**" covers the
+// contents of a but not a itself.
+func matchDoubleStar(pathSegs, patSegs []string) bool {
+	if len(patSegs) == 0 {
+		return len(pathSegs) == 0
+	}
+	if patSegs[0] == globDoubleStar {
+		if len(patSegs) == 1 {
+			return len(pathSegs) > 0
+		}
+		for i := 0; i <= len(pathSegs); i++ {
+			if matchDoubleStar(pathSegs[i:], patSegs[1:]) {
 				return true
 			}
 		}
 		return false
 	}
-
-	// Handle patterns ending with **
-	if len(patSegs) > 0 && patSegs[len(patSegs)-1] == globDoubleStar {
-		// Match everything from the start
-		return matchSegmentsAt(pathSegments, patSegs[:len(patSegs)-1])
+	if len(pathSegs) == 0 || !matchSegment(pathSegs[0], patSegs[0]) {
+		return false
 	}
-
-	// Standard matching from the end (most common case: "node_modules", ".git")
-	// Check if pattern matches at the end of the path
-	return matchSegmentsAt(pathSegments, patSegs)
+	return matchDoubleStar(pathSegs[1:], patSegs[1:])
 }
 
 // matchSegmentsAt checks if pattern segments match path segments starting at a given position.
@@ -286,8 +407,8 @@ func LoadIgnoreFile(rootPath string, filename string) ([]string, error) {
 	cleanFilename := filepath.Clean(filename)
 
 	// Ensure filename doesn't contain path separators or directory traversal (only allow simple filenames)
-	if strings.Contains(filename, "..") || strings.Contains(filename, string(filepath.Separator)) || cleanFilename != filename {
-		return nil, fmt.Errorf("invalid filename: %s", filename)
+	if err := validateFilename(filename); err != nil {
+		return nil, err
 	}
 
 	ignorePath := filepath.Join(cleanRoot, cleanFilename)
@@ -333,7 +454,7 @@ func LoadIgnoreFile(rootPath string, filename string) ([]string, error) {
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
-			logger.Warn("Failed to close ignore file", "error", err)
+			logger.WithOperation("load_ignore").Warn("Failed to close ignore file", "error", err)
 		}
 	}()
 
@@ -346,7 +467,7 @@ func LoadIgnoreFile(rootPath string, filename string) ([]string, error) {
 		}
 	}
 
-	logger.Info("Loaded ignore file", "file", ignorePath, "patterns", len(patterns), "filename", filename)
+	logger.WithOperation("load_ignore").Info("Loaded ignore file", "file", ignorePath, "patterns", len(patterns), "filename", filename)
 
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
@@ -362,9 +483,41 @@ func LoadIgnoreFile(rootPath string, filename string) ([]string, error) {
 // Returns patterns from all found ignore files. Patterns from directories closer
 // to the root take precedence. .mtcignore patterns take precedence over .gitignore patterns.
 //
-// Returns a slice of all collected patterns and any error encountered during the search.
-func FindIgnoreFiles() ([]string, error) {
-	var allPatterns []string
+// Parameters:
+//   - name: The ignore file name replacing both .mtcignore and .gitignore, or empty for them
+//
+// Returns a slice of all collected patterns and any error encountered during the search,
+// including an invalid name.
+func FindIgnoreFiles(name string) ([]string, error) {
+	sourced, err := FindIgnoreFilesWithSources(name)
+	if err != nil {
+		return nil, err
+	}
+	if sourced == nil {
+		return nil, nil
+	}
+
+	allPatterns := make([]string, len(sourced))
+	for i, sp := range sourced {
+		allPatterns[i] = sp.Pattern
+	}
+	return allPatterns, nil
+}
+
+// FindIgnoreFilesWithSources behaves like FindIgnoreFiles but records, for each
+// pattern, the absolute path of the ignore file it was read from.
+// The returned patterns are in the same order as those returned by FindIgnoreFiles.
+//
+// Parameters:
+//   - name: The ignore file name replacing both .mtcignore and .gitignore, or empty for them
+//
+// Returns a slice of all collected patterns with their sources and any error encountered.
+func FindIgnoreFilesWithSources(name string) ([]SourcedPattern, error) {
+	names, err := ignoreFileNames(name)
+	if err != nil {
+		return nil, err
+	}
+	var allPatterns []SourcedPattern
 
 	// Get current working directory (where the command is executed from)
 	wd, err := os.Getwd()
@@ -388,24 +541,23 @@ func FindIgnoreFiles() ([]string, error) {
 		}
 		visited[current] = true
 
-		// Try to load .mtcignore first (has priority)
-		mtcPatterns, err := LoadIgnoreFile(current, ".mtcignore")
-		if err != nil {
-			return nil, err
-		}
-		if mtcPatterns != nil {
-			// Prepend patterns from closer directories (they take precedence)
-			allPatterns = append(mtcPatterns, allPatterns...)
-		}
-
-		// Try to load .gitignore (only if .mtcignore doesn't exist or as supplement)
-		gitPatterns, err := LoadIgnoreFile(current, ".gitignore")
-		if err != nil {
-			return nil, err
-		}
-		if gitPatterns != nil {
-			// Append .gitignore patterns after .mtcignore (lower priority)
-			allPatterns = append(allPatterns, gitPatterns...)
+		// Load .mtcignore first (has priority), then .gitignore as a supplement
+		for i, name := range names {
+			patterns, err := LoadIgnoreFile(current, name)
+			if err != nil {
+				return nil, err
+			}
+			if patterns == nil {
+				continue
+			}
+			sourced := withSource(patterns, filepath.Join(current, name))
+			if i == 0 {
+				// Prepend patterns from closer directories (they take precedence)
+				allPatterns = append(sourced, allPatterns...)
+			} else {
+				// Append .gitignore patterns after .mtcignore (lower priority)
+				allPatterns = append(allPatterns, sourced...)
+			}
 		}
 
 		// Move to parent directory
@@ -461,7 +613,7 @@ func LoadCustomIgnoreFile(filePath string) ([]string, error) {
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
-			logger.Warn("Failed to close ignore file", "error", err)
+			logger.WithOperation("load_ignore").Warn("Failed to close ignore file", "error", err)
 		}
 	}()
 
@@ -496,44 +648,74 @@ func LoadCustomIgnoreFile(filePath string) ([]string, error) {
 //   - rootPath: The root path being hashed (used for context, not for loading ignore files)
 //   - loadIgnoreFile: If true, automatically loads .mtcignore and .gitignore files
 //   - customIgnoreFile: Optional path to a custom ignore file (always loaded if provided)
+//   - ignoreFileName: Optional name of the ignore file loaded instead of .mtcignore and .gitignore
 //
 // Returns a Matcher instance ready to use, or an error if pattern compilation fails.
-func NewMatcher(patterns []string, rootPath string, loadIgnoreFile bool, customIgnoreFile string) (Matcher, error) {
-	allPatterns := make([]string, len(patterns))
-	copy(allPatterns, patterns)
+func NewMatcher(patterns []string, rootPath string, loadIgnoreFile bool, customIgnoreFile, ignoreFileName string) (Matcher, error) {
+	sourced, err := CollectPatterns(patterns, rootPath, loadIgnoreFile, customIgnoreFile, ignoreFileName)
+	if err != nil {
+		return nil, err
+	}
 
-	var customPatterns []string
-	var ignorePatterns []string
+	if len(sourced) == 0 {
+		return &noOpMatcher{}, nil
+	}
+
+	allPatterns := make([]string, len(sourced))
+	for i, sp := range sourced {
+		allPatterns[i] = sp.Pattern
+	}
+	return NewPatternMatcher(allPatterns), nil
+}
+
+// CollectPatterns gathers the exclusion patterns NewMatcher would use, annotated
+// with the source each pattern came from. Patterns are returned in the order they
+// are fed to the matcher: command-line patterns, then the custom ignore file, then
+// the automatically discovered .mtcignore and .gitignore files.
+//
+// Parameters:
+//   - patterns: Command-line exclusion patterns to include
+//   - rootPath: The root path being hashed (used for context, not for loading ignore files)
+//   - loadIgnoreFile: If true, automatically loads .mtcignore and .gitignore files
+//   - customIgnoreFile: Optional path to a custom ignore file (always loaded if provided)
+//   - ignoreFileName: Optional name of the ignore file loaded instead of .mtcignore and .gitignore
+//
+// Returns the collected patterns with their sources, or an error if an ignore file cannot be loaded.
+func CollectPatterns(patterns []string, rootPath string, loadIgnoreFile bool, customIgnoreFile, ignoreFileName string) ([]SourcedPattern, error) {
+	allPatterns := withSource(patterns, SourceCommandLine)
 
 	// Load custom ignore file first (highest priority, always loaded if specified)
 	if customIgnoreFile != "" {
-		var err error
-		customPatterns, err = LoadCustomIgnoreFile(customIgnoreFile)
+		customPatterns, err := LoadCustomIgnoreFile(customIgnoreFile)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load custom ignore file: %w", err)
 		}
-		allPatterns = append(allPatterns, customPatterns...)
-		logger.Info("Loaded custom ignore file", "file", customIgnoreFile, "patterns", len(customPatterns))
+		allPatterns = append(allPatterns, withSource(customPatterns, customIgnoreFile)...)
+		logger.WithOperation("load_ignore").Info("Loaded custom ignore file", "file", customIgnoreFile, "patterns", len(customPatterns))
 	}
 
 	// Load automatic ignore files (.mtcignore and .gitignore) only if loadIgnoreFile is true
 	if loadIgnoreFile {
-		var err error
-		ignorePatterns, err = FindIgnoreFiles()
+		ignorePatterns, err := FindIgnoreFilesWithSources(ignoreFileName)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load ignore files: %w", err)
 		}
 		allPatterns = append(allPatterns, ignorePatterns...)
 		if len(ignorePatterns) > 0 {
-			logger.Info("Loaded automatic ignore files", "patterns", len(ignorePatterns))
+			logger.WithOperation("load_ignore").Info("Loaded automatic ignore files", "patterns", len(ignorePatterns))
 		}
 	}
 
-	if len(allPatterns) == 0 {
-		return &noOpMatcher{}, nil
-	}
+	return allPatterns, nil
+}
 
-	return NewPatternMatcher(allPatterns), nil
+// withSource annotates each pattern with the given source.
+func withSource(patterns []string, source string) []SourcedPattern {
+	sourced := make([]SourcedPattern, 0, len(patterns))
+	for _, p := range patterns {
+		sourced = append(sourced, SourcedPattern{Pattern: p, Source: source})
+	}
+	return sourced
 }
 
 // noOpMatcher is a Matcher implementation that never matches anything.
@@ -552,3 +734,8 @@ type noOpMatcher struct{}
 func (n *noOpMatcher) Match(path string, isDir bool) bool {
 	return false
 }
+
+// Explain never excludes a path and reports no pattern.
+func (n *noOpMatcher) Explain(path string, isDir bool) (bool, string) {
+	return false, ""
+}
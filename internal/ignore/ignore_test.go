@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/lucho00cuba/mtc/internal/logger"
@@ -177,6 +178,77 @@ func TestPatternMatcher_Match(t *testing.T) {
 	}
 }
 
+func TestPatternMatcher_Explain(t *testing.T) {
+	tests := []struct {
+		name        string
+		patterns    []string
+		path        string
+		wantExclude bool
+		wantPattern string
+	}{
+		{
+			name:        "no match",
+			patterns:    []string{"*.log"},
+			path:        "main.go",
+			wantExclude: false,
+			wantPattern: "",
+		},
+		{
+			name:        "exclusion reported",
+			patterns:    []string{"node_modules", "*.log"},
+			path:        "logs/app.log",
+			wantExclude: true,
+			wantPattern: "*.log",
+		},
+		{
+			name:        "negation reported",
+			patterns:    []string{"*.log", "!important.log"},
+			path:        "important.log",
+			wantExclude: false,
+			wantPattern: "!important.log",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := NewPatternMatcher(tt.patterns)
+			excluded, pat := pm.Explain(tt.path, false)
+			if excluded != tt.wantExclude || pat != tt.wantPattern {
+				t.Errorf("PatternMatcher.Explain(%q) = (%v, %q), want (%v, %q)", tt.path, excluded, pat, tt.wantExclude, tt.wantPattern)
+			}
+			if excluded != pm.Match(tt.path, false) {
+				t.Errorf("PatternMatcher.Explain(%q) disagrees with Match", tt.path)
+			}
+		})
+	}
+}
+
+func TestCollectPatterns(t *testing.T) {
+	tmpDir := t.TempDir()
+	customPath := filepath.Join(tmpDir, "custom.ignore")
+	if err := os.WriteFile(customPath, []byte("*.tmp\n"), 0644); err != nil {
+		t.Fatalf("Failed to create custom ignore file: %v", err)
+	}
+
+	sourced, err := CollectPatterns([]string{"node_modules"}, tmpDir, false, customPath, "")
+	if err != nil {
+		t.Fatalf("CollectPatterns() error = %v", err)
+	}
+
+	want := []SourcedPattern{
+		{Pattern: "node_modules", Source: SourceCommandLine},
+		{Pattern: "*.tmp", Source: customPath},
+	}
+	if len(sourced) != len(want) {
+		t.Fatalf("CollectPatterns() got %d patterns, want %d: %v", len(sourced), len(want), sourced)
+	}
+	for i := range want {
+		if sourced[i] != want[i] {
+			t.Errorf("CollectPatterns()[%d] = %+v, want %+v", i, sourced[i], want[i])
+		}
+	}
+}
+
 func TestLoadIgnoreFile(t *testing.T) {
 	// Create a temporary directory
 	tmpDir := t.TempDir()
@@ -296,6 +368,68 @@ func TestLoadCustomIgnoreFile(t *testing.T) {
 	}
 }
 
+func TestFindIgnoreFiles_Name(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		".mtcignore":      "*.log\n",
+		".gitignore":      "*.tmp\n",
+		".checksumignore": "build/\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	oldWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer func() {
+		if err := os.Chdir(oldWd); err != nil {
+			t.Errorf("Failed to restore working directory: %v", err)
+		}
+	}()
+
+	sourced, err := FindIgnoreFilesWithSources(".checksumignore")
+	if err != nil {
+		t.Fatalf("FindIgnoreFilesWithSources() error = %v", err)
+	}
+	want := SourcedPattern{Pattern: "build/", Source: filepath.Join(tmpDir, ".checksumignore")}
+	if len(sourced) != 1 || sourced[0] != want {
+		t.Errorf("FindIgnoreFilesWithSources() = %v, want only %+v", sourced, want)
+	}
+
+	// The name is passed per call: other callers still discover the default files
+	patterns, err := FindIgnoreFiles("")
+	if err != nil {
+		t.Fatalf("FindIgnoreFiles() error = %v", err)
+	}
+	if len(patterns) != 2 || patterns[0] != "*.log" || patterns[1] != "*.tmp" {
+		t.Errorf("FindIgnoreFiles(\"\") = %v, want [*.log *.tmp]", patterns)
+	}
+
+	collected, err := CollectPatterns(nil, tmpDir, true, "", ".checksumignore")
+	if err != nil {
+		t.Fatalf("CollectPatterns() error = %v", err)
+	}
+	if len(collected) != 1 || collected[0] != want {
+		t.Errorf("CollectPatterns() = %v, want only %+v", collected, want)
+	}
+
+	for _, name := range []string{"../.checksumignore", "dir/.checksumignore", ".", ".."} {
+		if err := ValidateIgnoreFileName(name); err == nil {
+			t.Errorf("ValidateIgnoreFileName(%q) expected error", name)
+		}
+		if _, err := FindIgnoreFiles(name); err == nil {
+			t.Errorf("FindIgnoreFiles(%q) expected error", name)
+		}
+	}
+}
+
 func TestNewMatcher(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -372,7 +506,7 @@ func TestNewMatcher(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			matcher, err := NewMatcher(tt.patterns, tmpDir, tt.loadIgnoreFile, tt.customIgnoreFile)
+			matcher, err := NewMatcher(tt.patterns, tmpDir, tt.loadIgnoreFile, tt.customIgnoreFile, "")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewMatcher() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -384,6 +518,176 @@ func TestNewMatcher(t *testing.T) {
 	}
 }
 
+func TestParsePrecedence(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{input: "", want: nil},
+		{input: "custom,cli,mtcignore,gitignore", want: DefaultPrecedence},
+		{input: "cli", want: []string{"cli", "custom", "mtcignore", "gitignore"}},
+		{input: " GitIgnore , mtcignore", want: []string{"gitignore", "mtcignore", "custom", "cli"}},
+		{input: "cli,unknown", wantErr: true},
+		{input: "cli,cli", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePrecedence(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePrecedence(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ParsePrecedence(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMatcherWithPrecedence(t *testing.T) {
+	tmpDir := t.TempDir()
+	customPath := filepath.Join(tmpDir, "custom.ignore")
+	if err := os.WriteFile(customPath, []byte("!keep.log\n"), 0644); err != nil {
+		t.Fatalf("Failed to create custom ignore file: %v", err)
+	}
+	patterns := []string{"*.log"}
+
+	tests := []struct {
+		name         string
+		precedence   string
+		wantExcluded bool
+	}{
+		// By default any matching negation wins
+		{name: "default", precedence: "", wantExcluded: false},
+		{name: "custom first", precedence: "custom,cli", wantExcluded: false},
+		{name: "cli first", precedence: "cli,custom", wantExcluded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			precedence, err := ParsePrecedence(tt.precedence)
+			if err != nil {
+				t.Fatalf("ParsePrecedence() error = %v", err)
+			}
+			matcher, err := NewMatcherWithPrecedence(patterns, tmpDir, false, customPath, "", precedence)
+			if err != nil {
+				t.Fatalf("NewMatcherWithPrecedence() error = %v", err)
+			}
+			if got := matcher.Match("keep.log", false); got != tt.wantExcluded {
+				t.Errorf("Match(keep.log) = %v, want %v", got, tt.wantExcluded)
+			}
+			if !matcher.Match("other.log", false) {
+				t.Error("Match(other.log) should be excluded by the command-line pattern")
+			}
+			if matcher.Match("main.go", false) {
+				t.Error("Match(main.go) should not be excluded")
+			}
+		})
+	}
+}
+
+func TestDockerMatcher_Match(t *testing.T) {
+	dm := NewDockerMatcher([]string{
+		"# comment",
+		"node_modules",
+		"/build/",
+		"**/*.log",
+		"docs/*.md",
+		"!docs/README.md",
+		"secrets",
+		"!secrets",
+		"tmp",
+		"!tmp/keep",
+		"tmp/keep/*.bak",
+	})
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		// Patterns are anchored at the root
+		{path: "node_modules", isDir: true, want: true},
+		{path: "node_modules/pkg/index.js", want: true},
+		{path: "app/node_modules", isDir: true, want: false},
+		// A leading "/" is redundant and a trailing "/" does not restrict to directories
+		{path: "build", want: true},
+		{path: "build/out.bin", want: true},
+		{path: "src/build", isDir: true, want: false},
+		// "**" matches any number of directories, including none
+		{path: "debug.log", want: true},
+		{path: "a/b/debug.log", want: true},
+		// "*" does not cross directories
+		{path: "docs/guide.md", want: true},
+		{path: "docs/api/guide.md", want: false},
+		// The last matching pattern decides
+		{path: "docs/README.md", want: false},
+		{path: "secrets", want: false},
+		{path: "tmp/cache", want: true},
+		{path: "tmp/keep/data.txt", want: false},
+		{path: "tmp/keep/data.bak", want: true},
+		{path: "src/main.go", want: false},
+		{path: ".", isDir: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := dm.Match(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("Match(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDockerignore(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	patterns, err := LoadDockerignore(tmpDir)
+	if err != nil || patterns != nil {
+		t.Fatalf("LoadDockerignore() without a file = %v, %v; want nil, nil", patterns, err)
+	}
+
+	content := "# build context\n.git\n*.tmp\n!keep.tmp\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, DockerignoreFile), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write .dockerignore: %v", err)
+	}
+	patterns, err = LoadDockerignore(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadDockerignore() error = %v", err)
+	}
+	if len(patterns) != 3 {
+		t.Fatalf("LoadDockerignore() returned %d patterns, want 3: %v", len(patterns), patterns)
+	}
+
+	dm := NewDockerMatcher(patterns)
+	for path, want := range map[string]bool{".git": true, "a.tmp": true, "keep.tmp": false, "sub/a.tmp": false, "main.go": false} {
+		if got := dm.Match(path, false); got != want {
+			t.Errorf("Match(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	foo := Fingerprint([]string{"foo"})
+	if len(foo) != 2*FingerprintSize {
+		t.Errorf("Fingerprint() = %q, want %d hexadecimal characters", foo, 2*FingerprintSize)
+	}
+	if bar := Fingerprint([]string{"bar"}); foo == bar {
+		t.Errorf("Fingerprint(foo) and Fingerprint(bar) should differ, both %s", foo)
+	}
+	if Fingerprint(nil) == foo {
+		t.Error("Fingerprint(nil) should differ from Fingerprint(foo)")
+	}
+
+	// Order, duplicates, whitespace and comments do not matter
+	a := Fingerprint([]string{"*.log", "node_modules", "# comment", ""})
+	b := Fingerprint([]string{" node_modules ", "*.log", "node_modules"})
+	if a != b {
+		t.Errorf("Equivalent pattern sets fingerprint differently: %s vs %s", a, b)
+	}
+}
+
 func TestNoOpMatcher(t *testing.T) {
 	matcher := &noOpMatcher{}
 
@@ -450,6 +754,58 @@ func TestMatchGlob(t *testing.T) {
 	}
 }
 
+func TestParseSizeRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		size    int64
+		want    bool
+		wantErr bool
+	}{
+		{rule: ">100M", size: 100<<20 + 1, want: true},
+		{rule: ">100M", size: 100 << 20, want: false},
+		{rule: ">=100M", size: 100 << 20, want: true},
+		{rule: "<1K", size: 1023, want: true},
+		{rule: "<= 1K", size: 1024, want: true},
+		{rule: "<=1K", size: 1025, want: false},
+		{rule: "=0", size: 0, want: true},
+		{rule: "100M", wantErr: true},
+		{rule: ">lots", wantErr: true},
+		{rule: ">", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			rule, err := ParseSizeRule(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSizeRule(%q) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := rule.Match(tt.size); got != tt.want {
+				t.Errorf("ParseSizeRule(%q).Match(%d) = %v, want %v", tt.rule, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatternMatcher_MatchSize(t *testing.T) {
+	pm := NewPatternMatcher([]string{"@size >1K", "@size lots", "*.log"})
+	if !pm.MatchSize(2048) {
+		t.Error("MatchSize(2048) = false, want true for \"@size >1K\"")
+	}
+	if pm.MatchSize(1024) {
+		t.Error("MatchSize(1024) = true, want false for \"@size >1K\"")
+	}
+	// Size rules never match paths, and path patterns still do
+	if pm.Match("@size >1K", false) {
+		t.Error("Match() should not treat a size rule as a path pattern")
+	}
+	if !pm.Match("debug.log", false) {
+		t.Error("Match(\"debug.log\") = false, want true")
+	}
+}
+
 func TestPatternMatchSegments(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -496,6 +852,66 @@ func TestPatternMatchSegments(t *testing.T) {
 	}
 }
 
+func TestPatternMatcher_DoubleStar(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		// Trailing **: everything inside a directory named a, at any level, but not a itself
+		{pattern: "a/**", path: "a/file.txt", want: true},
+		{pattern: "a/**", path: "a/x/y/file.txt", want: true},
+		{pattern: "a/**", path: "project/a/file.txt", want: true},
+		{pattern: "a/**", path: "a", isDir: true, want: false},
+		{pattern: "a/**", path: "ab/file.txt", want: false},
+		{pattern: "a/**", path: "b/file.txt", want: false},
+		// Leading **: b at any depth, ending the path
+		{pattern: "**/b", path: "b", want: true},
+		{pattern: "**/b", path: "x/b", isDir: true, want: true},
+		{pattern: "**/b", path: "x/y/b", want: true},
+		{pattern: "**/b", path: "x/bb", want: false},
+		{pattern: "**/b", path: "b/x", want: false},
+		{pattern: "**/*.log", path: "logs/2024/app.log", want: true},
+		// Middle **: zero or more directories between a and b
+		{pattern: "a/**/b", path: "a/b", want: true},
+		{pattern: "a/**/b", path: "a/x/b", want: true},
+		{pattern: "a/**/b", path: "a/x/y/b", want: true},
+		{pattern: "a/**/b", path: "project/a/x/b", want: true},
+		{pattern: "a/**/b", path: "a/x/b/c", want: false},
+		{pattern: "a/**/b", path: "a/x/c", want: false},
+		{pattern: "a/**/b", path: "b", want: false},
+		// Leading and trailing **: everything inside a directory named a
+		{pattern: "**/a/**", path: "x/a/file.txt", want: true},
+		{pattern: "**/a/**", path: "x/a", isDir: true, want: false},
+		// A lone ** matches everything
+		{pattern: "**", path: "x/y", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			pm := NewPatternMatcher([]string{tt.pattern})
+			if got := pm.Match(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("Match(%q, %v) with %q = %v, want %v", tt.path, tt.isDir, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatternMatcher_DoubleStarNegation(t *testing.T) {
+	// "build/**" leaves the build directory itself in place, so a file inside it can be kept
+	pm := NewPatternMatcher([]string{"build/**", "!build/keep.txt"})
+	if pm.Match("build", true) {
+		t.Error("Match(\"build\") = true, want false: only its contents are excluded")
+	}
+	if !pm.Match("build/out.bin", false) {
+		t.Error("Match(\"build/out.bin\") = false, want true")
+	}
+	if pm.Match("build/keep.txt", false) {
+		t.Error("Match(\"build/keep.txt\") = true, want false")
+	}
+}
+
 // Helper function
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr ||
@@ -0,0 +1,139 @@
+// Package ignore (precedence.go) provides configurable precedence between pattern sources.
+// By default all patterns are matched together and any matching negation wins. With an
+// explicit precedence, each source is matched on its own and the highest-priority source
+// with a matching pattern decides, so e.g. command-line patterns can override a negation
+// in .gitignore, or .gitignore can take priority over .mtcignore.
+package ignore
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Pattern sources that can be ordered with ParsePrecedence.
+const (
+	// PrecedenceCustom is the custom ignore file given with --ignore-file.
+	PrecedenceCustom = "custom"
+	// PrecedenceCommandLine are the patterns given with -e/--exclude.
+	PrecedenceCommandLine = "cli"
+	// PrecedenceMtcignore are the patterns of the discovered .mtcignore files.
+	PrecedenceMtcignore = "mtcignore"
+	// PrecedenceGitignore are the patterns of the discovered .gitignore files.
+	PrecedenceGitignore = "gitignore"
+)
+
+// DefaultPrecedence is the documented priority of pattern sources, highest first.
+var DefaultPrecedence = []string{PrecedenceCustom, PrecedenceCommandLine, PrecedenceMtcignore, PrecedenceGitignore}
+
+// ParsePrecedence parses a comma-separated list of pattern sources in priority order,
+// highest first (e.g. "cli,gitignore"). Sources that are not listed keep their default
+// relative order after the listed ones. An empty string returns nil.
+//
+// Parameters:
+//   - s: The comma-separated list of sources
+//
+// Returns the full priority order of all sources, or an error for unknown or repeated sources.
+func ParsePrecedence(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var order []string
+	for _, field := range strings.Split(s, ",") {
+		source := strings.ToLower(strings.TrimSpace(field))
+		if !slices.Contains(DefaultPrecedence, source) {
+			return nil, fmt.Errorf("unknown pattern source %q (expected one of %s)", field, strings.Join(DefaultPrecedence, ", "))
+		}
+		if slices.Contains(order, source) {
+			return nil, fmt.Errorf("pattern source %q listed more than once", source)
+		}
+		order = append(order, source)
+	}
+	for _, source := range DefaultPrecedence {
+		if !slices.Contains(order, source) {
+			order = append(order, source)
+		}
+	}
+	return order, nil
+}
+
+// NewMatcherWithPrecedence creates a matcher like NewMatcher, but matches each pattern
+// source separately and lets the highest-priority source with a matching pattern decide.
+// Within a source, a matching negation still overrides that source's exclusions.
+// With an empty precedence it is equivalent to NewMatcher.
+//
+// Parameters:
+//   - patterns: Command-line exclusion patterns to include
+//   - rootPath: The root path being hashed (used for context, not for loading ignore files)
+//   - loadIgnoreFile: If true, automatically loads .mtcignore and .gitignore files
+//   - customIgnoreFile: Optional path to a custom ignore file (always loaded if provided)
+//   - ignoreFileName: Optional name of the ignore file loaded instead of .mtcignore and .gitignore
+//   - precedence: The sources in priority order, highest first, as returned by ParsePrecedence
+//
+// Returns a Matcher instance ready to use, or an error if an ignore file cannot be loaded.
+func NewMatcherWithPrecedence(patterns []string, rootPath string, loadIgnoreFile bool, customIgnoreFile, ignoreFileName string, precedence []string) (Matcher, error) {
+	if len(precedence) == 0 {
+		return NewMatcher(patterns, rootPath, loadIgnoreFile, customIgnoreFile, ignoreFileName)
+	}
+
+	sourced, err := CollectPatterns(patterns, rootPath, loadIgnoreFile, customIgnoreFile, ignoreFileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(sourced) == 0 {
+		return &noOpMatcher{}, nil
+	}
+
+	bySource := make(map[string][]string)
+	for _, sp := range sourced {
+		kind := sourceKind(sp.Source, customIgnoreFile)
+		bySource[kind] = append(bySource[kind], sp.Pattern)
+	}
+
+	lm := &layeredMatcher{}
+	for _, source := range precedence {
+		if len(bySource[source]) > 0 {
+			lm.layers = append(lm.layers, NewPatternMatcher(bySource[source]))
+		}
+	}
+	return lm, nil
+}
+
+// sourceKind maps the source recorded by CollectPatterns to a precedence source.
+func sourceKind(source, customIgnoreFile string) string {
+	switch {
+	case source == SourceCommandLine:
+		return PrecedenceCommandLine
+	case customIgnoreFile != "" && source == customIgnoreFile:
+		return PrecedenceCustom
+	case filepath.Base(source) == ".gitignore":
+		return PrecedenceGitignore
+	default:
+		return PrecedenceMtcignore
+	}
+}
+
+// layeredMatcher matches paths against pattern sources in priority order.
+type layeredMatcher struct {
+	// layers holds one matcher per source, highest priority first
+	layers []*PatternMatcher
+}
+
+// Match returns the verdict of the highest-priority source with a pattern matching the path.
+func (lm *layeredMatcher) Match(path string, isDir bool) bool {
+	excluded, _ := lm.Explain(path, isDir)
+	return excluded
+}
+
+// Explain returns the verdict of the highest-priority source with a pattern matching the
+// path, and that pattern.
+func (lm *layeredMatcher) Explain(path string, isDir bool) (bool, string) {
+	for _, layer := range lm.layers {
+		if excluded, pattern := layer.Explain(path, isDir); pattern != "" {
+			return excluded, pattern
+		}
+	}
+	return false, ""
+}
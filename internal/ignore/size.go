@@ -0,0 +1,115 @@
+// Package ignore (size.go) provides size-based exclusion rules. A line such as
+// "@size >100M" in an ignore file, or the same pattern given with -e, excludes files by
+// their size instead of their path. Matchers built from such patterns report them
+// through the SizeMatcher interface, since Match only sees paths.
+package ignore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/lucho00cuba/mtc/internal/units"
+)
+
+// SizePrefix starts a size-based exclusion pattern, e.g. "@size >100M".
+const SizePrefix = "@size"
+
+// sizeOps lists the comparison operators of size rules, longest first so ">=" is not
+// parsed as ">" followed by "=".
+var sizeOps = []string{">=", "<=", ">", "<", "="}
+
+// SizeRule excludes files whose size satisfies a comparison, such as "larger than 100 MiB".
+type SizeRule struct {
+	op    string
+	bytes int64
+}
+
+// ParseSizeRule parses a size condition: a comparison operator (>, >=, <, <= or =)
+// followed by a size with an optional K, M, G or T suffix, e.g. ">100M" or "<= 1K".
+//
+// Parameters:
+//   - s: The condition to parse
+//
+// Returns the rule, or an error if the operator or size is invalid.
+func ParseSizeRule(s string) (SizeRule, error) {
+	s = strings.TrimSpace(s)
+	for _, op := range sizeOps {
+		if rest, ok := strings.CutPrefix(s, op); ok {
+			bytes, err := units.ParseSize(rest)
+			if err != nil {
+				return SizeRule{}, fmt.Errorf("invalid size rule %q: %w", s, err)
+			}
+			return SizeRule{op: op, bytes: bytes}, nil
+		}
+	}
+	return SizeRule{}, fmt.Errorf("invalid size rule %q (expected >, >=, <, <= or = followed by a size, e.g. >100M)", s)
+}
+
+// Match reports whether a file of the given size is excluded by the rule.
+func (r SizeRule) Match(size int64) bool {
+	switch r.op {
+	case ">":
+		return size > r.bytes
+	case ">=":
+		return size >= r.bytes
+	case "<":
+		return size < r.bytes
+	case "<=":
+		return size <= r.bytes
+	default:
+		return size == r.bytes
+	}
+}
+
+// String returns the rule as a pattern, with its size in bytes, e.g. "@size >104857600".
+func (r SizeRule) String() string {
+	return fmt.Sprintf("%s %s%d", SizePrefix, r.op, r.bytes)
+}
+
+// SizeMatcher is implemented by matchers that also exclude files by size.
+type SizeMatcher interface {
+	// MatchSize returns true if a file of the given size should be excluded.
+	MatchSize(size int64) bool
+}
+
+// sizeCondition returns the condition of a size-based pattern ("@size >100M" gives
+// ">100M"), or false if the pattern matches paths.
+func sizeCondition(pattern string) (string, bool) {
+	rest, ok := strings.CutPrefix(pattern, SizePrefix)
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		return "", false
+	}
+	return rest, true
+}
+
+// compileSizeRule parses a size-based pattern for a matcher. Invalid rules are logged and
+// skipped, like the rest of an ignore file is used when one line is malformed.
+func compileSizeRule(pattern, condition string) (SizeRule, bool) {
+	rule, err := ParseSizeRule(condition)
+	if err != nil {
+		logger.WithOperation("load_ignore").Warn("Skipping invalid size rule", "pattern", pattern, "error", err)
+		return SizeRule{}, false
+	}
+	return rule, true
+}
+
+// MatchSize returns true if a file of the given size is excluded by a size rule.
+func (pm *PatternMatcher) MatchSize(size int64) bool {
+	for _, rule := range pm.sizeRules {
+		if rule.Match(size) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchSize returns true if a file of the given size is excluded by a size rule of any source.
+func (lm *layeredMatcher) MatchSize(size int64) bool {
+	for _, layer := range lm.layers {
+		if layer.MatchSize(size) {
+			return true
+		}
+	}
+	return false
+}
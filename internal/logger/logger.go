@@ -7,6 +7,28 @@ import (
 	"io"
 	"log/slog"
 	"os"
+
+	"github.com/lucho00cuba/mtc/version"
+)
+
+// Standard log field names. Every log line carries FieldVersion; lines emitted
+// while performing an operation carry FieldOperation. The remaining fields are
+// used consistently across packages so logs can be aggregated and queried.
+const (
+	// FieldVersion is the MTC version that emitted the log line.
+	FieldVersion = "mtc_version"
+	// FieldOperation names the operation being performed (e.g. "hash", "hash_file").
+	FieldOperation = "operation"
+	// FieldPath is the file or directory path the line refers to.
+	FieldPath = "path"
+	// FieldDuration is the elapsed time of the operation.
+	FieldDuration = "duration"
+	// FieldHash is a hexadecimal Merkle hash.
+	FieldHash = "hash"
+	// FieldSize is a size in raw bytes (always an integer, never a human-readable string).
+	FieldSize = "size"
+	// FieldError is the error that caused a failure.
+	FieldError = "error"
 )
 
 var (
@@ -20,7 +42,7 @@ var (
 
 // Init initializes the logger with the specified level and format.
 // If format is "json", logs will be in JSON format; otherwise, human-readable text.
-// If output is nil, os.Stderr is used.
+// If output is nil, os.Stderr is used. Every line is tagged with the MTC version (FieldVersion).
 func Init(level string, format string, output io.Writer) {
 	if output == nil {
 		output = os.Stderr
@@ -52,7 +74,17 @@ func Init(level string, format string, output io.Writer) {
 		handler = slog.NewTextHandler(output, opts)
 	}
 
-	defaultLogger = slog.New(handler)
+	defaultLogger = slog.New(handler).With(FieldVersion, version.VERSION)
+}
+
+// AddAttrs adds the given key-value pairs to every line logged from now on, e.g. a run ID
+// injected from the command line to correlate logs across a pipeline. It must be called
+// after Init, which resets the attributes.
+//
+// Parameters:
+//   - args: Key-value pairs to add to the default logger (e.g., "run_id", "42")
+func AddAttrs(args ...any) {
+	defaultLogger = Logger().With(args...)
 }
 
 // Logger returns the default logger instance.
@@ -122,3 +154,15 @@ func Error(msg string, args ...any) {
 func With(args ...any) *slog.Logger {
 	return Logger().With(args...)
 }
+
+// WithOperation returns a logger whose lines carry the given operation name
+// (under FieldOperation) followed by the given key-value pairs.
+//
+// Parameters:
+//   - operation: The name of the operation being performed (e.g. "hash_file")
+//   - args: Additional key-value pairs to add to the logger context
+//
+// Returns a new logger instance with the context added.
+func WithOperation(operation string, args ...any) *slog.Logger {
+	return Logger().With(append([]any{FieldOperation, operation}, args...)...)
+}
@@ -2,9 +2,12 @@ package logger
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"strings"
 	"testing"
+
+	"github.com/lucho00cuba/mtc/version"
 )
 
 func TestInit(t *testing.T) {
@@ -146,6 +149,27 @@ func TestWith(t *testing.T) {
 	}
 }
 
+func TestWithOperation(t *testing.T) {
+	var buf bytes.Buffer
+	Init("info", "json", &buf)
+
+	WithOperation("hash_file", FieldPath, "/tmp/file", FieldSize, int64(1024)).Info("message")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to parse JSON log line %q: %v", buf.String(), err)
+	}
+	if entry[FieldOperation] != "hash_file" {
+		t.Errorf("Expected %s=hash_file, got %v", FieldOperation, entry[FieldOperation])
+	}
+	if entry[FieldVersion] != version.VERSION {
+		t.Errorf("Expected %s=%s, got %v", FieldVersion, version.VERSION, entry[FieldVersion])
+	}
+	if size, ok := entry[FieldSize].(float64); !ok || size != 1024 {
+		t.Errorf("Expected numeric %s=1024, got %v (%T)", FieldSize, entry[FieldSize], entry[FieldSize])
+	}
+}
+
 func TestLogLevels(t *testing.T) {
 	levels := []string{"debug", "info", "warn", "error", "invalid"}
 
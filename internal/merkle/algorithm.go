@@ -0,0 +1,147 @@
+// Package merkle (algorithm.go) provides the selectable node hash algorithms.
+// BLAKE3 is the default; SHA-256, SHA3-256 and SHA3-512 are available for environments
+// that require a FIPS hash or interoperability with tools such as sha256sum. The
+// algorithm is used for every node in the tree (file leaves, symlink leaves and directory
+// combinations), so roots computed with different algorithms are never comparable.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha3"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/zeebo/blake3"
+)
+
+// Algorithm names a node hash algorithm.
+type Algorithm string
+
+const (
+	// AlgorithmBLAKE3 is the default algorithm, producing 32-byte hashes.
+	AlgorithmBLAKE3 Algorithm = "blake3"
+	// AlgorithmSHA256 is SHA-256 (FIPS 180-4), producing 32-byte hashes.
+	AlgorithmSHA256 Algorithm = "sha256"
+	// AlgorithmSHA3_256 is SHA3-256 (FIPS 202), producing 32-byte hashes.
+	AlgorithmSHA3_256 Algorithm = "sha3-256"
+	// AlgorithmSHA3_512 is SHA3-512 (FIPS 202), producing 64-byte hashes.
+	AlgorithmSHA3_512 Algorithm = "sha3-512"
+)
+
+// Algorithms lists the supported algorithms, default first.
+var Algorithms = []Algorithm{AlgorithmBLAKE3, AlgorithmSHA256, AlgorithmSHA3_256, AlgorithmSHA3_512}
+
+// ParseAlgorithm parses an algorithm name case-insensitively. An empty name selects
+// the default, BLAKE3.
+//
+// Parameters:
+//   - name: The algorithm name (e.g. "blake3", "sha3-256")
+//
+// Returns the algorithm, or an error if the name is not supported.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return AlgorithmBLAKE3, nil
+	}
+	for _, a := range Algorithms {
+		if Algorithm(name) == a {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("unknown hash algorithm %q (supported: blake3, sha256, sha3-256, sha3-512)", name)
+}
+
+// New returns a new hasher for the algorithm. The zero value selects BLAKE3.
+func (a Algorithm) New() hash.Hash {
+	switch a {
+	case AlgorithmSHA256:
+		return sha256.New()
+	case AlgorithmSHA3_256:
+		return sha3.New256()
+	case AlgorithmSHA3_512:
+		return sha3.New512()
+	default:
+		return blake3.New()
+	}
+}
+
+// Size returns the size in bytes of the hashes the algorithm produces.
+func (a Algorithm) Size() int {
+	if a == AlgorithmSHA3_512 {
+		return 64
+	}
+	return HashSize
+}
+
+// CombineResults combines independent roots with the algorithm, exactly like the
+// package-level CombineResults does with BLAKE3.
+//
+// Parameters:
+//   - results: The roots to combine
+//   - unordered: Whether to sort the roots by hash before combining them
+//
+// Returns the combined result and any error encountered while hashing.
+func (a Algorithm) CombineResults(results []Result, unordered bool) (Result, error) {
+	children := make([]childResult, len(results))
+	for i, result := range results {
+		children[i] = childResult{isDir: true, result: result}
+	}
+	if unordered {
+		sort.SliceStable(children, func(i, j int) bool {
+			return bytes.Compare(children[i].result.Hash, children[j].result.Hash) < 0
+		})
+	}
+	return combineResults(a, children)
+}
+
+// CombineNamed combines the results of a directory's entries with the algorithm, exactly
+// like the package-level CombineNamed does with BLAKE3.
+//
+// Parameters:
+//   - named: The entries of the directory, each listed once
+//
+// Returns the directory result, or an error if a name is empty or listed twice, or a type
+// is invalid.
+func (a Algorithm) CombineNamed(named []NamedResult) (Result, error) {
+	children := make([]childResult, len(named))
+	for i, n := range named {
+		if n.Name == "" {
+			return Result{}, fmt.Errorf("entry %d has no name", i)
+		}
+		if _, err := ParseNodeType(n.Type.String()); err != nil {
+			return Result{}, fmt.Errorf("entry %q: %w", n.Name, err)
+		}
+		children[i] = childResult{name: n.Name, isDir: n.Type == NodeDir, isLink: n.Type == NodeSymlink, result: n.Result}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].name < children[j].name
+	})
+	for i := 1; i < len(children); i++ {
+		if children[i].name == children[i-1].name {
+			return Result{}, fmt.Errorf("entry %q is listed twice", children[i].name)
+		}
+	}
+	return combineResults(a, children)
+}
+
+// SetAlgorithm selects the node hash algorithm. The zero value selects BLAKE3.
+// Changes the root hash.
+func (e *Engine) SetAlgorithm(algorithm Algorithm) {
+	e.algorithm = algorithm
+}
+
+// Algorithm returns the engine's node hash algorithm.
+func (e *Engine) Algorithm() Algorithm {
+	if e.algorithm == "" {
+		return AlgorithmBLAKE3
+	}
+	return e.algorithm
+}
+
+// newHash returns a new hasher for the engine's algorithm.
+func (e *Engine) newHash() hash.Hash {
+	return e.algorithm.New()
+}
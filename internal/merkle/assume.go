@@ -0,0 +1,72 @@
+// Package merkle (assume.go) provides assumed subtree hashes.
+// An assumed hash is substituted for a file or directory instead of hashing it, so
+// incremental pipelines that already know a subtree's root only hash what changed.
+// The resulting root is identical to a full computation when the assumed hash is correct.
+package merkle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SetAssumedHashes registers precomputed hashes for paths inside the tree, keyed by
+// slash-separated path relative to the root being hashed ("." is the root itself).
+// Assumed entries are not read: their hash is taken as given and their size is computed
+// from directory entries only. Excluded paths stay excluded. Passing nil or an empty map
+// clears all assumptions.
+//
+// Parameters:
+//   - assumed: A map from relative path to the hash to assume for it
+//
+// Returns an error if a path is absolute or points outside the root.
+func (e *Engine) SetAssumedHashes(assumed map[string][]byte) error {
+	if len(assumed) == 0 {
+		e.assumed = nil
+		return nil
+	}
+
+	normalized := make(map[string][]byte, len(assumed))
+	for rel, hash := range assumed {
+		clean := filepath.Clean(filepath.FromSlash(rel))
+		if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("assumed path %q must be relative to the root", rel)
+		}
+		normalized[filepath.ToSlash(clean)] = hash
+	}
+	e.assumed = normalized
+	return nil
+}
+
+// assumedResult returns the assumed result for absPath, if one was registered.
+// The size is computed without reading file contents so totals stay accurate.
+//
+// Parameters:
+//   - absPath: The absolute path of the entry
+//   - info: The entry's file info (from Lstat)
+//
+// Returns the assumed result, whether an assumption applies, and any error encountered
+// while computing the size.
+func (e *Engine) assumedResult(absPath string, info os.FileInfo) (Result, bool, error) {
+	if e.assumed == nil || e.rootPath == "" {
+		return Result{}, false, nil
+	}
+	rel, err := filepath.Rel(e.rootPath, absPath)
+	if err != nil {
+		return Result{}, false, nil
+	}
+	hash, ok := e.assumed[filepath.ToSlash(rel)]
+	if !ok {
+		return Result{}, false, nil
+	}
+
+	size := info.Size()
+	if info.IsDir() {
+		size, err = e.sizeDir(absPath)
+		if err != nil {
+			return Result{}, false, err
+		}
+	}
+	return Result{Hash: hash, Size: size}, true, nil
+}
@@ -0,0 +1,47 @@
+// Package merkle (bom.go) provides UTF-8 byte order mark stripping for text files.
+// Some editors prefix text files with a BOM that carries no content, so two files with the
+// same text hash differently. With stripping, a leading BOM of a file detected as text is
+// skipped before hashing, giving a hash of the file's logical content.
+package merkle
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// utf8BOM is the UTF-8 encoding of the byte order mark U+FEFF.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// SetStripBOM makes the engine skip a leading UTF-8 byte order mark of text files before
+// hashing them, so a file hashes alike with and without one. A file counts as text when
+// its first SniffSize bytes hold no NUL byte, as for content classes; binary files are
+// hashed unchanged. Sizes still count the mark. Changes the root hash of trees holding
+// text files with a BOM.
+func (e *Engine) SetStripBOM(strip bool) {
+	e.stripBOM = strip
+}
+
+// stripsBOM reports whether a file starting with head has a byte order mark to skip.
+func (e *Engine) stripsBOM(head []byte) bool {
+	return e.stripBOM && bytes.HasPrefix(head, utf8BOM) && bytes.IndexByte(head[:min(len(head), SniffSize)], 0) < 0
+}
+
+// bomReader returns a reader of r's contents without a leading byte order mark, if the
+// engine strips them and r holds text, together with the number of bytes skipped.
+func (e *Engine) bomReader(r io.Reader) (io.Reader, int64, error) {
+	if !e.stripBOM {
+		return r, 0, nil
+	}
+	br := bufio.NewReaderSize(r, SniffSize)
+	head, err := br.Peek(SniffSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, 0, err
+	}
+	if !e.stripsBOM(head) {
+		return br, 0, nil
+	}
+	n, err := br.Discard(len(utf8BOM))
+	return br, int64(n), err
+}
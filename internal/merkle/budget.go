@@ -0,0 +1,56 @@
+// Package merkle (budget.go) provides byte-budgeted hashing.
+// With a byte budget, file contents are only read until the budget is used up; every
+// later file is hashed as a metadata leaf of its name and size. This bounds the time
+// spent on huge trees while still producing a representative, reproducible fingerprint.
+package merkle
+
+import (
+	"io"
+	"path/filepath"
+	"strconv"
+)
+
+// SetByteBudget limits how many bytes of file contents the engine reads. Files are
+// visited in sorted order; each one is read in full while the bytes read so far are
+// below the budget, and hashed from its name and size once the budget is used up.
+// Because the visiting order is fixed, the same files are content-hashed on every run.
+// Adaptive scheduling is ignored while a budget is set, to keep that order.
+// Zero or a negative value disables the budget. Changes the root hash once it is exceeded.
+//
+// Parameters:
+//   - bytes: The maximum number of bytes to read before falling back to metadata leaves
+func (e *Engine) SetByteBudget(bytes int64) {
+	if bytes < 0 {
+		bytes = 0
+	}
+	e.byteBudget = bytes
+	e.budgetUsed.Store(0)
+}
+
+// takeBudget reserves size bytes of the byte budget for a file about to be read.
+// It returns true if the file should be content-hashed, and false if the budget is
+// already used up. It always returns true when no budget is set.
+func (e *Engine) takeBudget(size int64) bool {
+	if e.byteBudget <= 0 {
+		return true
+	}
+	for {
+		used := e.budgetUsed.Load()
+		if used >= e.byteBudget {
+			return false
+		}
+		if e.budgetUsed.CompareAndSwap(used, used+size) {
+			return true
+		}
+	}
+}
+
+// metadataResult hashes a file from its name and size instead of its contents, as
+// "<name>\x00<size>". It is used for files visited after the byte budget is used up.
+func (e *Engine) metadataResult(path string, size int64) Result {
+	h := e.newHash()
+	_, _ = io.WriteString(h, filepath.Base(path))
+	_, _ = io.WriteString(h, "\x00")
+	_, _ = io.WriteString(h, strconv.FormatInt(size, 10))
+	return Result{Hash: h.Sum(nil), Size: size}
+}
@@ -0,0 +1,62 @@
+// Package merkle (bufpool.go) provides the engine's read buffer pool.
+// Buffers are recycled through a sync.Pool; the pool counts how many buffers it had
+// to allocate and how many requests were served by a recycled one, so memory pressure
+// can be diagnosed and the worker count tuned.
+package merkle
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// BufferStats reports how the engine's read buffers were obtained.
+type BufferStats struct {
+	// Allocated is the number of buffers newly allocated by the pool.
+	Allocated int64
+	// Reused is the number of requests served by a recycled buffer.
+	Reused int64
+}
+
+// bufferPool is a sync.Pool of fixed-size byte buffers that counts allocations and requests.
+type bufferPool struct {
+	pool      sync.Pool
+	allocated atomic.Int64
+	gets      atomic.Int64
+}
+
+// newBufferPool returns a pool of size-byte buffers.
+func newBufferPool(size int) *bufferPool {
+	p := &bufferPool{}
+	p.pool.New = func() interface{} {
+		p.allocated.Add(1)
+		buf := make([]byte, size)
+		return &buf
+	}
+	return p
+}
+
+// get returns a buffer from the pool, allocating one if none is available.
+func (p *bufferPool) get() (*[]byte, bool) {
+	p.gets.Add(1)
+	bufPtr, ok := p.pool.Get().(*[]byte)
+	return bufPtr, ok
+}
+
+// put returns a buffer to the pool for reuse.
+func (p *bufferPool) put(bufPtr *[]byte) {
+	p.pool.Put(bufPtr)
+}
+
+// stats returns the allocation and reuse counts so far.
+func (p *bufferPool) stats() BufferStats {
+	allocated := p.allocated.Load()
+	return BufferStats{Allocated: allocated, Reused: max(p.gets.Load()-allocated, 0)}
+}
+
+// BufferStats returns how many read buffers the engine has allocated and how many
+// requests were served by recycled buffers since it was created. Many allocations
+// relative to reuses indicate that concurrent workers hold more buffers than the pool
+// can recycle; lowering the worker count reduces memory use.
+func (e *Engine) BufferStats() BufferStats {
+	return e.bufferPool.stats()
+}
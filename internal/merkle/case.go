@@ -0,0 +1,51 @@
+// Package merkle (case.go) provides detection of case-colliding entry names.
+// Names such as "File.txt" and "file.txt" can coexist on Linux but not on the
+// case-insensitive filesystems of macOS and Windows, where one of them is lost when the
+// tree is copied. Such a tree hashes differently depending on where it lives, so the
+// engine warns about collisions, or refuses to hash them in strict mode.
+package merkle
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+)
+
+// SetStrictCase makes hashing fail when a directory holds two entries whose names differ
+// only by case. Without it such collisions are logged as warnings and hashed normally.
+func (e *Engine) SetStrictCase(strict bool) {
+	e.strictCase = strict
+}
+
+// checkCaseCollisions reports entries of a directory whose names differ only by case.
+// Every collision is logged as a warning; in strict mode the first one is returned as
+// an error.
+//
+// Parameters:
+//   - path: The absolute path to the directory
+//   - items: The directory's included entries, in sorted order
+//
+// Returns an error for the first collision in strict mode, and nil otherwise.
+func (e *Engine) checkCaseCollisions(path string, items []dirWorkItem) error {
+	if len(items) < 2 {
+		return nil
+	}
+	seen := make(map[string]string, len(items))
+	for _, item := range items {
+		name := item.entry.Name()
+		folded := strings.ToLower(name)
+		other, ok := seen[folded]
+		if !ok {
+			seen[folded] = name
+			continue
+		}
+		if e.strictCase {
+			return fmt.Errorf("entries %q and %q in %q differ only by case", other, name, path)
+		}
+		logger.WithOperation("hash_dir", "path", path).Warn("Entries differ only by case; the tree cannot be reproduced on case-insensitive filesystems",
+			"entry", other, "other", name)
+		e.diagnostics.add(DiagnosticCaseCollision, path, fmt.Sprintf("%q and %q", other, name))
+	}
+	return nil
+}
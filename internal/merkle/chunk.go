@@ -0,0 +1,142 @@
+// Package merkle (chunk.go) provides chunked file hashing.
+// Files larger than the engine's chunk size are split into fixed-size chunks, each
+// chunk is hashed on its own, and the file hash is the hash of the chunk hashes
+// concatenated in order. Chunk hashes pinpoint which part of a large file changed,
+// which enables deduplication and rsync-style transfers.
+package merkle
+
+import (
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+)
+
+// chunkHasher is an io.Writer that hashes a stream either as a single hash or,
+// when chunking applies, as a sequence of fixed-size chunk hashes.
+type chunkHasher struct {
+	// chunkSize is the chunk size in bytes, or 0 when the stream is hashed as a whole
+	chunkSize int64
+	// newHash creates the hashers for the stream, the chunks and the chunk combination
+	newHash func() hash.Hash
+	// current hashes the whole stream, or the current chunk when chunking
+	current hash.Hash
+	// filled is the number of bytes written to the current chunk
+	filled int64
+	// chunks holds the results of the completed chunks
+	chunks []Result
+}
+
+// newChunkHasher returns a hasher for a stream of total bytes. Chunking only applies
+// when chunkSize is positive and the stream is larger than one chunk, so small files
+// keep their single-stream hash.
+func newChunkHasher(newHash func() hash.Hash, chunkSize, total int64) *chunkHasher {
+	if chunkSize <= 0 || total <= chunkSize {
+		chunkSize = 0
+	}
+	return &chunkHasher{chunkSize: chunkSize, newHash: newHash, current: newHash()}
+}
+
+// Write hashes p, closing a chunk every chunkSize bytes.
+func (c *chunkHasher) Write(p []byte) (int, error) {
+	if c.chunkSize == 0 {
+		return c.current.Write(p)
+	}
+
+	written := 0
+	for len(p) > 0 {
+		part := p[:min(int64(len(p)), c.chunkSize-c.filled)]
+		if _, err := c.current.Write(part); err != nil {
+			return written, err
+		}
+		c.filled += int64(len(part))
+		written += len(part)
+		p = p[len(part):]
+
+		if c.filled == c.chunkSize {
+			c.closeChunk()
+		}
+	}
+	return written, nil
+}
+
+// closeChunk records the current chunk's hash and starts a new chunk.
+func (c *chunkHasher) closeChunk() {
+	c.chunks = append(c.chunks, Result{Hash: c.current.Sum(nil), Size: c.filled})
+	c.current = c.newHash()
+	c.filled = 0
+}
+
+// final closes the last partial chunk and returns the hasher whose sum is the file hash:
+// the stream hasher itself, or a hasher over the concatenated chunk hashes when chunking.
+// Callers may write additional data (e.g. extended attributes) before summing it.
+func (c *chunkHasher) final() (hash.Hash, error) {
+	if c.chunkSize == 0 {
+		return c.current, nil
+	}
+	if c.filled > 0 {
+		c.closeChunk()
+	}
+
+	h := c.newHash()
+	for _, chunk := range c.chunks {
+		if _, err := h.Write(chunk.Hash); err != nil {
+			return nil, fmt.Errorf("failed to combine chunk hashes: %w", err)
+		}
+	}
+	return h, nil
+}
+
+// SetChunkSize enables chunked hashing: files larger than chunkSize bytes are split into
+// chunkSize-byte chunks, and their hash becomes the hash of the concatenated chunk
+// hashes. Files no larger than one chunk keep their single-stream hash. Zero or a
+// negative value disables chunking (the default). Chunking changes the root hash of
+// trees containing files larger than chunkSize.
+func (e *Engine) SetChunkSize(chunkSize int64) {
+	if chunkSize < 0 {
+		chunkSize = 0
+	}
+	e.chunkSize = chunkSize
+}
+
+// HashChunks hashes a single regular file with the engine's configuration and returns
+// its hash together with the hash of each chunk in file order. A file no larger than
+// one chunk, or hashed with chunking disabled, has a single chunk covering the whole file.
+//
+// Parameters:
+//   - path: The regular file to hash
+//
+// Returns the file result, the chunk results, and any error encountered.
+func (e *Engine) HashChunks(path string) (Result, []Result, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return Result{}, nil, fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	if e.rootPath == "" {
+		e.rootPath = absPath
+	}
+
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return Result{}, nil, fmt.Errorf("failed to stat path %q: %w", absPath, err)
+	}
+	if !info.Mode().IsRegular() {
+		return Result{}, nil, fmt.Errorf("path %q is not a regular file", path)
+	}
+
+	result, chunks, err := e.hashFileChunks(absPath, info.Size())
+	if err != nil {
+		return Result{}, nil, err
+	}
+	e.fileDone(absPath, result)
+	if len(chunks) == 0 {
+		// Not chunked: the file is its own single chunk
+		chunks = []Result{result}
+	}
+	if e.includeRootName {
+		if result, err = e.withRootName(path, result); err != nil {
+			return Result{}, nil, err
+		}
+	}
+	return result, chunks, nil
+}
@@ -0,0 +1,35 @@
+// Package merkle (depth.go) provides depth-based exclusion: entries nested more than a
+// given number of levels below the root are left out of the hash, as if they matched an
+// exclusion pattern.
+package merkle
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// SetExcludeDeeperThan excludes every entry whose depth below the root exceeds depth,
+// where the root's direct children are at depth 1. Directories at depth are still hashed,
+// but without their contents, so this changes the root hash of trees deeper than depth.
+// Zero or a negative value disables the limit (the default).
+func (e *Engine) SetExcludeDeeperThan(depth int) {
+	e.excludeDeeperThan = max(depth, 0)
+}
+
+// isTooDeep reports whether absPath lies deeper below the root than the depth limit.
+func (e *Engine) isTooDeep(absPath string) bool {
+	if e.excludeDeeperThan == 0 || e.rootPath == "" {
+		return false
+	}
+	return pathDepth(e.rootPath, absPath) > e.excludeDeeperThan
+}
+
+// pathDepth returns the number of path segments of path below root, so a direct child
+// of root has depth 1. Paths that are not below root have depth 0.
+func pathDepth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return 0
+	}
+	return strings.Count(filepath.ToSlash(rel), "/") + 1
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+// Package merkle (device_other.go) provides the device ID fallback for platforms
+// without Unix device numbers.
+package merkle
+
+import "os"
+
+// OneFilesystemSupported reports whether hashing can be restricted to one filesystem on this platform.
+const OneFilesystemSupported = false
+
+// deviceID is not supported on this platform.
+func deviceID(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
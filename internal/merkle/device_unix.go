@@ -0,0 +1,23 @@
+//go:build unix
+
+// Package merkle (device_unix.go) reads filesystem device IDs on Unix systems.
+package merkle
+
+import (
+	"os"
+	"syscall"
+)
+
+// OneFilesystemSupported reports whether hashing can be restricted to one filesystem on this platform.
+const OneFilesystemSupported = true
+
+// deviceID returns the ID of the device (filesystem) holding the file described by info.
+//
+// Returns the device ID and whether it could be determined.
+func deviceID(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true //nolint:unconvert // Dev is not uint64 on every Unix
+}
@@ -0,0 +1,101 @@
+//go:build unix
+
+package merkle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeviceID(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "file.txt")
+	if err := os.WriteFile(file, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	dirInfo, err := os.Lstat(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to stat directory: %v", err)
+	}
+	fileInfo, err := os.Lstat(file)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+
+	dirDev, ok := deviceID(dirInfo)
+	if !ok {
+		t.Fatal("deviceID() could not determine the device of a directory")
+	}
+	fileDev, ok := deviceID(fileInfo)
+	if !ok {
+		t.Fatal("deviceID() could not determine the device of a file")
+	}
+	if dirDev != fileDev {
+		t.Errorf("deviceID() = %d for file, want %d (same filesystem as its directory)", fileDev, dirDev)
+	}
+}
+
+func TestEngine_OneFilesystem(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 2, 2, 2)
+
+	full, err := NewEngine().HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	engine := NewEngine()
+	if err := engine.SetOneFilesystem(true); err != nil {
+		t.Fatalf("SetOneFilesystem() error = %v", err)
+	}
+	single, err := engine.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !equal(full.Hash, single.Hash) {
+		t.Error("A tree on a single filesystem should hash identically with one-filesystem mode")
+	}
+}
+
+func TestEngine_OneFilesystemSkipsMounts(t *testing.T) {
+	// /proc is a separate filesystem on Linux; look for a mount point under "/"
+	rootInfo, err := os.Lstat("/")
+	if err != nil {
+		t.Skipf("Cannot stat /: %v", err)
+	}
+	rootDev, _ := deviceID(rootInfo)
+	var mount os.DirEntry
+	entries, err := os.ReadDir("/")
+	if err != nil {
+		t.Skipf("Cannot read /: %v", err)
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		if dev, ok := deviceID(info); ok && dev != rootDev {
+			mount = entry
+			break
+		}
+	}
+	if mount == nil {
+		t.Skip("No separate mount point available under /")
+	}
+
+	engine := NewEngine()
+	engine.rootPath = "/"
+	if err := engine.SetOneFilesystem(true); err != nil {
+		t.Fatalf("SetOneFilesystem() error = %v", err)
+	}
+	if !engine.onOtherDevice(mount) {
+		t.Errorf("onOtherDevice(%q) = false, want true for a mount point", mount.Name())
+	}
+	if err := engine.SetOneFilesystem(false); err != nil {
+		t.Fatalf("SetOneFilesystem() error = %v", err)
+	}
+	if engine.onOtherDevice(mount) {
+		t.Errorf("onOtherDevice(%q) = true with one-filesystem mode disabled", mount.Name())
+	}
+}
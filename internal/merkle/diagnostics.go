@@ -0,0 +1,151 @@
+// Package merkle (diagnostics.go) provides a collector for the non-fatal problems met
+// while hashing. They are logged as they happen, scattered among other log lines; a
+// Diagnostics collector also keeps them so a summary can be reported once a run ends.
+package merkle
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+)
+
+// DiagnosticKind classifies a non-fatal problem met while hashing.
+type DiagnosticKind string
+
+const (
+	// DiagnosticSpecialFile is a pipe, socket or device skipped because it cannot be hashed.
+	DiagnosticSpecialFile DiagnosticKind = "special-file"
+	// DiagnosticFileChanged is a file whose size changed while it was read, so its hash
+	// may not match its contents before or after the run.
+	DiagnosticFileChanged DiagnosticKind = "file-changed"
+	// DiagnosticCloseFailed is a file or directory that could not be closed after reading.
+	DiagnosticCloseFailed DiagnosticKind = "close-failed"
+	// DiagnosticCaseCollision is a pair of entries whose names differ only by case.
+	DiagnosticCaseCollision DiagnosticKind = "case-collision"
+	// DiagnosticTruncated is a directory truncated to the entries limit.
+	DiagnosticTruncated DiagnosticKind = "truncated"
+	// DiagnosticVanished is an entry removed between the listing of its directory and its
+	// hashing, left out of the hash.
+	DiagnosticVanished DiagnosticKind = "vanished"
+)
+
+// diagnosticKinds lists the kinds in summary order, with their singular and plural descriptions.
+var diagnosticKinds = []struct {
+	kind             DiagnosticKind
+	singular, plural string
+}{
+	{DiagnosticSpecialFile, "special file skipped", "special files skipped"},
+	{DiagnosticFileChanged, "file changed during read", "files changed during read"},
+	{DiagnosticCloseFailed, "close failure", "close failures"},
+	{DiagnosticCaseCollision, "case collision", "case collisions"},
+	{DiagnosticTruncated, "directory truncated", "directories truncated"},
+	{DiagnosticVanished, "entry vanished during walk", "entries vanished during walk"},
+}
+
+// Diagnostic is a single non-fatal problem met while hashing.
+type Diagnostic struct {
+	// Kind classifies the problem.
+	Kind DiagnosticKind
+	// Path is the path of the entry concerned.
+	Path string
+	// Detail describes the problem, e.g. the underlying error.
+	Detail string
+}
+
+// Diagnostics collects the diagnostics of one or more hashing runs. It is safe for
+// concurrent use; a nil *Diagnostics discards everything.
+type Diagnostics struct {
+	mu    sync.Mutex
+	items []Diagnostic
+}
+
+// add records a diagnostic. It does nothing on a nil collector.
+func (d *Diagnostics) add(kind DiagnosticKind, path, detail string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.items = append(d.items, Diagnostic{Kind: kind, Path: path, Detail: detail})
+}
+
+// Items returns the collected diagnostics in the order they were recorded.
+func (d *Diagnostics) Items() []Diagnostic {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Diagnostic(nil), d.items...)
+}
+
+// Count returns the number of collected diagnostics of the given kind.
+func (d *Diagnostics) Count(kind DiagnosticKind) int {
+	count := 0
+	for _, item := range d.Items() {
+		if item.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// Summary describes the collected diagnostics in one line, counting each kind, e.g.
+// "3 special files skipped, 1 file changed during read". It returns "none" when nothing
+// was collected.
+func (d *Diagnostics) Summary() string {
+	var parts []string
+	for _, k := range diagnosticKinds {
+		switch n := d.Count(k.kind); n {
+		case 0:
+		case 1:
+			parts = append(parts, "1 "+k.singular)
+		default:
+			parts = append(parts, fmt.Sprintf("%d %s", n, k.plural))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SetDiagnostics makes the engine record the non-fatal problems it meets (skipped special
+// files, files changed while being read, close failures, case collisions and truncated
+// directories) in d, in addition to logging them. Nil stops collecting.
+func (e *Engine) SetDiagnostics(d *Diagnostics) {
+	e.diagnostics = d
+}
+
+// closeFile closes a file or directory opened while hashing, logging any failure under the
+// given operation and recording it as a diagnostic.
+func (e *Engine) closeFile(c io.Closer, operation, path string) {
+	if err := c.Close(); err != nil {
+		logger.WithOperation(operation, "path", path).Warn("Failed to close file", "error", err)
+		e.diagnostics.add(DiagnosticCloseFailed, path, err.Error())
+	}
+}
+
+// checkUnchanged warns when the file at path changed size while it was hashed: when the
+// bytes read differ from the size it was listed with, or when it has since grown or shrunk.
+// Its hash then matches neither its contents before nor after the run.
+func (e *Engine) checkUnchanged(f *os.File, path string, size, bytesRead int64) {
+	current := bytesRead
+	if current == size {
+		info, err := f.Stat()
+		if err != nil {
+			return
+		}
+		current = info.Size()
+	}
+	if current == size {
+		return
+	}
+	logger.WithOperation("hash_file", "path", path).Warn("File changed while being read; its hash may be inconsistent",
+		"size", size, "current_size", current)
+	e.diagnostics.add(DiagnosticFileChanged, path, fmt.Sprintf("size changed from %d to %d bytes", size, current))
+}
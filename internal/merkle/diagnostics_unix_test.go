@@ -0,0 +1,68 @@
+//go:build unix
+
+package merkle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// failingCloser is an io.Closer whose Close always fails.
+type failingCloser struct{}
+
+func (failingCloser) Close() error { return errors.New("close failed") }
+
+func TestEngine_Diagnostics(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	for _, name := range []string{"fifo1", "fifo2", "fifo3"} {
+		if err := syscall.Mkfifo(filepath.Join(tmpDir, name), 0644); err != nil {
+			t.Skipf("Cannot create FIFO: %v", err)
+		}
+	}
+
+	engine := NewEngine()
+	diagnostics := &Diagnostics{}
+	engine.SetDiagnostics(diagnostics)
+	if _, err := engine.HashPath(tmpDir); err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if got := diagnostics.Count(DiagnosticSpecialFile); got != 3 {
+		t.Errorf("Count(DiagnosticSpecialFile) = %d, want 3", got)
+	}
+
+	engine.closeFile(failingCloser{}, "hash_file", filepath.Join(tmpDir, "file.txt"))
+
+	f, err := os.Open(filepath.Join(tmpDir, "file.txt"))
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+	engine.checkUnchanged(f, f.Name(), 7, 7)
+	if got := diagnostics.Count(DiagnosticFileChanged); got != 0 {
+		t.Errorf("Unchanged file recorded as changed")
+	}
+	engine.checkUnchanged(f, f.Name(), 3, 3)
+
+	want := "3 special files skipped, 1 file changed during read, 1 close failure"
+	if got := diagnostics.Summary(); got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+	items := diagnostics.Items()
+	if len(items) != 5 {
+		t.Fatalf("Items() returned %d diagnostics, want 5", len(items))
+	}
+	if items[3].Kind != DiagnosticCloseFailed || items[3].Detail != "close failed" {
+		t.Errorf("Close failure recorded as %+v", items[3])
+	}
+
+	var none *Diagnostics
+	if got := none.Summary(); got != "none" {
+		t.Errorf("Summary() of a nil collector = %q, want \"none\"", got)
+	}
+}
@@ -3,8 +3,12 @@
 package merkle
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
+	"os"
+	"sort"
 	"time"
 
 	"github.com/lucho00cuba/mtc/internal/logger"
@@ -34,7 +38,10 @@ func Compare(a, b string) ([]string, error) {
 
 // CompareWithExclusions computes the Merkle root hashes of two paths with exclusion patterns.
 // It applies the same exclusion patterns to both paths to ensure fair comparison.
-// The function computes hashes sequentially and compares the results.
+// The function computes hashes sequentially and compares the results via CompareEngines.
+// Both engines use the default hashing options, so symlinks are compared as links; to
+// compare with other options, such as SetFollowSymlinks, configure two engines alike and
+// call CompareEngines.
 //
 // Parameters:
 //   - a: The first path to compare (file or directory)
@@ -46,10 +53,8 @@ func Compare(a, b string) ([]string, error) {
 // Returns a slice of difference messages. If paths are identical, returns a single
 // "No differences detected" message. Otherwise, returns hash mismatch information.
 func CompareWithExclusions(a, b string, patterns []string, loadIgnoreFile bool, customIgnoreFile string) ([]string, error) {
-	log := logger.With("pathA", a, "pathB", b, "operation", "compare")
-
 	// Create engines with exclusions for both paths
-	var engineA, engineB *Engine
+	engineA, engineB := NewEngine(), NewEngine()
 	var err error
 
 	if len(patterns) > 0 || loadIgnoreFile || customIgnoreFile != "" {
@@ -63,17 +68,45 @@ func CompareWithExclusions(a, b string, patterns []string, loadIgnoreFile bool,
 		}
 	}
 
+	return CompareEngines(a, b, engineA, engineB)
+}
+
+// CompareEngines computes the Merkle root hashes of two paths using the given engines
+// and compares the results. Callers are responsible for configuring both engines
+// identically (exclusions, content filters, ...) to ensure a fair comparison.
+//
+// Parameters:
+//   - a: The first path to compare (file or directory)
+//   - b: The second path to compare (file or directory)
+//   - engineA: The engine used to hash path a
+//   - engineB: The engine used to hash path b
+//
+// Returns a slice of difference messages. If paths are identical, returns a single
+// "No differences detected" message. Otherwise, returns hash mismatch information.
+func CompareEngines(a, b string, engineA, engineB *Engine) ([]string, error) {
+	_, _, diff, err := CompareRoots(a, b, engineA, engineB)
+	return diff, err
+}
+
+// CompareRoots compares two paths like CompareEngines and also returns the root
+// results computed for each path, so callers can record exactly what was compared.
+//
+// Parameters:
+//   - a: The first path to compare (file or directory)
+//   - b: The second path to compare (file or directory)
+//   - engineA: The engine used to hash path a
+//   - engineB: The engine used to hash path b
+//
+// Returns the root results of a and b, the difference messages, and any error encountered.
+func CompareRoots(a, b string, engineA, engineB *Engine) (Result, Result, []string, error) {
+	log := logger.WithOperation("compare", "pathA", a, "pathB", b)
+
 	log.Info("Starting hash computation for path A")
 	startA := time.Now()
-	var resultA Result
-	if engineA != nil {
-		resultA, err = engineA.HashPath(a)
-	} else {
-		resultA, err = HashPath(a)
-	}
+	resultA, err := engineA.HashPath(a)
 	if err != nil {
 		log.Error("Failed to hash path A", "error", err, "duration", time.Since(startA))
-		return nil, fmt.Errorf("failed to hash path %q: %w", a, err)
+		return Result{}, Result{}, nil, fmt.Errorf("failed to hash path %q: %w", a, err)
 	}
 	durationA := time.Since(startA)
 	log.Info("Hash computation for path A completed",
@@ -84,15 +117,10 @@ func CompareWithExclusions(a, b string, patterns []string, loadIgnoreFile bool,
 
 	log.Info("Starting hash computation for path B")
 	startB := time.Now()
-	var resultB Result
-	if engineB != nil {
-		resultB, err = engineB.HashPath(b)
-	} else {
-		resultB, err = HashPath(b)
-	}
+	resultB, err := engineB.HashPath(b)
 	if err != nil {
 		log.Error("Failed to hash path B", "error", err, "duration", time.Since(startB))
-		return nil, fmt.Errorf("failed to hash path %q: %w", b, err)
+		return Result{}, Result{}, nil, fmt.Errorf("failed to hash path %q: %w", b, err)
 	}
 	durationB := time.Since(startB)
 	log.Info("Hash computation for path B completed",
@@ -103,17 +131,148 @@ func CompareWithExclusions(a, b string, patterns []string, loadIgnoreFile bool,
 
 	if bytes.Equal(resultA.Hash, resultB.Hash) {
 		log.Info("Paths are identical", "total_duration", durationA+durationB)
-		return []string{noDifferencesMsg}, nil
+	} else {
+		log.Warn("Paths differ",
+			"hashA", fmt.Sprintf("%x", resultA.Hash),
+			"hashB", fmt.Sprintf("%x", resultB.Hash),
+			"sizeA", resultA.Size,
+			"sizeB", resultB.Size,
+		)
 	}
+	return resultA, resultB, CompareResults(resultA, resultB), nil
+}
 
-	log.Warn("Paths differ",
-		"hashA", fmt.Sprintf("%x", resultA.Hash),
-		"hashB", fmt.Sprintf("%x", resultB.Hash),
-		"sizeA", resultA.Size,
-		"sizeB", resultB.Size,
-	)
+// CompareResults returns the difference messages for two root results computed by any
+// means, e.g. one with HashPath and the other with HashFS: a single "No differences
+// detected" message if their hashes are identical, or the hash mismatch otherwise.
+//
+// Parameters:
+//   - resultA: The root result of the first tree
+//   - resultB: The root result of the second tree
+//
+// Returns the difference messages, as reported by CompareRoots.
+func CompareResults(resultA, resultB Result) []string {
+	if bytes.Equal(resultA.Hash, resultB.Hash) {
+		return []string{noDifferencesMsg}
+	}
 	return []string{
 		fmt.Sprintf("Root mismatch:\nA: %x (size: %d)\nB: %x (size: %d)",
 			resultA.Hash, resultA.Size, resultB.Hash, resultB.Size),
-	}, nil
+	}
+}
+
+// CompareTopLevel compares two paths like CompareRoots and, when their roots differ, also
+// reports which immediate entries of the two roots differ, as a quick hint of where the
+// trees drifted. The entries' results are collected while hashing the roots, so this costs
+// no more than CompareRoots. After the root mismatch, one line is added per differing
+// entry, sorted by name: "added: <name>" (only in a), "deleted: <name>" (only in b) or
+// "modified: <name>", with a trailing "/" for directories. Paths that are not directories
+// have no entries, so only the root mismatch is reported.
+//
+// Parameters:
+//   - a: The first path to compare (file or directory)
+//   - b: The second path to compare (file or directory)
+//   - engineA: The engine used to hash path a
+//   - engineB: The engine used to hash path b
+//
+// Returns the root results of a and b, the difference messages, and any error encountered.
+func CompareTopLevel(a, b string, engineA, engineB *Engine) (Result, Result, []string, error) {
+	log := logger.WithOperation("compare", "pathA", a, "pathB", b)
+
+	resultA, childrenA, err := engineA.hashTopLevel(a)
+	if err != nil {
+		return Result{}, Result{}, nil, fmt.Errorf("failed to hash path %q: %w", a, err)
+	}
+	resultB, childrenB, err := engineB.hashTopLevel(b)
+	if err != nil {
+		return Result{}, Result{}, nil, fmt.Errorf("failed to hash path %q: %w", b, err)
+	}
+
+	diff := CompareResults(resultA, resultB)
+	if bytes.Equal(resultA.Hash, resultB.Hash) {
+		return resultA, resultB, diff, nil
+	}
+
+	entriesA := make(map[string]childResult, len(childrenA))
+	for _, child := range childrenA {
+		entriesA[child.name] = child
+	}
+	entriesB := make(map[string]childResult, len(childrenB))
+	for _, child := range childrenB {
+		entriesB[child.name] = child
+	}
+	names := make([]string, 0, len(entriesA)+len(entriesB))
+	for name := range entriesA {
+		names = append(names, name)
+	}
+	for name := range entriesB {
+		if _, ok := entriesA[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		childA, inA := entriesA[name]
+		childB, inB := entriesB[name]
+		switch {
+		case !inB:
+			diff = append(diff, "added: "+topLevelName(childA))
+		case !inA:
+			diff = append(diff, "deleted: "+topLevelName(childB))
+		case childA.isDir != childB.isDir || !bytes.Equal(childA.result.Hash, childB.result.Hash):
+			diff = append(diff, "modified: "+topLevelName(childA))
+		}
+	}
+	log.Info("Top-level comparison completed", "entriesA", len(childrenA), "entriesB", len(childrenB), "differences", len(diff)-1)
+	return resultA, resultB, diff, nil
+}
+
+// topLevelName returns the name of a root entry as reported by CompareTopLevel: with a
+// trailing "/" for directories.
+func topLevelName(child childResult) string {
+	if child.isDir {
+		return child.name + "/"
+	}
+	return child.name
+}
+
+// FirstDifference returns the offset of the first byte at which two files differ, reading
+// both in a single streaming pass. If one file is a prefix of the other, the offset is the
+// length of the shorter one.
+//
+// Parameters:
+//   - a: The first file
+//   - b: The second file
+//
+// Returns -1 if the files are identical, or an error if either cannot be read.
+func FirstDifference(a, b string) (int64, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %q: %w", a, err)
+	}
+	defer func() { _ = fa.Close() }()
+	fb, err := os.Open(b)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %q: %w", b, err)
+	}
+	defer func() { _ = fb.Close() }()
+
+	ra, rb := bufio.NewReader(fa), bufio.NewReader(fb)
+	for offset := int64(0); ; offset++ {
+		ca, errA := ra.ReadByte()
+		cb, errB := rb.ReadByte()
+		if errA != nil && errA != io.EOF {
+			return 0, fmt.Errorf("failed to read %q: %w", a, errA)
+		}
+		if errB != nil && errB != io.EOF {
+			return 0, fmt.Errorf("failed to read %q: %w", b, errB)
+		}
+		switch {
+		case errA == io.EOF && errB == io.EOF:
+			return -1, nil
+		case errA == io.EOF || errB == io.EOF || ca != cb:
+			return offset, nil
+		}
+	}
 }
@@ -0,0 +1,173 @@
+// Package merkle (explain.go) provides explanations of exclusion decisions.
+// A path is left out of a hash when it, or any directory above it, is excluded while the
+// tree is walked. Explaining a path replays those decisions from the root down with the
+// engine's own rules, so the verdict is the one hashing would reach.
+package merkle
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lucho00cuba/mtc/internal/ignore"
+)
+
+// ExclusionRule names the rule that decided whether a path is excluded.
+type ExclusionRule string
+
+const (
+	// ExclusionPattern is an exclusion pattern (or a negation re-including the path).
+	ExclusionPattern ExclusionRule = "pattern"
+	// ExclusionDockerignore is a pattern of the root's .dockerignore.
+	ExclusionDockerignore ExclusionRule = "dockerignore"
+	// ExclusionDepth is the depth limit (--exclude-deeper-than).
+	ExclusionDepth ExclusionRule = "depth"
+	// ExclusionOtherFilesystem is a directory on another filesystem (--one-filesystem).
+	ExclusionOtherFilesystem ExclusionRule = "one-filesystem"
+	// ExclusionMarkerDir is a marker directory, hashed without its contents (--marker-dir).
+	ExclusionMarkerDir ExclusionRule = "marker-dir"
+	// ExclusionShallow is a subdirectory hashed by name only (--recursive=false).
+	ExclusionShallow ExclusionRule = "recursive"
+	// ExclusionContentClass is a file of the class not hashed (--text-only, --binary-only).
+	ExclusionContentClass ExclusionRule = "content-class"
+	// ExclusionEmptyFile is a zero-byte file (--exclude-empty-files).
+	ExclusionEmptyFile ExclusionRule = "empty-file"
+	// ExclusionSize is a size rule (--exclude-size or an "@size" pattern).
+	ExclusionSize ExclusionRule = "size"
+)
+
+// Exclusion explains whether a path would be left out of the hash.
+type Exclusion struct {
+	// Excluded reports whether the path is left out of the hash.
+	Excluded bool
+	// Path is the slash-separated path, relative to the root, the verdict was decided on:
+	// the explained path itself or the directory above it that is excluded.
+	Path string
+	// Rule is the rule that decided the verdict; empty if nothing applied.
+	Rule ExclusionRule
+	// Pattern is the deciding pattern for ExclusionPattern and ExclusionDockerignore,
+	// which for an included path is the negation re-including it.
+	Pattern string
+}
+
+// ExplainExclusion reports whether the path at rel, relative to the engine's root, would be
+// excluded when the root is hashed, and why. Every directory on the way is checked first,
+// as the walk never reaches entries of an excluded directory, then the path itself; file
+// rules such as size limits apply if it is a regular file that exists. A path that does not
+// exist is checked as a file.
+//
+// Parameters:
+//   - rel: The path to explain, relative to the root
+//
+// Returns the explanation, or an error if the engine has no root or rel is not below it.
+func (e *Engine) ExplainExclusion(rel string) (Exclusion, error) {
+	if e.rootPath == "" {
+		return Exclusion{}, fmt.Errorf("exclusions can only be explained for an engine created with exclusions")
+	}
+	clean := filepath.ToSlash(filepath.Clean(filepath.FromSlash(rel)))
+	if filepath.IsAbs(rel) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return Exclusion{}, fmt.Errorf("path %q is not below the root", rel)
+	}
+
+	parts := strings.Split(clean, "/")
+	var result Exclusion
+	var info os.FileInfo
+	for i, name := range parts {
+		sub := strings.Join(parts[:i+1], "/")
+		absPath := filepath.Join(e.rootPath, filepath.FromSlash(sub))
+		last := i == len(parts)-1
+		isDir := !last
+		info, _ = os.Lstat(absPath)
+		if info != nil {
+			isDir = info.IsDir()
+		}
+
+		excluded, rule, pattern := e.explainExcluded(absPath, isDir)
+		if excluded {
+			return Exclusion{Excluded: true, Path: sub, Rule: rule, Pattern: pattern}, nil
+		}
+		result = Exclusion{Path: sub, Rule: rule, Pattern: pattern}
+		if info != nil && e.onOtherDevice(fs.FileInfoToDirEntry(info)) {
+			return Exclusion{Excluded: true, Path: sub, Rule: ExclusionOtherFilesystem}, nil
+		}
+		if last {
+			break
+		}
+		// The walk does not descend into these directories, leaving out all they hold
+		if e.shallow {
+			return Exclusion{Excluded: true, Path: sub, Rule: ExclusionShallow}, nil
+		}
+		if e.isMarkerDir(name) {
+			return Exclusion{Excluded: true, Path: sub, Rule: ExclusionMarkerDir}, nil
+		}
+	}
+
+	if info == nil || !info.Mode().IsRegular() {
+		return result, nil
+	}
+	absPath := filepath.Join(e.rootPath, filepath.FromSlash(clean))
+	if e.contentClass != ContentAll {
+		binary, err := e.isBinary(absPath)
+		if err != nil {
+			return Exclusion{}, err
+		}
+		if binary != (e.contentClass == ContentBinaryOnly) {
+			return Exclusion{Excluded: true, Path: clean, Rule: ExclusionContentClass}, nil
+		}
+	}
+	if e.excludeEmptyFiles && info.Size() == 0 {
+		return Exclusion{Excluded: true, Path: clean, Rule: ExclusionEmptyFile}, nil
+	}
+	if e.isExcludedBySize(info.Size()) {
+		return Exclusion{Excluded: true, Path: clean, Rule: ExclusionSize}, nil
+	}
+	return result, nil
+}
+
+// explainExcluded decides whether the entry at absPath is excluded by the depth limit or
+// the exclusion patterns, like isExcluded, and reports the deciding rule and pattern. For
+// an entry that is not excluded, the pattern is a matching negation, if any.
+func (e *Engine) explainExcluded(absPath string, isDir bool) (bool, ExclusionRule, string) {
+	if e.isTooDeep(absPath) {
+		return true, ExclusionDepth, ""
+	}
+	if e.matcher == nil {
+		return false, "", ""
+	}
+	// Compute relative path from root for matching
+	relPath, err := filepath.Rel(e.rootPath, absPath)
+	if err != nil {
+		// If we can't compute relative path, use the basename
+		relPath = filepath.Base(absPath)
+	} else if e.dockerMatcher != nil {
+		// .dockerignore patterns are anchored at the root, so only the relative path is checked
+		if excluded, pattern := e.dockerMatcher.Explain(relPath, isDir); excluded {
+			return true, ExclusionDockerignore, pattern
+		}
+	}
+
+	// Also check with absolute path and basename for flexibility
+	explainer, ok := e.matcher.(ignore.Explainer)
+	var negation string
+	for _, candidate := range []string{relPath, absPath, filepath.Base(absPath)} {
+		if !ok {
+			if e.matcher.Match(candidate, isDir) {
+				return true, ExclusionPattern, ""
+			}
+			continue
+		}
+		excluded, pattern := explainer.Explain(candidate, isDir)
+		if excluded {
+			return true, ExclusionPattern, pattern
+		}
+		if pattern != "" && negation == "" {
+			negation = pattern
+		}
+	}
+	if negation != "" {
+		return false, ExclusionPattern, negation
+	}
+	return false, "", ""
+}
@@ -0,0 +1,58 @@
+// Package merkle (follow.go) provides following of symbolic links.
+// By default a symlink is a leaf hashed from its target path, so a tree holding a link and
+// a tree holding a copy of what it points to differ. When links are followed, a link is
+// hashed as the file or directory it points to, under the link's name.
+package merkle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+)
+
+// SetFollowSymlinks makes the engine hash symlinks to regular files and directories as
+// what they point to instead of as their target path. Dangling links and links to special
+// files are still hashed as links. A link leading back into a directory being hashed is
+// reported as a circular symlink. Files reached through a link are read through it, so a
+// link pointing outside the root is followed unless the root is checked by real path.
+// Changes the root hash of trees holding symlinks.
+func (e *Engine) SetFollowSymlinks(follow bool) {
+	e.followSymlinks = follow
+}
+
+// followLink returns the info of what the symlink at path points to, if the engine
+// follows symlinks and the target is a regular file or a directory.
+func (e *Engine) followLink(path string) (os.FileInfo, bool) {
+	if !e.followSymlinks {
+		return nil, false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		logger.WithOperation("follow_link", "path", path).Debug("Not following symlink", "error", err)
+		return nil, false
+	}
+	if !info.Mode().IsRegular() && !info.IsDir() {
+		return nil, false
+	}
+	return info, true
+}
+
+// enterLink records the real path of a followed link as visited, so a link leading back
+// into a directory being hashed is detected.
+//
+// Returns a function removing the record once the link is hashed, or an error if the link
+// is circular.
+func (e *Engine) enterLink(path string, visited *sync.Map) (func(), error) {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve symlink %q: %w", path, err)
+	}
+	if _, exists := visited.Load(real); exists {
+		return nil, fmt.Errorf("circular symlink detected at %q", path)
+	}
+	visited.Store(real, true)
+	return func() { visited.Delete(real) }, nil
+}
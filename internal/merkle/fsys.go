@@ -0,0 +1,382 @@
+// Package merkle (fsys.go) provides hashing of trees behind an fs.FS, such as an embed.FS
+// holding embedded assets or an fstest.MapFS built in a test. The walk mirrors the one
+// over the operating system's filesystem, so a tree produces the same root whether it is
+// hashed from disk with HashPath or through os.DirFS with HashFS. Which engine options
+// the walk honors, and which it rejects, is recorded in options.go.
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+)
+
+// readLinkFS is implemented by file systems that can read symlink targets, such as
+// os.DirFS and fstest.MapFS from Go 1.25 on (see fs.ReadLinkFS).
+type readLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+}
+
+// HashFS computes the Merkle root of the file or directory named root inside fsys,
+// exactly as HashPath would for the same tree on disk: files are hashed by content,
+// directories combine their entries in sorted order, and symlinks hash their target.
+// Exclusion patterns are matched against paths relative to root.
+//
+// Symlinks are only supported if fsys can read their targets (an optional
+// ReadLink(name string) (string, error) method, as in fs.ReadLinkFS); otherwise they are
+// reported as errors, since fs.FS has no portable way to read them. Options that need the
+// operating system (extended attributes, hardlink groups, an external hasher, assumed hashes,
+// the byte budget and following or resolving symlinks) are rejected; other OS-specific
+// options, such as --one-filesystem, do not apply.
+// Entries are hashed sequentially.
+//
+// Parameters:
+//   - fsys: The file system holding the tree
+//   - root: The slash-separated name of the tree's root inside fsys ("." for all of it)
+//
+// Returns the hash result and any error encountered during traversal or hashing.
+func (e *Engine) HashFS(fsys fs.FS, root string) (Result, error) {
+	return e.hashFS(&fsWalker{engine: e, fsys: fsys, root: root})
+}
+
+// hashFS hashes the tree of the given walker like HashFS.
+func (e *Engine) hashFS(w *fsWalker) (Result, error) {
+	root := w.root
+	if !fs.ValidPath(root) {
+		return Result{}, fmt.Errorf("invalid path %q in file system", root)
+	}
+	if err := e.checkFSOptions(); err != nil {
+		return Result{}, err
+	}
+
+	info, err := fs.Stat(w.fsys, root)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to stat path %q: %w", root, err)
+	}
+	var result Result
+	if info.IsDir() {
+		result, err = w.hashDir(root)
+	} else {
+		result, err = w.hashFile(root, info.Size())
+		if err == nil && w.onLeaf != nil {
+			w.onLeaf(".", result)
+		}
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	if e.includeRootName {
+		if root == "." {
+			return Result{}, fmt.Errorf("the root name cannot be included when hashing a whole file system")
+		}
+		return e.namedResult(path.Base(root), result)
+	}
+	return result, nil
+}
+
+// fsWalker hashes the tree under root in an fs.FS.
+type fsWalker struct {
+	engine *Engine
+	fsys   fs.FS
+	root   string
+	// onLeaf, if set, is called with the relative path and result of every leaf: files,
+	// symlinks, and with shallow hashing, subdirectories
+	onLeaf func(rel string, result Result)
+}
+
+// rel returns the path of name relative to the walker's root.
+func (w *fsWalker) rel(name string) string {
+	if w.root == "." {
+		return name
+	}
+	return strings.TrimPrefix(name, w.root+"/")
+}
+
+// isExcluded reports whether the entry at name is excluded by the engine's patterns or
+// its depth limit, matching the relative path and the base name like Engine.isExcluded.
+func (w *fsWalker) isExcluded(name string, isDir bool) bool {
+	e := w.engine
+	rel := w.rel(name)
+	if e.excludeDeeperThan > 0 && strings.Count(rel, "/")+1 > e.excludeDeeperThan {
+		return true
+	}
+	if e.matcher == nil {
+		return false
+	}
+	if e.dockerMatcher != nil && e.dockerMatcher.Match(rel, isDir) {
+		return true
+	}
+	return e.matcher.Match(rel, isDir) || e.matcher.Match(path.Base(name), isDir)
+}
+
+// hashDir combines the entries of the directory at name, like Engine.hashDir.
+func (w *fsWalker) hashDir(name string) (Result, error) {
+	e := w.engine
+	entries, err := fs.ReadDir(w.fsys, name)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read directory %q: %w", name, err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return e.nameLess(entries[i].Name(), entries[j].Name())
+	})
+	if e.entriesLimit > 0 && len(entries) > e.entriesLimit {
+		if !e.truncateEntries {
+			return Result{}, fmt.Errorf("directory %q has more than %d entries (--entries-limit)", name, e.entriesLimit)
+		}
+		logger.WithOperation("hash_fs", "path", name).Warn("Directory exceeds entries limit, truncating",
+			"entries", len(entries),
+			"limit", e.entriesLimit,
+		)
+		e.diagnostics.add(DiagnosticTruncated, name, fmt.Sprintf("%d entries, limit %d", len(entries), e.entriesLimit))
+		entries = entries[:e.entriesLimit]
+	}
+
+	var items []dirWorkItem
+	for _, entry := range entries {
+		childName := path.Join(name, entry.Name())
+		if entry.Type()&(fs.ModeNamedPipe|fs.ModeSocket|fs.ModeDevice) != 0 {
+			e.diagnostics.add(DiagnosticSpecialFile, childName, entry.Type().String())
+			continue
+		}
+		if w.isExcluded(childName, entry.IsDir()) {
+			continue
+		}
+		items = append(items, dirWorkItem{entry: entry, entryPath: childName})
+	}
+	if err := e.checkCaseCollisions(name, items); err != nil {
+		return Result{}, err
+	}
+
+	children := make([]childResult, 0, len(items))
+	for _, item := range items {
+		child, keep, err := w.hashEntry(name, item.entry, item.entryPath)
+		if err != nil {
+			return Result{}, err
+		}
+		if keep {
+			children = append(children, child)
+		}
+	}
+	return combineResults(e.algorithm, children)
+}
+
+// hashEntry hashes a single directory entry, like Engine.hashEntry.
+func (w *fsWalker) hashEntry(dir string, entry fs.DirEntry, name string) (childResult, bool, error) {
+	e := w.engine
+	child := childResult{name: entry.Name(), isDir: entry.IsDir(), isLink: entry.Type()&fs.ModeSymlink != 0}
+
+	if child.isLink {
+		if err := e.checkSymlink(name); err != nil {
+			return child, false, err
+		}
+		rfs, ok := w.fsys.(readLinkFS)
+		if !ok {
+			return child, false, fmt.Errorf("cannot hash symlink %q: the file system cannot read symlink targets", name)
+		}
+		target, err := rfs.ReadLink(name)
+		if err != nil {
+			return child, false, fmt.Errorf("failed to read symlink %q: %w", name, err)
+		}
+		if e.structureOnly {
+			child.result = Result{Hash: e.structureLeaf(structureSymlink, entry.Name(), []byte(target)), Size: 0}
+			w.leafDone(name, child.result)
+			return child, true, nil
+		}
+		h := e.newHash()
+		if _, err := io.WriteString(h, target); err != nil {
+			return child, false, fmt.Errorf("failed to hash symlink target: %w", err)
+		}
+		child.result = Result{Hash: h.Sum(nil), Size: 0}
+		w.leafDone(name, child.result)
+		return child, true, nil
+	}
+
+	if entry.IsDir() && e.shallow {
+		child.result = e.shallowDirResult(entry.Name())
+		w.leafDone(name, child.result)
+		return child, true, nil
+	}
+
+	if entry.IsDir() && e.isMarkerDir(entry.Name()) {
+		child.result = e.markerDirResult(entry.Name())
+		if e.structureOnly {
+			child.result.Hash = e.structureLeaf(structureDir, entry.Name(), child.result.Hash)
+		}
+		return child, true, nil
+	}
+
+	if entry.IsDir() {
+		result, err := w.hashDir(name)
+		if err != nil {
+			return child, false, fmt.Errorf("failed to hash entry %q in directory %q: %w", entry.Name(), dir, err)
+		}
+		if e.structureOnly {
+			result.Hash = e.structureLeaf(structureDir, entry.Name(), result.Hash)
+		}
+		child.result = result
+		return child, true, nil
+	}
+
+	info, err := entry.Info()
+	if err != nil {
+		return child, false, fmt.Errorf("failed to get info for entry %q in directory %q: %w", entry.Name(), dir, err)
+	}
+	if e.contentClass != ContentAll {
+		binary, err := w.isBinary(name)
+		if err != nil {
+			return child, false, err
+		}
+		if binary != (e.contentClass == ContentBinaryOnly) {
+			return child, false, nil
+		}
+	}
+	if (e.excludeEmptyFiles && info.Size() == 0) || e.isExcludedBySize(info.Size()) {
+		return child, false, nil
+	}
+
+	result, err := w.hashFile(name, info.Size())
+	if err != nil {
+		return child, false, err
+	}
+	child.result = result
+	e.fileDone(name, result)
+	w.leafDone(name, result)
+	return child, true, nil
+}
+
+// leafDone reports a hashed leaf to the walker's onLeaf callback, if any.
+func (w *fsWalker) leafDone(name string, result Result) {
+	if w.onLeaf != nil {
+		w.onLeaf(w.rel(name), result)
+	}
+}
+
+// hashFile hashes the contents of the file at name, like Engine.hashFile.
+func (w *fsWalker) hashFile(name string, size int64) (Result, error) {
+	e := w.engine
+	if e.structureOnly {
+		return Result{Hash: e.structureLeaf(structureFile, path.Base(name), nil), Size: size}, nil
+	}
+
+	f, err := w.fsys.Open(name)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to open file %q: %w", name, err)
+	}
+	defer w.engine.closeFile(f, "hash_fs", name)
+
+	reader, _, err := e.bomReader(e.headReader(f, size))
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read file %q: %w", name, err)
+	}
+	bufPtr, ok := e.bufferPool.get()
+	if !ok {
+		return Result{}, fmt.Errorf("failed to get buffer from pool")
+	}
+	defer e.bufferPool.put(bufPtr)
+	ch := newChunkHasher(e.newHash, e.chunkSize, size)
+	if _, err := e.readContents(ch, reader, *bufPtr, fmt.Sprintf("file %q", name)); err != nil {
+		return Result{}, err
+	}
+	h, err := ch.final()
+	if err != nil {
+		return Result{}, err
+	}
+	e.writeHeadSize(h, size)
+	return Result{Hash: h.Sum(nil), Size: size}, nil
+}
+
+// isBinary classifies the file at name by its first SniffSize bytes, like Engine.isBinary.
+func (w *fsWalker) isBinary(name string) (bool, error) {
+	f, err := w.fsys.Open(name)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file %q: %w", name, err)
+	}
+	defer w.engine.closeFile(f, "hash_fs", name)
+
+	buf := make([]byte, SniffSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, fmt.Errorf("failed to read file %q: %w", name, err)
+	}
+	return bytes.IndexByte(buf[:n], 0) >= 0, nil
+}
+
+// DiffFS compares the leaves of two trees behind file systems, like StreamDiff does for
+// trees on disk: it calls emit with an "added: <path>" (only in a), "deleted: <path>" (only
+// in b) or "modified: <path>" line for every difference, sorted by path relative to each
+// tree's root. Unlike StreamDiff, both trees are hashed first and their leaf hashes held
+// in memory. A tree on disk can be compared against one in an archive by passing
+// os.DirFS for it.
+//
+// Parameters:
+//   - fsysA, rootA: The file system and root of the first tree (see HashFS)
+//   - fsysB, rootB: The file system and root of the second tree
+//   - engineA: The engine used to hash tree a
+//   - engineB: The engine used to hash tree b
+//   - emit: Called with each difference line; an error stops the comparison
+//
+// Returns the number of differences and any error encountered while hashing or emitting.
+func DiffFS(fsysA fs.FS, rootA string, fsysB fs.FS, rootB string, engineA, engineB *Engine, emit func(line string) error) (int, error) {
+	leavesA, err := engineA.fsLeaves(fsysA, rootA)
+	if err != nil {
+		return 0, err
+	}
+	leavesB, err := engineB.fsLeaves(fsysB, rootB)
+	if err != nil {
+		return 0, err
+	}
+
+	paths := make([]string, 0, len(leavesA)+len(leavesB))
+	for rel := range leavesA {
+		paths = append(paths, rel)
+	}
+	for rel := range leavesB {
+		if _, ok := leavesA[rel]; !ok {
+			paths = append(paths, rel)
+		}
+	}
+	sort.Strings(paths)
+
+	count := 0
+	for _, rel := range paths {
+		hashA, okA := leavesA[rel]
+		hashB, okB := leavesB[rel]
+		var line string
+		switch {
+		case !okB:
+			line = "added: " + rel
+		case !okA:
+			line = "deleted: " + rel
+		case !bytes.Equal(hashA, hashB):
+			line = "modified: " + rel
+		default:
+			continue
+		}
+		count++
+		if err := emit(line); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// fsLeaves hashes the tree at root in fsys and returns the hash of every leaf, keyed by
+// its path relative to root.
+func (e *Engine) fsLeaves(fsys fs.FS, root string) (map[string][]byte, error) {
+	leaves := make(map[string][]byte)
+	w := &fsWalker{engine: e, fsys: fsys, root: root, onLeaf: func(rel string, result Result) {
+		leaves[rel] = result.Hash
+	}}
+	if _, err := e.hashFS(w); err != nil {
+		return nil, err
+	}
+	return leaves, nil
+}
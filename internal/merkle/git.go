@@ -0,0 +1,623 @@
+// Package merkle (git.go) provides comparison of a working tree against a git ref.
+// Both sides are reduced to the set of files git knows about (tracked files plus
+// untracked files not ignored by .gitignore), hashed with the same Merkle algorithm
+// used for directories, and compared file by file to report drift.
+package merkle
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+)
+
+const (
+	// gitModeSymlink is the git tree entry mode of a symbolic link
+	gitModeSymlink = "120000"
+	// gitTypeBlob is the git object type of file contents
+	gitTypeBlob = "blob"
+)
+
+// CompareGitRef compares the working tree at path against the tree recorded in a git ref.
+// Only files git knows about are considered: on the working tree side, tracked files and
+// untracked files not ignored by .gitignore (as reported by "git ls-files"); on the ref side,
+// every blob of the ref's tree. Submodules and empty directories are not compared.
+// The engine's exclusion patterns and content class are applied to both sides; symlinks
+// are compared as links, so following or resolving them is rejected.
+//
+// Parameters:
+//   - path: The working tree directory (the repository root or any subdirectory)
+//   - ref: The git ref (branch, tag, commit) to compare against
+//
+// Returns a "No differences detected" message if both trees match; otherwise a root
+// mismatch message followed by one "modified:", "added:" or "deleted:" line per drifted file.
+func (e *Engine) CompareGitRef(path, ref string) ([]string, error) {
+	log := logger.WithOperation("compare_git", "path", path, "ref", ref)
+
+	if e.includeXattr {
+		return nil, fmt.Errorf("extended attributes cannot be compared against a git ref")
+	}
+	if e.structureOnly {
+		return nil, fmt.Errorf("structure-only hashes cannot be compared against a git ref")
+	}
+	// A ref stores links as their target strings, which cannot be followed or resolved there
+	if e.followSymlinks {
+		return nil, fmt.Errorf("symlinks cannot be followed when comparing against a git ref")
+	}
+	if e.resolveSymlinks {
+		return nil, fmt.Errorf("symlinks cannot be resolved to real paths when comparing against a git ref")
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	if e.rootPath == "" {
+		e.rootPath = absPath
+	}
+
+	worktree, err := e.gitWorktreeLeaves(absPath)
+	if err != nil {
+		return nil, err
+	}
+	committed, err := e.gitRefLeaves(absPath, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	rootA, err := e.rootFromLeaves(worktree)
+	if err != nil {
+		return nil, err
+	}
+	rootB, err := e.rootFromLeaves(committed)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(rootA.Hash, rootB.Hash) {
+		log.Info("Working tree matches ref", "hash", fmt.Sprintf("%x", rootA.Hash))
+		return []string{noDifferencesMsg}, nil
+	}
+
+	diffs := []string{
+		fmt.Sprintf("Root mismatch:\nA: %x (size: %d)\nB: %x (size: %d)",
+			rootA.Hash, rootA.Size, rootB.Hash, rootB.Size),
+	}
+	diffs = append(diffs, leafDrift(worktree, committed)...)
+
+	log.Warn("Working tree differs from ref", "drifted", len(diffs)-1)
+	return diffs, nil
+}
+
+// leafResult is the result of a file of a tree built from its leaves, with whether it is
+// hashed as a symlink.
+type leafResult struct {
+	Result
+	isLink bool
+}
+
+// leafDrift lists the files that differ between two leaf sets, sorted by path.
+func leafDrift(a, b map[string]leafResult) []string {
+	paths := make([]string, 0, len(a)+len(b))
+	for p := range a {
+		paths = append(paths, p)
+	}
+	for p := range b {
+		if _, ok := a[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	var drift []string
+	for _, p := range paths {
+		ra, inA := a[p]
+		rb, inB := b[p]
+		switch {
+		case !inB:
+			drift = append(drift, "added: "+p)
+		case !inA:
+			drift = append(drift, "deleted: "+p)
+		case ra.isLink != rb.isLink || !bytes.Equal(ra.Hash, rb.Hash):
+			drift = append(drift, "modified: "+p)
+		}
+	}
+	return drift
+}
+
+// gitWorktreeLeaves hashes the files of the working tree at root that git knows about:
+// tracked files still present on disk and untracked files not ignored by .gitignore.
+//
+// Returns a map from slash-separated path (relative to root) to leaf result.
+func (e *Engine) gitWorktreeLeaves(root string) (map[string]leafResult, error) {
+	out, err := runGit(root, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	return e.hashWorktreeFiles(root, strings.Split(string(out), "\x00"))
+}
+
+// hashWorktreeFiles hashes the given files of the working tree at root, skipping files
+// that no longer exist, directories (submodule checkouts), and files excluded by the
+// engine's patterns, content class or empty-file setting.
+//
+// Parameters:
+//   - root: The working tree directory
+//   - rels: Slash-separated paths relative to root; empty and repeated paths are ignored
+//
+// Returns a map from slash-separated path (relative to root) to leaf result.
+func (e *Engine) hashWorktreeFiles(root string, rels []string) (map[string]leafResult, error) {
+	leaves := make(map[string]leafResult)
+	visited := &sync.Map{}
+	for _, rel := range rels {
+		if rel == "" || e.isExcludedRel(root, rel) {
+			continue
+		}
+		if _, seen := leaves[rel]; seen {
+			continue
+		}
+
+		absPath := filepath.Join(root, filepath.FromSlash(rel))
+		info, err := os.Lstat(absPath)
+		if os.IsNotExist(err) {
+			continue // Tracked but deleted from the working tree
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat path %q: %w", absPath, err)
+		}
+		if info.IsDir() {
+			continue // Submodule checkout
+		}
+
+		if info.Mode().IsRegular() && ((e.excludeEmptyFiles && info.Size() == 0) || e.isExcludedBySize(info.Size())) {
+			continue
+		}
+		if info.Mode().IsRegular() && e.contentClass != ContentAll {
+			binary, err := e.isBinary(absPath)
+			if err != nil {
+				return nil, err
+			}
+			if binary != (e.contentClass == ContentBinaryOnly) {
+				continue
+			}
+		}
+
+		result, err := e.hashPath(absPath, visited)
+		if err != nil {
+			return nil, err
+		}
+		_, followed := e.followLink(absPath)
+		leaves[rel] = leafResult{Result: result, isLink: info.Mode()&os.ModeSymlink != 0 && !followed}
+	}
+	return leaves, nil
+}
+
+// HashGitChanged computes a Merkle root over only the files of the working tree at path
+// that git reports as changed: modified or added (staged or not), renamed or copied
+// (under their new name), and untracked files not ignored by .gitignore. Deleted files
+// cannot be hashed and are left out. The root is built exactly like the root of a tree
+// holding just those files, so it changes whenever one of them does, and it is the hash
+// of an empty directory when nothing changed. The engine's exclusion patterns and content
+// class are applied too.
+//
+// Parameters:
+//   - path: The working tree directory (the repository root or any subdirectory)
+//
+// Returns the root result, the sorted slash-separated paths (relative to path) of the
+// files it covers, and any error encountered.
+func (e *Engine) HashGitChanged(path string) (Result, []string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return Result{}, nil, fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	changed, err := gitChangedFiles(absPath)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	return e.hashChangedFiles(absPath, changed)
+}
+
+// HashGitChangedSince computes a Merkle root over only the files of the working tree at
+// path that changed since ref, e.g. the tag of the last release: files whose contents
+// differ from ref (committed, staged or not), and untracked files not ignored by
+// .gitignore. Deleted files are left out. The root is built like HashGitChanged's, so it is
+// a fingerprint of what changed since ref.
+//
+// Parameters:
+//   - path: The working tree directory (the repository root or any subdirectory)
+//   - ref: The commit, branch or tag to compare against
+//
+// Returns the root result, the sorted slash-separated paths (relative to path) of the
+// files it covers, and any error encountered, e.g. if ref does not exist.
+func (e *Engine) HashGitChangedSince(path, ref string) (Result, []string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return Result{}, nil, fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	changed, err := gitChangedSince(absPath, ref)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	return e.hashChangedFiles(absPath, changed)
+}
+
+// hashChangedFiles computes the root of a tree holding just the given files of the working
+// tree at absPath, skipping the ones that no longer exist.
+//
+// Returns the root result, the sorted paths of the hashed files, and any error encountered.
+func (e *Engine) hashChangedFiles(absPath string, changed []string) (Result, []string, error) {
+	if e.rootPath == "" {
+		e.rootPath = absPath
+	}
+	leaves, err := e.hashWorktreeFiles(absPath, changed)
+	if err != nil {
+		return Result{}, nil, err
+	}
+
+	paths := make([]string, 0, len(leaves))
+	for rel := range leaves {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+
+	root, err := e.rootFromLeaves(leaves)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	if e.includeRootName {
+		if root, err = e.withRootName(absPath, root); err != nil {
+			return Result{}, nil, err
+		}
+	}
+	logger.WithOperation("hash_git_changed", "path", absPath).Debug("Hashed changed files", "files", len(paths))
+	return root, paths, nil
+}
+
+// gitChangedFiles lists the files under root that "git status" reports as changed or
+// untracked, as slash-separated paths relative to root. Deleted files are included;
+// callers skip them when they are missing from the working tree.
+func gitChangedFiles(root string) ([]string, error) {
+	// Porcelain paths are relative to the repository root, not to root
+	prefixOut, err := runGit(root, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSpace(string(prefixOut))
+
+	out, err := runGit(root, "status", "--porcelain=v1", "-z", "--untracked-files=all", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	records := strings.Split(string(out), "\x00")
+	for i := 0; i < len(records); i++ {
+		// Format: "XY SP <path>", followed by a "<source path>" record for renames and copies
+		record := records[i]
+		if len(record) < 4 {
+			continue
+		}
+		status, rel := record[:2], record[3:]
+		if strings.ContainsAny(status, "RC") {
+			i++ // Skip the source path
+		}
+		if rel, ok := strings.CutPrefix(rel, prefix); ok {
+			changed = append(changed, rel)
+		}
+	}
+	return changed, nil
+}
+
+// gitChangedSince lists the files under root that differ from ref, and the untracked files
+// not ignored by .gitignore, as slash-separated paths relative to root. Deleted files are
+// included; callers skip them when they are missing from the working tree.
+func gitChangedSince(root, ref string) ([]string, error) {
+	if strings.HasPrefix(ref, "-") {
+		return nil, fmt.Errorf("invalid git ref %q", ref)
+	}
+	if _, err := runGit(root, "rev-parse", "--verify", "--quiet", "--end-of-options", ref+"^{commit}"); err != nil {
+		return nil, fmt.Errorf("unknown git ref %q: %w", ref, err)
+	}
+
+	// --relative makes paths relative to root, like ls-files does
+	diffOut, err := runGit(root, "diff", "--name-only", "-z", "--relative", ref, "--", ".")
+	if err != nil {
+		return nil, err
+	}
+	untrackedOut, err := runGit(root, "ls-files", "--others", "--exclude-standard", "-z", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for _, out := range [][]byte{diffOut, untrackedOut} {
+		for _, rel := range strings.Split(string(out), "\x00") {
+			if rel != "" {
+				changed = append(changed, rel)
+			}
+		}
+	}
+	return changed, nil
+}
+
+// gitRefLeaves hashes every blob of the tree recorded in ref, restricted to root.
+// The ref is resolved to its tree first, so it is never passed on as an option.
+// Blob contents are streamed from a single "git cat-file --batch" process.
+//
+// Returns a map from slash-separated path (relative to root) to leaf result.
+func (e *Engine) gitRefLeaves(root, ref string) (map[string]leafResult, error) {
+	if strings.HasPrefix(ref, "-") {
+		return nil, fmt.Errorf("invalid git ref %q", ref)
+	}
+	treeOut, err := runGit(root, "rev-parse", "--verify", "--quiet", "--end-of-options", ref+"^{tree}")
+	if err != nil {
+		return nil, fmt.Errorf("unknown git ref %q: %w", ref, err)
+	}
+	out, err := runGit(root, "ls-tree", "-r", "-z", strings.TrimSpace(string(treeOut)))
+	if err != nil {
+		return nil, err
+	}
+
+	type blob struct {
+		path string
+		mode string
+		sha  string
+	}
+	var blobs []blob
+	for _, line := range strings.Split(string(out), "\x00") {
+		// Format: "<mode> SP <type> SP <object> TAB <path>"
+		meta, rel, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 3 || fields[1] != gitTypeBlob || e.isExcludedRel(root, rel) {
+			continue
+		}
+		if fields[0] == gitModeSymlink {
+			if err := e.checkSymlink(rel); err != nil {
+				return nil, err
+			}
+		}
+		blobs = append(blobs, blob{path: rel, mode: fields[0], sha: fields[2]})
+	}
+
+	leaves := make(map[string]leafResult, len(blobs))
+	if len(blobs) == 0 {
+		return leaves, nil
+	}
+
+	cmd := exec.Command("git", "-C", root, "cat-file", "--batch")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+	}
+
+	// Feed object names concurrently so git never blocks on a full stdout pipe
+	go func() {
+		w := bufio.NewWriter(stdin)
+		for _, b := range blobs {
+			if _, err := w.WriteString(b.sha + "\n"); err != nil {
+				break
+			}
+		}
+		if err := w.Flush(); err != nil {
+			logger.WithOperation("compare_git").Warn("Failed to write to git cat-file", "error", err)
+		}
+		if err := stdin.Close(); err != nil {
+			logger.WithOperation("compare_git").Warn("Failed to close git cat-file input", "error", err)
+		}
+	}()
+
+	r := bufio.NewReader(stdout)
+	for _, b := range blobs {
+		result, keep, err := e.readBlob(r, b.mode == gitModeSymlink)
+		if err != nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			return nil, fmt.Errorf("failed to read %s from git: %w", b.path, err)
+		}
+		if keep {
+			leaves[b.path] = leafResult{Result: result, isLink: b.mode == gitModeSymlink}
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("git cat-file failed: %w", err)
+	}
+	return leaves, nil
+}
+
+// readBlob reads one "git cat-file --batch" record and hashes its contents.
+// Symlink blobs hold the link target, which is hashed exactly like a symlink on disk.
+//
+// Returns the leaf result, whether the blob passes the engine's content class filter,
+// and any error encountered while reading.
+func (e *Engine) readBlob(r *bufio.Reader, symlink bool) (Result, bool, error) {
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return Result{}, false, err
+	}
+	// Format: "<object> SP <type> SP <size> LF <contents> LF"
+	fields := strings.Fields(header)
+	if len(fields) != 3 || fields[1] != gitTypeBlob {
+		return Result{}, false, fmt.Errorf("unexpected object header %q", strings.TrimSpace(header))
+	}
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return Result{}, false, fmt.Errorf("invalid object size in %q: %w", strings.TrimSpace(header), err)
+	}
+
+	head := make([]byte, min(size, SniffSize))
+	if _, err := io.ReadFull(r, head); err != nil {
+		return Result{}, false, err
+	}
+	chunkSize := e.chunkSize
+	if symlink {
+		chunkSize = 0 // Link targets are never chunked
+	}
+	ch := newChunkHasher(e.newHash, chunkSize, size)
+	var w io.Writer = ch
+	var ext *externalHasher
+	if e.hasherCmd != "" && !symlink {
+		ext, err = startExternalHasher(e.hasherCmd)
+		if err != nil {
+			return Result{}, false, err
+		}
+		defer ext.abort()
+		w = ext
+	}
+	// With head-only hashing, the rest of the blob is read past without being hashed
+	hashed := size
+	if !symlink && e.headOnly(size) {
+		hashed = e.headBytes
+	}
+	// A byte order mark is skipped like when reading the file from disk
+	start, end := 0, int(min(int64(len(head)), hashed))
+	if !symlink && e.stripsBOM(head) {
+		start = min(len(utf8BOM), end)
+	}
+	if _, err := w.Write(head[start:end]); err != nil {
+		return Result{}, false, err
+	}
+	if _, err := io.CopyN(w, r, max(hashed-int64(len(head)), 0)); err != nil {
+		return Result{}, false, err
+	}
+	if _, err := io.CopyN(io.Discard, r, size-max(hashed, int64(len(head)))); err != nil {
+		return Result{}, false, err
+	}
+	if _, err := r.Discard(1); err != nil { // Trailing LF
+		return Result{}, false, err
+	}
+	var digest []byte
+	if ext != nil {
+		if digest, err = ext.sum(); err != nil {
+			return Result{}, false, err
+		}
+	} else {
+		h, err := ch.final()
+		if err != nil {
+			return Result{}, false, err
+		}
+		if !symlink {
+			e.writeHeadSize(h, size)
+		}
+		digest = h.Sum(nil)
+	}
+
+	if symlink {
+		// Symlinks have zero size
+		return Result{Hash: digest, Size: 0}, true, nil
+	}
+	if (e.excludeEmptyFiles && size == 0) || e.isExcludedBySize(size) {
+		return Result{}, false, nil
+	}
+	if e.contentClass != ContentAll {
+		binary := bytes.IndexByte(head, 0) >= 0
+		if binary != (e.contentClass == ContentBinaryOnly) {
+			return Result{}, false, nil
+		}
+	}
+	return Result{Hash: digest, Size: size}, true, nil
+}
+
+// isExcludedRel reports whether a slash-separated path relative to root, or any of its
+// parent directories, matches the engine's exclusion patterns.
+func (e *Engine) isExcludedRel(root, rel string) bool {
+	if e.matcher == nil {
+		return false
+	}
+	segments := strings.Split(rel, "/")
+	current := root
+	for i, seg := range segments {
+		current = filepath.Join(current, seg)
+		if e.isExcluded(current, i < len(segments)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// rootFromLeaves computes the Merkle root of a tree containing exactly the given files.
+// Intermediate directories are implied by the paths and combined exactly like hashDir does
+// (using the engine's name ordering), so a directory without empty subdirectories or special files produces the same root
+// as HashPath.
+//
+// Parameters:
+//   - leaves: A map from slash-separated relative path to leaf result
+//
+// Returns the root result and any error encountered while combining hashes.
+func (e *Engine) rootFromLeaves(leaves map[string]leafResult) (Result, error) {
+	type node struct {
+		children map[string]*node
+		leaf     *leafResult
+	}
+	root := &node{children: map[string]*node{}}
+	for rel, result := range leaves {
+		current := root
+		segments := strings.Split(rel, "/")
+		for _, seg := range segments[:len(segments)-1] {
+			next, ok := current.children[seg]
+			if !ok {
+				next = &node{children: map[string]*node{}}
+				current.children[seg] = next
+			}
+			current = next
+		}
+		leaf := result
+		current.children[segments[len(segments)-1]] = &node{leaf: &leaf}
+	}
+
+	var combine func(n *node) (Result, error)
+	combine = func(n *node) (Result, error) {
+		if n.leaf != nil {
+			return n.leaf.Result, nil
+		}
+		names := make([]string, 0, len(n.children))
+		for name := range n.children {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return e.nameLess(names[i], names[j])
+		})
+
+		children := make([]childResult, 0, len(names))
+		for _, name := range names {
+			result, err := combine(n.children[name])
+			if err != nil {
+				return Result{}, err
+			}
+			leaf := n.children[name].leaf
+			children = append(children, childResult{name: name, isDir: leaf == nil, isLink: leaf != nil && leaf.isLink, result: result})
+		}
+		return combineResults(e.algorithm, children)
+	}
+	return combine(root)
+}
+
+// runGit runs a git command in dir and returns its standard output.
+func runGit(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
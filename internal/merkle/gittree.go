@@ -0,0 +1,235 @@
+// Package merkle (gittree.go) provides git-compatible object IDs of a tree on disk.
+// Files, symlinks and directories are serialized as git blob and tree objects and hashed
+// with SHA-1 exactly as git does, so the root matches "git write-tree" for the same files
+// and each entry can be looked up with "git cat-file". These IDs are independent of the
+// engine's hash algorithm and Merkle node rules.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // Git object IDs are defined as SHA-1
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// gitModeFile is the git tree entry mode of a regular file
+	gitModeFile = "100644"
+	// gitModeExecutable is the git tree entry mode of an executable file
+	gitModeExecutable = "100755"
+	// gitModeTree is the git tree entry mode of a directory, as "git ls-tree" prints it
+	gitModeTree = "040000"
+	// gitTypeTree is the git object type of directories
+	gitTypeTree = "tree"
+	// gitDirName is the name of git's own directory, which git never stores in a tree
+	gitDirName = ".git"
+)
+
+// GitTreeEntry is an entry of a git tree, as listed by "git ls-tree".
+type GitTreeEntry struct {
+	// Mode is the entry mode: 100644, 100755, 120000 or 040000
+	Mode string
+	// Type is the object type: blob or tree
+	Type string
+	// OID is the 20-byte SHA-1 object ID
+	OID []byte
+	// Path is the slash-separated path relative to the root ("." for the root directory)
+	Path string
+}
+
+// String formats the entry like a line of "git ls-tree": mode, type, object ID and path.
+func (g GitTreeEntry) String() string {
+	return fmt.Sprintf("%s %s %x\t%s", g.Mode, g.Type, g.OID, g.Path)
+}
+
+// GitTree computes the git object IDs of path and everything under it. The engine's
+// exclusions are applied, special files and ".git" directories are skipped, and
+// directories left without entries are omitted, since git cannot store them; an empty
+// root directory yields git's empty tree.
+//
+// Parameters:
+//   - path: The file or directory to describe
+//
+// Returns the root entry, every entry below it in "git ls-tree -r -t" order (each tree
+// before its contents), and any error encountered.
+func (e *Engine) GitTree(path string) (GitTreeEntry, []GitTreeEntry, error) {
+	path, err := e.resolveRoot(path)
+	if err != nil {
+		return GitTreeEntry{}, nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return GitTreeEntry{}, nil, fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	if e.rootPath == "" {
+		e.rootPath = absPath
+	}
+
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return GitTreeEntry{}, nil, fmt.Errorf("failed to stat path %q: %w", absPath, err)
+	}
+	if !info.IsDir() {
+		root, err := e.gitLeaf(absPath, info)
+		if err != nil {
+			return GitTreeEntry{}, nil, err
+		}
+		root.Path = filepath.Base(absPath)
+		return root, nil, nil
+	}
+
+	var listing []GitTreeEntry
+	oid, _, err := e.gitTreeDir(absPath, "", &listing)
+	if err != nil {
+		return GitTreeEntry{}, nil, err
+	}
+	return GitTreeEntry{Mode: gitModeTree, Type: gitTypeTree, OID: oid, Path: "."}, listing, nil
+}
+
+// gitTreeDir computes the tree object ID of a directory, appending its entries and those
+// of its subdirectories to listing.
+//
+// Parameters:
+//   - dir: The absolute path of the directory
+//   - rel: The slash-separated path of the directory relative to the root ("" for the root)
+//   - listing: The entries found so far
+//
+// Returns the tree object ID, whether the directory has any entries, and any error.
+func (e *Engine) gitTreeDir(dir, rel string, listing *[]GitTreeEntry) ([]byte, bool, error) {
+	entries, err := e.readDirEntries(dir)
+	if err != nil {
+		return nil, false, err
+	}
+	// Git orders entries bytewise, comparing directory names as if they ended in "/"
+	sort.Slice(entries, func(i, j int) bool {
+		return gitSortName(entries[i]) < gitSortName(entries[j])
+	})
+
+	var object bytes.Buffer
+	for _, entry := range entries {
+		if entry.Name() == gitDirName || entry.Type()&(os.ModeNamedPipe|os.ModeSocket|os.ModeDevice) != 0 {
+			continue
+		}
+		childPath := filepath.Join(dir, entry.Name())
+		if e.isExcluded(childPath, entry.IsDir()) || e.onOtherDevice(entry) {
+			continue
+		}
+		childRel := path.Join(rel, entry.Name())
+
+		var child GitTreeEntry
+		if entry.IsDir() {
+			// Reserve the tree's place before its contents, and drop it if it ends up empty
+			index := len(*listing)
+			*listing = append(*listing, GitTreeEntry{})
+			oid, ok, err := e.gitTreeDir(childPath, childRel, listing)
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				*listing = (*listing)[:index]
+				continue
+			}
+			child = GitTreeEntry{Mode: gitModeTree, Type: gitTypeTree, OID: oid, Path: childRel}
+			(*listing)[index] = child
+		} else {
+			info, err := entry.Info()
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to get info for entry %q in directory %q: %w", entry.Name(), dir, err)
+			}
+			if info.Mode().IsRegular() && e.isExcludedBySize(info.Size()) {
+				continue
+			}
+			if child, err = e.gitLeaf(childPath, info); err != nil {
+				return nil, false, err
+			}
+			child.Path = childRel
+			*listing = append(*listing, child)
+		}
+
+		// Tree objects store modes without leading zeros and object IDs in binary
+		fmt.Fprintf(&object, "%s %s\x00", strings.TrimLeft(child.Mode, "0"), entry.Name())
+		object.Write(child.OID)
+	}
+	if object.Len() == 0 && rel != "" {
+		return nil, false, nil
+	}
+	return gitObjectID(gitTypeTree, object.Bytes()), true, nil
+}
+
+// gitLeaf computes the blob entry of a file or symlink; a symlink's blob holds its target.
+func (e *Engine) gitLeaf(path string, info os.FileInfo) (GitTreeEntry, error) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return GitTreeEntry{}, fmt.Errorf("failed to read symlink %q: %w", path, err)
+		}
+		return GitTreeEntry{Mode: gitModeSymlink, Type: gitTypeBlob, OID: gitObjectID(gitTypeBlob, []byte(target))}, nil
+	}
+
+	mode := gitModeFile
+	if info.Mode()&0o100 != 0 {
+		mode = gitModeExecutable
+	}
+	oid, err := e.gitBlobFile(path, info.Size())
+	if err != nil {
+		return GitTreeEntry{}, err
+	}
+	return GitTreeEntry{Mode: mode, Type: gitTypeBlob, OID: oid}, nil
+}
+
+// gitBlobFile computes the blob object ID of a file's contents, streaming the file under
+// the same concurrency, open-file and read-rate limits as hashFile.
+func (e *Engine) gitBlobFile(path string, size int64) ([]byte, error) {
+	e.sem <- struct{}{}
+	defer func() { <-e.sem }()
+
+	e.acquireFD()
+	defer e.releaseFD()
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", path, err)
+	}
+	defer e.closeFile(f, "git_tree", path)
+
+	bufPtr, ok := e.bufferPool.get()
+	if !ok {
+		return nil, fmt.Errorf("failed to get buffer from pool")
+	}
+	defer e.bufferPool.put(bufPtr)
+	buf := *bufPtr
+	if e.limiter != nil && int64(len(buf)) > int64(e.limiter.rate) {
+		buf = buf[:int(e.limiter.rate)]
+	}
+
+	h := sha1.New() //nolint:gosec // Git object IDs are defined as SHA-1
+	fmt.Fprintf(h, "%s %d\x00", gitTypeBlob, size)
+	n, err := e.readContents(h, f, buf, fmt.Sprintf("file %q", path))
+	if err != nil {
+		return nil, err
+	}
+	if n != size {
+		// The header already committed to the size, so the object ID would be wrong
+		return nil, fmt.Errorf("file %q changed size while being read", path)
+	}
+	return h.Sum(nil), nil
+}
+
+// gitObjectID computes the ID of a git object of the given type and contents.
+func gitObjectID(kind string, data []byte) []byte {
+	h := sha1.New() //nolint:gosec // Git object IDs are defined as SHA-1
+	fmt.Fprintf(h, "%s %d\x00", kind, len(data))
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// gitSortName returns the name git sorts a directory entry by.
+func gitSortName(entry os.DirEntry) string {
+	if entry.IsDir() {
+		return entry.Name() + "/"
+	}
+	return entry.Name()
+}
@@ -0,0 +1,114 @@
+// Package merkle (hardlink.go) provides hardlink-aware hashing. With SetIncludeHardlinks,
+// files sharing an inode within the tree have their link group mixed into their hash, so
+// two trees with the same contents but a different hardlink topology hash differently.
+package merkle
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// inode identifies a file's inode: the device holding it and its inode number.
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// SetIncludeHardlinks makes the hashes of files with several hardlinks within the tree
+// cover their link group. Each such file's hash is combined with the path, relative to the
+// root, of the first file (in bytewise path order) sharing its inode, so identical trees
+// whose files are linked differently do not hash the same. Files whose other links are
+// outside the tree hash as before. Inode numbers themselves are never hashed, so a copy
+// preserving the links (e.g. with rsync -H) keeps its root. Applies to trees on disk.
+//
+// Returns an error if hardlinks cannot be detected on this platform.
+func (e *Engine) SetIncludeHardlinks(include bool) error {
+	if include && !HardlinksSupported {
+		return fmt.Errorf("hardlinks cannot be detected on this platform")
+	}
+	e.includeHardlinks = include
+	return nil
+}
+
+// hardlinkGroups returns, for every inode with several links within the tree, the first
+// of its paths relative to the root. The tree is walked once, on first use, applying the
+// same exclusions as hashing; unreadable directories are skipped, as hashing reports them.
+func (e *Engine) hardlinkGroups() map[inode]string {
+	e.hardlinksOnce.Do(func() {
+		counts := make(map[inode]int)
+		first := make(map[inode]string)
+		_ = filepath.WalkDir(e.rootPath, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || path == e.rootPath {
+				return nil
+			}
+			if e.isExcluded(path, entry.IsDir()) || e.onOtherDevice(entry) {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !entry.Type().IsRegular() {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil
+			}
+			id, ok := inodeOf(info)
+			if !ok {
+				return nil
+			}
+			rel, err := filepath.Rel(e.rootPath, path)
+			if err != nil {
+				return nil
+			}
+			rel = filepath.ToSlash(rel)
+			counts[id]++
+			if current, seen := first[id]; !seen || rel < current {
+				first[id] = rel
+			}
+			return nil
+		})
+
+		e.hardlinks = make(map[inode]string)
+		for id, count := range counts {
+			if count > 1 {
+				e.hardlinks[id] = first[id]
+			}
+		}
+	})
+	return e.hardlinks
+}
+
+// withHardlink returns the result of a file with its link group mixed in, when hardlinks
+// are included and the file shares its inode with another file of the tree: the hash of
+// the file hash, a NUL byte, and the path of the group's first file. The size is unchanged.
+//
+// Parameters:
+//   - info: The file's information, as returned by Lstat
+//   - result: The file's content result
+//
+// Returns the result to use for the file and any error encountered while hashing.
+func (e *Engine) withHardlink(info os.FileInfo, result Result) (Result, error) {
+	if !e.includeHardlinks {
+		return result, nil
+	}
+	id, ok := inodeOf(info)
+	if !ok {
+		return result, nil
+	}
+	group, ok := e.hardlinkGroups()[id]
+	if !ok {
+		return result, nil
+	}
+	h := e.newHash()
+	_, _ = h.Write(result.Hash)
+	_, _ = h.Write([]byte{0})
+	if _, err := io.WriteString(h, group); err != nil {
+		return Result{}, fmt.Errorf("failed to hash hardlink group: %w", err)
+	}
+	return Result{Hash: h.Sum(nil), Size: result.Size}, nil
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+// Package merkle (hardlink_other.go) provides the inode fallback for platforms without
+// Unix inode numbers.
+package merkle
+
+import "os"
+
+// HardlinksSupported reports whether hardlinks can be detected on this platform.
+const HardlinksSupported = false
+
+// inodeOf is not supported on this platform.
+func inodeOf(info os.FileInfo) (inode, bool) {
+	return inode{}, false
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+// Package merkle (hardlink_unix.go) reads inode identities on Unix systems.
+package merkle
+
+import (
+	"os"
+	"syscall"
+)
+
+// HardlinksSupported reports whether hardlinks can be detected on this platform.
+const HardlinksSupported = true
+
+// inodeOf returns the identity of the inode behind the file described by info, and
+// whether the file has other hardlinks.
+//
+// Returns the inode identity, and false if the file has a single link or its inode
+// cannot be determined.
+func inodeOf(info os.FileInfo) (inode, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return inode{}, false
+	}
+	return inode{dev: uint64(st.Dev), ino: st.Ino}, true //nolint:unconvert // Dev is not uint64 on every Unix
+}
@@ -0,0 +1,98 @@
+//go:build unix
+
+package merkle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEngine_IncludeHardlinks(t *testing.T) {
+	// Two trees with identical contents: in linked, b.txt is a hardlink to a.txt
+	copied := t.TempDir()
+	linked := t.TempDir()
+	for _, root := range []string{copied, linked} {
+		if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		for _, name := range []string{"a.txt", "c.txt"} {
+			if err := os.WriteFile(filepath.Join(root, name), []byte("shared content"), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+		}
+	}
+	if err := os.WriteFile(filepath.Join(copied, "sub", "b.txt"), []byte("shared content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Link(filepath.Join(linked, "a.txt"), filepath.Join(linked, "sub", "b.txt")); err != nil {
+		t.Fatalf("Failed to create hardlink: %v", err)
+	}
+
+	hash := func(root string, include bool) Result {
+		t.Helper()
+		engine := NewEngine()
+		if err := engine.SetIncludeHardlinks(include); err != nil {
+			t.Fatalf("SetIncludeHardlinks() error = %v", err)
+		}
+		result, err := engine.HashPath(root)
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		return result
+	}
+
+	if !equal(hash(copied, false).Hash, hash(linked, false).Hash) {
+		t.Error("Hardlinks should not affect the hash by default")
+	}
+	if !equal(hash(copied, true).Hash, hash(copied, false).Hash) {
+		t.Error("A tree without hardlinks should hash the same with --include-hardlinks")
+	}
+	withLinks := hash(linked, true)
+	if equal(withLinks.Hash, hash(copied, true).Hash) {
+		t.Error("Trees with different hardlink topology should hash differently with --include-hardlinks")
+	}
+	if withLinks.Size != hash(linked, false).Size {
+		t.Errorf("Size = %d with --include-hardlinks, want it unchanged", withLinks.Size)
+	}
+
+	// Linking a different pair of files is a different topology
+	relinked := t.TempDir()
+	if err := os.Mkdir(filepath.Join(relinked, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		if err := os.WriteFile(filepath.Join(relinked, filepath.FromSlash(name)), []byte("shared content"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	if err := os.Link(filepath.Join(relinked, "a.txt"), filepath.Join(relinked, "c.txt")); err != nil {
+		t.Fatalf("Failed to create hardlink: %v", err)
+	}
+	if equal(hash(relinked, true).Hash, withLinks.Hash) {
+		t.Error("Linking different files should change the hash with --include-hardlinks")
+	}
+
+	// A file whose only other link is outside the hashed tree is not marked
+	if !equal(hash(filepath.Join(linked, "sub"), true).Hash, hash(filepath.Join(copied, "sub"), true).Hash) {
+		t.Error("Links leaving the hashed tree should not affect its hash")
+	}
+}
+
+func TestHashFS_IncludeHardlinks(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	engine := NewEngine()
+	if err := engine.SetIncludeHardlinks(true); err != nil {
+		t.Fatalf("SetIncludeHardlinks() error = %v", err)
+	}
+	if _, err := engine.HashFS(os.DirFS(root), "."); err == nil {
+		t.Error("HashFS() expected error with SetIncludeHardlinks, which a file system cannot honor")
+	}
+	if _, err := DiffFS(os.DirFS(root), ".", os.DirFS(root), ".", engine, engine, func(string) error { return nil }); err == nil {
+		t.Error("DiffFS() expected error with SetIncludeHardlinks, which a file system cannot honor")
+	}
+}
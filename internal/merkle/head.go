@@ -0,0 +1,44 @@
+// Package merkle (head.go) provides head-only hashing for quick fingerprints.
+// With a head size, only the first bytes of each larger file are read and hashed together
+// with its size, giving a "probably identical" signal for near-duplicate detection at a
+// fraction of the I/O. It is not an integrity check: changes past the head go unnoticed.
+package merkle
+
+import (
+	"hash"
+	"io"
+	"strconv"
+)
+
+// SetHeadBytes makes the engine hash only the first n bytes of each file larger than n,
+// followed by "\x00<size>", instead of its whole contents. Files of at most n bytes are
+// hashed in full, exactly as without a head size. Zero or a negative value disables it
+// (the default). Changes the root hash of trees holding files larger than n bytes.
+//
+// Parameters:
+//   - n: The number of leading bytes hashed from each file
+func (e *Engine) SetHeadBytes(n int64) {
+	e.headBytes = max(n, 0)
+}
+
+// headOnly reports whether only the head of a file of the given size is hashed.
+func (e *Engine) headOnly(size int64) bool {
+	return e.headBytes > 0 && size > e.headBytes
+}
+
+// headReader limits r to the head of a file of the given size, if only its head is hashed.
+func (e *Engine) headReader(r io.Reader, size int64) io.Reader {
+	if !e.headOnly(size) {
+		return r
+	}
+	return io.LimitReader(r, e.headBytes)
+}
+
+// writeHeadSize mixes the size of a file whose head alone was hashed into its hash, so
+// files sharing a head but not a size still differ.
+func (e *Engine) writeHeadSize(h hash.Hash, size int64) {
+	if e.headOnly(size) {
+		_, _ = io.WriteString(h, "\x00")
+		_, _ = io.WriteString(h, strconv.FormatInt(size, 10))
+	}
+}
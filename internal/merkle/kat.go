@@ -0,0 +1,95 @@
+// Package merkle (kat.go) provides known-answer tests for the node hash algorithms.
+// Roots are only comparable over time if the hash implementations keep producing the same
+// output, so a dependency bump that silently changed, for example, the BLAKE3 library's
+// output would invalidate every stored hash. The baked-in vectors below catch that.
+package merkle
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// knownAnswer holds the expected hashes of fixed inputs for one algorithm.
+type knownAnswer struct {
+	algorithm Algorithm
+	// empty and abc are the hashes of the empty input and of "abc", the standard test vectors
+	empty string
+	abc   string
+	// dir is the root of a directory holding a.txt ("abc") and b.txt (empty): the hash of
+	// each leaf's type and hash in turn, pinning how directories combine their entries
+	dir string
+}
+
+// knownAnswers lists the expected hashes for every supported algorithm.
+var knownAnswers = []knownAnswer{
+	{
+		algorithm: AlgorithmBLAKE3,
+		empty:     "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262",
+		abc:       "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85",
+		dir:       "480f7a7d45462dd8ed45aa3285a2ece0a5e1c10c0a8241680454a044fbc24d62",
+	},
+	{
+		algorithm: AlgorithmSHA256,
+		empty:     "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		abc:       "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		dir:       "fa8f37cd212a6ee25403e46df20b1062acaea9bdaf4bf8e7295b23a108467fa6",
+	},
+	{
+		algorithm: AlgorithmSHA3_256,
+		empty:     "a7ffc6f8bf1ed76651c14756a061d662f580ff4de43b49fa82d80a4b80f8434a",
+		abc:       "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532",
+		dir:       "a330be92c38a5941d2b6781d000465f270bcd270d4ee59313d817bf651d7f9ac",
+	},
+	{
+		algorithm: AlgorithmSHA3_512,
+		empty:     "a69f73cca23a9ac5c8b567dc185a756e97c982164fe25859e0d1dcc1475c80a615b2123af1f5f94c11e3e9402c3ac558f500199d95b6d3e301758586281dcd26",
+		abc:       "b751850b1a57168a5693cd924b6b096e08f621827444f70d884f5d0240d2712e10e116e9192af3c91a7ec57647e3934057340b4cf408d5a56592f8274eec53f0",
+		dir:       "44ce709784adbec849e37fd7f12f8a26fb457a0e1a21df17d8a7650c26f2a70ee75d14782375542552544e10c46fba17d1226360686963acfdae8676ebfea1e2",
+	},
+}
+
+// KnownAnswerTest hashes fixed inputs with every supported algorithm and compares the
+// results with baked-in expected values, both for single inputs and for a directory
+// combining two leaves. A mismatch means a hash implementation (for instance after a
+// dependency update) no longer produces the output earlier versions did, so roots it
+// computes are not comparable with stored ones.
+//
+// Returns nil if every answer matches, or an error listing the mismatches.
+func KnownAnswerTest() error {
+	var errs []error
+	for _, ka := range knownAnswers {
+		empty := hashBytes(ka.algorithm, nil)
+		abc := hashBytes(ka.algorithm, []byte("abc"))
+		dir, err := combineResults(ka.algorithm, []childResult{
+			{result: Result{Hash: abc, Size: 3}},
+			{result: Result{Hash: empty}},
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, got := range []struct {
+			name string
+			hash []byte
+			want string
+		}{
+			{name: "empty input", hash: empty, want: ka.empty},
+			{name: `"abc"`, hash: abc, want: ka.abc},
+			{name: "directory", hash: dir.Hash, want: ka.dir},
+		} {
+			if hex.EncodeToString(got.hash) != got.want {
+				errs = append(errs, fmt.Errorf("%s known answer for %s: got %x, want %s", ka.algorithm, got.name, got.hash, got.want))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hashBytes returns the hash of data with the given algorithm.
+func hashBytes(algorithm Algorithm, data []byte) []byte {
+	h := algorithm.New()
+	// Writing to a hash.Hash never returns an error
+	_, _ = h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,87 @@
+// Package merkle (limit.go) provides a safety cap on the number of entries per directory.
+// A corrupted or malicious directory holding millions of entries would otherwise be
+// listed and queued in full before any of it is hashed. With a limit, such a directory
+// fails fast after reading one entry past the limit, or, in truncating mode, only its
+// first entries in sorted order are hashed.
+package merkle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+)
+
+// SetEntriesLimit caps the number of entries a single directory may hold. When a
+// directory exceeds limit, hashing fails, unless truncate is true: then a warning is
+// logged and only the first limit entries in sorted order are hashed, which changes the
+// root hash. Truncation has to list the whole directory to pick the sorted entries
+// deterministically, while failing stops reading right after the limit. Zero or a
+// negative limit means unlimited (the default).
+func (e *Engine) SetEntriesLimit(limit int, truncate bool) {
+	e.entriesLimit = max(limit, 0)
+	e.truncateEntries = truncate
+}
+
+// readDirEntries lists a directory sorted by name, enforcing the entries limit.
+//
+// Parameters:
+//   - path: The absolute path to the directory
+//
+// Returns the sorted entries, or an error if the directory cannot be read or exceeds
+// the limit without truncation.
+func (e *Engine) readDirEntries(path string) ([]os.DirEntry, error) {
+	var entries []os.DirEntry
+	var err error
+	failFast := e.entriesLimit > 0 && !e.truncateEntries
+	e.acquireFD()
+	if failFast {
+		entries, err = readDirAtMost(path, e.entriesLimit+1)
+	} else {
+		entries, err = os.ReadDir(path)
+	}
+	e.releaseFD()
+	if err == nil && failFast && len(entries) > e.entriesLimit {
+		return nil, fmt.Errorf("directory %q has more than %d entries (--entries-limit)", path, e.entriesLimit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %q: %w", path, err)
+	}
+
+	// Sort entries by name for deterministic hashing
+	sort.Slice(entries, func(i, j int) bool {
+		return e.nameLess(entries[i].Name(), entries[j].Name())
+	})
+
+	if e.entriesLimit > 0 && len(entries) > e.entriesLimit {
+		logger.WithOperation("hash_dir", "path", path).Warn("Directory exceeds entries limit, truncating",
+			"entries", len(entries),
+			"limit", e.entriesLimit,
+		)
+		e.diagnostics.add(DiagnosticTruncated, path, fmt.Sprintf("%d entries, limit %d", len(entries), e.entriesLimit))
+		entries = entries[:e.entriesLimit]
+	}
+	return entries, nil
+}
+
+// readDirAtMost reads at most n entries of a directory, in directory order.
+func readDirAtMost(path string, n int) ([]os.DirEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			logger.WithOperation("hash_dir", "path", path).Warn("Failed to close directory", "error", err)
+		}
+	}()
+
+	entries, err := f.ReadDir(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return entries, nil
+}
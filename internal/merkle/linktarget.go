@@ -0,0 +1,50 @@
+// Package merkle (linktarget.go) provides the target a symlink leaf is hashed from.
+// Symlinks are hashed in one of three modes. By default a link is a leaf hashed from its
+// target exactly as stored, so "../lib/x" and "/opt/lib/x" differ even if they point to
+// the same file. With following (follow.go), a link is hashed as the file or directory it
+// points to. With resolved targets, a link stays a leaf but is hashed from the absolute
+// real path it finally points to, so links reaching the same file through different
+// chains of links hash alike, without reading what they point to.
+package merkle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SetResolveSymlinks makes the engine hash symlink leaves from the absolute real path they
+// resolve to, following every link in the chain, instead of from their target as stored.
+// Contents are never read. A dangling link is resolved as far as its parent directory, and
+// hashed from its target joined to it. Real paths depend on where the tree is, so roots of
+// trees holding symlinks differ between copies at different locations. Changes the root
+// hash of trees holding symlinks.
+func (e *Engine) SetResolveSymlinks(resolve bool) {
+	e.resolveSymlinks = resolve
+}
+
+// symlinkTarget returns the string the symlink at path is hashed from: its target as
+// stored or, if the engine resolves symlinks, the absolute real path it resolves to.
+func (e *Engine) symlinkTarget(path string) (string, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read symlink %q: %w", path, err)
+	}
+	if !e.resolveSymlinks {
+		return target, nil
+	}
+
+	real, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return filepath.Abs(real)
+	}
+	// Dangling or circular: resolve the directory holding the link instead
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		dir = filepath.Dir(path)
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(dir, target)
+	}
+	return filepath.Abs(target)
+}
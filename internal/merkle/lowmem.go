@@ -0,0 +1,76 @@
+// Package merkle (lowmem.go) provides the low-memory directory combine.
+// By default, a directory collects the results of all its entries before combining
+// them into its own hash. When entries are hashed sequentially, they complete in the
+// order they are combined, so in low-memory mode each child hash is written to the
+// directory's hasher as soon as it is known and then dropped, keeping peak memory
+// independent of the number of entries per directory beyond their listing.
+package merkle
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+)
+
+// SetLowMemory enables or disables the low-memory combine. It only takes effect while
+// entries are hashed sequentially: adaptive scheduling (unless a byte budget forces
+// sorted order) and callers that need every directory's children, such as manifests
+// and inclusion proofs, keep collecting results. Does not change the root hash.
+func (e *Engine) SetLowMemory(enabled bool) {
+	e.lowMemory = enabled
+}
+
+// streamsCombine reports whether directories are combined with the low-memory combine.
+func (e *Engine) streamsCombine() bool {
+	sequential := e.spawn == nil || e.byteBudget > 0
+	return e.lowMemory && sequential && e.onDir == nil
+}
+
+// hashDirStreaming hashes a directory like hashDir, writing each included entry's hash
+// to the directory hasher as soon as it is computed instead of collecting the results.
+//
+// Parameters:
+//   - path: The absolute path to the directory to hash
+//   - visited: A thread-safe map tracking visited paths to detect circular symlinks
+//
+// Returns the directory result and any error encountered.
+func (e *Engine) hashDirStreaming(path string, visited *sync.Map) (Result, error) {
+	start := time.Now()
+	log := logger.WithOperation("hash_dir", "path", path)
+
+	workItems, err := e.dirWorkItems(path)
+	if err != nil {
+		return Result{}, err
+	}
+
+	h := e.newHash()
+	var totalSize int64
+	processed := 0
+	for _, item := range workItems {
+		child, keep, err := e.hashEntry(path, item.entry, item.entryPath, visited)
+		if err != nil {
+			return Result{}, err
+		}
+		if !keep {
+			continue
+		}
+		if err := writeEntry(h, child.nodeType(), child.result.Hash); err != nil {
+			log.Error("Failed to write to hash", "error", err)
+			return Result{}, err
+		}
+		totalSize += child.result.Size
+		processed++
+	}
+
+	log.Debug("Directory hashed successfully",
+		"processed", processed,
+		"duration", time.Since(start),
+		"total_size", totalSize,
+		"low_memory", true,
+	)
+	if processed == 0 {
+		return emptyDirResult(e.algorithm), nil
+	}
+	return Result{Hash: h.Sum(nil), Size: totalSize}, nil
+}
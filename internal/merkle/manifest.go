@@ -0,0 +1,389 @@
+// Package merkle (manifest.go) provides tree manifests.
+// A manifest records the root hash of a tree together with the hash and size of every
+// file and symlink in it, so individual entries can later be re-verified on their own,
+// for example by re-hashing a random sample of a very large tree.
+package merkle
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/zeebo/blake3"
+)
+
+const (
+	// ManifestVersion is the version of the manifest format written by BuildManifest.
+	ManifestVersion = 1
+	// EntryFile is the manifest entry type of a regular file.
+	EntryFile = "f"
+	// EntrySymlink is the manifest entry type of a symbolic link.
+	EntrySymlink = "l"
+	// ManifestFingerprintSize is the size in bytes of a manifest fingerprint.
+	ManifestFingerprintSize = 16
+	// ManifestNameHashSize is the size in bytes of a path component hashed by HashNames.
+	ManifestNameHashSize = 16
+)
+
+// Manifest lists the leaves of a tree with their hashes.
+// All hashes are lowercase hexadecimal strings so manifests can be stored as JSON.
+type Manifest struct {
+	// Version is the manifest format version.
+	Version int `json:"version"`
+	// Root is the Merkle root hash of the tree.
+	Root string `json:"root"`
+	// Size is the total size in bytes of the tree.
+	Size int64 `json:"size"`
+	// Entries lists every file and symlink of the tree, sorted by path.
+	Entries []ManifestEntry `json:"entries"`
+	// Algorithm is the node hash algorithm; empty means BLAKE3.
+	Algorithm string `json:"algorithm,omitempty"`
+	// HashedNames reports that entry paths were replaced by HashNames, so the manifest
+	// can be compared with another one but not verified against a tree.
+	HashedNames bool `json:"hashed_names,omitempty"`
+}
+
+// ManifestEntry is a single file or symlink of a manifest.
+type ManifestEntry struct {
+	// Path is the slash-separated path relative to the tree root ("." if the root is a file).
+	Path string `json:"path"`
+	// Type is EntryFile or EntrySymlink.
+	Type string `json:"type"`
+	// Hash is the hash of the file contents or symlink target.
+	Hash string `json:"hash"`
+	// Size is the size of the file in bytes (zero for symlinks).
+	Size int64 `json:"size"`
+}
+
+// ManifestReport is the outcome of verifying (part of) a manifest against a tree.
+type ManifestReport struct {
+	// Total is the number of entries in the manifest.
+	Total int
+	// Checked lists the paths of the entries that were re-hashed, in manifest order.
+	Checked []string
+	// Failures lists one "missing: <path>" or "modified: <path>" line per failed entry.
+	Failures []string
+}
+
+// BuildManifest hashes the tree at path with the engine's configuration and records
+// every file and symlink it contains. Entries of assumed subtrees are not listed.
+//
+// Parameters:
+//   - path: The file or directory to describe
+//
+// Returns the manifest and any error encountered while hashing.
+func (e *Engine) BuildManifest(path string) (*Manifest, error) {
+	path, err := e.resolveRoot(path)
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	if e.rootPath == "" {
+		e.rootPath = absPath
+	}
+
+	var entries []ManifestEntry
+	e.onDir = func(dir string, children []childResult) {
+		for _, child := range children {
+			if child.isDir {
+				continue
+			}
+			rel, err := filepath.Rel(absPath, filepath.Join(dir, child.name))
+			if err != nil {
+				continue
+			}
+			entries = append(entries, newManifestEntry(rel, child.isLink, child.result))
+		}
+	}
+	defer func() { e.onDir = nil }()
+
+	root, err := e.HashPath(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat path %q: %w", absPath, err)
+	}
+	if !info.IsDir() {
+		entries = []ManifestEntry{newManifestEntry(".", info.Mode()&os.ModeSymlink != 0, root)}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+
+	manifest := &Manifest{
+		Version: ManifestVersion,
+		Root:    hex.EncodeToString(root.Hash),
+		Size:    root.Size,
+		Entries: entries,
+	}
+	if algorithm := e.Algorithm(); algorithm != AlgorithmBLAKE3 {
+		manifest.Algorithm = string(algorithm)
+	}
+	return manifest, nil
+}
+
+// newManifestEntry builds the manifest entry of a leaf at the given relative path.
+func newManifestEntry(rel string, isLink bool, result Result) ManifestEntry {
+	entryType := EntryFile
+	if isLink {
+		entryType = EntrySymlink
+	}
+	return ManifestEntry{
+		Path: filepath.ToSlash(rel),
+		Type: entryType,
+		Hash: hex.EncodeToString(result.Hash),
+		Size: result.Size,
+	}
+}
+
+// Fingerprint returns a short hexadecimal BLAKE3 hash of the manifest's JSON encoding,
+// so two manifests can be compared by a single value. The encoding is deterministic
+// (fields in a fixed order, entries sorted by path), so manifests with the same root,
+// size, algorithm and entries always have the same fingerprint.
+//
+// Returns the fingerprint, or an error if the manifest cannot be encoded.
+func (m *Manifest) Fingerprint() (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	sum := blake3.Sum256(data)
+	return hex.EncodeToString(sum[:ManifestFingerprintSize]), nil
+}
+
+// HashNames replaces the path components of every entry below the given depth with
+// hashes, for sharing a manifest without revealing file names. Each hidden component is
+// replaced by a BLAKE3 hash of the entry's path up to and including it, so entries of the
+// same directory still share a prefix and the structure can be compared, while equal names
+// in different directories do not give each other away. Content hashes and sizes are kept,
+// and entries are sorted again by their new paths.
+//
+// Names are not salted: anyone able to guess a full path can confirm it is present.
+//
+// Parameters:
+//   - depth: The number of leading path components kept in clear (0 hashes every name)
+//
+// Returns an error if depth is negative.
+func (m *Manifest) HashNames(depth int) error {
+	if depth < 0 {
+		return fmt.Errorf("redact depth must not be negative, got %d", depth)
+	}
+	for i, entry := range m.Entries {
+		if entry.Path == "." {
+			// The root itself has no name to hide
+			continue
+		}
+		names := strings.Split(entry.Path, "/")
+		components := slices.Clone(names)
+		for j := depth; j < len(names); j++ {
+			sum := blake3.Sum256([]byte(strings.Join(names[:j+1], "/")))
+			components[j] = hex.EncodeToString(sum[:ManifestNameHashSize])
+		}
+		m.Entries[i].Path = strings.Join(components, "/")
+	}
+	sort.Slice(m.Entries, func(i, j int) bool {
+		return m.Entries[i].Path < m.Entries[j].Path
+	})
+	m.HashedNames = true
+	return nil
+}
+
+// VerifyManifest re-hashes manifest entries under root and reports those that are
+// missing or whose hash differs. With a sample fraction below 1, only a random subset
+// of ceil(sample * entries) entries is checked; the subset is drawn from a generator
+// seeded with seed, so the same seed always selects the same entries. Exclusion
+// patterns are not applied, since the manifest lists exactly what to check.
+//
+// Parameters:
+//   - m: The manifest to verify
+//   - root: The tree the manifest describes
+//   - sample: The fraction of entries to check, in (0, 1]
+//   - seed: The seed used to select the sample
+//
+// Returns the report, or an error if the sample fraction is invalid.
+func (e *Engine) VerifyManifest(m *Manifest, root string, sample float64, seed int64) (*ManifestReport, error) {
+	if m == nil {
+		return nil, fmt.Errorf("manifest is nil")
+	}
+	if m.HashedNames {
+		return nil, fmt.Errorf("manifest has hashed names and cannot be verified against a tree; compare it with a manifest built with the same --hash-names options instead")
+	}
+	if math.IsNaN(sample) || sample <= 0 || sample > 1 {
+		return nil, fmt.Errorf("sample fraction must be in (0, 1], got %v", sample)
+	}
+	algorithm, err := ParseAlgorithm(m.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm != e.Algorithm() {
+		return nil, fmt.Errorf("manifest was built with %s, but the engine uses %s", algorithm, e.Algorithm())
+	}
+	root, err = e.resolveRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve root path: %w", err)
+	}
+	if e.rootPath == "" {
+		e.rootPath = absRoot
+	}
+	log := logger.WithOperation("verify_manifest", "path", absRoot, "sample", sample, "seed", seed)
+
+	report := &ManifestReport{Total: len(m.Entries)}
+	visited := &sync.Map{}
+	for _, i := range sampleIndices(len(m.Entries), sample, seed) {
+		entry := m.Entries[i]
+		report.Checked = append(report.Checked, entry.Path)
+
+		absPath := filepath.Join(absRoot, filepath.FromSlash(entry.Path))
+		if _, err := os.Lstat(absPath); err != nil {
+			report.Failures = append(report.Failures, "missing: "+entry.Path)
+			continue
+		}
+		result, err := e.verifyLeaf(absPath, entry, visited)
+		if err != nil {
+			log.Warn("Failed to hash manifest entry", "entry", entry.Path, "error", err)
+			report.Failures = append(report.Failures, "modified: "+entry.Path)
+			continue
+		}
+		if hex.EncodeToString(result.Hash) != entry.Hash {
+			report.Failures = append(report.Failures, "modified: "+entry.Path)
+		}
+	}
+
+	log.Info("Manifest verified", "checked", len(report.Checked), "total", report.Total, "failures", len(report.Failures))
+	return report, nil
+}
+
+// CompareManifests compares two manifests without touching any tree, keyed on entry path,
+// so snapshots recorded at different times or on different machines can be diffed. It
+// returns a single "No differences detected" message if the roots and every entry match.
+// Otherwise a root mismatch is reported, if the roots differ, followed by one line per
+// differing entry, sorted by path: "added: <path>" (only in a), "deleted: <path>" (only in
+// b) or "modified: <path>" (hash, size or type differ), as the diff command reports files.
+//
+// Parameters:
+//   - a: The first manifest
+//   - b: The second manifest
+//
+// Returns the difference messages, or an error if the manifests were built with different
+// algorithms or only one of them has hashed names, which makes them incomparable.
+func CompareManifests(a, b *Manifest) ([]string, error) {
+	if a == nil || b == nil {
+		return nil, fmt.Errorf("manifest is nil")
+	}
+	algorithmA, err := ParseAlgorithm(a.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	algorithmB, err := ParseAlgorithm(b.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if algorithmA != algorithmB {
+		return nil, fmt.Errorf("manifests were built with different algorithms (%s and %s)", algorithmA, algorithmB)
+	}
+	if a.HashedNames != b.HashedNames {
+		return nil, fmt.Errorf("only one of the manifests has hashed names, so their paths cannot be compared")
+	}
+
+	entriesA := make(map[string]ManifestEntry, len(a.Entries))
+	for _, entry := range a.Entries {
+		entriesA[entry.Path] = entry
+	}
+	entriesB := make(map[string]ManifestEntry, len(b.Entries))
+	for _, entry := range b.Entries {
+		entriesB[entry.Path] = entry
+	}
+	paths := make([]string, 0, len(entriesA)+len(entriesB))
+	for path := range entriesA {
+		paths = append(paths, path)
+	}
+	for path := range entriesB {
+		if _, ok := entriesA[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var diff []string
+	if a.Root != b.Root || a.Size != b.Size {
+		diff = append(diff, fmt.Sprintf("Root mismatch:\nA: %s (size: %d)\nB: %s (size: %d)", a.Root, a.Size, b.Root, b.Size))
+	}
+	for _, path := range paths {
+		entryA, inA := entriesA[path]
+		entryB, inB := entriesB[path]
+		switch {
+		case !inB:
+			diff = append(diff, "added: "+path)
+		case !inA:
+			diff = append(diff, "deleted: "+path)
+		case entryA != entryB:
+			diff = append(diff, "modified: "+path)
+		}
+	}
+	if len(diff) == 0 {
+		return []string{noDifferencesMsg}, nil
+	}
+	return diff, nil
+}
+
+// verifyLeaf hashes a single manifest entry. Symlinks are hashed by their target;
+// anything else is hashed like HashPath would, so a file replaced by a directory
+// or a symlink does not match.
+func (e *Engine) verifyLeaf(absPath string, entry ManifestEntry, visited *sync.Map) (Result, error) {
+	if entry.Type == EntrySymlink {
+		target, err := e.symlinkTarget(absPath)
+		if err != nil {
+			return Result{}, err
+		}
+		h := e.newHash()
+		if _, err := io.WriteString(h, target); err != nil {
+			return Result{}, fmt.Errorf("failed to hash symlink target: %w", err)
+		}
+		return Result{Hash: h.Sum(nil), Size: 0}, nil
+	}
+	return e.hashPath(absPath, visited)
+}
+
+// sampleIndices selects ceil(fraction * n) distinct indices in [0, n), chosen with a
+// generator seeded by seed, and returns them in increasing order. A fraction of 1
+// selects every index.
+func sampleIndices(n int, fraction float64, seed int64) []int {
+	k := int(math.Ceil(fraction * float64(n)))
+	if k >= n {
+		k = n
+	}
+
+	var indices []int
+	if k == n {
+		indices = make([]int, n)
+		for i := range indices {
+			indices[i] = i
+		}
+		return indices
+	}
+
+	rng := rand.New(rand.NewPCG(uint64(seed), 0)) //nolint:gosec // Sampling, not security-sensitive
+	indices = rng.Perm(n)[:k]
+	sort.Ints(indices)
+	return indices
+}
@@ -0,0 +1,305 @@
+// Package merkle (manifestformat.go) provides the YAML and TOML encodings of manifests.
+// Both encode the same fields as JSON, under the same names, so a manifest can be written
+// for config-driven tools and still be verified. Only the subset of each language needed
+// for a manifest is written and read, so no YAML or TOML library is required.
+package merkle
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ManifestFormat is the encoding of a manifest.
+type ManifestFormat string
+
+const (
+	// ManifestJSON encodes manifests as JSON, the default.
+	ManifestJSON ManifestFormat = "json"
+	// ManifestYAML encodes manifests as a YAML document.
+	ManifestYAML ManifestFormat = "yaml"
+	// ManifestTOML encodes manifests as a TOML document, with entries as an array of tables.
+	ManifestTOML ManifestFormat = "toml"
+)
+
+// ParseManifestFormat parses a manifest format name (json, yaml or toml), case-insensitively.
+//
+// Returns the format, or an error if the name is not supported.
+func ParseManifestFormat(name string) (ManifestFormat, error) {
+	switch format := ManifestFormat(strings.ToLower(strings.TrimSpace(name))); format {
+	case ManifestJSON, ManifestYAML, ManifestTOML:
+		return format, nil
+	case "yml":
+		return ManifestYAML, nil
+	default:
+		return "", fmt.Errorf("unsupported manifest format %q (supported: json, yaml, toml)", name)
+	}
+}
+
+// DetectManifestFormat guesses the format of an encoded manifest from its first line that
+// is not blank or a comment: "{" starts JSON, "key =" or "[[" starts TOML, and anything
+// else is taken as YAML.
+func DetectManifestFormat(data []byte) ManifestFormat {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "{"):
+			return ManifestJSON
+		case strings.HasPrefix(line, "[["):
+			return ManifestTOML
+		}
+		if key, _, ok := strings.Cut(line, "="); ok && !strings.ContainsAny(key, ":\"") {
+			return ManifestTOML
+		}
+		return ManifestYAML
+	}
+	return ManifestJSON
+}
+
+// EncodeYAML returns the manifest as a YAML document. Strings are double-quoted, so paths
+// that look like numbers or contain special characters keep their meaning.
+func (m *Manifest) EncodeYAML() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "version: %d\n", m.Version)
+	fmt.Fprintf(&b, "root: %s\n", quoteManifestString(m.Root))
+	fmt.Fprintf(&b, "size: %d\n", m.Size)
+	if m.Algorithm != "" {
+		fmt.Fprintf(&b, "algorithm: %s\n", quoteManifestString(m.Algorithm))
+	}
+	if m.HashedNames {
+		b.WriteString("hashed_names: true\n")
+	}
+	if len(m.Entries) == 0 {
+		b.WriteString("entries: []\n")
+		return b.Bytes()
+	}
+	b.WriteString("entries:\n")
+	for _, entry := range m.Entries {
+		fmt.Fprintf(&b, "  - path: %s\n", quoteManifestString(entry.Path))
+		fmt.Fprintf(&b, "    type: %s\n", quoteManifestString(entry.Type))
+		fmt.Fprintf(&b, "    hash: %s\n", quoteManifestString(entry.Hash))
+		fmt.Fprintf(&b, "    size: %d\n", entry.Size)
+	}
+	return b.Bytes()
+}
+
+// EncodeTOML returns the manifest as a TOML document, with one [[entries]] table per entry.
+func (m *Manifest) EncodeTOML() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "version = %d\n", m.Version)
+	fmt.Fprintf(&b, "root = %s\n", quoteManifestString(m.Root))
+	fmt.Fprintf(&b, "size = %d\n", m.Size)
+	if m.Algorithm != "" {
+		fmt.Fprintf(&b, "algorithm = %s\n", quoteManifestString(m.Algorithm))
+	}
+	if m.HashedNames {
+		b.WriteString("hashed_names = true\n")
+	}
+	if len(m.Entries) == 0 {
+		b.WriteString("entries = []\n")
+		return b.Bytes()
+	}
+	for _, entry := range m.Entries {
+		b.WriteString("\n[[entries]]\n")
+		fmt.Fprintf(&b, "path = %s\n", quoteManifestString(entry.Path))
+		fmt.Fprintf(&b, "type = %s\n", quoteManifestString(entry.Type))
+		fmt.Fprintf(&b, "hash = %s\n", quoteManifestString(entry.Hash))
+		fmt.Fprintf(&b, "size = %d\n", entry.Size)
+	}
+	return b.Bytes()
+}
+
+// quoteManifestString double-quotes s with the escapes YAML, TOML and JSON have in common:
+// \" and \\, and \uXXXX for control characters. Invalid UTF-8 is replaced by U+FFFD, as
+// encoding/json does.
+func quoteManifestString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range strings.ToValidUTF8(s, string(utf8.RuneError)) {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, "\\u%04x", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// ParseManifest decodes a manifest in the given format. YAML and TOML manifests must have
+// the layout written by EncodeYAML and EncodeTOML; unknown keys are ignored, as with JSON.
+//
+// Parameters:
+//   - data: The encoded manifest
+//   - format: The encoding of data
+//
+// Returns the manifest, or an error if data is not a valid manifest in that format.
+func ParseManifest(data []byte, format ManifestFormat) (*Manifest, error) {
+	var m Manifest
+	var err error
+	switch format {
+	case ManifestJSON:
+		err = json.Unmarshal(data, &m)
+	case ManifestYAML:
+		err = parseManifestLines(data, &m, parseYAMLLine)
+	case ManifestTOML:
+		err = parseManifestLines(data, &m, parseTOMLLine)
+	default:
+		return nil, fmt.Errorf("unsupported manifest format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// manifestLine is a line of a YAML or TOML manifest: a key and its raw value, and whether
+// it starts a new entry (a "- " item or an [[entries]] header) or belongs to one.
+type manifestLine struct {
+	key, value          string
+	newEntry, inEntries bool
+}
+
+// parseYAMLLine splits a line of a YAML manifest. inEntries reports whether the entries
+// list has started.
+func parseYAMLLine(line string, inEntries bool) (manifestLine, error) {
+	indented := strings.HasPrefix(line, " ")
+	line = strings.TrimSpace(line)
+	parsed := manifestLine{inEntries: indented}
+	if indented {
+		if !inEntries {
+			return parsed, fmt.Errorf("unexpected indented line %q", line)
+		}
+		if rest, ok := strings.CutPrefix(line, "- "); ok {
+			parsed.newEntry, line = true, strings.TrimSpace(rest)
+		}
+	}
+	key, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return parsed, fmt.Errorf("expected \"key: value\", got %q", line)
+	}
+	parsed.key, parsed.value = strings.TrimSpace(key), strings.TrimSpace(value)
+	return parsed, nil
+}
+
+// parseTOMLLine splits a line of a TOML manifest. Once an [[entries]] table has started,
+// every key belongs to an entry.
+func parseTOMLLine(line string, inEntries bool) (manifestLine, error) {
+	line = strings.TrimSpace(line)
+	if line == "[[entries]]" {
+		return manifestLine{newEntry: true, inEntries: true}, nil
+	}
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return manifestLine{}, fmt.Errorf("expected \"key = value\", got %q", line)
+	}
+	return manifestLine{key: strings.TrimSpace(key), value: strings.TrimSpace(value), inEntries: inEntries}, nil
+}
+
+// parseManifestLines decodes the lines of a YAML or TOML manifest into m, splitting each
+// line with split. Blank lines and "#" comments are skipped.
+func parseManifestLines(data []byte, m *Manifest, split func(line string, inEntries bool) (manifestLine, error)) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	inEntries := false
+	for number := 1; scanner.Scan(); number++ {
+		text := scanner.Text()
+		if trimmed := strings.TrimSpace(text); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		line, err := split(text, inEntries)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", number, err)
+		}
+		if line.newEntry {
+			m.Entries = append(m.Entries, ManifestEntry{})
+			inEntries = true
+		}
+		if line.key == "" {
+			continue
+		}
+		if line.inEntries {
+			if len(m.Entries) == 0 {
+				return fmt.Errorf("line %d: entry field %q outside an entry", number, line.key)
+			}
+			err = setManifestEntryField(&m.Entries[len(m.Entries)-1], line.key, line.value)
+		} else {
+			if line.key == "entries" {
+				if line.value != "" && line.value != "[]" {
+					return fmt.Errorf("line %d: unexpected entries value %q", number, line.value)
+				}
+				inEntries = line.value == ""
+				continue
+			}
+			err = setManifestField(m, line.key, line.value)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", number, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// setManifestField sets the top-level manifest field named key from its raw value.
+func setManifestField(m *Manifest, key, value string) error {
+	var err error
+	switch key {
+	case "version":
+		m.Version, err = strconv.Atoi(value)
+	case "root":
+		m.Root, err = unquoteManifestString(value)
+	case "size":
+		m.Size, err = strconv.ParseInt(value, 10, 64)
+	case "algorithm":
+		m.Algorithm, err = unquoteManifestString(value)
+	case "hashed_names":
+		m.HashedNames, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return nil
+}
+
+// setManifestEntryField sets the entry field named key from its raw value.
+func setManifestEntryField(entry *ManifestEntry, key, value string) error {
+	var err error
+	switch key {
+	case "path":
+		entry.Path, err = unquoteManifestString(value)
+	case "type":
+		entry.Type, err = unquoteManifestString(value)
+	case "hash":
+		entry.Hash, err = unquoteManifestString(value)
+	case "size":
+		entry.Size, err = strconv.ParseInt(value, 10, 64)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid entry %s %q: %w", key, value, err)
+	}
+	return nil
+}
+
+// unquoteManifestString decodes a string written by quoteManifestString.
+func unquoteManifestString(value string) (string, error) {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return "", fmt.Errorf("expected a double-quoted string")
+	}
+	var s string
+	if err := json.Unmarshal([]byte(value), &s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
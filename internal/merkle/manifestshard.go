@@ -0,0 +1,144 @@
+// Package merkle (manifestshard.go) provides sharded manifests.
+// The manifest of a huge tree is a single unwieldy file. Like git's loose objects, its
+// entries can instead be spread over shards named after the first hex digits of a hash of
+// each entry's path, listed by an index. Every shard is itself a manifest of the same tree
+// holding only its entries, so it can be read and verified on its own.
+package merkle
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zeebo/blake3"
+)
+
+const (
+	// ManifestIndexFile is the name of the index of a sharded manifest, in JSON.
+	ManifestIndexFile = "index.json"
+	// MaxShardBy is the largest number of hex digits shards can be named after.
+	MaxShardBy = 4
+)
+
+// ManifestIndex describes a manifest split into shards.
+type ManifestIndex struct {
+	// Version is the manifest format version.
+	Version int `json:"version"`
+	// Root is the Merkle root hash of the tree.
+	Root string `json:"root"`
+	// Size is the total size in bytes of the tree.
+	Size int64 `json:"size"`
+	// Algorithm is the node hash algorithm; empty means BLAKE3.
+	Algorithm string `json:"algorithm,omitempty"`
+	// HashedNames reports that entry paths were replaced by HashNames.
+	HashedNames bool `json:"hashed_names,omitempty"`
+	// ShardBy is the number of hex digits of the path hash shards are named after.
+	ShardBy int `json:"shard_by"`
+	// Entries is the total number of entries across all shards.
+	Entries int `json:"entries"`
+	// Shards lists the shards, sorted by prefix. Prefixes without entries have no shard.
+	Shards []ManifestShard `json:"shards"`
+}
+
+// ManifestShard is a single shard of a sharded manifest.
+type ManifestShard struct {
+	// Prefix is the leading hex digits of the path hash shared by the shard's entries.
+	Prefix string `json:"prefix"`
+	// File is the name of the shard's manifest file, relative to the index.
+	File string `json:"file"`
+	// Entries is the number of entries in the shard.
+	Entries int `json:"entries"`
+}
+
+// shardPrefix returns the first n hex digits of the BLAKE3 hash of an entry path.
+func shardPrefix(path string, n int) string {
+	sum := blake3.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:])[:n]
+}
+
+// Shard splits the manifest by the first shardBy hex digits of the BLAKE3 hash of each
+// entry's path, spreading entries evenly whatever the layout of the tree. Each shard keeps
+// the manifest's root, size and options and holds its entries in path order; the index
+// names shard files "<prefix>.<ext>".
+//
+// Parameters:
+//   - shardBy: The number of hex digits shards are named after, from 1 to MaxShardBy
+//   - ext: The file name extension of the shards, e.g. "json"
+//
+// Returns the index and the shards keyed by prefix, or an error if shardBy is out of range.
+func (m *Manifest) Shard(shardBy int, ext string) (*ManifestIndex, map[string]*Manifest, error) {
+	if shardBy < 1 || shardBy > MaxShardBy {
+		return nil, nil, fmt.Errorf("shard prefix length must be between 1 and %d, got %d", MaxShardBy, shardBy)
+	}
+	shards := make(map[string]*Manifest)
+	for _, entry := range m.Entries {
+		prefix := shardPrefix(entry.Path, shardBy)
+		shard, ok := shards[prefix]
+		if !ok {
+			shard = &Manifest{Version: m.Version, Root: m.Root, Size: m.Size, Algorithm: m.Algorithm, HashedNames: m.HashedNames}
+			shards[prefix] = shard
+		}
+		shard.Entries = append(shard.Entries, entry)
+	}
+
+	index := &ManifestIndex{
+		Version:     m.Version,
+		Root:        m.Root,
+		Size:        m.Size,
+		Algorithm:   m.Algorithm,
+		HashedNames: m.HashedNames,
+		ShardBy:     shardBy,
+		Entries:     len(m.Entries),
+		Shards:      make([]ManifestShard, 0, len(shards)),
+	}
+	for prefix, shard := range shards {
+		index.Shards = append(index.Shards, ManifestShard{Prefix: prefix, File: prefix + "." + ext, Entries: len(shard.Entries)})
+	}
+	sort.Slice(index.Shards, func(i, j int) bool {
+		return index.Shards[i].Prefix < index.Shards[j].Prefix
+	})
+	return index, shards, nil
+}
+
+// AssembleShards reassembles the manifest split by Shard from its index and shards,
+// checking that the shards belong to the same tree, hold the number of entries the index
+// records, and only entries whose path hash matches their prefix.
+//
+// Parameters:
+//   - index: The index of the sharded manifest
+//   - shards: The shards keyed by prefix, one for every shard of the index
+//
+// Returns the manifest with entries sorted by path, or an error if a shard is missing
+// or does not match the index.
+func AssembleShards(index *ManifestIndex, shards map[string]*Manifest) (*Manifest, error) {
+	if index.ShardBy < 1 || index.ShardBy > MaxShardBy {
+		return nil, fmt.Errorf("invalid shard prefix length %d in index", index.ShardBy)
+	}
+	m := &Manifest{Version: index.Version, Root: index.Root, Size: index.Size, Algorithm: index.Algorithm, HashedNames: index.HashedNames}
+	for _, s := range index.Shards {
+		shard, ok := shards[s.Prefix]
+		if !ok {
+			return nil, fmt.Errorf("shard %s is missing", s.File)
+		}
+		if !strings.EqualFold(shard.Root, index.Root) || shard.Algorithm != index.Algorithm || shard.HashedNames != index.HashedNames {
+			return nil, fmt.Errorf("shard %s describes another tree than the index", s.File)
+		}
+		if len(shard.Entries) != s.Entries {
+			return nil, fmt.Errorf("shard %s holds %d entries, but the index records %d", s.File, len(shard.Entries), s.Entries)
+		}
+		for _, entry := range shard.Entries {
+			if shardPrefix(entry.Path, index.ShardBy) != s.Prefix {
+				return nil, fmt.Errorf("shard %s holds entry %q of another shard", s.File, entry.Path)
+			}
+		}
+		m.Entries = append(m.Entries, shard.Entries...)
+	}
+	if len(m.Entries) != index.Entries {
+		return nil, fmt.Errorf("shards hold %d entries, but the index records %d", len(m.Entries), index.Entries)
+	}
+	sort.Slice(m.Entries, func(i, j int) bool {
+		return m.Entries[i].Path < m.Entries[j].Path
+	})
+	return m, nil
+}
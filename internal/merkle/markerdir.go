@@ -0,0 +1,32 @@
+// Package merkle (markerdir.go) provides marker directories, hashed by presence only.
+// Some directories hold volatile internals, such as a repository's .git, whose contents
+// change on every fetch or gc without any change to the tree that matters. Excluding them
+// would lose the fact that they exist; a marker directory is instead hashed as a single
+// leaf derived from its name, without descending into it.
+package merkle
+
+import "slices"
+
+// markerDirTag prefixes the input hashed for a marker directory, keeping its leaf apart from
+// a shallow directory's. A file holding the same input still differs in its directory's node,
+// which writes each entry's type before its hash.
+const markerDirTag = "mtc:marker-dir:"
+
+// SetMarkerDirs makes the engine hash directories with one of the given base names, e.g.
+// ".git", as a marker leaf without reading their contents: the root notes that such a
+// directory is present, and does not change when its contents do. Marker directories have
+// a size of 0. Exclusions still apply to them first; a file with a marker name is hashed
+// as usual. Changes the root hash of trees holding such directories.
+func (e *Engine) SetMarkerDirs(names []string) {
+	e.markerDirs = names
+}
+
+// isMarkerDir reports whether the directory named name is hashed as a marker leaf.
+func (e *Engine) isMarkerDir(name string) bool {
+	return slices.Contains(e.markerDirs, name)
+}
+
+// markerDirResult returns the marker leaf of the directory named name.
+func (e *Engine) markerDirResult(name string) Result {
+	return Result{Hash: hashBytes(e.algorithm, []byte(markerDirTag+name)), Size: 0}
+}
@@ -6,18 +6,21 @@
 package merkle
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lucho00cuba/mtc/internal/ignore"
 	"github.com/lucho00cuba/mtc/internal/logger"
-	"github.com/zeebo/blake3"
+	"github.com/lucho00cuba/mtc/internal/metrics"
+	"golang.org/x/text/unicode/norm"
 )
 
 const (
@@ -25,17 +28,35 @@ const (
 	DefaultBufferSize = 256 * 1024 // 256KB
 	// DefaultMaxWorkers limits concurrent directory hashing to avoid IO thrashing
 	DefaultMaxWorkers = 8
-	// HashSize is the size in bytes of MTC node hashes.
-	// BLAKE3 produces 32-byte (256-bit) hashes by default.
+	// HashSize is the size in bytes of MTC node hashes with the default algorithm.
+	// BLAKE3 produces 32-byte (256-bit) hashes by default; see Algorithm.Size.
 	HashSize = 32
+	// SniffSize is the number of leading bytes inspected to classify a file as text or binary.
+	SniffSize = 512
+	// FormatVersion is the version of the scheme combining leaf hashes into directory
+	// roots. It changes only if roots of unchanged trees change under default settings.
+	// Version 2 writes each entry's type before its hash (see NodeType).
+	FormatVersion = 2
+)
+
+// ContentClass selects which files contribute to a directory hash based on their content.
+type ContentClass int
+
+const (
+	// ContentAll includes every file (the default).
+	ContentAll ContentClass = iota
+	// ContentTextOnly includes only files classified as text.
+	ContentTextOnly
+	// ContentBinaryOnly includes only files classified as binary.
+	ContentBinaryOnly
 )
 
 // Result represents the result of hashing a path, containing both the hash and size.
-// The hash is a BLAKE3 hash (32 bytes by default) representing the Merkle root,
+// The hash is a hash of the engine's algorithm (BLAKE3 by default) representing the Merkle root,
 // and the size is the total size in bytes of all files hashed.
 type Result struct {
 	// Hash is the Merkle root hash as a byte slice.
-	// For files, this is the BLAKE3 hash of the file contents.
+	// For files, this is the hash of the file contents.
 	// For directories, this is the combined hash of all entries.
 	Hash []byte
 
@@ -45,31 +66,205 @@ type Result struct {
 	Size int64
 }
 
+// dirWorkItem is a directory entry selected for hashing, with its absolute path.
+type dirWorkItem struct {
+	entry     os.DirEntry
+	entryPath string
+}
+
+// childResult is the hash result of a single directory entry, as it contributes
+// to its parent directory's Merkle node.
+type childResult struct {
+	name   string
+	isDir  bool
+	isLink bool
+	result Result
+}
+
+// nodeType returns the type the entry contributes to its directory's node as.
+func (c childResult) nodeType() NodeType {
+	switch {
+	case c.isLink:
+		return NodeSymlink
+	case c.isDir:
+		return NodeDir
+	default:
+		return NodeFile
+	}
+}
+
+// NodeType is the type of a Merkle node as an entry of its directory, written with the
+// same letters as manifest entry types. A directory's node hashes each entry's type byte
+// before the entry's hash, so entries of different types never contribute alike: a
+// file holding exactly the bytes a directory or symlink leaf is hashed from still changes
+// the root of the directory holding it.
+type NodeType byte
+
+const (
+	// NodeFile is a regular file, hashed by its contents.
+	NodeFile NodeType = 'f'
+	// NodeDir is a directory, including one hashed without its contents, such as an
+	// empty, marker or shallow directory.
+	NodeDir NodeType = 'd'
+	// NodeSymlink is a symlink hashed as a link, from its target.
+	NodeSymlink NodeType = 'l'
+)
+
+// ParseNodeType returns the node type written as s: "f", "d" or "l".
+func ParseNodeType(s string) (NodeType, error) {
+	if len(s) == 1 {
+		switch t := NodeType(s[0]); t {
+		case NodeFile, NodeDir, NodeSymlink:
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid node type %q (expected f, d or l)", s)
+}
+
+// String returns the node type as a single letter: "f", "d" or "l".
+func (t NodeType) String() string {
+	return string(rune(t))
+}
+
+// writeEntry writes an entry's contribution to its directory's node: its type, then its hash.
+func writeEntry(w io.Writer, t NodeType, hash []byte) error {
+	if _, err := w.Write([]byte{byte(t)}); err != nil {
+		return fmt.Errorf("failed to combine hashes: %w", err)
+	}
+	if _, err := w.Write(hash); err != nil {
+		return fmt.Errorf("failed to combine hashes: %w", err)
+	}
+	return nil
+}
+
 // Engine represents a Merkle hashing engine with configurable concurrency and buffer management.
 // This structure is designed to be future-proof for caching, tree export, and partial diffing.
 type Engine struct {
 	maxWorkers int
-	bufferPool *sync.Pool
+	bufferPool *bufferPool
 	// sem is a global semaphore shared across the entire engine lifecycle.
 	// It prevents goroutine/thread explosion by bounding concurrent hashing work.
 	sem chan struct{}
+	// fds bounds the files and directories held open at once while hashing; nil is unlimited
+	fds chan struct{}
 	// matcher determines which paths should be excluded from hashing
 	matcher ignore.Matcher
+	// ignorePatterns, loadIgnoreFile, customIgnoreFile and ignoreFileName are the sources
+	// matcher was built from, and ignorePrecedence the order it matches them in, kept so
+	// it can be rebuilt when one of them changes
+	ignorePatterns   []string
+	loadIgnoreFile   bool
+	customIgnoreFile string
+	ignoreFileName   string
+	ignorePrecedence []string
+	// dockerMatcher applies the root's .dockerignore, anchored at the root; nil disables it
+	dockerMatcher *ignore.DockerMatcher
+	// dockerPatterns are the patterns dockerMatcher was built from
+	dockerPatterns []string
 	// rootPath is the root path being hashed, used for computing relative paths for matching
 	rootPath string
+	// onDir, if set, is called with the entry results of every directory once they are hashed.
+	// It is used to record intermediate tree nodes (e.g. sibling hashes for inclusion proofs).
+	onDir func(path string, children []childResult)
+	// contentClass restricts which files inside directories are hashed (text, binary or all)
+	contentClass ContentClass
+	// includeXattr mixes each file's extended attributes into its hash
+	includeXattr bool
+	// includeHardlinks mixes the link group of hardlinked files into their hash
+	includeHardlinks bool
+	// hardlinks maps hardlinked inodes to their group's first path, built once by hardlinkGroups
+	hardlinks     map[inode]string
+	hardlinksOnce sync.Once
+	// limiter throttles total read bandwidth across all workers (nil means unlimited)
+	limiter *rateLimiter
+	// chunkSize splits files larger than it into separately hashed chunks (0 disables chunking)
+	chunkSize int64
+	// normalizeUnicode orders entry names by their Unicode NFC form
+	normalizeUnicode bool
+	// oneFilesystem skips entries on a different device than rootPath
+	oneFilesystem bool
+	// rootDevOnce resolves rootDev, the device ID of rootPath, on first use
+	rootDevOnce sync.Once
+	rootDev     uint64
+	rootDevOK   bool
+	// metrics records hashing statistics (nil means statistics are not collected)
+	metrics *metrics.Registry
+	// assumed maps slash-separated paths relative to rootPath to precomputed hashes
+	// that replace hashing those entries (nil means nothing is assumed)
+	assumed map[string][]byte
+	// spawn bounds the goroutines started by adaptive scheduling (nil means entries
+	// of a directory are processed sequentially)
+	spawn chan struct{}
+	// onDirMu serializes onDir calls, which may come from concurrent directory workers
+	onDirMu sync.Mutex
+	// onFile, if set, is called with the result of every regular file once it is hashed
+	onFile func(path string, result Result)
+	// onFileMu serializes onFile calls, which may come from concurrent workers
+	onFileMu sync.Mutex
+	// byteBudget caps the bytes of file contents read (0 means unlimited);
+	// budgetUsed counts the bytes reserved so far
+	byteBudget int64
+	budgetUsed atomic.Int64
+	// hasherCmd, if set, is a shell command that hashes file contents instead of BLAKE3
+	hasherCmd string
+	// shallow hashes subdirectories by name only instead of descending into them
+	shallow bool
+	// resolveRootLink hashes the target of a symlinked root instead of the link itself
+	resolveRootLink bool
+	// realpathRoot checks that hashed files are inside the root by comparing real paths,
+	// so a root reached through a symlinked path does not reject its own children
+	realpathRoot bool
+	// realRootOnce resolves realRoot, the real path of rootPath, on first use
+	realRootOnce sync.Once
+	realRoot     string
+	// structureOnly hashes entry names and types instead of file contents
+	structureOnly bool
+	// excludeEmptyFiles skips zero-byte regular files inside directories
+	excludeEmptyFiles bool
+	// algorithm is the node hash algorithm; empty selects BLAKE3
+	algorithm Algorithm
+	// strictCase fails on directory entries whose names differ only by case
+	strictCase bool
+	// noSymlinks fails on any symlink encountered while hashing
+	noSymlinks bool
+	// ignoreVanished leaves out entries removed between listing and hashing
+	ignoreVanished bool
+	// markerDirs lists the names of directories hashed as a marker leaf without descending
+	markerDirs []string
+	// includeRootName mixes the base name of the hashed path into the root
+	includeRootName bool
+	// lowMemory writes child hashes straight into the parent hasher when entries are
+	// hashed sequentially, instead of collecting them first
+	lowMemory bool
+	// entriesLimit caps the entries of a single directory (0 means unlimited);
+	// truncateEntries hashes the first entriesLimit entries instead of failing
+	entriesLimit    int
+	truncateEntries bool
+	// excludeDeeperThan excludes entries nested more than this many levels below the
+	// root (0 means no depth limit)
+	excludeDeeperThan int
+	// diagnostics collects non-fatal problems for a summary (nil when not collecting)
+	diagnostics *Diagnostics
+	// headBytes hashes only the first headBytes of larger files, plus their size
+	// (0 means whole files)
+	headBytes int64
+	// excludeSize excludes files inside directories by size (--exclude-size)
+	excludeSize []ignore.SizeRule
+	// stripBOM skips a leading UTF-8 byte order mark of text files before hashing them
+	stripBOM bool
+	// followSymlinks hashes symlinks to files and directories as what they point to
+	followSymlinks bool
+	// resolveSymlinks hashes symlink leaves from the real path they resolve to
+	resolveSymlinks bool
 }
 
 // NewEngine creates a new Merkle hashing engine with default settings.
 func NewEngine() *Engine {
 	return &Engine{
 		maxWorkers: DefaultMaxWorkers,
-		bufferPool: &sync.Pool{
-			New: func() interface{} {
-				buf := make([]byte, DefaultBufferSize)
-				return &buf
-			},
-		},
-		sem: make(chan struct{}, DefaultMaxWorkers),
+		bufferPool: newBufferPool(DefaultBufferSize),
+		sem:        make(chan struct{}, DefaultMaxWorkers),
+		fds:        newOpenFilesBudget(0),
 	}
 }
 
@@ -80,13 +275,9 @@ func NewEngineWithWorkers(maxWorkers int) *Engine {
 	}
 	return &Engine{
 		maxWorkers: maxWorkers,
-		bufferPool: &sync.Pool{
-			New: func() interface{} {
-				buf := make([]byte, DefaultBufferSize)
-				return &buf
-			},
-		},
-		sem: make(chan struct{}, maxWorkers),
+		bufferPool: newBufferPool(DefaultBufferSize),
+		sem:        make(chan struct{}, maxWorkers),
+		fds:        newOpenFilesBudget(0),
 	}
 }
 
@@ -96,7 +287,7 @@ func NewEngineWithWorkers(maxWorkers int) *Engine {
 // loadIgnoreFile if true, loads .mtcignore and .gitignore files from the working directory.
 // customIgnoreFile is an optional path to a custom ignore file (takes highest priority if provided).
 func NewEngineWithExclusions(maxWorkers int, patterns []string, rootPath string, loadIgnoreFile bool, customIgnoreFile string) (*Engine, error) {
-	matcher, err := ignore.NewMatcher(patterns, rootPath, loadIgnoreFile, customIgnoreFile)
+	matcher, err := ignore.NewMatcher(patterns, rootPath, loadIgnoreFile, customIgnoreFile, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create exclusion matcher: %w", err)
 	}
@@ -111,21 +302,369 @@ func NewEngineWithExclusions(maxWorkers int, patterns []string, rootPath string,
 	}
 
 	return &Engine{
-		maxWorkers: maxWorkers,
-		bufferPool: &sync.Pool{
-			New: func() interface{} {
-				buf := make([]byte, DefaultBufferSize)
-				return &buf
-			},
-		},
-		sem:      make(chan struct{}, maxWorkers),
-		matcher:  matcher,
-		rootPath: absRoot,
+		maxWorkers:       maxWorkers,
+		bufferPool:       newBufferPool(DefaultBufferSize),
+		sem:              make(chan struct{}, maxWorkers),
+		fds:              newOpenFilesBudget(0),
+		matcher:          matcher,
+		ignorePatterns:   patterns,
+		loadIgnoreFile:   loadIgnoreFile,
+		customIgnoreFile: customIgnoreFile,
+		rootPath:         absRoot,
 	}, nil
 }
 
+// SetIgnorePrecedence rebuilds the engine's exclusion matcher so that pattern sources
+// are matched in the given priority order (see ignore.NewMatcherWithPrecedence): the
+// highest-priority source with a pattern matching a path decides whether it is excluded.
+// Nil restores the default, where any matching negation wins. It has no effect on
+// engines created without exclusions.
+//
+// Parameters:
+//   - precedence: The sources in priority order, highest first, as returned by ignore.ParsePrecedence
+//
+// Returns an error if an ignore file cannot be loaded.
+func (e *Engine) SetIgnorePrecedence(precedence []string) error {
+	if e.matcher == nil {
+		return nil
+	}
+	e.ignorePrecedence = precedence
+	return e.rebuildMatcher()
+}
+
+// SetIgnoreFileName rebuilds the engine's exclusion matcher so that the ignore files
+// discovered automatically are the ones named name instead of .mtcignore and .gitignore.
+// An empty name restores the default. It has no effect on engines created without
+// exclusions or without automatic ignore files.
+//
+// Parameters:
+//   - name: The ignore file name (e.g., ".checksumignore"); it must be a simple filename
+//
+// Returns an error if the name is not a simple filename or an ignore file cannot be loaded.
+func (e *Engine) SetIgnoreFileName(name string) error {
+	if err := ignore.ValidateIgnoreFileName(name); err != nil {
+		return err
+	}
+	if e.matcher == nil || !e.loadIgnoreFile {
+		return nil
+	}
+	e.ignoreFileName = name
+	return e.rebuildMatcher()
+}
+
+// rebuildMatcher builds the exclusion matcher again from its sources and precedence.
+func (e *Engine) rebuildMatcher() error {
+	matcher, err := ignore.NewMatcherWithPrecedence(e.ignorePatterns, e.rootPath, e.loadIgnoreFile, e.customIgnoreFile, e.ignoreFileName, e.ignorePrecedence)
+	if err != nil {
+		return fmt.Errorf("failed to create exclusion matcher: %w", err)
+	}
+	e.matcher = matcher
+	return nil
+}
+
+// SetContentClass restricts directory hashing to text or binary files.
+// Files are classified by sniffing their first SniffSize bytes: a file containing a NUL
+// byte is binary, anything else (including empty files) is text. Files of the other class
+// are left out of their directory's hash, so this changes the resulting root.
+// A single file passed directly to HashPath is always hashed.
+func (e *Engine) SetContentClass(class ContentClass) {
+	e.contentClass = class
+}
+
+// SetIncludeXattr makes file hashes cover the file's extended attributes in addition
+// to its contents. Attributes are sorted by name and mixed in as name=value pairs, so
+// SELinux labels, ACLs stored as xattrs, etc. change the hash. Files without extended
+// attributes hash as before.
+//
+// Returns an error if extended attributes are not supported on this platform.
+func (e *Engine) SetIncludeXattr(include bool) error {
+	if include && !XattrSupported {
+		return fmt.Errorf("extended attributes are not supported on this platform")
+	}
+	e.includeXattr = include
+	return nil
+}
+
+// SetMaxReadRate limits the total read bandwidth of the engine, shared across all
+// workers, to bytesPerSec bytes per second. Zero or a negative value means unlimited.
+// Throttling only affects how fast files are read; hashes are unchanged.
+func (e *Engine) SetMaxReadRate(bytesPerSec int64) {
+	if bytesPerSec <= 0 {
+		e.limiter = nil
+		return
+	}
+	e.limiter = newRateLimiter(bytesPerSec)
+}
+
+// SetNormalizeUnicode makes directory entries sort by the Unicode NFC form of their
+// names. macOS stores names decomposed (NFD) while Linux usually keeps them composed (NFC),
+// which can order the same entries differently; normalizing makes trees created on either
+// platform hash identically. Entries whose names normalize to the same form are ordered
+// by their raw names.
+func (e *Engine) SetNormalizeUnicode(normalize bool) {
+	e.normalizeUnicode = normalize
+}
+
+// SetDockerignore additionally excludes the paths matched by the .dockerignore file in
+// the root directory, with Docker's semantics (see ignore.DockerMatcher). Its patterns are
+// matched separately from the other sources, against paths relative to the root, so its
+// negations only re-include paths it excluded itself. It has no effect on engines created
+// without exclusions, or when the root is not a directory.
+//
+// Parameters:
+//   - enabled: Whether to load and apply the root's .dockerignore
+//
+// Returns an error if the .dockerignore file cannot be read.
+func (e *Engine) SetDockerignore(enabled bool) error {
+	e.dockerMatcher, e.dockerPatterns = nil, nil
+	if !enabled || e.matcher == nil || e.rootPath == "" {
+		return nil
+	}
+	if info, err := os.Stat(e.rootPath); err != nil || !info.IsDir() {
+		return nil
+	}
+	patterns, err := ignore.LoadDockerignore(e.rootPath)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", ignore.DockerignoreFile, err)
+	}
+	if len(patterns) > 0 {
+		e.dockerMatcher, e.dockerPatterns = ignore.NewDockerMatcher(patterns), patterns
+	}
+	return nil
+}
+
+// ExclusionFingerprint returns the fingerprint (see ignore.Fingerprint) of every exclusion
+// pattern the engine applies: command-line patterns, the custom ignore file, the
+// discovered .mtcignore and .gitignore files, the root's .dockerignore if enabled, and
+// the depth limit.
+// Roots computed by engines with different fingerprints may differ only because of
+// their exclusions.
+//
+// Returns the fingerprint, or an error if an ignore file cannot be read.
+func (e *Engine) ExclusionFingerprint() (string, error) {
+	patterns, err := e.ExclusionPatterns()
+	if err != nil {
+		return "", err
+	}
+	return ignore.Fingerprint(patterns), nil
+}
+
+// ExclusionPatterns returns every exclusion pattern the engine applies, as fingerprinted
+// by ExclusionFingerprint: the depth limit and size rules count as one pattern each.
+//
+// Returns the patterns, or an error if an ignore file cannot be read.
+func (e *Engine) ExclusionPatterns() ([]string, error) {
+	var patterns []string
+	if e.matcher != nil {
+		sourced, err := ignore.CollectPatterns(e.ignorePatterns, e.rootPath, e.loadIgnoreFile, e.customIgnoreFile, e.ignoreFileName)
+		if err != nil {
+			return nil, err
+		}
+		for _, sp := range sourced {
+			patterns = append(patterns, sp.Pattern)
+		}
+	}
+	for _, p := range e.dockerPatterns {
+		// .dockerignore patterns are anchored, so keep them distinct from the same text elsewhere
+		patterns = append(patterns, ignore.DockerignoreFile+":"+p)
+	}
+	if e.excludeDeeperThan > 0 {
+		// The depth limit excludes paths just like a pattern would
+		patterns = append(patterns, fmt.Sprintf("@maxdepth %d", e.excludeDeeperThan))
+	}
+	for _, rule := range e.excludeSize {
+		patterns = append(patterns, rule.String())
+	}
+	return patterns, nil
+}
+
+// Workers returns the maximum number of files the engine hashes concurrently.
+func (e *Engine) Workers() int {
+	return e.maxWorkers
+}
+
+// SetOneFilesystem restricts hashing to the filesystem holding the root path, like
+// tar's --one-file-system: entries on a different device (mount points such as /proc
+// or network shares) are skipped as if they were excluded.
+//
+// Returns an error if device IDs are not available on this platform.
+func (e *Engine) SetOneFilesystem(oneFilesystem bool) error {
+	if oneFilesystem && !OneFilesystemSupported {
+		return fmt.Errorf("restricting hashing to one filesystem is not supported on this platform")
+	}
+	e.oneFilesystem = oneFilesystem
+	return nil
+}
+
+// SetMetrics makes the engine record hashing statistics (files hashed, bytes read,
+// errors and per-file durations) in the given registry. Nil disables collection.
+func (e *Engine) SetMetrics(registry *metrics.Registry) {
+	e.metrics = registry
+}
+
+// SetFileCallback registers fn to be called with the absolute path and result of every
+// regular file as soon as it is hashed, for streaming progress on large trees. Calls are
+// serialized, but with adaptive scheduling files may complete out of sorted order.
+// Nil removes the callback.
+func (e *Engine) SetFileCallback(fn func(path string, result Result)) {
+	e.onFile = fn
+}
+
+// ContentLeaves reports whether file hashes are plain digests of the file contents with
+// the engine's algorithm, as tools such as sha256sum compute them. Chunking, extended
+// attributes, hardlink groups, structure-only hashing, a byte budget, head-only hashing, BOM
+// stripping or an external hasher make file hashes differ from a plain digest.
+func (e *Engine) ContentLeaves() bool {
+	return e.chunkSize == 0 && !e.includeXattr && !e.includeHardlinks && !e.structureOnly && e.byteBudget <= 0 && e.headBytes <= 0 && !e.stripBOM && e.hasherCmd == ""
+}
+
+// fileDone reports a hashed regular file to the file callback, if one is registered.
+func (e *Engine) fileDone(path string, result Result) {
+	if e.onFile == nil {
+		return
+	}
+	e.onFileMu.Lock()
+	defer e.onFileMu.Unlock()
+	e.onFile(path, result)
+}
+
+// SetResolveRoot controls how a root path that is itself a symlink is hashed. When
+// resolve is true, the symlink is resolved before walking, so the tree it points to is
+// hashed as if it had been given directly. When false (the default), the root is hashed
+// like any other symlink: as a leaf holding its target string, with size 0. Symlinks
+// inside the tree are never followed either way.
+func (e *Engine) SetResolveRoot(resolve bool) {
+	e.resolveRootLink = resolve
+}
+
+// SetResolveRootRealpath controls how files are checked to be inside the root path.
+// When enabled, the root path and each file path are resolved with filepath.EvalSymlinks
+// before comparing them, so a root given through a symlinked path (or files reached
+// through one) are not rejected as outside the allowed directory, and the error names
+// the resolved root. When disabled (the default), the paths are compared as given.
+// Does not change the root hash.
+func (e *Engine) SetResolveRootRealpath(enabled bool) {
+	e.realpathRoot = enabled
+}
+
+// checkContained returns the absolute path of a file to hash, or an error if it is not
+// inside the engine's root path. It always succeeds when no root path is set.
+func (e *Engine) checkContained(path string) (string, error) {
+	absPath, err := filepath.Abs(filepath.Clean(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	if e.rootPath == "" {
+		return absPath, nil
+	}
+	absRoot, err := filepath.Abs(e.rootPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve root path: %w", err)
+	}
+
+	if !e.realpathRoot {
+		// Ensure the path is within the root directory
+		relPath, err := filepath.Rel(absRoot, absPath)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			return "", fmt.Errorf("path outside allowed directory: %q", path)
+		}
+		return absPath, nil
+	}
+
+	e.realRootOnce.Do(func() {
+		e.realRoot = absRoot
+		if resolved, err := filepath.EvalSymlinks(absRoot); err == nil {
+			e.realRoot = resolved
+		}
+	})
+	realPath := absPath
+	if resolved, err := filepath.EvalSymlinks(absPath); err == nil {
+		realPath = resolved
+	}
+	relPath, err := filepath.Rel(e.realRoot, realPath)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return "", fmt.Errorf("path outside allowed directory %q: %q", e.realRoot, path)
+	}
+	return absPath, nil
+}
+
+// resolveRoot returns the path to walk for a root argument. If root resolution is enabled
+// and path is a symlink, it returns the fully resolved target; when the engine's root path
+// is the symlink itself, the root path moves to the target too, so exclusions and the
+// directory traversal check apply to the resolved tree. Otherwise path is returned unchanged.
+func (e *Engine) resolveRoot(path string) (string, error) {
+	if !e.resolveRootLink {
+		return path, nil
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	info, err := os.Lstat(absPath)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		// Missing paths are reported by the caller
+		return path, nil
+	}
+
+	resolved, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve symlinked root %q: %w", path, err)
+	}
+	if e.rootPath == "" || e.rootPath == absPath {
+		e.rootPath = resolved
+	}
+	logger.WithOperation("resolve_root", "path", absPath).Debug("Resolved symlinked root", "target", resolved)
+	return resolved, nil
+}
+
+// SetExcludeEmptyFiles skips zero-byte regular files (placeholders such as .gitkeep)
+// inside directories, as if they were excluded. Directories left empty as a result hash
+// like any other empty directory. Changes the root hash if empty files are present.
+func (e *Engine) SetExcludeEmptyFiles(exclude bool) {
+	e.excludeEmptyFiles = exclude
+}
+
+// SetRecursive controls whether subdirectories are descended into. When recursive is
+// false, every subdirectory of the hashed directory is a leaf node whose hash is derived
+// from its name (see shallowDirResult) and whose size is zero, so the root only covers the top-level
+// listing and the contents of the top-level files. Changes the root hash.
+func (e *Engine) SetRecursive(recursive bool) {
+	e.shallow = !recursive
+}
+
+// SetAdaptiveScheduling enables or disables adaptive scheduling. When enabled, the
+// entries of every directory (subdirectories as well as files) are hashed by concurrent
+// workers drawn from a budget of maxWorkers goroutines shared by the whole tree, so deep
+// and wide trees keep all workers busy. When the budget is exhausted, entries are hashed
+// by the calling worker instead of waiting for one to free up. File I/O remains bounded
+// by the global semaphore, and results are combined in sorted order, so the root hash
+// is identical to sequential traversal.
+func (e *Engine) SetAdaptiveScheduling(enabled bool) {
+	if !enabled {
+		e.spawn = nil
+		return
+	}
+	e.spawn = make(chan struct{}, e.maxWorkers)
+}
+
+// ShareWorkers makes the engine draw from pool's workers instead of its own: the
+// semaphore bounding concurrent file hashing, the open files budget, the buffer pool
+// and, when both engines use adaptive scheduling, the goroutine budget. Several engines
+// hashing different roots at the same time then stay within pool's worker count
+// together, while each keeps its own root, exclusions and settings. Call it after
+// SetAdaptiveScheduling on both engines. Does not change the root hash.
+func (e *Engine) ShareWorkers(pool *Engine) {
+	e.maxWorkers = pool.maxWorkers
+	e.sem = pool.sem
+	e.fds = pool.fds
+	e.bufferPool = pool.bufferPool
+	if e.spawn != nil && pool.spawn != nil {
+		e.spawn = pool.spawn
+	}
+}
+
 // HashPath computes the Merkle root hash and total size of a file or directory.
-// For files, it returns the BLAKE3 hash of the file contents and its size.
+// For files, it returns the hash of the file contents and its size.
 // For directories, it recursively computes hashes of all entries and returns
 // a combined hash representing the entire directory structure along with the total size.
 // Symlinks are treated as leaf nodes; their target path is hashed, not traversed.
@@ -151,6 +690,12 @@ func HashPath(path string) (Result, error) {
 //
 // Returns the hash result and any error encountered during computation.
 func (e *Engine) HashPath(path string) (Result, error) {
+	name := path
+	path, err := e.resolveRoot(path)
+	if err != nil {
+		return Result{}, err
+	}
+
 	// Set root path if not already set
 	if e.rootPath == "" {
 		absPath, err := filepath.Abs(path)
@@ -161,7 +706,143 @@ func (e *Engine) HashPath(path string) (Result, error) {
 	}
 
 	visited := &sync.Map{}
-	return e.hashPath(path, visited)
+	result, err := e.hashPath(path, visited)
+	stats := e.bufferPool.stats()
+	logger.WithOperation("hash", "path", path).Debug("Buffer pool statistics",
+		"buffers_allocated", stats.Allocated,
+		"buffers_reused", stats.Reused,
+	)
+	if err != nil || !e.includeRootName {
+		return result, err
+	}
+	return e.withRootName(name, result)
+}
+
+// HashSubtrees computes the Merkle root of a directory together with the root of each
+// of its immediate subdirectories, keyed by entry name. The returned root is identical
+// to the one produced by HashPath, so callers can cache results per subdirectory and
+// only recompute the ones that changed.
+//
+// Excluded subdirectories and symlinks to directories are not reported as subtrees.
+// If path is not a directory, the subtrees map is empty.
+//
+// Parameters:
+//   - path: The directory path to hash
+//
+// Returns the root hash result, the subtree results, and any error encountered.
+func (e *Engine) HashSubtrees(path string) (Result, map[string]Result, error) {
+	root, children, err := e.hashTopLevel(path)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	subtrees := make(map[string]Result)
+	for _, child := range children {
+		if child.isDir {
+			subtrees[child.name] = child.result
+		}
+	}
+	return root, subtrees, nil
+}
+
+// HashAllDirs computes the Merkle root of path together with the root of every directory
+// in the tree, keyed by its slash-separated path relative to path ("." for path itself).
+// It extends HashSubtrees to all depths, so callers can cache results at every level.
+// The returned root is identical to the one produced by HashPath, and each directory's
+// root is the one it contributes to its parent.
+//
+// Excluded directories, symlinks to directories that are not followed, directories inside
+// assumed subtrees and, without recursion, subdirectories are not reported. If path is not
+// a directory, the map is empty.
+//
+// Parameters:
+//   - path: The directory path to hash
+//
+// Returns the root hash result, the directory results, and any error encountered.
+func (e *Engine) HashAllDirs(path string) (Result, map[string]Result, error) {
+	resolved, err := e.resolveRoot(path)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	absPath, err := filepath.Abs(resolved)
+	if err != nil {
+		return Result{}, nil, fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+
+	dirs := make(map[string]Result)
+	e.onDir = func(dir string, children []childResult) {
+		for _, child := range children {
+			// Without recursion, subdirectories are hashed by name only
+			if !child.isDir || e.shallow {
+				continue
+			}
+			rel, err := filepath.Rel(absPath, filepath.Join(dir, child.name))
+			if err != nil {
+				continue
+			}
+			dirs[filepath.ToSlash(rel)] = child.result
+		}
+	}
+	defer func() { e.onDir = nil }()
+
+	root, err := e.HashPath(path)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return Result{}, nil, fmt.Errorf("failed to stat path %q: %w", absPath, err)
+	}
+	if info.IsDir() {
+		dirs["."] = root
+	}
+	return root, dirs, nil
+}
+
+// hashTopLevel computes the Merkle root of path like HashPath, together with the results
+// of the immediate entries of a directory. The entries are empty if path is not a directory.
+func (e *Engine) hashTopLevel(path string) (Result, []childResult, error) {
+	name := path
+	path, err := e.resolveRoot(path)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return Result{}, nil, fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	if e.rootPath == "" {
+		e.rootPath = absPath
+	}
+
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return Result{}, nil, fmt.Errorf("failed to stat path %q: %w", absPath, err)
+	}
+	if !info.IsDir() || e.isExcluded(absPath, true) {
+		root, err := e.HashPath(name)
+		if err != nil {
+			return Result{}, nil, err
+		}
+		return root, nil, nil
+	}
+
+	visited := &sync.Map{}
+	visited.Store(absPath, true)
+	children, err := e.hashDirEntries(absPath, visited)
+	if err != nil {
+		return Result{}, nil, err
+	}
+
+	root, err := combineResults(e.algorithm, children)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	if e.includeRootName {
+		if root, err = e.withRootName(name, root); err != nil {
+			return Result{}, nil, err
+		}
+	}
+	return root, children, nil
 }
 
 // hashPath is the internal implementation that tracks visited paths
@@ -180,10 +861,11 @@ func (e *Engine) hashPath(path string, visited *sync.Map) (Result, error) {
 	if err != nil {
 		return Result{}, fmt.Errorf("failed to resolve absolute path for %q: %w", path, err)
 	}
+	log := logger.WithOperation("hash_path", "path", absPath)
 
 	// Check for circular symlinks (thread-safe check)
 	if _, exists := visited.Load(absPath); exists {
-		logger.Error("Circular symlink detected", "path", absPath)
+		log.Error("Circular symlink detected")
 		return Result{}, fmt.Errorf("circular symlink detected at %q", absPath)
 	}
 	visited.Store(absPath, true)
@@ -191,59 +873,79 @@ func (e *Engine) hashPath(path string, visited *sync.Map) (Result, error) {
 
 	info, err := os.Lstat(absPath)
 	if err != nil {
-		logger.Error("Failed to stat path", "path", absPath, "error", err)
+		log.Error("Failed to stat path", "error", err)
 		return Result{}, fmt.Errorf("failed to stat path %q: %w", absPath, err)
 	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		if err := e.checkSymlink(absPath); err != nil {
+			return Result{}, err
+		}
+		if target, ok := e.followLink(absPath); ok {
+			leave, err := e.enterLink(absPath, visited)
+			if err != nil {
+				log.Error("Circular symlink detected")
+				return Result{}, err
+			}
+			defer leave()
+			info = target
+		}
+	}
 
 	// Check if path should be excluded
-	if e.matcher != nil {
-		// Compute relative path from root for matching
-		relPath, err := filepath.Rel(e.rootPath, absPath)
+	if e.isExcluded(absPath, info.IsDir()) {
+		log.Debug("Excluding path")
+		// Entries inside a directory are filtered before they get here, so this is an
+		// excluded root: nothing of it is hashed, exactly like a directory without entries.
+		// It must not yield a leaf such as the hash of no input, which is an empty file.
+		return emptyDirResult(e.algorithm), nil
+	}
+
+	// Use a precomputed hash instead of hashing the entry, if one was assumed
+	if info.Mode()&os.ModeSymlink == 0 {
+		result, ok, err := e.assumedResult(absPath, info)
 		if err != nil {
-			// If we can't compute relative path, use the basename
-			relPath = filepath.Base(absPath)
+			return Result{}, err
 		}
-		// Also check with absolute path and basename for flexibility
-		if e.matcher.Match(relPath, info.IsDir()) ||
-			e.matcher.Match(absPath, info.IsDir()) ||
-			e.matcher.Match(filepath.Base(absPath), info.IsDir()) {
-			logger.Debug("Excluding path", "path", absPath, "relative", relPath)
-			// Return empty hash and zero size for excluded paths
-			// This ensures excluded directories don't affect the hash
-			h := blake3.New()
-			return Result{Hash: h.Sum(nil), Size: 0}, nil
+		if ok {
+			log.Debug("Using assumed hash", "hash", fmt.Sprintf("%x", result.Hash))
+			return result, nil
 		}
 	}
 
 	// Treat symlinks as leaf nodes - hash their target path, don't traverse
 	if info.Mode()&os.ModeSymlink != 0 {
-		target, err := os.Readlink(absPath)
+		target, err := e.symlinkTarget(absPath)
 		if err != nil {
-			logger.Error("Failed to read symlink", "path", absPath, "error", err)
-			return Result{}, fmt.Errorf("failed to read symlink %q: %w", absPath, err)
+			log.Error("Failed to read symlink", "error", err)
+			return Result{}, err
 		}
 		// Hash the target path as a string (deterministic representation)
-		h := blake3.New()
-		if _, err := h.WriteString(target); err != nil {
-			logger.Error("Failed to write to hash", "error", err)
+		h := e.newHash()
+		if _, err := io.WriteString(h, target); err != nil {
+			log.Error("Failed to write to hash", "error", err)
 			return Result{}, fmt.Errorf("failed to hash symlink target: %w", err)
 		}
-		logger.Debug("Hashed symlink as leaf node", "symlink", absPath, "target", target)
+		log.Debug("Hashed symlink as leaf node", "target", target)
 		// Symlinks have zero size
 		return Result{Hash: h.Sum(nil), Size: 0}, nil
 	}
 
 	// After handling symlinks, check if it's a directory
 	if info.IsDir() {
-		logger.Debug("Processing directory", "path", absPath)
+		log.Debug("Processing directory")
 		return e.hashDir(absPath, visited)
 	}
 
-	logger.Debug("Processing file", "path", absPath, "size", info.Size())
-	return e.hashFile(absPath, info.Size())
+	log.Debug("Processing file", "size", info.Size())
+	result, err := e.hashFile(absPath, info.Size())
+	if err != nil {
+		return Result{}, err
+	}
+	e.fileDone(absPath, result)
+	return result, nil
 }
 
-// hashFile computes the BLAKE3 hash of a file's contents using a pooled buffer.
+// hashFile computes the hash of a file's contents with the engine's algorithm using a pooled buffer.
 // It validates the path is within the root directory to prevent directory traversal,
 // acquires a semaphore slot to limit concurrent I/O, and uses a buffer pool for efficiency.
 // It returns both the hash and the file size.
@@ -254,24 +956,39 @@ func (e *Engine) hashPath(path string, visited *sync.Map) (Result, error) {
 //
 // Returns the hash result and any error encountered during file reading or hashing.
 func (e *Engine) hashFile(path string, size int64) (Result, error) {
+	if e.structureOnly {
+		return Result{Hash: e.structureLeaf(structureFile, filepath.Base(path), nil), Size: size}, nil
+	}
+	readSize := size
+	if e.headOnly(size) {
+		readSize = e.headBytes
+	}
+	if !e.takeBudget(readSize) {
+		logger.WithOperation("hash_file", "path", path).Debug("Byte budget used up, hashing metadata only", "size", size)
+		return e.metadataResult(path, size), nil
+	}
+	result, _, err := e.hashFileChunks(path, size)
+	return result, err
+}
+
+// hashFileChunks hashes a file like hashFile and also returns its chunk results when
+// chunked hashing applies (nil otherwise).
+func (e *Engine) hashFileChunks(path string, size int64) (result Result, chunks []Result, err error) {
 	start := time.Now()
-	log := logger.With("path", path, "operation", "hash_file")
+	defer func() {
+		if err != nil {
+			e.metrics.IncErrors()
+			return
+		}
+		e.metrics.ObserveFile(time.Since(start))
+	}()
+	log := logger.WithOperation("hash_file", "path", path)
 
 	// Validate path is within rootPath to prevent directory traversal
 	if e.rootPath != "" {
-		cleanPath := filepath.Clean(path)
-		absPath, err := filepath.Abs(cleanPath)
+		absPath, err := e.checkContained(path)
 		if err != nil {
-			return Result{}, fmt.Errorf("failed to resolve absolute path: %w", err)
-		}
-		absRoot, err := filepath.Abs(e.rootPath)
-		if err != nil {
-			return Result{}, fmt.Errorf("failed to resolve root path: %w", err)
-		}
-		// Ensure the path is within the root directory
-		relPath, err := filepath.Rel(absRoot, absPath)
-		if err != nil || strings.HasPrefix(relPath, "..") {
-			return Result{}, fmt.Errorf("path outside allowed directory: %q", path)
+			return Result{}, nil, err
 		}
 		path = absPath
 	}
@@ -280,43 +997,78 @@ func (e *Engine) hashFile(path string, size int64) (Result, error) {
 	e.sem <- struct{}{}
 	defer func() { <-e.sem }()
 
+	e.acquireFD()
+	defer e.releaseFD()
 	f, err := os.Open(path)
 	if err != nil {
 		log.Error("Failed to open file", "error", err)
-		return Result{}, fmt.Errorf("failed to open file %q: %w", path, err)
+		return Result{}, nil, fmt.Errorf("failed to open file %q: %w", path, err)
 	}
-	defer func() {
-		if err := f.Close(); err != nil {
-			log.Warn("Failed to close file", "error", err)
-		}
-	}()
+	defer e.closeFile(f, "hash_file", path)
 
 	// Get buffer from pool
-	bufPtr, ok := e.bufferPool.Get().(*[]byte)
+	bufPtr, ok := e.bufferPool.get()
 	if !ok {
-		return Result{}, fmt.Errorf("failed to get buffer from pool")
+		return Result{}, nil, fmt.Errorf("failed to get buffer from pool")
 	}
-	defer e.bufferPool.Put(bufPtr)
+	defer e.bufferPool.put(bufPtr)
 	buf := *bufPtr
+	if e.limiter != nil && int64(len(buf)) > int64(e.limiter.rate) {
+		// Read in chunks no larger than one second's worth to keep throttling smooth
+		buf = buf[:int(e.limiter.rate)]
+	}
 
-	h := blake3.New()
-	bytesRead := int64(0)
-
-	for {
-		n, err := f.Read(buf)
-		if n > 0 {
-			if _, writeErr := h.Write(buf[:n]); writeErr != nil {
-				log.Error("Failed to write to hash", "error", writeErr)
-				return Result{}, fmt.Errorf("failed to hash file content: %w", writeErr)
-			}
-			bytesRead += int64(n)
-		}
-		if err == io.EOF {
-			break
+	ch := newChunkHasher(e.newHash, e.chunkSize, size)
+	var w io.Writer = ch
+	var ext *externalHasher
+	if e.hasherCmd != "" {
+		ext, err = startExternalHasher(e.hasherCmd)
+		if err != nil {
+			log.Error("Failed to start external hasher", "error", err)
+			return Result{}, nil, err
 		}
+		defer ext.abort()
+		w = ext
+	}
+	// Holes of sparse files are produced as zeros instead of being read
+	reader, bytesRead, err := e.bomReader(e.headReader(newFileReader(f, size), size))
+	if err != nil {
+		log.Error("Failed to read file", "error", err)
+		return Result{}, nil, fmt.Errorf("failed to read file %q: %w", path, err)
+	}
+
+	copied, err := e.readContents(w, reader, buf, fmt.Sprintf("file %q", path))
+	bytesRead += copied
+	if err != nil {
+		log.Error("Failed to read file", "error", err, "bytes_read", bytesRead)
+		return Result{}, nil, err
+	}
+	if e.headOnly(size) {
+		// Only the head was read; a size change is still detected
+		e.checkUnchanged(f, path, size, size)
+	} else {
+		e.checkUnchanged(f, path, size, bytesRead)
+	}
+
+	if ext != nil {
+		digest, err := ext.sum()
 		if err != nil {
-			log.Error("Failed to read file", "error", err, "bytes_read", bytesRead)
-			return Result{}, fmt.Errorf("failed to read file %q: %w", path, err)
+			log.Error("External hasher failed", "error", err)
+			return Result{}, nil, err
+		}
+		log.Debug("File hashed by external hasher", "size", size, "duration", time.Since(start))
+		return Result{Hash: digest, Size: size}, nil, nil
+	}
+
+	h, err := ch.final()
+	if err != nil {
+		return Result{}, nil, err
+	}
+	e.writeHeadSize(h, size)
+	if e.includeXattr {
+		if err := hashXattrs(h, path); err != nil {
+			log.Error("Failed to hash extended attributes", "error", err)
+			return Result{}, nil, err
 		}
 	}
 
@@ -324,17 +1076,61 @@ func (e *Engine) hashFile(path string, size int64) (Result, error) {
 	log.Debug("File hashed successfully",
 		"size", size,
 		"bytes_read", bytesRead,
+		"chunks", len(ch.chunks),
 		"duration", duration,
 	)
 
-	return Result{Hash: h.Sum(nil), Size: size}, nil
+	return Result{Hash: h.Sum(nil), Size: size}, ch.chunks, nil
 }
 
 // hashDir computes the Merkle root hash of a directory by hashing all entries
 // in sorted order and combining their hashes. It also accumulates the total size.
-// Entries are processed sequentially to maintain deterministic ordering.
+// Entries are processed sequentially unless adaptive scheduling is enabled; either way
+// they are combined in sorted order to keep the hash deterministic.
 // File hashing is bounded by a global semaphore to limit concurrent I/O.
 //
+// Parameters:
+//   - path: The absolute path to the directory to hash
+//   - visited: A thread-safe map tracking visited paths to detect circular symlinks
+//
+// Returns the hash result and any error encountered during directory processing.
+func (e *Engine) hashDir(path string, visited *sync.Map) (Result, error) {
+	start := time.Now()
+	log := logger.WithOperation("hash_dir", "path", path)
+
+	if e.streamsCombine() {
+		return e.hashDirStreaming(path, visited)
+	}
+
+	children, err := e.hashDirEntries(path, visited)
+	if err != nil {
+		return Result{}, err
+	}
+	if e.onDir != nil {
+		e.onDirMu.Lock()
+		e.onDir(path, children)
+		e.onDirMu.Unlock()
+	}
+
+	result, err := combineResults(e.algorithm, children)
+	if err != nil {
+		log.Error("Failed to write to hash", "error", err)
+		return Result{}, err
+	}
+
+	duration := time.Since(start)
+	log.Debug("Directory hashed successfully",
+		"processed", len(children),
+		"duration", duration,
+		"total_size", result.Size,
+	)
+
+	return result, nil
+}
+
+// hashDirEntries hashes every entry of a directory and returns the per-entry results
+// in the order they contribute to the directory hash.
+//
 // The function filters out special files (pipes, sockets, devices) and applies
 // exclusion patterns before processing. Directory entries are sorted alphabetically
 // to ensure deterministic hash computation.
@@ -343,129 +1139,420 @@ func (e *Engine) hashFile(path string, size int64) (Result, error) {
 //   - path: The absolute path to the directory to hash
 //   - visited: A thread-safe map tracking visited paths to detect circular symlinks
 //
-// Returns the hash result and any error encountered during directory processing.
-func (e *Engine) hashDir(path string, visited *sync.Map) (Result, error) {
-	start := time.Now()
-	log := logger.With("path", path, "operation", "hash_dir")
+// Returns the results of all included entries and any error encountered.
+func (e *Engine) hashDirEntries(path string, visited *sync.Map) ([]childResult, error) {
+	workItems, err := e.dirWorkItems(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// A byte budget must be spent in sorted order, so it disables adaptive scheduling
+	if e.spawn != nil && e.byteBudget <= 0 {
+		return e.hashEntriesAdaptive(path, workItems, visited)
+	}
+
+	// Sequentially process work items (no concurrency)
+	results := make([]childResult, 0, len(workItems))
+	for _, item := range workItems {
+		child, keep, err := e.hashEntry(path, item.entry, item.entryPath, visited)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			results = append(results, child)
+		}
+	}
+
+	return results, nil
+}
+
+// dirWorkItems lists the entries of a directory that take part in its hash, in sorted
+// order: special files, excluded entries and entries on other filesystems are left out,
+// and case collisions are checked.
+//
+// Parameters:
+//   - path: The absolute path to the directory
+//
+// Returns the work items and any error encountered while listing the directory.
+func (e *Engine) dirWorkItems(path string) ([]dirWorkItem, error) {
+	log := logger.WithOperation("hash_dir", "path", path)
 
-	entries, err := os.ReadDir(path)
+	entries, err := e.readDirEntries(path)
 	if err != nil {
 		log.Error("Failed to read directory", "error", err)
-		return Result{}, fmt.Errorf("failed to read directory %q: %w", path, err)
+		return nil, err
 	}
 
-	// Sort entries by name for deterministic hashing
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Name() < entries[j].Name()
-	})
-
 	log.Debug("Processing directory entries", "entry_count", len(entries))
 
 	// Filter out special files and prepare work items
-	type workItem struct {
-		entry     os.DirEntry
-		entryPath string
-	}
-
-	var workItems []workItem
+	var workItems []dirWorkItem
 	for _, entry := range entries {
 		// Skip special files (pipes, sockets, devices) as they cannot be hashed
 		if entry.Type()&(os.ModeNamedPipe|os.ModeSocket|os.ModeDevice) != 0 {
 			log.Debug("Skipping special file", "entry", entry.Name(), "type", entry.Type())
+			e.diagnostics.add(DiagnosticSpecialFile, filepath.Join(path, entry.Name()), entry.Type().String())
 			continue
 		}
 
 		childPath := filepath.Join(path, entry.Name())
 
 		// Check if entry should be excluded
-		if e.matcher != nil {
-			relPath, err := filepath.Rel(e.rootPath, childPath)
-			if err != nil {
-				relPath = entry.Name()
-			}
-			isDir := entry.IsDir()
-			if e.matcher.Match(relPath, isDir) ||
-				e.matcher.Match(childPath, isDir) ||
-				e.matcher.Match(entry.Name(), isDir) {
-				log.Debug("Excluding entry", "entry", entry.Name(), "path", childPath)
-				continue
-			}
+		if e.isExcluded(childPath, entry.IsDir()) {
+			log.Debug("Excluding entry", "entry", entry.Name(), "path", childPath)
+			continue
+		}
+		if e.onOtherDevice(entry) {
+			log.Debug("Skipping entry on another filesystem", "entry", entry.Name(), "path", childPath)
+			continue
 		}
 
-		workItems = append(workItems, workItem{
+		workItems = append(workItems, dirWorkItem{
 			entry:     entry,
 			entryPath: childPath,
 		})
 	}
 
-	if len(workItems) == 0 {
-		// Empty directory
-		h := blake3.New()
-		return Result{Hash: h.Sum(nil), Size: 0}, nil
+	if err := e.checkCaseCollisions(path, workItems); err != nil {
+		log.Error("Case-colliding entries", "error", err)
+		return nil, err
 	}
+	return workItems, nil
+}
 
-	// Sequentially process work items (no concurrency)
-	results := make([]Result, len(workItems))
+// hashEntriesAdaptive hashes the entries of a directory concurrently. Each entry is
+// handed to a new goroutine if the engine's spawn budget has a free slot, and hashed
+// by the calling goroutine otherwise, so traversal never blocks waiting for a worker.
+// Results are stored by entry index, keeping the sorted order regardless of which
+// entry finishes first.
+//
+// Returns the results of all included entries, or the error of the first failing entry
+// in sorted order.
+func (e *Engine) hashEntriesAdaptive(path string, workItems []dirWorkItem, visited *sync.Map) ([]childResult, error) {
+	children := make([]childResult, len(workItems))
+	keep := make([]bool, len(workItems))
+	errs := make([]error, len(workItems))
 
+	var wg sync.WaitGroup
 	for i, item := range workItems {
-		entry := item.entry
-		childPath := item.entryPath
+		select {
+		case e.spawn <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-e.spawn }()
+				children[i], keep[i], errs[i] = e.hashEntry(path, item.entry, item.entryPath, visited)
+			}()
+		default:
+			children[i], keep[i], errs[i] = e.hashEntry(path, item.entry, item.entryPath, visited)
+		}
+	}
+	wg.Wait()
 
-		entryType := entry.Type()
+	results := make([]childResult, 0, len(workItems))
+	for i := range workItems {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if keep[i] {
+			results = append(results, children[i])
+		}
+	}
+	return results, nil
+}
 
-		if entryType&os.ModeSymlink != 0 {
-			target, err := os.Readlink(childPath)
-			if err != nil {
-				return Result{}, fmt.Errorf("failed to read symlink %q: %w", childPath, err)
-			}
-			h := blake3.New()
-			if _, err := h.WriteString(target); err != nil {
-				return Result{}, fmt.Errorf("failed to hash symlink target: %w", err)
-			}
-			results[i] = Result{Hash: h.Sum(nil), Size: 0}
-			continue
+// hashEntry hashes a single directory entry: symlinks by their target, subdirectories
+// recursively and regular files by their contents.
+//
+// Parameters:
+//   - dir: The absolute path of the directory containing the entry
+//   - entry: The directory entry to hash
+//   - childPath: The absolute path of the entry
+//   - visited: A thread-safe map tracking visited paths to detect circular symlinks
+//
+// Returns the entry result, whether the entry contributes to the directory hash
+// (false if it is filtered out by the content class or vanished), and any error
+// encountered.
+func (e *Engine) hashEntry(dir string, entry os.DirEntry, childPath string, visited *sync.Map) (child childResult, keep bool, err error) {
+	defer func() {
+		if err != nil && e.vanished(childPath, err) {
+			keep, err = false, nil
 		}
+	}()
+	child = childResult{name: entry.Name(), isDir: entry.IsDir(), isLink: entry.Type()&os.ModeSymlink != 0}
+	if child.isLink {
+		if err := e.checkSymlink(childPath); err != nil {
+			return child, false, err
+		}
+		// A followed link is hashed as what it points to, under its own name
+		if info, ok := e.followLink(childPath); ok {
+			entry = fs.FileInfoToDirEntry(info)
+			child.isDir, child.isLink = info.IsDir(), false
+		}
+	}
 
-		if entry.IsDir() {
-			result, err := e.hashPath(childPath, visited)
-			if err != nil {
-				return Result{}, fmt.Errorf("failed to hash entry %q in directory %q: %w", entry.Name(), path, err)
-			}
-			results[i] = result
-			continue
+	if entry.Type()&os.ModeSymlink != 0 {
+		target, err := e.symlinkTarget(childPath)
+		if err != nil {
+			return child, false, err
 		}
+		if e.structureOnly {
+			child.result = Result{Hash: e.structureLeaf(structureSymlink, entry.Name(), []byte(target)), Size: 0}
+			return child, true, nil
+		}
+		h := e.newHash()
+		if _, err := io.WriteString(h, target); err != nil {
+			return child, false, fmt.Errorf("failed to hash symlink target: %w", err)
+		}
+		child.result = Result{Hash: h.Sum(nil), Size: 0}
+		return child, true, nil
+	}
 
-		info, err := entry.Info()
+	if entry.IsDir() && e.shallow {
+		child.result = e.shallowDirResult(entry.Name())
+		return child, true, nil
+	}
+
+	if entry.IsDir() && e.isMarkerDir(entry.Name()) {
+		child.result = e.markerDirResult(entry.Name())
+		if e.structureOnly {
+			child.result.Hash = e.structureLeaf(structureDir, entry.Name(), child.result.Hash)
+		}
+		return child, true, nil
+	}
+
+	if entry.IsDir() {
+		result, err := e.hashPath(childPath, visited)
 		if err != nil {
-			return Result{}, fmt.Errorf("failed to get info for entry %q in directory %q: %w", entry.Name(), path, err)
+			return child, false, fmt.Errorf("failed to hash entry %q in directory %q: %w", entry.Name(), dir, err)
+		}
+		if e.structureOnly {
+			// Directory names are part of the structure, unlike in content hashing
+			result.Hash = e.structureLeaf(structureDir, entry.Name(), result.Hash)
 		}
+		child.result = result
+		return child, true, nil
+	}
 
-		result, err := e.hashFile(childPath, info.Size())
+	if e.contentClass != ContentAll {
+		binary, err := e.isBinary(childPath)
 		if err != nil {
-			return Result{}, err
+			return child, false, err
 		}
+		if binary != (e.contentClass == ContentBinaryOnly) {
+			logger.WithOperation("hash_dir", "path", dir).Debug("Skipping file by content class", "entry", entry.Name(), "binary", binary)
+			return child, false, nil
+		}
+	}
+
+	info, err := entry.Info()
+	if err != nil {
+		return child, false, fmt.Errorf("failed to get info for entry %q in directory %q: %w", entry.Name(), dir, err)
+	}
+	if e.excludeEmptyFiles && info.Size() == 0 {
+		logger.WithOperation("hash_dir", "path", dir).Debug("Skipping empty file", "entry", entry.Name())
+		return child, false, nil
+	}
+	if e.isExcludedBySize(info.Size()) {
+		logger.WithOperation("hash_dir", "path", dir).Debug("Skipping file by size", "entry", entry.Name(), "size", info.Size())
+		return child, false, nil
+	}
 
-		results[i] = result
+	assumed, ok, err := e.assumedResult(childPath, info)
+	if err != nil {
+		return child, false, err
+	}
+	if ok {
+		child.result = assumed
+		e.fileDone(childPath, assumed)
+		return child, true, nil
 	}
 
-	// Combine all hashes and accumulate sizes
-	h := blake3.New()
-	var totalSize int64
-	for _, result := range results {
-		if _, err := h.Write(result.Hash); err != nil {
-			log.Error("Failed to write to hash", "error", err)
-			return Result{}, fmt.Errorf("failed to combine hashes: %w", err)
+	result, err := e.hashFile(childPath, info.Size())
+	if err != nil {
+		return child, false, err
+	}
+	if result, err = e.withHardlink(info, result); err != nil {
+		return child, false, err
+	}
+	child.result = result
+	e.fileDone(childPath, result)
+	return child, true, nil
+}
+
+// onOtherDevice reports whether a directory entry lives on a different device than the
+// root path. It always returns false unless one-filesystem mode is enabled.
+//
+// Parameters:
+//   - entry: The directory entry to check
+//
+// Returns true if the entry should be skipped because it crosses a filesystem boundary.
+func (e *Engine) onOtherDevice(entry os.DirEntry) bool {
+	if !e.oneFilesystem {
+		return false
+	}
+	e.rootDevOnce.Do(func() {
+		if info, err := os.Lstat(e.rootPath); err == nil {
+			e.rootDev, e.rootDevOK = deviceID(info)
 		}
-		totalSize += result.Size
+	})
+	if !e.rootDevOK {
+		return false
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return false
 	}
+	dev, ok := deviceID(info)
+	return ok && dev != e.rootDev
+}
 
-	duration := time.Since(start)
-	log.Debug("Directory hashed successfully",
-		"entry_count", len(entries),
-		"processed", len(workItems),
-		"duration", duration,
-		"total_size", totalSize,
-	)
+// nameLess reports whether the entry named a sorts before the entry named b within a
+// directory. Names are compared bytewise, after NFC normalization if enabled. The order
+// never depends on the locale (LC_COLLATE, LC_ALL, LANG): hashes must be reproducible on
+// any machine, so every ordering in the engine goes through this comparison or another
+// bytewise one.
+func (e *Engine) nameLess(a, b string) bool {
+	if e.normalizeUnicode {
+		na, nb := norm.NFC.String(a), norm.NFC.String(b)
+		if na != nb {
+			return na < nb
+		}
+	}
+	return a < b
+}
+
+// isBinary classifies a file by reading its first SniffSize bytes into a pooled buffer.
+// A file is considered binary if those bytes contain a NUL byte.
+//
+// Parameters:
+//   - path: The absolute path to the file to classify
+//
+// Returns true if the file is binary, and any error encountered while reading it.
+func (e *Engine) isBinary(path string) (bool, error) {
+	// Acquire global semaphore to limit concurrent file access
+	e.sem <- struct{}{}
+	defer func() { <-e.sem }()
 
+	e.acquireFD()
+	defer e.releaseFD()
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file %q: %w", path, err)
+	}
+	defer e.closeFile(f, "sniff", path)
+
+	bufPtr, ok := e.bufferPool.get()
+	if !ok {
+		return false, fmt.Errorf("failed to get buffer from pool")
+	}
+	defer e.bufferPool.put(bufPtr)
+	buf := (*bufPtr)[:SniffSize]
+
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, fmt.Errorf("failed to read file %q: %w", path, err)
+	}
+	return bytes.IndexByte(buf[:n], 0) >= 0, nil
+}
+
+// emptyDirTag is the input hashed for a directory without entries. Hashing no input
+// instead would give an empty directory the hash of an empty file.
+const emptyDirTag = "mtc:empty-dir"
+
+// emptyDirResult returns the Merkle node of a directory without entries.
+func emptyDirResult(algorithm Algorithm) Result {
+	return Result{Hash: hashBytes(algorithm, []byte(emptyDirTag)), Size: 0}
+}
+
+// shallowDirTag prefixes the input hashed for a subdirectory that is not descended into
+// (SetRecursive), keeping its leaf apart from a file holding its name.
+const shallowDirTag = "mtc:shallow-dir:"
+
+// shallowDirResult returns the leaf of the subdirectory named name when hashing is not
+// recursive.
+func (e *Engine) shallowDirResult(name string) Result {
+	return Result{Hash: hashBytes(e.algorithm, []byte(shallowDirTag+name)), Size: 0}
+}
+
+// combineResults combines the results of a directory's entries into the directory's
+// Merkle node: the hash of each child's type byte and hash concatenated in order, and the
+// sum of their sizes. An empty directory hashes to emptyDirResult, so it never matches an
+// empty file.
+//
+// Parameters:
+//   - algorithm: The node hash algorithm
+//   - children: The entry results in sorted order
+//
+// Returns the combined result and any error encountered while hashing.
+func combineResults(algorithm Algorithm, children []childResult) (Result, error) {
+	if len(children) == 0 {
+		return emptyDirResult(algorithm), nil
+	}
+	h := algorithm.New()
+	var totalSize int64
+	for _, child := range children {
+		if err := writeEntry(h, child.nodeType(), child.result.Hash); err != nil {
+			return Result{}, err
+		}
+		totalSize += child.result.Size
+	}
 	return Result{Hash: h.Sum(nil), Size: totalSize}, nil
 }
+
+// CombineResults combines independent roots into a single root exactly like a directory
+// combines its entries, each root taken as a subdirectory: the BLAKE3 hash of the
+// concatenated entries, and the sum of the sizes.
+// By default the combination is order-sensitive; with unordered set, the results are first
+// sorted by hash, so any permutation of the same roots produces the same combined root.
+//
+// Parameters:
+//   - results: The roots to combine
+//   - unordered: Whether to sort the roots by hash before combining them
+//
+// Returns the combined result and any error encountered while hashing.
+func CombineResults(results []Result, unordered bool) (Result, error) {
+	return AlgorithmBLAKE3.CombineResults(results, unordered)
+}
+
+// NamedResult is the result of a directory entry hashed on its own, e.g. by another worker
+// of a distributed run, together with the entry's name.
+type NamedResult struct {
+	// Name is the entry's base name within its directory.
+	Name string
+	// Result is the entry's result, as returned by HashPath for it.
+	Result Result
+	// Type is the entry's node type: NodeFile, NodeDir or NodeSymlink.
+	Type NodeType
+}
+
+// CombineNamed combines the results of a directory's entries into the directory's result
+// exactly like hashing the directory does, with BLAKE3: entries are ordered by name,
+// bytewise, whatever their order in named. A coordinator can thus combine subtrees hashed
+// separately into the root a single run over the whole tree would give. Engines ordering
+// names by their Unicode normal form (SetNormalizeUnicode) may order them differently.
+// It is not named CombineResults, which already combines unnamed roots for "mtc combine",
+// and it returns an error as well, since names and types are checked.
+//
+// Parameters:
+//   - named: The entries of the directory, each listed once
+//
+// Returns the directory result, or an error if a name is empty or listed twice, or a type
+// is invalid.
+func CombineNamed(named []NamedResult) (Result, error) {
+	return AlgorithmBLAKE3.CombineNamed(named)
+}
+
+// isExcluded reports whether the given absolute path matches the engine's exclusion patterns,
+// or lies deeper below the root than the depth limit.
+// The path is checked relative to the root, as an absolute path, and by its basename.
+//
+// Parameters:
+//   - absPath: The absolute path to check
+//   - isDir: Whether the path is a directory
+//
+// Returns true if the path should be excluded from hashing.
+func (e *Engine) isExcluded(absPath string, isDir bool) bool {
+	excluded, _, _ := e.explainExcluded(absPath, isDir)
+	return excluded
+}
@@ -1,12 +1,29 @@
 package merkle
 
 import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"maps"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"testing/iotest"
+	"time"
 
+	"github.com/lucho00cuba/mtc/internal/ignore"
 	"github.com/lucho00cuba/mtc/internal/logger"
+	"github.com/zeebo/blake3"
 )
 
 func init() {
@@ -402,6 +419,98 @@ func TestCompare_Different(t *testing.T) {
 	}
 }
 
+func TestFirstDifference(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		return p
+	}
+	base := write("base", "abcdef")
+
+	tests := []struct {
+		name  string
+		other string
+		want  int64
+	}{
+		{name: "identical", other: write("same", "abcdef"), want: -1},
+		{name: "differs in the middle", other: write("middle", "abcXef"), want: 3},
+		{name: "shorter", other: write("short", "abc"), want: 3},
+		{name: "longer", other: write("long", "abcdefgh"), want: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FirstDifference(base, tt.other)
+			if err != nil {
+				t.Fatalf("FirstDifference() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FirstDifference() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareTopLevel(t *testing.T) {
+	tmpDir := t.TempDir()
+	dirA := filepath.Join(tmpDir, "a")
+	dirB := filepath.Join(tmpDir, "b")
+	for _, dir := range []string{dirA, dirB} {
+		for _, name := range []string{"file0.txt", "d0/file0.txt", "d1/file0.txt", "d1/d2/file0.txt", "d2/file0.txt"} {
+			p := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+		}
+	}
+	// One changed subdirectory, one file only in a, one directory only in b, and a file
+	// replaced by a directory
+	if err := os.WriteFile(filepath.Join(dirB, "d1", "d2", "file0.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dirA, "extra.txt"), []byte("extra"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(dirB, "new"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dirB, "file0.txt")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(dirB, "file0.txt"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	rootA, rootB, diff, err := CompareTopLevel(dirA, dirB, NewEngine(), NewEngine())
+	if err != nil {
+		t.Fatalf("CompareTopLevel() error = %v", err)
+	}
+	wantA, err := NewEngine().HashPath(dirA)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !equal(rootA.Hash, wantA.Hash) || equal(rootA.Hash, rootB.Hash) {
+		t.Errorf("CompareTopLevel() roots = %x, %x; want %x for a and a mismatch", rootA.Hash, rootB.Hash, wantA.Hash)
+	}
+	want := []string{"modified: d1/", "added: extra.txt", "modified: file0.txt", "deleted: new/"}
+	if len(diff) != len(want)+1 || strings.Join(diff[1:], "\n") != strings.Join(want, "\n") {
+		t.Errorf("CompareTopLevel() = %q, want the root mismatch followed by %q", diff, want)
+	}
+
+	_, _, diff, err = CompareTopLevel(dirA, dirA, NewEngine(), NewEngine())
+	if err != nil {
+		t.Fatalf("CompareTopLevel() error = %v", err)
+	}
+	if len(diff) != 1 || diff[0] != noDifferencesMsg {
+		t.Errorf("CompareTopLevel() of identical trees = %q, want [%q]", diff, noDifferencesMsg)
+	}
+}
+
 func TestCompareWithExclusions(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -527,6 +636,76 @@ func TestHashPath_ExcludedDirectory(t *testing.T) {
 	}
 }
 
+func TestHashPath_ExcludedEntriesAreAbsent(t *testing.T) {
+	withDir := t.TempDir()
+	withoutDir := t.TempDir()
+	for _, root := range []string{withDir, withoutDir} {
+		if err := os.WriteFile(filepath.Join(root, "keep.txt"), []byte("keep"), 0644); err != nil {
+			t.Fatalf("Failed to create keep.txt: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(withDir, "skip", "nested"), 0755); err != nil {
+		t.Fatalf("Failed to create skip dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(withDir, "skip", "nested", "file.txt"), []byte("excluded"), 0644); err != nil {
+		t.Fatalf("Failed to create excluded file: %v", err)
+	}
+
+	modes := []struct {
+		name  string
+		apply func(e *Engine)
+	}{
+		{"default", func(e *Engine) {}},
+		{"low memory", func(e *Engine) { e.SetLowMemory(true) }},
+		{"adaptive", func(e *Engine) { e.SetAdaptiveScheduling(true) }},
+	}
+	for _, mode := range modes {
+		t.Run(mode.name, func(t *testing.T) {
+			hash := func(root string, patterns []string) Result {
+				t.Helper()
+				engine, err := NewEngineWithExclusions(0, patterns, root, false, "")
+				if err != nil {
+					t.Fatalf("NewEngineWithExclusions() error = %v", err)
+				}
+				mode.apply(engine)
+				result, err := engine.HashPath(root)
+				if err != nil {
+					t.Fatalf("Engine.HashPath() error = %v", err)
+				}
+				return result
+			}
+
+			got := hash(withDir, []string{"skip"})
+			want := hash(withoutDir, nil)
+			if !equal(got.Hash, want.Hash) || got.Size != want.Size {
+				t.Errorf("excluding a subdirectory = %x (%d bytes), want the root without it %x (%d bytes)", got.Hash, got.Size, want.Hash, want.Size)
+			}
+
+			// An excluded root has no entries at all, so it must not hash like an empty file
+			root := hash(filepath.Join(withDir, "skip"), []string{"skip"})
+			if empty := emptyDirResult(AlgorithmBLAKE3); !equal(root.Hash, empty.Hash) || root.Size != 0 {
+				t.Errorf("excluded root = %x (%d bytes), want the empty directory node %x", root.Hash, root.Size, empty.Hash)
+			}
+		})
+	}
+
+	engine, err := NewEngineWithExclusions(0, []string{"skip"}, withDir, false, "")
+	if err != nil {
+		t.Fatalf("NewEngineWithExclusions() error = %v", err)
+	}
+	got, err := engine.HashFS(os.DirFS(withDir), ".")
+	if err != nil {
+		t.Fatalf("Engine.HashFS() error = %v", err)
+	}
+	want, err := NewEngine().HashFS(os.DirFS(withoutDir), ".")
+	if err != nil {
+		t.Fatalf("Engine.HashFS() error = %v", err)
+	}
+	if !equal(got.Hash, want.Hash) {
+		t.Errorf("Engine.HashFS() excluding a subdirectory = %x, want the root without it %x", got.Hash, want.Hash)
+	}
+}
+
 func TestHashPath_LargeFile(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "large.txt")
@@ -658,6 +837,429 @@ func TestHashPath_SymlinkToDirectory(t *testing.T) {
 	}
 }
 
+func TestEngine_NoSymlinks(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create sub dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sub", "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file.txt: %v", err)
+	}
+	if err := os.Symlink("file.txt", filepath.Join(root, "sub", "link")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	if _, err := NewEngine().HashPath(root); err != nil {
+		t.Fatalf("HashPath() without --no-symlinks error = %v", err)
+	}
+
+	modes := []struct {
+		name  string
+		apply func(e *Engine)
+	}{
+		{"default", func(e *Engine) {}},
+		{"low memory", func(e *Engine) { e.SetLowMemory(true) }},
+		{"adaptive", func(e *Engine) { e.SetAdaptiveScheduling(true) }},
+	}
+	for _, mode := range modes {
+		t.Run(mode.name, func(t *testing.T) {
+			engine := NewEngine()
+			engine.SetNoSymlinks(true)
+			mode.apply(engine)
+			_, err := engine.HashPath(root)
+			if err == nil || !strings.Contains(err.Error(), filepath.Join("sub", "link")) {
+				t.Fatalf("HashPath() error = %v, want an error naming the symlink", err)
+			}
+		})
+	}
+
+	t.Run("excluded", func(t *testing.T) {
+		engine, err := NewEngineWithExclusions(0, []string{"link"}, root, false, "")
+		if err != nil {
+			t.Fatalf("NewEngineWithExclusions() error = %v", err)
+		}
+		engine.SetNoSymlinks(true)
+		if _, err := engine.HashPath(root); err != nil {
+			t.Errorf("HashPath() with the symlink excluded error = %v", err)
+		}
+	})
+
+	t.Run("fs", func(t *testing.T) {
+		engine := NewEngine()
+		engine.SetNoSymlinks(true)
+		if _, err := engine.HashFS(os.DirFS(root), "."); err == nil {
+			t.Error("HashFS() expected error for a symlink with --no-symlinks")
+		}
+	})
+}
+
+func TestEngine_IgnoreVanished(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"keep.txt", "gone.txt", filepath.Join("gonedir", "inner.txt")} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	// List the directory, then remove entries before hashing them, as a concurrent
+	// writer would
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if err := os.Remove(filepath.Join(root, "gone.txt")); err != nil {
+		t.Fatalf("Failed to remove gone.txt: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(root, "gonedir")); err != nil {
+		t.Fatalf("Failed to remove gonedir: %v", err)
+	}
+
+	for _, entry := range entries {
+		childPath := filepath.Join(root, entry.Name())
+		vanished := entry.Name() != "keep.txt"
+
+		strict := NewEngine()
+		strict.rootPath = root
+		if _, _, err := strict.hashEntry(root, entry, childPath, &sync.Map{}); (err != nil) != vanished {
+			t.Errorf("hashEntry(%s) without ignore-vanished error = %v, want error %v", entry.Name(), err, vanished)
+		}
+
+		var diags Diagnostics
+		engine := NewEngine()
+		engine.rootPath = root
+		engine.SetIgnoreVanished(true)
+		engine.SetDiagnostics(&diags)
+		_, keep, err := engine.hashEntry(root, entry, childPath, &sync.Map{})
+		if err != nil {
+			t.Errorf("hashEntry(%s) with ignore-vanished error = %v", entry.Name(), err)
+		}
+		if keep == vanished {
+			t.Errorf("hashEntry(%s) keep = %v, want %v", entry.Name(), keep, !vanished)
+		}
+		want := 0
+		if vanished {
+			want = 1
+		}
+		if got := diags.Count(DiagnosticVanished); got != want {
+			t.Errorf("hashEntry(%s) vanished diagnostics = %d, want %d", entry.Name(), got, want)
+		}
+	}
+
+	// A missing path that is not the vanished entry itself still fails
+	engine := NewEngine()
+	engine.SetIgnoreVanished(true)
+	if _, err := engine.HashPath(filepath.Join(root, "missing")); err == nil {
+		t.Error("HashPath() of a missing root with ignore-vanished error = nil, want an error")
+	}
+}
+
+func TestEngine_MarkerDirs(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"main.go":     "package main",
+		".git/HEAD":   "ref: refs/heads/main\n",
+		".git/config": "[core]\n",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	hash := func(markers ...string) Result {
+		t.Helper()
+		engine := NewEngine()
+		engine.SetMarkerDirs(markers)
+		result, err := engine.HashPath(root)
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		return result
+	}
+
+	plain, marked := hash(), hash(".git")
+	if equal(plain.Hash, marked.Hash) {
+		t.Error("HashPath() with a .git marker = the plain root, want a different root")
+	}
+	if want := int64(len("package main")); marked.Size != want {
+		t.Errorf("HashPath() with a .git marker size = %d, want %d", marked.Size, want)
+	}
+
+	// Churn inside .git changes the plain root but not the marked one
+	if err := os.WriteFile(filepath.Join(root, ".git", "ORIG_HEAD"), []byte("0123abcd\n"), 0644); err != nil {
+		t.Fatalf("Failed to write ORIG_HEAD: %v", err)
+	}
+	if got := hash(); equal(got.Hash, plain.Hash) {
+		t.Error("HashPath() after changing .git = the previous root, want a different root")
+	}
+	if got := hash(".git"); !equal(got.Hash, marked.Hash) {
+		t.Errorf("HashPath() with a .git marker after changing .git = %x, want %x", got.Hash, marked.Hash)
+	}
+
+	// Removing the repository changes the marked root
+	if err := os.RemoveAll(filepath.Join(root, ".git")); err != nil {
+		t.Fatalf("Failed to remove .git: %v", err)
+	}
+	if got := hash(".git"); equal(got.Hash, marked.Hash) {
+		t.Error("HashPath() with a .git marker after removing .git = the previous root, want a different root")
+	}
+
+	// The fs.FS walk agrees with the filesystem walk
+	if err := os.MkdirAll(filepath.Join(root, ".git", "objects"), 0755); err != nil {
+		t.Fatalf("Failed to recreate .git: %v", err)
+	}
+	engine := NewEngine()
+	engine.SetMarkerDirs([]string{".git"})
+	fromFS, err := engine.HashFS(os.DirFS(root), ".")
+	if err != nil {
+		t.Fatalf("HashFS() error = %v", err)
+	}
+	if got := hash(".git"); !equal(fromFS.Hash, got.Hash) || !equal(got.Hash, marked.Hash) {
+		t.Errorf("HashFS() = %x, HashPath() = %x, want both %x", fromFS.Hash, got.Hash, marked.Hash)
+	}
+
+	// A file holding the marker leaf's input does not stand in for the marker directory
+	forged := t.TempDir()
+	if err := os.WriteFile(filepath.Join(forged, "main.go"), []byte("package main"), 0644); err != nil {
+		t.Fatalf("Failed to create main.go: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(forged, ".git"), []byte(markerDirTag+".git"), 0644); err != nil {
+		t.Fatalf("Failed to create .git: %v", err)
+	}
+	for name, hashWith := range map[string]func(e *Engine) (Result, error){
+		"HashPath": func(e *Engine) (Result, error) { return e.HashPath(forged) },
+		"HashFS":   func(e *Engine) (Result, error) { return e.HashFS(os.DirFS(forged), ".") },
+	} {
+		engine := NewEngine()
+		engine.SetMarkerDirs([]string{".git"})
+		got, err := hashWith(engine)
+		if err != nil {
+			t.Fatalf("%s() error = %v", name, err)
+		}
+		if equal(got.Hash, marked.Hash) {
+			t.Errorf("%s() with a file .git holding the marker input = the marked root, want a different root", name)
+		}
+	}
+}
+
+func TestEngine_ExplainExclusion(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"build", ".git", "src"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	for _, file := range []string{"build/keep.txt", ".git/HEAD", "src/main.go", "src/keep.txt"} {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(file)), []byte("content"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", file, err)
+		}
+	}
+
+	engine, err := NewEngineWithExclusions(0, []string{"build/", "*.txt", "!keep.txt"}, root, false, "")
+	if err != nil {
+		t.Fatalf("NewEngineWithExclusions() error = %v", err)
+	}
+	engine.SetMarkerDirs([]string{".git"})
+
+	tests := []struct {
+		rel  string
+		want Exclusion
+	}{
+		{"build/keep.txt", Exclusion{Excluded: true, Path: "build", Rule: ExclusionPattern, Pattern: "build/"}},
+		{".git/HEAD", Exclusion{Excluded: true, Path: ".git", Rule: ExclusionMarkerDir}},
+		{"src/keep.txt", Exclusion{Path: "src/keep.txt", Rule: ExclusionPattern, Pattern: "!keep.txt"}},
+		{"src/other.txt", Exclusion{Excluded: true, Path: "src/other.txt", Rule: ExclusionPattern, Pattern: "*.txt"}},
+		{"src/main.go", Exclusion{Path: "src/main.go"}},
+	}
+	for _, tt := range tests {
+		got, err := engine.ExplainExclusion(tt.rel)
+		if err != nil {
+			t.Fatalf("ExplainExclusion(%q) error = %v", tt.rel, err)
+		}
+		if got != tt.want {
+			t.Errorf("ExplainExclusion(%q) = %+v, want %+v", tt.rel, got, tt.want)
+		}
+	}
+
+	// The verdicts agree with hashing: only src/main.go and src/keep.txt are hashed
+	all, err := engine.HashPath(root)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if all.Size != int64(2*len("content")) {
+		t.Errorf("HashPath() size = %d, want %d", all.Size, 2*len("content"))
+	}
+
+	if _, err := engine.ExplainExclusion("../outside"); err == nil {
+		t.Error("ExplainExclusion() expected error for a path outside the root")
+	}
+	if _, err := NewEngine().ExplainExclusion("src"); err == nil {
+		t.Error("ExplainExclusion() expected error for an engine without a root")
+	}
+}
+
+func TestEngine_FollowSymlinks(t *testing.T) {
+	base := t.TempDir()
+	shared := filepath.Join(base, "shared")
+	if err := os.MkdirAll(filepath.Join(shared, "lib"), 0755); err != nil {
+		t.Fatalf("Failed to create shared dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(shared, "config.txt"), []byte("config"), 0644); err != nil {
+		t.Fatalf("Failed to create config.txt: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(shared, "lib", "util.txt"), []byte("util"), 0644); err != nil {
+		t.Fatalf("Failed to create util.txt: %v", err)
+	}
+
+	// The copy holds real files, the linked tree links to the shared ones
+	copied := filepath.Join(base, "copied")
+	if err := os.CopyFS(copied, os.DirFS(shared)); err != nil {
+		t.Fatalf("Failed to copy tree: %v", err)
+	}
+	linked := filepath.Join(base, "linked")
+	if err := os.Mkdir(linked, 0755); err != nil {
+		t.Fatalf("Failed to create linked dir: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(shared, "config.txt"), filepath.Join(linked, "config.txt")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(shared, "lib"), filepath.Join(linked, "lib")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	hash := func(follow bool, path string) Result {
+		t.Helper()
+		e := NewEngine()
+		e.SetFollowSymlinks(follow)
+		result, err := e.HashPath(path)
+		if err != nil {
+			t.Fatalf("HashPath(%s) error = %v", path, err)
+		}
+		return result
+	}
+
+	if equal(hash(false, linked).Hash, hash(false, copied).Hash) {
+		t.Error("Links should not hash like their targets without SetFollowSymlinks")
+	}
+	got, want := hash(true, linked), hash(true, copied)
+	if !equal(got.Hash, want.Hash) || got.Size != want.Size {
+		t.Errorf("Followed links hash to %x (%d bytes), want %x (%d bytes) like the copy", got.Hash, got.Size, want.Hash, want.Size)
+	}
+
+	// Dangling links cannot be followed and are hashed as links
+	dangling := filepath.Join(base, "dangling")
+	if err := os.Mkdir(dangling, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.Symlink("missing", filepath.Join(dangling, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if !equal(hash(true, dangling).Hash, hash(false, dangling).Hash) {
+		t.Error("Dangling links should hash the same with SetFollowSymlinks")
+	}
+
+	// A link back to an ancestor would never end
+	loop := filepath.Join(base, "loop")
+	if err := os.MkdirAll(filepath.Join(loop, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.Symlink(loop, filepath.Join(loop, "sub", "up")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	e := NewEngine()
+	e.SetFollowSymlinks(true)
+	if _, err := e.HashPath(loop); err == nil || !strings.Contains(err.Error(), "circular symlink") {
+		t.Errorf("HashPath() error = %v, want a circular symlink error", err)
+	}
+}
+
+func TestEngine_ResolveSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "lib"), 0755); err != nil {
+		t.Fatalf("Failed to create lib dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "lib", "target.txt"), []byte("target"), 0644); err != nil {
+		t.Fatalf("Failed to create target.txt: %v", err)
+	}
+	real, err := filepath.EvalSymlinks(filepath.Join(dir, "lib", "target.txt"))
+	if err != nil {
+		t.Fatalf("Failed to resolve target.txt: %v", err)
+	}
+
+	// direct links to the target, chain goes through another link
+	links := map[string]string{
+		"relative": filepath.Join("lib", "target.txt"),
+		"absolute": real,
+		"chain":    "relative",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skipf("Symlinks not supported: %v", err)
+		}
+	}
+
+	hash := func(resolve bool, name string) Result {
+		t.Helper()
+		e := NewEngine()
+		e.SetResolveSymlinks(resolve)
+		e.SetResolveRoot(false)
+		result, err := e.HashPath(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("HashPath(%s) error = %v", name, err)
+		}
+		return result
+	}
+
+	if equal(hash(false, "relative").Hash, hash(false, "chain").Hash) {
+		t.Error("Links with different targets should differ without SetResolveSymlinks")
+	}
+	want := hash(true, "relative")
+	for _, name := range []string{"absolute", "chain"} {
+		if got := hash(true, name); !equal(got.Hash, want.Hash) || got.Size != 0 {
+			t.Errorf("Resolved %s = %x (%d bytes), want %x (0 bytes) like relative", name, got.Hash, got.Size, want.Hash)
+		}
+	}
+	if equal(want.Hash, hash(true, filepath.Join("lib", "target.txt")).Hash) {
+		t.Error("Resolved links should not hash like their target's content")
+	}
+
+	// Inside a tree, chained links to the same file hash alike
+	a, b := t.TempDir(), t.TempDir()
+	if err := os.Symlink(filepath.Join(dir, "relative"), filepath.Join(a, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "chain"), filepath.Join(b, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	e := NewEngine()
+	e.SetResolveSymlinks(true)
+	ra, err := e.HashPath(a)
+	if err != nil {
+		t.Fatalf("HashPath(a) error = %v", err)
+	}
+	rb, err := e.HashPath(b)
+	if err != nil {
+		t.Fatalf("HashPath(b) error = %v", err)
+	}
+	if !equal(ra.Hash, rb.Hash) {
+		t.Errorf("Trees linking through different chains = %x and %x, want equal", ra.Hash, rb.Hash)
+	}
+
+	// Dangling links still hash, from their target joined to their directory
+	if err := os.Symlink("missing", filepath.Join(a, "dangling")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if _, err := e.HashPath(a); err != nil {
+		t.Errorf("HashPath with a dangling link error = %v", err)
+	}
+}
+
 func TestEngine_HashPath_WithCustomIgnoreFile(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -766,15 +1368,3485 @@ func TestHashPath_DirectoryOrder(t *testing.T) {
 	}
 }
 
-// Helper functions
-func equal(a, b []byte) bool {
-	if len(a) != len(b) {
-		return false
+func TestEngine_HashSubtrees(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"a", "b/nested", "c"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
 	}
-	for i := range a {
-		if a[i] != b[i] {
-			return false
+	files := map[string]string{
+		"root.txt":       "root",
+		"a/a.txt":        "a",
+		"b/b.txt":        "b",
+		"b/nested/n.txt": "nested",
+		"c/excluded.log": "log",
+		"c/included.txt": "c",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
 		}
 	}
-	return true
+
+	engine, err := NewEngineWithExclusions(0, []string{"*.log"}, tmpDir, false, "")
+	if err != nil {
+		t.Fatalf("NewEngineWithExclusions() error = %v", err)
+	}
+	root, subtrees, err := engine.HashSubtrees(tmpDir)
+	if err != nil {
+		t.Fatalf("HashSubtrees() error = %v", err)
+	}
+
+	want, err := engine.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !equal(root.Hash, want.Hash) || root.Size != want.Size {
+		t.Errorf("HashSubtrees() root = %x (size %d), want %x (size %d)", root.Hash, root.Size, want.Hash, want.Size)
+	}
+
+	if len(subtrees) != 3 {
+		t.Fatalf("HashSubtrees() returned %d subtrees, want 3: %v", len(subtrees), subtrees)
+	}
+	for name, got := range subtrees {
+		subEngine, err := NewEngineWithExclusions(0, []string{"*.log"}, filepath.Join(tmpDir, name), false, "")
+		if err != nil {
+			t.Fatalf("NewEngineWithExclusions() error = %v", err)
+		}
+		independent, err := subEngine.HashPath(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("HashPath(%s) error = %v", name, err)
+		}
+		if !equal(got.Hash, independent.Hash) || got.Size != independent.Size {
+			t.Errorf("subtree %q = %x (size %d), want %x (size %d)", name, got.Hash, got.Size, independent.Hash, independent.Size)
+		}
+	}
+}
+
+func TestEngine_HashAllDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"a/a.txt", "b/nested/deep/n.txt", "c/excluded.log", "root.txt"} {
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	engine, err := NewEngineWithExclusions(0, []string{"*.log"}, tmpDir, false, "")
+	if err != nil {
+		t.Fatalf("NewEngineWithExclusions() error = %v", err)
+	}
+	engine.SetAdaptiveScheduling(true)
+	root, dirs, err := engine.HashAllDirs(tmpDir)
+	if err != nil {
+		t.Fatalf("HashAllDirs() error = %v", err)
+	}
+
+	want := []string{".", "a", "b", "b/nested", "b/nested/deep", "c"}
+	got := slices.Sorted(maps.Keys(dirs))
+	if !slices.Equal(got, want) {
+		t.Fatalf("HashAllDirs() directories = %v, want %v", got, want)
+	}
+	if !equal(dirs["."].Hash, root.Hash) {
+		t.Errorf("HashAllDirs() \".\" = %x, want root %x", dirs["."].Hash, root.Hash)
+	}
+	for rel, result := range dirs {
+		dir := filepath.Join(tmpDir, filepath.FromSlash(rel))
+		subEngine, err := NewEngineWithExclusions(0, []string{"*.log"}, dir, false, "")
+		if err != nil {
+			t.Fatalf("NewEngineWithExclusions() error = %v", err)
+		}
+		independent, err := subEngine.HashPath(dir)
+		if err != nil {
+			t.Fatalf("HashPath(%s) error = %v", rel, err)
+		}
+		if !equal(result.Hash, independent.Hash) || result.Size != independent.Size {
+			t.Errorf("directory %q = %x (size %d), want %x (size %d)", rel, result.Hash, result.Size, independent.Hash, independent.Size)
+		}
+	}
+}
+
+func TestEngine_HashSubtrees_File(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "file.txt")
+	if err := os.WriteFile(testFile, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	root, subtrees, err := NewEngine().HashSubtrees(testFile)
+	if err != nil {
+		t.Fatalf("HashSubtrees() error = %v", err)
+	}
+	if len(subtrees) != 0 {
+		t.Errorf("HashSubtrees() on a file returned %d subtrees, want 0", len(subtrees))
+	}
+	want, err := HashPath(testFile)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !equal(root.Hash, want.Hash) {
+		t.Errorf("HashSubtrees() root = %x, want %x", root.Hash, want.Hash)
+	}
+}
+
+func TestEngine_Prove(t *testing.T) {
+	tmpDir := t.TempDir()
+	nested := filepath.Join(tmpDir, "a", "b")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("Failed to create nested directories: %v", err)
+	}
+	files := map[string]string{
+		"root.txt":     "root",
+		"a/before.txt": "before",
+		"a/z.txt":      "after",
+		"a/b/leaf.txt": "leaf",
+		"a/b/other":    "other",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	target := filepath.Join(nested, "leaf.txt")
+
+	proof, err := NewEngine().Prove(tmpDir, target)
+	if err != nil {
+		t.Fatalf("Prove() error = %v", err)
+	}
+
+	rootResult, err := HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if proof.Root != hex.EncodeToString(rootResult.Hash) {
+		t.Errorf("Prove() root = %s, want %x", proof.Root, rootResult.Hash)
+	}
+	leafResult, err := HashPath(target)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if proof.Leaf != hex.EncodeToString(leafResult.Hash) {
+		t.Errorf("Prove() leaf = %s, want %x", proof.Leaf, leafResult.Hash)
+	}
+	if proof.Path != "a/b/leaf.txt" {
+		t.Errorf("Prove() path = %q, want %q", proof.Path, "a/b/leaf.txt")
+	}
+	if len(proof.Steps) != 3 {
+		t.Fatalf("Prove() steps = %d, want 3", len(proof.Steps))
+	}
+
+	if err := VerifyProof(proof); err != nil {
+		t.Errorf("VerifyProof() error = %v", err)
+	}
+
+	// Tampering with the leaf must invalidate the proof
+	tampered := *proof
+	tampered.Leaf = hex.EncodeToString(make([]byte, HashSize))
+	if err := VerifyProof(&tampered); err == nil {
+		t.Error("VerifyProof() expected error for tampered leaf")
+	}
+
+	// Leaves and siblings of the wrong length or type must be rejected, not hashed
+	short := *proof
+	short.Leaf = proof.Leaf[2:]
+	if err := VerifyProof(&short); err == nil || !strings.Contains(err.Error(), "invalid leaf hash") {
+		t.Errorf("VerifyProof() error = %v, want an error for a short leaf", err)
+	}
+	sibling := proof.Steps[0].After[0]
+	for name, bad := range map[string]string{
+		"short":     sibling[:len(sibling)-2],
+		"long":      sibling + "00",
+		"bad type":  "78" + sibling[2:],
+		"no prefix": sibling[2:],
+	} {
+		malformed := *proof
+		malformed.Steps = slices.Clone(proof.Steps)
+		malformed.Steps[0] = ProofStep{Before: proof.Steps[0].Before, After: []string{bad}}
+		if err := VerifyProof(&malformed); err == nil || !strings.Contains(err.Error(), "invalid sibling") {
+			t.Errorf("VerifyProof() error = %v, want an error for a %s sibling", err, name)
+		}
+	}
+}
+
+func TestEngine_Prove_Errors(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "app.log"), []byte("log"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	engine, err := NewEngineWithExclusions(0, []string{"*.log"}, tmpDir, false, "")
+	if err != nil {
+		t.Fatalf("NewEngineWithExclusions() error = %v", err)
+	}
+	if _, err := engine.Prove(tmpDir, filepath.Join(tmpDir, "app.log")); err == nil {
+		t.Error("Prove() expected error for excluded file")
+	}
+	if _, err := NewEngine().Prove(tmpDir, filepath.Dir(tmpDir)); err == nil {
+		t.Error("Prove() expected error for path outside root")
+	}
+
+	chunked := NewEngine()
+	chunked.SetChunkSize(4)
+	if _, err := chunked.Prove(tmpDir, filepath.Join(tmpDir, "app.log")); err == nil || !strings.Contains(err.Error(), "plain digests") {
+		t.Errorf("Prove() error = %v, want an error for chunked file hashes", err)
+	}
+}
+
+func TestEngine_SetContentClass(t *testing.T) {
+	tmpDir := t.TempDir()
+	mixed := filepath.Join(tmpDir, "mixed")
+	textOnly := filepath.Join(tmpDir, "text")
+	binaryOnly := filepath.Join(tmpDir, "binary")
+	for _, dir := range []string{mixed, textOnly, binaryOnly} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+
+	text := []byte("plain text content\n")
+	binary := []byte{0x7f, 'E', 'L', 'F', 0x00, 0x01, 0x02}
+	writes := map[string][]byte{
+		filepath.Join(mixed, "notes.txt"):        text,
+		filepath.Join(mixed, "program.bin"):      binary,
+		filepath.Join(textOnly, "notes.txt"):     text,
+		filepath.Join(binaryOnly, "program.bin"): binary,
+	}
+	for path, content := range writes {
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		class ContentClass
+		want  string
+		size  int64
+	}{
+		{name: "text only", class: ContentTextOnly, want: textOnly, size: int64(len(text))},
+		{name: "binary only", class: ContentBinaryOnly, want: binaryOnly, size: int64(len(binary))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine()
+			engine.SetContentClass(tt.class)
+			got, err := engine.HashPath(mixed)
+			if err != nil {
+				t.Fatalf("HashPath() error = %v", err)
+			}
+			want, err := HashPath(tt.want)
+			if err != nil {
+				t.Fatalf("HashPath() error = %v", err)
+			}
+			if !equal(got.Hash, want.Hash) {
+				t.Errorf("HashPath() with content class = %x, want %x", got.Hash, want.Hash)
+			}
+			if got.Size != tt.size {
+				t.Errorf("HashPath() size = %d, want %d", got.Size, tt.size)
+			}
+		})
+	}
+
+	all, err := HashPath(mixed)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if all.Size != int64(len(text)+len(binary)) {
+		t.Errorf("HashPath() without content class size = %d, want %d", all.Size, len(text)+len(binary))
+	}
+}
+
+// initGitRepo creates a git repository in a temporary directory with the given files
+// committed, skipping the test if git is not available.
+func initGitRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in PATH")
+	}
+
+	repo := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(repo, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=mtc", "-c", "user.email=mtc@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	return repo
+}
+
+func TestEngine_CompareGitRef(t *testing.T) {
+	repo := initGitRepo(t, map[string]string{
+		".gitignore":      "*.log\n",
+		"README.md":       "readme",
+		"src/main.go":     "package main",
+		"src/util/a.go":   "package util",
+		"docs/removed.md": "gone soon",
+	})
+
+	t.Run("clean checkout", func(t *testing.T) {
+		// Ignored files must not count as drift
+		if err := os.WriteFile(filepath.Join(repo, "debug.log"), []byte("log"), 0644); err != nil {
+			t.Fatalf("Failed to create ignored file: %v", err)
+		}
+		diff, err := NewEngine().CompareGitRef(repo, "HEAD")
+		if err != nil {
+			t.Fatalf("CompareGitRef() error = %v", err)
+		}
+		if len(diff) != 1 || diff[0] != noDifferencesMsg {
+			t.Errorf("CompareGitRef() = %v, want no differences", diff)
+		}
+	})
+
+	t.Run("dirty checkout", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(repo, "src", "main.go"), []byte("package main // changed"), 0644); err != nil {
+			t.Fatalf("Failed to modify file: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(repo, "src", "new.go"), []byte("package main"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if err := os.Remove(filepath.Join(repo, "docs", "removed.md")); err != nil {
+			t.Fatalf("Failed to remove file: %v", err)
+		}
+
+		diff, err := NewEngine().CompareGitRef(repo, "HEAD")
+		if err != nil {
+			t.Fatalf("CompareGitRef() error = %v", err)
+		}
+		if len(diff) == 0 || !contains(diff[0], "Root mismatch") {
+			t.Fatalf("CompareGitRef() = %v, want root mismatch", diff)
+		}
+		want := []string{"deleted: docs/removed.md", "modified: src/main.go", "added: src/new.go"}
+		got := diff[1:]
+		if len(got) != len(want) {
+			t.Fatalf("CompareGitRef() drift = %v, want %v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("CompareGitRef() drift[%d] = %q, want %q", i, got[i], want[i])
+			}
+		}
+	})
+
+	t.Run("invalid ref", func(t *testing.T) {
+		if _, err := NewEngine().CompareGitRef(repo, "no-such-ref"); err == nil {
+			t.Error("CompareGitRef() expected error for unknown ref")
+		}
+		// A ref must name a tree, and is never passed to git as an option
+		for _, ref := range []string{"--full-tree", "-r", "HEAD:README.md"} {
+			if _, err := NewEngine().CompareGitRef(repo, ref); err == nil {
+				t.Errorf("CompareGitRef(%q) expected error", ref)
+			}
+		}
+	})
+}
+
+func TestEngine_CompareGitRefSymlink(t *testing.T) {
+	repo := initGitRepo(t, map[string]string{"a.txt": "a"})
+	if err := os.Symlink("a.txt", filepath.Join(repo, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	for _, args := range [][]string{
+		{"add", "link"},
+		{"-c", "user.name=mtc", "-c", "user.email=mtc@example.com", "commit", "-q", "-m", "link"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	// A committed link matches its checkout when both are compared as links
+	diff, err := NewEngine().CompareGitRef(repo, "HEAD")
+	if err != nil {
+		t.Fatalf("CompareGitRef() error = %v", err)
+	}
+	if len(diff) != 1 || diff[0] != noDifferencesMsg {
+		t.Errorf("CompareGitRef() = %v, want no differences", diff)
+	}
+
+	// The ref side cannot follow links, so following them would report false drift
+	engine := NewEngine()
+	engine.SetFollowSymlinks(true)
+	if _, err := engine.CompareGitRef(repo, "HEAD"); err == nil {
+		t.Error("CompareGitRef() with followed symlinks expected an error")
+	}
+
+	// Nor can it resolve them to real paths
+	engine = NewEngine()
+	engine.SetResolveSymlinks(true)
+	if _, err := engine.CompareGitRef(repo, "HEAD"); err == nil {
+		t.Error("CompareGitRef() with resolved symlinks expected an error")
+	}
+}
+
+func TestEngine_GitTree(t *testing.T) {
+	repo := initGitRepo(t, map[string]string{
+		"README.md":   "readme",
+		"a.txt":       "sorts after the a/ directory in git order",
+		"a-b":         "sorts before it",
+		"a/b.go":      "package a",
+		"a/c/d.go":    "package c",
+		"bin/run.sh":  "#!/bin/sh\necho run\n",
+		"docs/x.md":   "x",
+		"docs/y/z.md": "z",
+	})
+	if err := os.Chmod(filepath.Join(repo, "bin", "run.sh"), 0755); err != nil {
+		t.Fatalf("Failed to make file executable: %v", err)
+	}
+	if err := os.Symlink("README.md", filepath.Join(repo, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	// Git cannot store empty directories, so they must not change the tree
+	if err := os.Mkdir(filepath.Join(repo, "empty"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	root, listing, err := NewEngine().GitTree(repo)
+	if err != nil {
+		t.Fatalf("GitTree() error = %v", err)
+	}
+
+	if out, err := exec.Command("git", "-C", repo, "add", "-A").CombinedOutput(); err != nil {
+		t.Fatalf("git add failed: %v\n%s", err, out)
+	}
+	out, err := exec.Command("git", "-C", repo, "write-tree").Output()
+	if err != nil {
+		t.Fatalf("git write-tree failed: %v", err)
+	}
+	want := strings.TrimSpace(string(out))
+	if got := fmt.Sprintf("%x", root.OID); got != want {
+		t.Errorf("GitTree() root = %s, want git write-tree %s", got, want)
+	}
+
+	out, err = exec.Command("git", "-C", repo, "ls-tree", "-r", "-t", want).Output()
+	if err != nil {
+		t.Fatalf("git ls-tree failed: %v", err)
+	}
+	var lines []string
+	for _, entry := range listing {
+		lines = append(lines, entry.String())
+	}
+	if got := strings.Join(lines, "\n") + "\n"; got != string(out) {
+		t.Errorf("GitTree() listing =\n%s\nwant git ls-tree -r -t:\n%s", got, out)
+	}
+}
+
+func TestEngine_GitTreeLimits(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	limited := NewEngine()
+	limited.SetEntriesLimit(1, false)
+	if _, _, err := limited.GitTree(tmpDir); err == nil || !strings.Contains(err.Error(), "--entries-limit") {
+		t.Errorf("GitTree() error = %v, want an --entries-limit error", err)
+	}
+
+	// Files are read under the engine's limits without changing their object IDs
+	want, wantListing, err := NewEngine().GitTree(tmpDir)
+	if err != nil {
+		t.Fatalf("GitTree() error = %v", err)
+	}
+	throttled := NewEngine()
+	throttled.SetOpenFilesLimit(1)
+	throttled.SetMaxReadRate(1 << 20)
+	got, listing, err := throttled.GitTree(tmpDir)
+	if err != nil {
+		t.Fatalf("GitTree() with limits error = %v", err)
+	}
+	if !equal(got.OID, want.OID) || len(listing) != len(wantListing) {
+		t.Errorf("GitTree() with limits = %x (%d entries), want %x (%d entries)", got.OID, len(listing), want.OID, len(wantListing))
+	}
+}
+
+func TestEngine_HashGitChanged(t *testing.T) {
+	repo := initGitRepo(t, map[string]string{
+		".gitignore":  "*.log\n",
+		"README.md":   "readme",
+		"src/main.go": "package main",
+		"src/util.go": "package main",
+	})
+
+	// A clean checkout has no changed files
+	result, paths, err := NewEngine().HashGitChanged(repo)
+	if err != nil {
+		t.Fatalf("HashGitChanged() error = %v", err)
+	}
+	empty, err := HashPath(t.TempDir())
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if len(paths) != 0 || !equal(result.Hash, empty.Hash) {
+		t.Errorf("HashGitChanged() on a clean checkout = %x %v, want the empty directory hash %x", result.Hash, paths, empty.Hash)
+	}
+
+	for name, content := range map[string]string{
+		"src/main.go": "package main // changed",
+		"src/new.go":  "package main",
+		"debug.log":   "ignored",
+	} {
+		if err := os.WriteFile(filepath.Join(repo, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	if err := os.Remove(filepath.Join(repo, "src", "util.go")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+
+	// The root must equal that of a tree holding only the changed files
+	expected := t.TempDir()
+	if err := os.Mkdir(filepath.Join(expected, "src"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for name, content := range map[string]string{"src/main.go": "package main // changed", "src/new.go": "package main"} {
+		if err := os.WriteFile(filepath.Join(expected, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		wantPaths []string
+		wantRoot  string
+	}{
+		{name: "repository root", path: repo, wantPaths: []string{"src/main.go", "src/new.go"}, wantRoot: expected},
+		{name: "subdirectory", path: filepath.Join(repo, "src"), wantPaths: []string{"main.go", "new.go"}, wantRoot: filepath.Join(expected, "src")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, paths, err := NewEngine().HashGitChanged(tt.path)
+			if err != nil {
+				t.Fatalf("HashGitChanged() error = %v", err)
+			}
+			if strings.Join(paths, ",") != strings.Join(tt.wantPaths, ",") {
+				t.Errorf("HashGitChanged() paths = %v, want %v", paths, tt.wantPaths)
+			}
+			want, err := HashPath(tt.wantRoot)
+			if err != nil {
+				t.Fatalf("HashPath() error = %v", err)
+			}
+			if !equal(result.Hash, want.Hash) || result.Size != want.Size {
+				t.Errorf("HashGitChanged() = %x (size %d), want %x (size %d)", result.Hash, result.Size, want.Hash, want.Size)
+			}
+		})
+	}
+}
+
+func TestEngine_HashGitChangedSince(t *testing.T) {
+	repo := initGitRepo(t, map[string]string{
+		".gitignore": "*.log\n",
+		"a.txt":      "a",
+		"b.txt":      "b",
+		"c.txt":      "c",
+	})
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=mtc", "-c", "user.email=mtc@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	git("tag", "v1.0.0")
+
+	// A change committed after the tag, one left in the working tree, an untracked file
+	// and an ignored one
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte("a2"), 0644); err != nil {
+		t.Fatalf("Failed to modify a.txt: %v", err)
+	}
+	git("commit", "-q", "-am", "change a")
+	for name, content := range map[string]string{"b.txt": "b2", "new.txt": "new", "debug.log": "ignored"} {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	result, paths, err := NewEngine().HashGitChangedSince(repo, "v1.0.0")
+	if err != nil {
+		t.Fatalf("HashGitChangedSince() error = %v", err)
+	}
+	if wantPaths := []string{"a.txt", "b.txt", "new.txt"}; strings.Join(paths, ",") != strings.Join(wantPaths, ",") {
+		t.Errorf("HashGitChangedSince() paths = %v, want %v", paths, wantPaths)
+	}
+
+	expected := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "a2", "b.txt": "b2", "new.txt": "new"} {
+		if err := os.WriteFile(filepath.Join(expected, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	want, err := HashPath(expected)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !equal(result.Hash, want.Hash) || result.Size != want.Size {
+		t.Errorf("HashGitChangedSince() = %x (size %d), want %x (size %d)", result.Hash, result.Size, want.Hash, want.Size)
+	}
+
+	for _, ref := range []string{"v9.9.9", "--output=x"} {
+		if _, _, err := NewEngine().HashGitChangedSince(repo, ref); err == nil {
+			t.Errorf("HashGitChangedSince(%q) error = nil, want an error", ref)
+		}
+	}
+}
+
+func TestRootFromLeaves_MatchesHashPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"a.txt":     "a",
+		"b/c.txt":   "c",
+		"b/d/e.txt": "e",
+	}
+	leaves := make(map[string]leafResult)
+	for name, content := range files {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		result, err := HashPath(path)
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		leaves[name] = leafResult{Result: result}
+	}
+
+	got, err := NewEngine().rootFromLeaves(leaves)
+	if err != nil {
+		t.Fatalf("rootFromLeaves() error = %v", err)
+	}
+	want, err := HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !equal(got.Hash, want.Hash) || got.Size != want.Size {
+		t.Errorf("rootFromLeaves() = %x (size %d), want %x (size %d)", got.Hash, got.Size, want.Hash, want.Size)
+	}
+}
+
+func TestEngine_SetMaxReadRate(t *testing.T) {
+	tmpDir := t.TempDir()
+	const fileSize = 32 * 1024
+	for _, name := range []string{"a.bin", "b.bin"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), make([]byte, fileSize), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	// 64KB at 128KB/s must take at least half a second
+	const rate = 128 * 1024
+	engine := NewEngine()
+	engine.SetMaxReadRate(rate)
+
+	start := time.Now()
+	throttled, err := engine.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	elapsed := time.Since(start)
+
+	minimum := time.Duration(float64(2*fileSize) / rate * float64(time.Second))
+	if elapsed < minimum {
+		t.Errorf("HashPath() took %v under a %d B/s limit, want at least %v", elapsed, rate, minimum)
+	}
+
+	unthrottled, err := HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !equal(throttled.Hash, unthrottled.Hash) {
+		t.Error("HashPath() throttling must not change the hash")
+	}
+}
+
+func TestEngine_AdaptiveSchedulingDeterministic(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 4, 3, 4)
+
+	sequential, err := NewEngineWithWorkers(4).HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	for _, workers := range []int{1, 2, 4, 16} {
+		for run := 0; run < 5; run++ {
+			engine := NewEngineWithWorkers(workers)
+			engine.SetAdaptiveScheduling(true)
+			result, err := engine.HashPath(tmpDir)
+			if err != nil {
+				t.Fatalf("HashPath() with adaptive scheduling error = %v", err)
+			}
+			if !equal(result.Hash, sequential.Hash) {
+				t.Fatalf("workers=%d run=%d: adaptive hash %x, want %x", workers, run, result.Hash, sequential.Hash)
+			}
+			if result.Size != sequential.Size {
+				t.Fatalf("workers=%d run=%d: adaptive size %d, want %d", workers, run, result.Size, sequential.Size)
+			}
+		}
+	}
+}
+
+func TestEngine_AdaptiveSchedulingError(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 2, 3, 2)
+	if os.Geteuid() == 0 {
+		t.Skip("Skipping permission test when running as root")
+	}
+	locked := filepath.Join(tmpDir, "d1", "locked")
+	if err := os.Mkdir(locked, 0000); err != nil {
+		t.Fatalf("Failed to create locked directory: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(locked, 0755) })
+
+	engine := NewEngineWithWorkers(4)
+	engine.SetAdaptiveScheduling(true)
+	if _, err := engine.HashPath(tmpDir); err == nil {
+		t.Error("HashPath() with adaptive scheduling expected error for unreadable directory")
+	}
+}
+
+func TestEngine_AdaptiveSchedulingProve(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 3, 3, 3)
+
+	engine := NewEngineWithWorkers(4)
+	engine.SetAdaptiveScheduling(true)
+	proof, err := engine.Prove(tmpDir, filepath.Join(tmpDir, "d1", "d2", "file0.txt"))
+	if err != nil {
+		t.Fatalf("Prove() error = %v", err)
+	}
+	if err := VerifyProof(proof); err != nil {
+		t.Errorf("VerifyProof() error = %v", err)
+	}
+}
+
+func TestEngine_SizePath(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 2, 2, 3)
+	if err := os.WriteFile(filepath.Join(tmpDir, "d0", "skip.log"), []byte("excluded content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Symlink("file0.txt", filepath.Join(tmpDir, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	for _, patterns := range [][]string{nil, {"*.log"}, {"d1"}} {
+		engine, err := NewEngineWithExclusions(0, patterns, tmpDir, false, "")
+		if err != nil {
+			t.Fatalf("NewEngineWithExclusions() error = %v", err)
+		}
+		result, err := engine.HashPath(tmpDir)
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		size, err := engine.SizePath(tmpDir)
+		if err != nil {
+			t.Fatalf("SizePath() error = %v", err)
+		}
+		if size != result.Size {
+			t.Errorf("patterns %v: SizePath() = %d, want HashPath size %d", patterns, size, result.Size)
+		}
+	}
+
+	file := filepath.Join(tmpDir, "file0.txt")
+	size, err := NewEngine().SizePath(file)
+	if err != nil {
+		t.Fatalf("SizePath() error = %v", err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if size != info.Size() {
+		t.Errorf("SizePath() for a file = %d, want %d", size, info.Size())
+	}
+}
+
+func TestEngine_ChunkSingleByteChange(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "large.bin")
+	content := make([]byte, 10*1024+100)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	engine := NewEngine()
+	engine.SetChunkSize(1024)
+	before, chunksBefore, err := engine.HashChunks(path)
+	if err != nil {
+		t.Fatalf("HashChunks() error = %v", err)
+	}
+	if len(chunksBefore) != 11 {
+		t.Fatalf("HashChunks() returned %d chunks, want 11", len(chunksBefore))
+	}
+	if chunksBefore[10].Size != 100 {
+		t.Errorf("Last chunk size = %d, want 100", chunksBefore[10].Size)
+	}
+
+	// The chunked file hash is the hash of the chunk hashes, as reported by HashPath
+	viaPath, err := engine.HashPath(path)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !equal(viaPath.Hash, before.Hash) {
+		t.Errorf("HashPath() = %x, HashChunks() = %x", viaPath.Hash, before.Hash)
+	}
+
+	content[5*1024+7] ^= 0xff
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	after, chunksAfter, err := engine.HashChunks(path)
+	if err != nil {
+		t.Fatalf("HashChunks() error = %v", err)
+	}
+	if equal(before.Hash, after.Hash) {
+		t.Error("File hash should change after modifying a byte")
+	}
+
+	changed := 0
+	for i := range chunksBefore {
+		if !equal(chunksBefore[i].Hash, chunksAfter[i].Hash) {
+			changed++
+			if i != 5 {
+				t.Errorf("Chunk %d changed, only chunk 5 should", i)
+			}
+		}
+	}
+	if changed != 1 {
+		t.Errorf("%d chunks changed, want 1", changed)
+	}
+}
+
+func TestEngine_ChunkDefaults(t *testing.T) {
+	tmpDir := t.TempDir()
+	small := filepath.Join(tmpDir, "small.txt")
+	large := filepath.Join(tmpDir, "large.txt")
+	if err := os.WriteFile(small, []byte("small content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.WriteFile(large, bytes.Repeat([]byte("x"), 4096), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	plain, err := NewEngine().HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	disabled := NewEngine()
+	disabled.SetChunkSize(0)
+	unchunked, err := disabled.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !equal(plain.Hash, unchunked.Hash) {
+		t.Error("Chunk size 0 should keep the single-stream hash")
+	}
+
+	chunked := NewEngine()
+	chunked.SetChunkSize(1024)
+	result, err := chunked.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if equal(plain.Hash, result.Hash) {
+		t.Error("Chunking a file larger than the chunk size should change the root hash")
+	}
+	if result.Size != plain.Size {
+		t.Errorf("Chunked size = %d, want %d", result.Size, plain.Size)
+	}
+
+	// Files no larger than one chunk keep their single-stream hash
+	smallPlain, err := NewEngine().HashPath(small)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	smallResult, chunks, err := chunked.HashChunks(small)
+	if err != nil {
+		t.Fatalf("HashChunks() error = %v", err)
+	}
+	if !equal(smallPlain.Hash, smallResult.Hash) || len(chunks) != 1 {
+		t.Errorf("Small file should be a single unchanged chunk, got %d chunks", len(chunks))
+	}
+
+	if _, _, err := chunked.HashChunks(tmpDir); err == nil {
+		t.Error("HashChunks() expected error for a directory")
+	}
+}
+
+func TestEngine_AssumedHashes(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 3, 2, 2)
+
+	full, err := NewEngine().HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	subtree, err := NewEngine().HashPath(filepath.Join(tmpDir, "d1", "d0"))
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	file, err := NewEngine().HashPath(filepath.Join(tmpDir, "d0", "file1.txt"))
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	engine := NewEngine()
+	if err := engine.SetAssumedHashes(map[string][]byte{"d1/d0": subtree.Hash, "d0/file1.txt": file.Hash}); err != nil {
+		t.Fatalf("SetAssumedHashes() error = %v", err)
+	}
+	assumed, err := engine.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() with assumed hashes error = %v", err)
+	}
+	if !equal(assumed.Hash, full.Hash) {
+		t.Errorf("Root with correct assumed hashes = %x, want %x", assumed.Hash, full.Hash)
+	}
+	if assumed.Size != full.Size {
+		t.Errorf("Size with assumed hashes = %d, want %d", assumed.Size, full.Size)
+	}
+
+	wrong := make([]byte, HashSize)
+	engine = NewEngine()
+	if err := engine.SetAssumedHashes(map[string][]byte{"d1/d0": wrong}); err != nil {
+		t.Fatalf("SetAssumedHashes() error = %v", err)
+	}
+	differing, err := engine.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() with assumed hashes error = %v", err)
+	}
+	if equal(differing.Hash, full.Hash) {
+		t.Error("Root with an incorrect assumed hash should differ from the full computation")
+	}
+
+	for _, rel := range []string{"../outside", "/abs/path"} {
+		if err := NewEngine().SetAssumedHashes(map[string][]byte{rel: wrong}); err == nil {
+			t.Errorf("SetAssumedHashes(%q) expected error", rel)
+		}
+	}
+}
+
+func TestEngine_NormalizeUnicode(t *testing.T) {
+	// "é" composed (NFC, as on Linux) and decomposed (NFD, as on macOS). The NFD form
+	// starts with "e" and sorts before "f"; the NFC form sorts after it.
+	nfc := "caf\u00e9.txt"
+	nfd := "cafe\u0301.txt"
+
+	createTree := func(name string) string {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("accent"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "caff.txt"), []byte("plain"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		return dir
+	}
+	linuxTree := createTree(nfc)
+	macTree := createTree(nfd)
+
+	rawLinux, err := NewEngine().HashPath(linuxTree)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	rawMac, err := NewEngine().HashPath(macTree)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if equal(rawLinux.Hash, rawMac.Hash) {
+		t.Fatal("NFC and NFD trees should hash differently without normalization")
+	}
+
+	hashNormalized := func(dir string) []byte {
+		engine := NewEngine()
+		engine.SetNormalizeUnicode(true)
+		result, err := engine.HashPath(dir)
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		return result.Hash
+	}
+	if got, want := hashNormalized(macTree), hashNormalized(linuxTree); !equal(got, want) {
+		t.Errorf("Normalized roots differ: NFD %x, NFC %x", got, want)
+	}
+}
+
+func TestCombineResults(t *testing.T) {
+	a := Result{Hash: bytes.Repeat([]byte{0x02}, HashSize), Size: 10}
+	b := Result{Hash: bytes.Repeat([]byte{0x01}, HashSize), Size: 5}
+
+	ab, err := CombineResults([]Result{a, b}, false)
+	if err != nil {
+		t.Fatalf("CombineResults() error = %v", err)
+	}
+	ba, err := CombineResults([]Result{b, a}, false)
+	if err != nil {
+		t.Fatalf("CombineResults() error = %v", err)
+	}
+	if equal(ab.Hash, ba.Hash) {
+		t.Error("Ordered combination should depend on order")
+	}
+	if ab.Size != 15 {
+		t.Errorf("Combined size = %d, want 15", ab.Size)
+	}
+
+	unorderedAB, err := CombineResults([]Result{a, b}, true)
+	if err != nil {
+		t.Fatalf("CombineResults() error = %v", err)
+	}
+	unorderedBA, err := CombineResults([]Result{b, a}, true)
+	if err != nil {
+		t.Fatalf("CombineResults() error = %v", err)
+	}
+	if !equal(unorderedAB.Hash, unorderedBA.Hash) || !equal(unorderedAB.Hash, ba.Hash) {
+		t.Error("Unordered combination should equal the ordered combination of sorted hashes")
+	}
+
+	// Combining the subdirectories of a directory reproduces the directory hash
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 1, 2, 2)
+	for _, name := range []string{"file0.txt", "file1.txt"} {
+		if err := os.Remove(filepath.Join(tmpDir, name)); err != nil {
+			t.Fatalf("Failed to remove %s: %v", name, err)
+		}
+	}
+	dir, err := NewEngine().HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	var entries []Result
+	for _, name := range []string{"d0", "d1"} {
+		result, err := NewEngine().HashPath(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		entries = append(entries, result)
+	}
+	combined, err := CombineResults(entries, false)
+	if err != nil {
+		t.Fatalf("CombineResults() error = %v", err)
+	}
+	if !equal(combined.Hash, dir.Hash) {
+		t.Errorf("Combined entries = %x, want directory hash %x", combined.Hash, dir.Hash)
+	}
+}
+
+func TestCombineNamed(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 2, 3, 2)
+	whole, err := NewEngine().HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	// Hash every top-level entry separately, as distributed workers would, and list them
+	// out of order: the coordinator's combination must still equal the whole tree's root
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	var named []NamedResult
+	for _, entry := range slices.Backward(entries) {
+		result, err := NewEngine().HashPath(filepath.Join(tmpDir, entry.Name()))
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		nodeType := NodeFile
+		if entry.IsDir() {
+			nodeType = NodeDir
+		}
+		named = append(named, NamedResult{Name: entry.Name(), Type: nodeType, Result: result})
+	}
+	combined, err := CombineNamed(named)
+	if err != nil {
+		t.Fatalf("CombineNamed() error = %v", err)
+	}
+	if !equal(combined.Hash, whole.Hash) || combined.Size != whole.Size {
+		t.Errorf("CombineNamed() = %x (size %d), want %x (size %d)", combined.Hash, combined.Size, whole.Hash, whole.Size)
+	}
+
+	empty, err := CombineNamed(nil)
+	if err != nil {
+		t.Fatalf("CombineNamed(nil) error = %v", err)
+	}
+	if emptyDir, err := HashPath(t.TempDir()); err != nil || !equal(empty.Hash, emptyDir.Hash) {
+		t.Errorf("CombineNamed(nil) = %x, want the empty directory hash", empty.Hash)
+	}
+
+	for name, bad := range map[string][]NamedResult{
+		"duplicate": {named[0], named[0]},
+		"unnamed":   {{Type: NodeFile, Result: named[0].Result}},
+		"untyped":   {{Name: named[0].Name, Result: named[0].Result}},
+	} {
+		if _, err := CombineNamed(bad); err == nil {
+			t.Errorf("CombineNamed(%s) error = nil, want an error", name)
+		}
+	}
+}
+
+func TestEngine_BuildManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 2, 2, 2)
+	if err := os.Symlink("file0.txt", filepath.Join(tmpDir, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	manifest, err := NewEngine().BuildManifest(tmpDir)
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+	root, err := NewEngine().HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if manifest.Root != fmt.Sprintf("%x", root.Hash) || manifest.Size != root.Size {
+		t.Errorf("Manifest root = %s (size %d), want %x (size %d)", manifest.Root, manifest.Size, root.Hash, root.Size)
+	}
+	// 2 files per directory in 7 directories, plus the symlink
+	if len(manifest.Entries) != 15 {
+		t.Fatalf("Manifest has %d entries, want 15", len(manifest.Entries))
+	}
+	for i, entry := range manifest.Entries {
+		if i > 0 && manifest.Entries[i-1].Path >= entry.Path {
+			t.Errorf("Entries are not sorted: %q before %q", manifest.Entries[i-1].Path, entry.Path)
+		}
+		if entry.Path == "link" && entry.Type != EntrySymlink {
+			t.Errorf("Symlink entry type = %q, want %q", entry.Type, EntrySymlink)
+		}
+	}
+
+	file, err := NewEngine().HashPath(filepath.Join(tmpDir, "d1", "d0", "file1.txt"))
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	found := false
+	for _, entry := range manifest.Entries {
+		if entry.Path == "d1/d0/file1.txt" {
+			found = true
+			if entry.Hash != fmt.Sprintf("%x", file.Hash) || entry.Type != EntryFile {
+				t.Errorf("Entry %q = %+v, want file hash %x", entry.Path, entry, file.Hash)
+			}
+		}
+	}
+	if !found {
+		t.Error("Manifest is missing d1/d0/file1.txt")
+	}
+}
+
+func TestManifest_EncodeFormats(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 1, 2, 2)
+	// Names that need quoting in YAML and TOML
+	for _, name := range []string{"123", "key: value.txt", "say \"hi\".txt", "#hash", "tab\there"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	engine := NewEngine()
+	engine.SetAlgorithm(AlgorithmSHA256)
+	manifest, err := engine.BuildManifest(tmpDir)
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+
+	empty := &Manifest{Version: ManifestVersion, Root: "00"}
+	hashed := &Manifest{Version: ManifestVersion, Root: "00", HashedNames: true}
+	tests := []struct {
+		name   string
+		format ManifestFormat
+		want   *Manifest
+		data   []byte
+	}{
+		{name: "yaml", format: ManifestYAML, want: manifest, data: manifest.EncodeYAML()},
+		{name: "toml", format: ManifestTOML, want: manifest, data: manifest.EncodeTOML()},
+		{name: "empty yaml", format: ManifestYAML, want: empty, data: empty.EncodeYAML()},
+		{name: "empty toml", format: ManifestTOML, want: empty, data: empty.EncodeTOML()},
+		{name: "hashed names toml", format: ManifestTOML, want: hashed, data: hashed.EncodeTOML()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectManifestFormat(tt.data); got != tt.format {
+				t.Errorf("DetectManifestFormat() = %q, want %q", got, tt.format)
+			}
+			parsed, err := ParseManifest(tt.data, tt.format)
+			if err != nil {
+				t.Fatalf("ParseManifest() error = %v\n%s", err, tt.data)
+			}
+			// The same fields must survive, so the fingerprint is unchanged
+			got, err := parsed.Fingerprint()
+			if err != nil {
+				t.Fatalf("Fingerprint() error = %v", err)
+			}
+			wantFingerprint, err := tt.want.Fingerprint()
+			if err != nil {
+				t.Fatalf("Fingerprint() error = %v", err)
+			}
+			if got != wantFingerprint {
+				t.Errorf("Round-tripped manifest differs:\n%s", tt.data)
+			}
+		})
+	}
+
+	parsed, err := ParseManifest(manifest.EncodeYAML(), ManifestYAML)
+	if err != nil {
+		t.Fatalf("ParseManifest() error = %v", err)
+	}
+	verifier := NewEngine()
+	verifier.SetAlgorithm(AlgorithmSHA256)
+	report, err := verifier.VerifyManifest(parsed, tmpDir, 1, 0)
+	if err != nil {
+		t.Fatalf("VerifyManifest() error = %v", err)
+	}
+	if len(report.Failures) != 0 || len(report.Checked) != len(manifest.Entries) {
+		t.Errorf("VerifyManifest() of the YAML manifest checked %d entries with failures %v", len(report.Checked), report.Failures)
+	}
+
+	if _, err := ParseManifest([]byte("version: 1\nroot: unquoted\n"), ManifestYAML); err == nil {
+		t.Error("ParseManifest() should reject unquoted strings")
+	}
+	if _, err := ParseManifestFormat("xml"); err == nil {
+		t.Error("ParseManifestFormat(\"xml\") should fail")
+	}
+}
+
+func TestManifest_HashNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"secret/plans.txt", "secret/notes.txt", "public/readme.txt"} {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	build := func() *Manifest {
+		manifest, err := NewEngine().BuildManifest(tmpDir)
+		if err != nil {
+			t.Fatalf("BuildManifest() error = %v", err)
+		}
+		return manifest
+	}
+	hashesOf := func(m *Manifest) []string {
+		var hashes []string
+		for _, entry := range m.Entries {
+			hashes = append(hashes, entry.Hash)
+		}
+		sort.Strings(hashes)
+		return hashes
+	}
+	original := build()
+
+	t.Run("all names", func(t *testing.T) {
+		manifest := build()
+		if err := manifest.HashNames(0); err != nil {
+			t.Fatalf("HashNames() error = %v", err)
+		}
+		dirs := make(map[string]bool)
+		for _, entry := range manifest.Entries {
+			for _, name := range []string{"secret", "public", "plans", "notes", "readme"} {
+				if strings.Contains(entry.Path, name) {
+					t.Errorf("Path %q reveals %q", entry.Path, name)
+				}
+			}
+			dir, _, _ := strings.Cut(entry.Path, "/")
+			dirs[dir] = true
+		}
+		// Both files of the same directory keep sharing their first component
+		if len(dirs) != 2 {
+			t.Errorf("Hashed paths have %d top-level components, want 2: %v", len(dirs), manifest.Entries)
+		}
+		if !slices.Equal(hashesOf(manifest), hashesOf(original)) || manifest.Root != original.Root || manifest.Size != original.Size {
+			t.Error("HashNames() changed content hashes, root or size")
+		}
+		if !manifest.HashedNames {
+			t.Error("HashNames() should mark the manifest")
+		}
+		if _, err := NewEngine().VerifyManifest(manifest, tmpDir, 1, 0); err == nil {
+			t.Error("VerifyManifest() should refuse a manifest with hashed names")
+		}
+
+		again := build()
+		if err := again.HashNames(0); err != nil {
+			t.Fatalf("HashNames() error = %v", err)
+		}
+		first, _ := manifest.Fingerprint()
+		second, _ := again.Fingerprint()
+		if first != second {
+			t.Error("Hashing the names of the same tree twice gave different manifests")
+		}
+	})
+
+	t.Run("below depth", func(t *testing.T) {
+		manifest := build()
+		if err := manifest.HashNames(1); err != nil {
+			t.Fatalf("HashNames() error = %v", err)
+		}
+		for _, entry := range manifest.Entries {
+			dir, name, _ := strings.Cut(entry.Path, "/")
+			if dir != "secret" && dir != "public" {
+				t.Errorf("Path %q should keep its first component", entry.Path)
+			}
+			if strings.HasSuffix(name, ".txt") {
+				t.Errorf("Path %q should hash the file name", entry.Path)
+			}
+		}
+	})
+
+	if err := build().HashNames(-1); err == nil {
+		t.Error("HashNames(-1) expected error")
+	}
+}
+
+func TestManifest_Shard(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 2, 3, 3)
+	manifest, err := NewEngine().BuildManifest(tmpDir)
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+
+	index, shards, err := manifest.Shard(1, "json")
+	if err != nil {
+		t.Fatalf("Shard() error = %v", err)
+	}
+	if index.Entries != len(manifest.Entries) || index.Root != manifest.Root || len(index.Shards) != len(shards) {
+		t.Fatalf("Shard() index = %+v, want %d entries of root %s in %d shards", index, len(manifest.Entries), manifest.Root, len(shards))
+	}
+	if len(shards) < 2 {
+		t.Errorf("Shard() made %d shards of %d entries, want entries spread over several", len(shards), len(manifest.Entries))
+	}
+	for _, s := range index.Shards {
+		if len(s.Prefix) != 1 || s.File != s.Prefix+".json" || s.Entries != len(shards[s.Prefix].Entries) {
+			t.Errorf("Shard() index shard = %+v, want a 1-digit prefix, its file and entry count", s)
+		}
+	}
+
+	// Reassembling the shards covers every entry exactly once
+	assembled, err := AssembleShards(index, shards)
+	if err != nil {
+		t.Fatalf("AssembleShards() error = %v", err)
+	}
+	if !slices.Equal(assembled.Entries, manifest.Entries) || assembled.Root != manifest.Root || assembled.Size != manifest.Size {
+		t.Errorf("AssembleShards() = %+v, want the original manifest", assembled)
+	}
+
+	// Tampered shards are rejected
+	first, second := index.Shards[0].Prefix, index.Shards[1].Prefix
+	for name, tamper := range map[string]func(map[string]*Manifest){
+		"missing shard": func(s map[string]*Manifest) { delete(s, first) },
+		"moved entry": func(s map[string]*Manifest) {
+			s[second].Entries = append(s[second].Entries, s[first].Entries[0])
+			s[first].Entries = s[first].Entries[1:]
+		},
+		"other tree": func(s map[string]*Manifest) { s[first].Root = strings.Repeat("0", len(manifest.Root)) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, shards, err := manifest.Shard(1, "json")
+			if err != nil {
+				t.Fatalf("Shard() error = %v", err)
+			}
+			tamper(shards)
+			if _, err := AssembleShards(index, shards); err == nil {
+				t.Error("AssembleShards() error = nil, want an error")
+			}
+		})
+	}
+
+	for _, shardBy := range []int{0, MaxShardBy + 1} {
+		if _, _, err := manifest.Shard(shardBy, "json"); err == nil {
+			t.Errorf("Shard(%d) error = nil, want an error", shardBy)
+		}
+	}
+}
+
+func TestCompareManifests(t *testing.T) {
+	a := &Manifest{Version: ManifestVersion, Root: "aa", Size: 3, Entries: []ManifestEntry{
+		{Path: "kept.txt", Type: EntryFile, Hash: "01", Size: 1},
+		{Path: "new.txt", Type: EntryFile, Hash: "02", Size: 1},
+		{Path: "type.txt", Type: EntrySymlink, Hash: "03", Size: 0},
+	}}
+	b := &Manifest{Version: ManifestVersion, Root: "bb", Size: 3, Entries: []ManifestEntry{
+		{Path: "kept.txt", Type: EntryFile, Hash: "01", Size: 1},
+		{Path: "old.txt", Type: EntryFile, Hash: "04", Size: 1},
+		{Path: "type.txt", Type: EntryFile, Hash: "03", Size: 1},
+	}}
+
+	diff, err := CompareManifests(a, b)
+	if err != nil {
+		t.Fatalf("CompareManifests() error = %v", err)
+	}
+	want := []string{
+		"Root mismatch:\nA: aa (size: 3)\nB: bb (size: 3)",
+		"added: new.txt",
+		"deleted: old.txt",
+		"modified: type.txt",
+	}
+	if !slices.Equal(diff, want) {
+		t.Errorf("CompareManifests() = %q, want %q", diff, want)
+	}
+
+	diff, err = CompareManifests(a, a)
+	if err != nil {
+		t.Fatalf("CompareManifests() error = %v", err)
+	}
+	if !slices.Equal(diff, []string{noDifferencesMsg}) {
+		t.Errorf("CompareManifests() of identical manifests = %q, want no differences", diff)
+	}
+
+	sha := *b
+	sha.Algorithm = string(AlgorithmSHA256)
+	if _, err := CompareManifests(a, &sha); err == nil {
+		t.Error("CompareManifests() expected error for different algorithms")
+	}
+	hashed := *b
+	hashed.HashedNames = true
+	if _, err := CompareManifests(a, &hashed); err == nil {
+		t.Error("CompareManifests() expected error when only one manifest has hashed names")
+	}
+}
+
+func TestEngine_VerifyManifestSample(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 2, 3, 4)
+
+	manifest, err := NewEngine().BuildManifest(tmpDir)
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+
+	full, err := NewEngine().VerifyManifest(manifest, tmpDir, 1, 0)
+	if err != nil {
+		t.Fatalf("VerifyManifest() error = %v", err)
+	}
+	if len(full.Checked) != len(manifest.Entries) || len(full.Failures) != 0 {
+		t.Fatalf("Full verification checked %d of %d entries with failures %v", len(full.Checked), len(manifest.Entries), full.Failures)
+	}
+
+	first, err := NewEngine().VerifyManifest(manifest, tmpDir, 0.1, 42)
+	if err != nil {
+		t.Fatalf("VerifyManifest() error = %v", err)
+	}
+	second, err := NewEngine().VerifyManifest(manifest, tmpDir, 0.1, 42)
+	if err != nil {
+		t.Fatalf("VerifyManifest() error = %v", err)
+	}
+	want := (len(manifest.Entries) + 9) / 10
+	if len(first.Checked) != want {
+		t.Errorf("Sample checked %d entries, want %d", len(first.Checked), want)
+	}
+	if strings.Join(first.Checked, ",") != strings.Join(second.Checked, ",") {
+		t.Errorf("Same seed selected different samples: %v vs %v", first.Checked, second.Checked)
+	}
+
+	// Corrupt a sampled file: the same seed must detect it
+	corrupted := first.Checked[0]
+	if err := os.WriteFile(filepath.Join(tmpDir, filepath.FromSlash(corrupted)), []byte("corrupted"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt file: %v", err)
+	}
+	report, err := NewEngine().VerifyManifest(manifest, tmpDir, 0.1, 42)
+	if err != nil {
+		t.Fatalf("VerifyManifest() error = %v", err)
+	}
+	if len(report.Failures) != 1 || report.Failures[0] != "modified: "+corrupted {
+		t.Errorf("Failures = %v, want [modified: %s]", report.Failures, corrupted)
+	}
+
+	// A missing file is reported as such
+	if err := os.Remove(filepath.Join(tmpDir, filepath.FromSlash(corrupted))); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	report, err = NewEngine().VerifyManifest(manifest, tmpDir, 0.1, 42)
+	if err != nil {
+		t.Fatalf("VerifyManifest() error = %v", err)
+	}
+	if len(report.Failures) != 1 || report.Failures[0] != "missing: "+corrupted {
+		t.Errorf("Failures = %v, want [missing: %s]", report.Failures, corrupted)
+	}
+
+	for _, sample := range []float64{0, -0.5, 1.5} {
+		if _, err := NewEngine().VerifyManifest(manifest, tmpDir, sample, 1); err == nil {
+			t.Errorf("VerifyManifest() with sample %v expected error", sample)
+		}
+	}
+}
+
+func TestEngine_ByteBudget(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("0123456789"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	full, err := NewEngine().HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	content, err := NewEngine().HashPath(filepath.Join(tmpDir, "a.txt"))
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	for _, adaptive := range []bool{false, true} {
+		for run := 0; run < 3; run++ {
+			engine := NewEngineWithWorkers(4)
+			engine.SetAdaptiveScheduling(adaptive)
+			// a.txt and b.txt fit in the budget; c.txt and d.txt are read after it is used up
+			engine.SetByteBudget(15)
+			var children []childResult
+			engine.onDir = func(path string, c []childResult) { children = c }
+
+			result, err := engine.HashPath(tmpDir)
+			if err != nil {
+				t.Fatalf("HashPath() with byte budget error = %v", err)
+			}
+			if len(children) != 4 {
+				t.Fatalf("Expected 4 entries, got %d", len(children))
+			}
+			for i, child := range children {
+				want := content.Hash
+				if i >= 2 {
+					want = NewEngine().metadataResult(child.name, 10).Hash
+				}
+				if !equal(child.result.Hash, want) {
+					t.Errorf("adaptive=%v run=%d: %s hash %x, want %x", adaptive, run, child.name, child.result.Hash, want)
+				}
+			}
+			if equal(result.Hash, full.Hash) {
+				t.Error("HashPath() exceeding the byte budget should change the root")
+			}
+			if result.Size != full.Size {
+				t.Errorf("HashPath() size = %d, want %d", result.Size, full.Size)
+			}
+		}
+	}
+
+	engine := NewEngine()
+	engine.SetByteBudget(1 << 20)
+	result, err := engine.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !equal(result.Hash, full.Hash) {
+		t.Error("HashPath() within the byte budget should not change the root")
+	}
+}
+
+func TestEngine_HasherCmd(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	tmpDir := t.TempDir()
+	// With "cat" as the hasher, a file containing hex digits hashes to those bytes
+	if err := os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("cafe\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "b.txt"), []byte("00ff -\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	engine := NewEngine()
+	engine.SetHasherCmd("cat")
+	file, err := engine.HashPath(filepath.Join(tmpDir, "a.txt"))
+	if err != nil {
+		t.Fatalf("HashPath() with hasher command error = %v", err)
+	}
+	if !equal(file.Hash, []byte{0xca, 0xfe}) {
+		t.Errorf("HashPath() file hash = %x, want cafe", file.Hash)
+	}
+
+	engine = NewEngine()
+	engine.SetHasherCmd("cat")
+	root, err := engine.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() with hasher command error = %v", err)
+	}
+	want := blake3.Sum256([]byte{byte(NodeFile), 0xca, 0xfe, byte(NodeFile), 0x00, 0xff})
+	if !equal(root.Hash, want[:]) {
+		t.Errorf("HashPath() root = %x, want %x", root.Hash, want)
+	}
+	if root.Size != 12 {
+		t.Errorf("HashPath() size = %d, want 12", root.Size)
+	}
+
+	for _, command := range []string{"cat >/dev/null; exit 1", "cat >/dev/null; echo not-hex", "cat >/dev/null"} {
+		engine.SetHasherCmd(command)
+		if _, err := engine.HashPath(tmpDir); err == nil {
+			t.Errorf("HashPath() with hasher %q expected error", command)
+		}
+	}
+}
+
+func TestEngine_Shallow(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 2, 2, 2)
+
+	deep, err := NewEngine().HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	shallowEngine := func() *Engine {
+		engine := NewEngine()
+		engine.SetRecursive(false)
+		return engine
+	}
+	shallow, err := shallowEngine().HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() shallow error = %v", err)
+	}
+	if equal(shallow.Hash, deep.Hash) {
+		t.Error("Shallow hash should differ from the deep hash of a nested tree")
+	}
+
+	// Top-level files contribute their contents, subdirectories only their names
+	file0, err := NewEngine().HashPath(filepath.Join(tmpDir, "file0.txt"))
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	file1, err := NewEngine().HashPath(filepath.Join(tmpDir, "file1.txt"))
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	d0 := blake3.Sum256([]byte(shallowDirTag + "d0"))
+	d1 := blake3.Sum256([]byte(shallowDirTag + "d1"))
+	var concat []byte
+	for _, entry := range []struct {
+		nodeType NodeType
+		hash     []byte
+	}{{NodeDir, d0[:]}, {NodeDir, d1[:]}, {NodeFile, file0.Hash}, {NodeFile, file1.Hash}} {
+		concat = append(append(concat, byte(entry.nodeType)), entry.hash...)
+	}
+	want := blake3.Sum256(concat)
+	if !equal(shallow.Hash, want[:]) {
+		t.Errorf("Shallow hash = %x, want %x", shallow.Hash, want)
+	}
+	if shallow.Size != file0.Size+file1.Size {
+		t.Errorf("Shallow size = %d, want %d", shallow.Size, file0.Size+file1.Size)
+	}
+	size, err := shallowEngine().SizePath(tmpDir)
+	if err != nil {
+		t.Fatalf("SizePath() shallow error = %v", err)
+	}
+	if size != shallow.Size {
+		t.Errorf("SizePath() shallow = %d, want %d", size, shallow.Size)
+	}
+
+	// Changes below the top level do not affect the shallow hash
+	if err := os.WriteFile(filepath.Join(tmpDir, "d0", "file0.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	again, err := shallowEngine().HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() shallow error = %v", err)
+	}
+	if !equal(again.Hash, shallow.Hash) {
+		t.Error("Shallow hash should not change when a nested file changes")
+	}
+	if err := os.Mkdir(filepath.Join(tmpDir, "d2"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	again, err = shallowEngine().HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() shallow error = %v", err)
+	}
+	if equal(again.Hash, shallow.Hash) {
+		t.Error("Shallow hash should change when a top-level directory is added")
+	}
+
+	// A subdirectory's leaf never matches a file holding its name, with or without the tag
+	withDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(withDir, "foo"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	dirRoot, err := shallowEngine().HashPath(withDir)
+	if err != nil {
+		t.Fatalf("HashPath() shallow error = %v", err)
+	}
+	for _, content := range []string{"foo", shallowDirTag + "foo"} {
+		withFile := t.TempDir()
+		if err := os.WriteFile(filepath.Join(withFile, "foo"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		for name, hash := range map[string]func() (Result, error){
+			"HashPath": func() (Result, error) { return shallowEngine().HashPath(withFile) },
+			"HashFS":   func() (Result, error) { return shallowEngine().HashFS(os.DirFS(withFile), ".") },
+		} {
+			fileRoot, err := hash()
+			if err != nil {
+				t.Fatalf("%s() shallow error = %v", name, err)
+			}
+			if equal(fileRoot.Hash, dirRoot.Hash) {
+				t.Errorf("%s() of a file foo holding %q matches the shallow hash of a subdirectory foo", name, content)
+			}
+		}
+	}
+}
+
+func TestEngine_ResolveRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	target := filepath.Join(tmpDir, "target")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	createDeepTree(t, target, 1, 2, 2)
+	link := filepath.Join(tmpDir, "link")
+	if err := os.Symlink("target", link); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	direct, err := NewEngine().HashPath(target)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	// Without resolution the root symlink is a leaf
+	leaf, err := NewEngine().HashPath(link)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if leaf.Size != 0 {
+		t.Errorf("HashPath() unresolved symlink root size = %d, want 0", leaf.Size)
+	}
+
+	// With exclusions anchored at the link, as the CLI creates engines
+	engine, err := NewEngineWithExclusions(0, []string{"file1.txt"}, link, false, "")
+	if err != nil {
+		t.Fatalf("NewEngineWithExclusions() error = %v", err)
+	}
+	engine.SetResolveRoot(true)
+	resolved, err := engine.HashPath(link)
+	if err != nil {
+		t.Fatalf("HashPath() with resolved root error = %v", err)
+	}
+	if resolved.Size == 0 {
+		t.Error("HashPath() with resolved root should have a non-zero size")
+	}
+	excluded, err := NewEngineWithExclusions(0, []string{"file1.txt"}, target, false, "")
+	if err != nil {
+		t.Fatalf("NewEngineWithExclusions() error = %v", err)
+	}
+	want, err := excluded.HashPath(target)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !equal(resolved.Hash, want.Hash) || resolved.Size != want.Size {
+		t.Errorf("HashPath() resolved root = %x (%d bytes), want %x (%d bytes)", resolved.Hash, resolved.Size, want.Hash, want.Size)
+	}
+	if equal(resolved.Hash, direct.Hash) {
+		t.Error("Exclusions should apply to the resolved tree")
+	}
+
+	engine = NewEngine()
+	engine.SetResolveRoot(true)
+	size, err := engine.SizePath(link)
+	if err != nil {
+		t.Fatalf("SizePath() with resolved root error = %v", err)
+	}
+	if size != direct.Size {
+		t.Errorf("SizePath() resolved root = %d, want %d", size, direct.Size)
+	}
+
+	engine = NewEngine()
+	engine.SetResolveRoot(true)
+	proof, err := engine.Prove(link, filepath.Join(link, "d0", "file0.txt"))
+	if err != nil {
+		t.Fatalf("Prove() with resolved root error = %v", err)
+	}
+	if proof.Root != hex.EncodeToString(direct.Hash) {
+		t.Errorf("Prove() root = %s, want %x", proof.Root, direct.Hash)
+	}
+}
+
+func TestEngine_StructureOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 2, 2, 2)
+	if err := os.Mkdir(filepath.Join(tmpDir, "empty"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	hash := func() Result {
+		t.Helper()
+		engine := NewEngine()
+		engine.SetStructureOnly(true)
+		result, err := engine.HashPath(tmpDir)
+		if err != nil {
+			t.Fatalf("HashPath() structure only error = %v", err)
+		}
+		return result
+	}
+	original := hash()
+
+	content, err := NewEngine().HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if equal(original.Hash, content.Hash) {
+		t.Error("Structure-only hash should differ from the content hash")
+	}
+	if original.Size != content.Size {
+		t.Errorf("Structure-only size = %d, want %d", original.Size, content.Size)
+	}
+
+	// Editing contents keeps the structure
+	if err := os.WriteFile(filepath.Join(tmpDir, "d0", "d1", "file0.txt"), []byte("edited content"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	if got := hash(); !equal(got.Hash, original.Hash) {
+		t.Error("Structure-only hash should not change when a file's content changes")
+	}
+
+	// Renaming a file, renaming an empty directory or adding a file changes it
+	steps := []struct {
+		name   string
+		change func() error
+	}{
+		{name: "rename file", change: func() error {
+			return os.Rename(filepath.Join(tmpDir, "d1", "file1.txt"), filepath.Join(tmpDir, "d1", "renamed.txt"))
+		}},
+		{name: "rename empty directory", change: func() error {
+			return os.Rename(filepath.Join(tmpDir, "empty"), filepath.Join(tmpDir, "vacant"))
+		}},
+		{name: "add file", change: func() error {
+			return os.WriteFile(filepath.Join(tmpDir, "d0", "new.txt"), nil, 0644)
+		}},
+	}
+	previous := original.Hash
+	for _, step := range steps {
+		if err := step.change(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		got := hash()
+		if equal(got.Hash, previous) {
+			t.Errorf("Structure-only hash should change after %s", step.name)
+		}
+		previous = got.Hash
+	}
+}
+
+func TestEngine_ExcludeEmptyFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 1, 2, 2)
+	if err := os.Mkdir(filepath.Join(tmpDir, "logs"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	hash := func(exclude bool) []byte {
+		t.Helper()
+		engine := NewEngine()
+		engine.SetExcludeEmptyFiles(exclude)
+		result, err := engine.HashPath(tmpDir)
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		return result.Hash
+	}
+	withoutPlaceholders := hash(true)
+
+	for _, keep := range []string{filepath.Join(tmpDir, ".gitkeep"), filepath.Join(tmpDir, "logs", ".gitkeep")} {
+		if err := os.WriteFile(keep, nil, 0644); err != nil {
+			t.Fatalf("Failed to create placeholder: %v", err)
+		}
+	}
+
+	if !equal(hash(true), withoutPlaceholders) {
+		t.Error("Empty files should not affect the hash with --exclude-empty-files")
+	}
+	if equal(hash(false), withoutPlaceholders) {
+		t.Error("Empty files should affect the hash by default")
+	}
+}
+
+func TestEngine_ExcludeSize(t *testing.T) {
+	tmpDir := t.TempDir()
+	createDeepTree(t, tmpDir, 1, 2, 2)
+
+	hash := func(configure func(e *Engine)) []byte {
+		t.Helper()
+		engine := NewEngine()
+		configure(engine)
+		result, err := engine.HashPath(tmpDir)
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		return result.Hash
+	}
+	rule, err := ignore.ParseSizeRule(">1K")
+	if err != nil {
+		t.Fatalf("ParseSizeRule() error = %v", err)
+	}
+	withRule := func(e *Engine) { e.SetExcludeSize([]ignore.SizeRule{rule}) }
+	withoutLarge := hash(withRule)
+
+	large := bytes.Repeat([]byte("x"), 4096)
+	if err := os.WriteFile(filepath.Join(tmpDir, "large.bin"), large, 0644); err != nil {
+		t.Fatalf("Failed to create large file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "d0", "large.bin"), large, 0644); err != nil {
+		t.Fatalf("Failed to create large file: %v", err)
+	}
+
+	if !equal(hash(withRule), withoutLarge) {
+		t.Error("Files over the threshold should not affect the hash with --exclude-size")
+	}
+	if equal(hash(func(*Engine) {}), withoutLarge) {
+		t.Error("Large files should affect the hash by default")
+	}
+
+	// The same rule given as an exclusion pattern, as in an ignore file
+	engine, err := NewEngineWithExclusions(DefaultMaxWorkers, []string{"@size >1K"}, tmpDir, false, "")
+	if err != nil {
+		t.Fatalf("NewEngineWithExclusions() error = %v", err)
+	}
+	result, err := engine.HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !equal(result.Hash, withoutLarge) {
+		t.Error("An \"@size >1K\" pattern should exclude the same files as --exclude-size '>1K'")
+	}
+
+	size, err := engine.SizePath(tmpDir)
+	if err != nil {
+		t.Fatalf("SizePath() error = %v", err)
+	}
+	want, err := NewEngine().SizePath(tmpDir)
+	if err != nil {
+		t.Fatalf("SizePath() error = %v", err)
+	}
+	if size != want-2*int64(len(large)) {
+		t.Errorf("SizePath() = %d, want %d without the large files", size, want-2*int64(len(large)))
+	}
+}
+
+func TestEngine_Algorithm(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sub", "b.txt"), []byte("world\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Documented roots of this tree (see docs/usage.md, Hash Algorithm)
+	tests := []struct {
+		algorithm Algorithm
+		want      string
+	}{
+		{AlgorithmSHA3_256, "d4e6ea32e628cdfa9eee1d107ec33abde8daaa80eff45c218d38381c61e02243"},
+		{AlgorithmSHA3_512, "cd16f531bf17d3bc45c3ed29132c006b8211d1eb4c845c85475370f3c5aff1d8f42ded14c135e4d4339ca6b4840b9eaf4f3f7fe08934d9f666cb39dcf6d49fbf"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			for run := 0; run < 3; run++ {
+				engine := NewEngine()
+				engine.SetAlgorithm(tt.algorithm)
+				result, err := engine.HashPath(root)
+				if err != nil {
+					t.Fatalf("HashPath() error = %v", err)
+				}
+				if len(result.Hash) != tt.algorithm.Size() {
+					t.Fatalf("hash length = %d, want %d", len(result.Hash), tt.algorithm.Size())
+				}
+				if got := hex.EncodeToString(result.Hash); got != tt.want {
+					t.Errorf("run %d: root = %s, want %s", run, got, tt.want)
+				}
+			}
+		})
+	}
+
+	// The root is the algorithm's hash over the same Merkle structure
+	leaf := func(data string) []byte {
+		h := AlgorithmSHA3_256.New()
+		_, _ = h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	sub := leaf("f" + string(leaf("world\n")))
+	want := leaf("f" + string(leaf("hello\n")) + "d" + string(sub))
+	if hex.EncodeToString(want) != tests[0].want {
+		t.Errorf("documented SHA3-256 root does not match the Merkle structure")
+	}
+
+	// A different algorithm changes the root
+	blake, err := NewEngine().HashPath(root)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if hex.EncodeToString(blake.Hash) == tests[0].want {
+		t.Error("BLAKE3 and SHA3-256 roots should differ")
+	}
+}
+
+func TestEngine_AlgorithmProof(t *testing.T) {
+	root := t.TempDir()
+	createDeepTree(t, root, 2, 2, 2)
+
+	engine := NewEngine()
+	engine.SetAlgorithm(AlgorithmSHA3_512)
+	proof, err := engine.Prove(root, filepath.Join(root, "d0", "file1.txt"))
+	if err != nil {
+		t.Fatalf("Prove() error = %v", err)
+	}
+	if proof.Algorithm != string(AlgorithmSHA3_512) {
+		t.Errorf("proof algorithm = %q, want %q", proof.Algorithm, AlgorithmSHA3_512)
+	}
+	if err := VerifyProof(proof); err != nil {
+		t.Errorf("VerifyProof() error = %v", err)
+	}
+
+	// Verifying with the wrong algorithm fails
+	proof.Algorithm = ""
+	if err := VerifyProof(proof); err == nil {
+		t.Error("VerifyProof() should fail when the algorithm is dropped")
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Algorithm
+		wantErr bool
+	}{
+		{input: "", want: AlgorithmBLAKE3},
+		{input: "blake3", want: AlgorithmBLAKE3},
+		{input: "SHA3-256", want: AlgorithmSHA3_256},
+		{input: "sha3-512", want: AlgorithmSHA3_512},
+		{input: "sha256", want: AlgorithmSHA256},
+		{input: "md5", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAlgorithm(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseAlgorithm(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseAlgorithm(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestEngine_CaseCollisions(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"File.txt", "file.txt", "other.txt"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	if entries, err := os.ReadDir(root); err != nil || len(entries) != 3 {
+		t.Skip("filesystem is case-insensitive")
+	}
+
+	var logs bytes.Buffer
+	logger.Init("warn", "text", &logs)
+	t.Cleanup(func() { logger.Init("error", "text", io.Discard) })
+
+	// By default the collision is hashed and logged as a warning
+	if _, err := NewEngine().HashPath(root); err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !strings.Contains(logs.String(), "differ only by case") || !strings.Contains(logs.String(), "File.txt") {
+		t.Errorf("Expected a case collision warning, got %q", logs.String())
+	}
+
+	// Strict mode refuses to hash it
+	engine := NewEngine()
+	engine.SetStrictCase(true)
+	_, err := engine.HashPath(root)
+	if err == nil || !strings.Contains(err.Error(), "differ only by case") {
+		t.Errorf("HashPath() error = %v, want case collision error", err)
+	}
+
+	// Excluding one of the colliding entries resolves it
+	engine, err = NewEngineWithExclusions(0, []string{"File.txt"}, root, false, "")
+	if err != nil {
+		t.Fatalf("NewEngineWithExclusions() error = %v", err)
+	}
+	engine.SetStrictCase(true)
+	if _, err := engine.HashPath(root); err != nil {
+		t.Errorf("HashPath() with an excluded collision error = %v", err)
+	}
+}
+
+func TestEngine_BufferStats(t *testing.T) {
+	root := t.TempDir()
+	const files = 50
+	for i := 0; i < files; i++ {
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("file%d.txt", i)), []byte("content"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	engine := NewEngine()
+	if stats := engine.BufferStats(); stats.Allocated != 0 || stats.Reused != 0 {
+		t.Fatalf("BufferStats() before hashing = %+v, want zero", stats)
+	}
+	if _, err := engine.HashPath(root); err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	stats := engine.BufferStats()
+	if stats.Allocated < 1 {
+		t.Errorf("BufferStats().Allocated = %d, want at least 1", stats.Allocated)
+	}
+	if stats.Reused < 1 {
+		t.Errorf("BufferStats().Reused = %d, want at least 1", stats.Reused)
+	}
+	if total := stats.Allocated + stats.Reused; total != files {
+		t.Errorf("BufferStats() accounts for %d buffer requests, want %d", total, files)
+	}
+}
+
+func TestEngine_Dockerignore(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".dockerignore":   "*.log\n!important.log\nvendor\n",
+		"app.go":          "package main",
+		"debug.log":       "noise",
+		"important.log":   "keep",
+		"sub/trace.log":   "nested logs are not matched by the anchored *.log",
+		"vendor/dep.go":   "package dep",
+		"sub/vendor/x.go": "package x",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	hash := func(t *testing.T, dockerignore bool) Result {
+		t.Helper()
+		engine, err := NewEngineWithExclusions(0, nil, root, false, "")
+		if err != nil {
+			t.Fatalf("NewEngineWithExclusions() error = %v", err)
+		}
+		if err := engine.SetDockerignore(dockerignore); err != nil {
+			t.Fatalf("SetDockerignore() error = %v", err)
+		}
+		result, err := engine.HashPath(root)
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		return result
+	}
+
+	got := hash(t, true)
+	if unfiltered := hash(t, false); equal(got.Hash, unfiltered.Hash) {
+		t.Error("SetDockerignore(true) should change the root")
+	}
+
+	// The .dockerignore excludes exactly the root-level debug.log and vendor directory
+	if err := os.Remove(filepath.Join(root, "debug.log")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(root, "vendor")); err != nil {
+		t.Fatal(err)
+	}
+	if want := hash(t, false); !equal(got.Hash, want.Hash) {
+		t.Errorf("SetDockerignore(true) root = %x, want %x", got.Hash, want.Hash)
+	}
+}
+
+func TestEngine_EstimatePath(t *testing.T) {
+	root := t.TempDir()
+	createDeepTree(t, root, 2, 2, 3)
+	if err := os.Mkdir(filepath.Join(root, "skip"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "skip", "big.bin"), make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := NewEngineWithExclusions(0, []string{"skip"}, root, false, "")
+	if err != nil {
+		t.Fatalf("NewEngineWithExclusions() error = %v", err)
+	}
+	size, err := engine.SizePath(root)
+	if err != nil {
+		t.Fatalf("SizePath() error = %v", err)
+	}
+
+	// Without a limit, the estimate covers every included file
+	est, err := engine.EstimatePath(root, 0)
+	if err != nil {
+		t.Fatalf("EstimatePath() error = %v", err)
+	}
+	if est.Bytes != size || est.Partial {
+		t.Errorf("EstimatePath() = %+v, want %d bytes and not partial", est, size)
+	}
+	if est.Files != 21 {
+		t.Errorf("EstimatePath().Files = %d, want 21", est.Files)
+	}
+
+	tests := []struct {
+		name        string
+		limit       int64
+		wantPartial bool
+	}{
+		{name: "below threshold", limit: size, wantPartial: false},
+		{name: "above threshold", limit: size - 1, wantPartial: true},
+		{name: "tiny threshold", limit: 1, wantPartial: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			est, err := engine.EstimatePath(root, tt.limit)
+			if err != nil {
+				t.Fatalf("EstimatePath() error = %v", err)
+			}
+			if est.Partial != tt.wantPartial {
+				t.Errorf("EstimatePath(%d).Partial = %v, want %v", tt.limit, est.Partial, tt.wantPartial)
+			}
+			if est.Partial && est.Bytes <= tt.limit {
+				t.Errorf("EstimatePath(%d) stopped at %d bytes, before exceeding the limit", tt.limit, est.Bytes)
+			}
+		})
+	}
+}
+
+func TestEngine_SetIgnoreFileName(t *testing.T) {
+	cwd := t.TempDir()
+	for name, content := range map[string]string{".mtcignore": "*.log\n", ".checksumignore": "build/\n"} {
+		if err := os.WriteFile(filepath.Join(cwd, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	t.Chdir(cwd)
+
+	root := t.TempDir()
+	for _, name := range []string{"main.go", "app.log", "build/out.bin"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	hash := func(configure func(e *Engine) error, patterns ...string) []byte {
+		t.Helper()
+		engine, err := NewEngineWithExclusions(0, patterns, root, configure != nil, "")
+		if err != nil {
+			t.Fatalf("NewEngineWithExclusions() error = %v", err)
+		}
+		if configure != nil {
+			if err := configure(engine); err != nil {
+				t.Fatalf("configure() error = %v", err)
+			}
+		}
+		result, err := engine.HashPath(root)
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		return result.Hash
+	}
+
+	// Each engine keeps its own name, whichever is configured last
+	named := func(e *Engine) error { return e.SetIgnoreFileName(".checksumignore") }
+	precedence := func(e *Engine) error { return e.SetIgnorePrecedence(ignore.DefaultPrecedence) }
+	for name, got := range map[string][]byte{
+		"default": hash(func(e *Engine) error { return nil }),
+		"named":   hash(named),
+		"named, then precedence": hash(func(e *Engine) error {
+			if err := named(e); err != nil {
+				return err
+			}
+			return precedence(e)
+		}),
+	} {
+		want := hash(nil, "build/")
+		if name == "default" {
+			want = hash(nil, "*.log")
+		}
+		if !equal(got, want) {
+			t.Errorf("%s: HashPath() = %x, want %x", name, got, want)
+		}
+	}
+
+	if err := NewEngine().SetIgnoreFileName("../.checksumignore"); err == nil {
+		t.Error("SetIgnoreFileName() with a path expected an error")
+	}
+}
+
+func TestEngine_ExclusionFingerprint(t *testing.T) {
+	root := t.TempDir()
+	fingerprint := func(t *testing.T, patterns ...string) string {
+		t.Helper()
+		engine, err := NewEngineWithExclusions(0, patterns, root, false, "")
+		if err != nil {
+			t.Fatalf("NewEngineWithExclusions() error = %v", err)
+		}
+		fp, err := engine.ExclusionFingerprint()
+		if err != nil {
+			t.Fatalf("ExclusionFingerprint() error = %v", err)
+		}
+		return fp
+	}
+
+	if foo, bar := fingerprint(t, "foo"), fingerprint(t, "bar"); foo == bar {
+		t.Errorf("-e foo and -e bar should fingerprint differently, both %s", foo)
+	}
+	if a, b := fingerprint(t, "foo", "bar"), fingerprint(t, "bar", "foo"); a != b {
+		t.Errorf("Pattern order should not matter: %s vs %s", a, b)
+	}
+
+	// An engine without exclusions has the fingerprint of no patterns
+	fp, err := NewEngine().ExclusionFingerprint()
+	if err != nil {
+		t.Fatalf("ExclusionFingerprint() error = %v", err)
+	}
+	if fp != fingerprint(t) {
+		t.Errorf("NewEngine() fingerprint = %s, want %s", fp, fingerprint(t))
+	}
+}
+
+func TestEngine_ResolveRootRealpath(t *testing.T) {
+	base := t.TempDir()
+	real := filepath.Join(base, "real")
+	if err := os.MkdirAll(filepath.Join(real, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(real, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to create a.txt: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(real, "sub", "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatalf("Failed to create b.txt: %v", err)
+	}
+	link := filepath.Join(base, "link")
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	want, err := HashPath(real)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	// The root is given through the symlink, the tree is walked through its real path
+	newEngine := func(t *testing.T) *Engine {
+		t.Helper()
+		engine, err := NewEngineWithExclusions(0, nil, link, false, "")
+		if err != nil {
+			t.Fatalf("NewEngineWithExclusions() error = %v", err)
+		}
+		return engine
+	}
+
+	if _, err := newEngine(t).HashPath(real); err == nil || !strings.Contains(err.Error(), "path outside allowed directory") {
+		t.Fatalf("HashPath() without realpath resolution error = %v, want a path outside allowed directory error", err)
+	}
+
+	engine := newEngine(t)
+	engine.SetResolveRootRealpath(true)
+	got, err := engine.HashPath(real)
+	if err != nil {
+		t.Fatalf("HashPath() with realpath resolution error = %v", err)
+	}
+	if !equal(got.Hash, want.Hash) {
+		t.Errorf("HashPath() = %x, want %x", got.Hash, want.Hash)
+	}
+
+	// Files outside the real root are still rejected, naming the resolved root
+	outside := filepath.Join(base, "outside.txt")
+	if err := os.WriteFile(outside, []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create outside.txt: %v", err)
+	}
+	realRoot, err := filepath.EvalSymlinks(real)
+	if err != nil {
+		t.Fatalf("EvalSymlinks() error = %v", err)
+	}
+	_, err = engine.hashFile(outside, 1)
+	if err == nil || !strings.Contains(err.Error(), realRoot) {
+		t.Errorf("hashFile() outside the root error = %v, want an error naming %q", err, realRoot)
+	}
+}
+
+func TestStreamDiff(t *testing.T) {
+	base := t.TempDir()
+	a, b := filepath.Join(base, "a"), filepath.Join(base, "b")
+	if err := os.Mkdir(a, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	createDeepTree(t, a, 3, 3, 4)
+	if err := os.CopyFS(b, os.DirFS(a)); err != nil {
+		t.Fatalf("Failed to copy tree: %v", err)
+	}
+
+	// Identical trees have no differences
+	count, err := StreamDiff(a, b, NewEngine(), NewEngine(), func(line string) error {
+		t.Errorf("Unexpected difference %q", line)
+		return nil
+	})
+	if err != nil || count != 0 {
+		t.Fatalf("StreamDiff() = %d, %v, want 0, nil", count, err)
+	}
+
+	mutations := []struct {
+		path    string
+		content string
+		remove  bool
+	}{
+		{path: "a/file0.txt", content: "modified"},
+		{path: "a/d1/d2/file3.txt", content: "modified"},
+		{path: "a/d2/file1.txt", remove: true},
+		{path: "b/d0/d0", remove: true},
+		{path: "a/d0/new.txt", content: "new"},
+		// "d1.txt" sorts before "d1/..." by full path, but after "d1" by name
+		{path: "a/d1.txt", content: "new"},
+		{path: "b/d1/d0.txt", content: "new"},
+		{path: "a/zz/only-a.txt", content: "new"},
+	}
+	for _, m := range mutations {
+		p := filepath.Join(base, filepath.FromSlash(m.path))
+		if m.remove {
+			if err := os.RemoveAll(p); err != nil {
+				t.Fatalf("Failed to remove %s: %v", m.path, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(m.content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", m.path, err)
+		}
+	}
+
+	// The materialized approach: list every leaf of both trees, then compare the sets
+	leaves := func(t *testing.T, root string) map[string]leafResult {
+		t.Helper()
+		manifest, err := NewEngine().BuildManifest(root)
+		if err != nil {
+			t.Fatalf("BuildManifest() error = %v", err)
+		}
+		set := make(map[string]leafResult, len(manifest.Entries))
+		for _, entry := range manifest.Entries {
+			hash, err := hex.DecodeString(entry.Hash)
+			if err != nil {
+				t.Fatalf("Invalid manifest hash: %v", err)
+			}
+			set[entry.Path] = leafResult{Result: Result{Hash: hash, Size: entry.Size}, isLink: entry.Type == EntrySymlink}
+		}
+		return set
+	}
+	want := leafDrift(leaves(t, a), leaves(t, b))
+
+	var got []string
+	count, err = StreamDiff(a, b, NewEngine(), NewEngine(), func(line string) error {
+		got = append(got, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamDiff() error = %v", err)
+	}
+	if count != len(got) {
+		t.Errorf("StreamDiff() count = %d, want %d", count, len(got))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("StreamDiff() lines =\n%s\nwant (materialized)\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(want) < len(mutations) {
+		t.Errorf("Expected at least %d differences, got %d", len(mutations), len(want))
+	}
+
+	// An emit error stops the comparison
+	stop := fmt.Errorf("stop")
+	count, err = StreamDiff(a, b, NewEngine(), NewEngine(), func(string) error { return stop })
+	if err != stop || count != 1 {
+		t.Errorf("StreamDiff() = %d, %v, want 1, %v", count, err, stop)
+	}
+}
+
+func TestStreamDiff_MarkerDirsAndLimits(t *testing.T) {
+	base := t.TempDir()
+	a, b := filepath.Join(base, "a"), filepath.Join(base, "b")
+	for name, content := range map[string]string{
+		"a/.git/HEAD": "ref: refs/heads/main\n",
+		"a/.git-x":    "only in a",
+		"a/main.go":   "package main",
+		"b/.git/HEAD": "0123abcd\n",
+		"b/main.go":   "package main // changed",
+	} {
+		path := filepath.Join(base, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	stream := func(configure func(e *Engine)) ([]string, error) {
+		var lines []string
+		engineA, engineB := NewEngine(), NewEngine()
+		configure(engineA)
+		configure(engineB)
+		_, err := StreamDiff(a, b, engineA, engineB, func(line string) error {
+			lines = append(lines, line)
+			return nil
+		})
+		return lines, err
+	}
+
+	// A marker directory is a single leaf, sorted by its name like any other leaf
+	got, err := stream(func(e *Engine) { e.SetMarkerDirs([]string{".git"}) })
+	if err != nil {
+		t.Fatalf("StreamDiff() error = %v", err)
+	}
+	want := []string{"added: .git-x", "modified: main.go"}
+	if !slices.Equal(got, want) {
+		t.Errorf("StreamDiff() with a .git marker = %v, want %v", got, want)
+	}
+
+	// Directories are listed within the entries limit, as when hashing
+	if _, err := stream(func(e *Engine) { e.SetEntriesLimit(1, false) }); err == nil || !contains(err.Error(), "--entries-limit") {
+		t.Errorf("StreamDiff() over the entries limit error = %v, want the limit error", err)
+	}
+}
+
+func TestEngine_EntriesLimit(t *testing.T) {
+	root := t.TempDir()
+	big := filepath.Join(root, "big")
+	truncated := t.TempDir()
+	if err := os.Mkdir(big, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(truncated, "big"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("file%02d.txt", i)
+		if err := os.WriteFile(filepath.Join(big, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		// The 20 first files in sorted order are kept when truncating
+		if i < 20 {
+			if err := os.WriteFile(filepath.Join(truncated, "big", name), []byte(name), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+		}
+	}
+	for _, dir := range []string{root, truncated} {
+		if err := os.WriteFile(filepath.Join(dir, "top.txt"), []byte("top"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	full, err := HashPath(root)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	want, err := HashPath(truncated)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		limit    int
+		truncate bool
+		want     []byte
+		wantErr  bool
+	}{
+		{name: "unlimited", limit: 0, want: full.Hash},
+		{name: "within limit", limit: 50, want: full.Hash},
+		{name: "exceeded", limit: 20, wantErr: true},
+		{name: "exceeded with truncation", limit: 20, truncate: true, want: want.Hash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine()
+			engine.SetEntriesLimit(tt.limit, tt.truncate)
+			result, err := engine.HashPath(root)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "more than 20 entries") {
+					t.Errorf("HashPath() error = %v, want an entries limit error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("HashPath() error = %v", err)
+			}
+			if !equal(result.Hash, tt.want) {
+				t.Errorf("HashPath() = %x, want %x", result.Hash, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngine_IncludeRootName(t *testing.T) {
+	base := t.TempDir()
+	dirs := []string{
+		filepath.Join(base, "alpha"),
+		filepath.Join(base, "beta"),
+		filepath.Join(base, "copy", "alpha"),
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("same"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	hash := func(t *testing.T, path string, include bool) []byte {
+		t.Helper()
+		engine := NewEngine()
+		engine.SetIncludeRootName(include)
+		result, err := engine.HashPath(path)
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		return result.Hash
+	}
+
+	// Without the flag only contents matter
+	if !equal(hash(t, dirs[0], false), hash(t, dirs[1], false)) {
+		t.Error("Identical directories with different names should hash the same by default")
+	}
+	// With it, the names do too, but not the parent directories
+	if equal(hash(t, dirs[0], true), hash(t, dirs[1], true)) {
+		t.Error("Identical directories with different names should hash differently with the root name")
+	}
+	if !equal(hash(t, dirs[0], true), hash(t, dirs[2], true)) {
+		t.Error("Identical directories with the same name should hash the same with the root name")
+	}
+	if equal(hash(t, dirs[0], true), hash(t, dirs[0], false)) {
+		t.Error("Including the root name should change the root hash")
+	}
+
+	engine := NewEngine()
+	engine.SetIncludeRootName(true)
+	if _, err := engine.Prove(dirs[0], filepath.Join(dirs[0], "file.txt")); err == nil {
+		t.Error("Prove() expected error with the root name included")
+	}
+}
+
+func TestEngine_EmptyFileVersusEmptyDir(t *testing.T) {
+	withFile := t.TempDir()
+	if err := os.WriteFile(filepath.Join(withFile, "x"), nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	withDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(withDir, "x"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	for _, lowMemory := range []bool{false, true} {
+		hash := func(path string) []byte {
+			engine := NewEngine()
+			engine.SetLowMemory(lowMemory)
+			result, err := engine.HashPath(path)
+			if err != nil {
+				t.Fatalf("HashPath() error = %v", err)
+			}
+			return result.Hash
+		}
+		if equal(hash(withFile), hash(withDir)) {
+			t.Errorf("A directory with an empty file x hashes like one with an empty subdirectory x (low memory: %v)", lowMemory)
+		}
+		if equal(hash(filepath.Join(withFile, "x")), hash(filepath.Join(withDir, "x"))) {
+			t.Errorf("An empty file hashes like an empty directory (low memory: %v)", lowMemory)
+		}
+	}
+
+	fromFS, err := NewEngine().HashFS(os.DirFS(withDir), ".")
+	if err != nil {
+		t.Fatalf("HashFS() error = %v", err)
+	}
+	fromDisk, err := HashPath(withDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !equal(fromFS.Hash, fromDisk.Hash) {
+		t.Errorf("HashFS() = %x, want the same empty directory node as HashPath() %x", fromFS.Hash, fromDisk.Hash)
+	}
+}
+
+func TestEngine_EntryTypes(t *testing.T) {
+	// Each pair holds an entry x and a file x with the same leaf hash; the entry's type must
+	// still keep the two directories apart
+	tests := []struct {
+		name   string
+		create func(t *testing.T, path string)
+		forged string
+	}{
+		{
+			name: "empty directory",
+			create: func(t *testing.T, path string) {
+				if err := os.Mkdir(path, 0755); err != nil {
+					t.Fatalf("Failed to create directory: %v", err)
+				}
+			},
+			forged: emptyDirTag,
+		},
+		{
+			name: "symlink",
+			create: func(t *testing.T, path string) {
+				if err := os.Symlink("target", path); err != nil {
+					t.Fatalf("Failed to create symlink: %v", err)
+				}
+			},
+			forged: "target",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withEntry := t.TempDir()
+			tt.create(t, filepath.Join(withEntry, "x"))
+			withFile := t.TempDir()
+			if err := os.WriteFile(filepath.Join(withFile, "x"), []byte(tt.forged), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+
+			for _, lowMemory := range []bool{false, true} {
+				hash := func(path string) []byte {
+					engine := NewEngine()
+					engine.SetLowMemory(lowMemory)
+					result, err := engine.HashPath(path)
+					if err != nil {
+						t.Fatalf("HashPath() error = %v", err)
+					}
+					return result.Hash
+				}
+				if !equal(hash(filepath.Join(withEntry, "x")), hash(filepath.Join(withFile, "x"))) {
+					t.Fatalf("The forged file should have the same leaf hash as the entry")
+				}
+				if equal(hash(withEntry), hash(withFile)) {
+					t.Errorf("A directory with a %s x hashes like one with a file x (low memory: %v)", tt.name, lowMemory)
+				}
+			}
+		})
+	}
+}
+
+func TestEngine_LowMemory(t *testing.T) {
+	root := t.TempDir()
+	createDeepTree(t, root, 3, 3, 3)
+	if err := os.Symlink("file0.txt", filepath.Join(root, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "empty.txt"), nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		configure func(e *Engine)
+	}{
+		{name: "default", configure: func(e *Engine) {}},
+		{name: "structure only", configure: func(e *Engine) { e.SetStructureOnly(true) }},
+		{name: "exclude empty files", configure: func(e *Engine) { e.SetExcludeEmptyFiles(true) }},
+		{name: "sha256", configure: func(e *Engine) { e.SetAlgorithm(AlgorithmSHA256) }},
+		{name: "adaptive scheduling", configure: func(e *Engine) { e.SetAdaptiveScheduling(true) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffered := NewEngine()
+			tt.configure(buffered)
+			want, err := buffered.HashPath(root)
+			if err != nil {
+				t.Fatalf("HashPath() error = %v", err)
+			}
+
+			streaming := NewEngine()
+			tt.configure(streaming)
+			streaming.SetLowMemory(true)
+			got, err := streaming.HashPath(root)
+			if err != nil {
+				t.Fatalf("HashPath() with low memory error = %v", err)
+			}
+			if !equal(got.Hash, want.Hash) || got.Size != want.Size {
+				t.Errorf("HashPath() with low memory = %x (size %d), want %x (size %d)", got.Hash, got.Size, want.Hash, want.Size)
+			}
+		})
+	}
+
+	// Manifests need every directory's children, so they keep collecting results
+	engine := NewEngine()
+	engine.SetLowMemory(true)
+	manifest, err := engine.BuildManifest(root)
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+	if len(manifest.Entries) == 0 {
+		t.Error("BuildManifest() with low memory should still list entries")
+	}
+}
+
+func TestEngine_ExcludeDeeperThan(t *testing.T) {
+	tmpDir := t.TempDir()
+	full := filepath.Join(tmpDir, "full")
+	pruned := filepath.Join(tmpDir, "pruned")
+	// A 4-level tree; the pruned copy lacks the deepest level but keeps its parent directory
+	for _, rel := range []string{"l1.txt", "a/l2.txt", "a/b/l3.txt", "a/b/c/l4.txt", "a/b/d/l4.txt"} {
+		for _, root := range []string{full, pruned} {
+			if root == pruned && strings.Count(rel, "/") == 3 {
+				continue
+			}
+			p := filepath.Join(root, filepath.FromSlash(rel))
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			if err := os.WriteFile(p, []byte(rel), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+		}
+	}
+
+	hashWithDepth := func(path string, depth int) Result {
+		t.Helper()
+		engine := NewEngine()
+		engine.SetExcludeDeeperThan(depth)
+		result, err := engine.HashPath(path)
+		if err != nil {
+			t.Fatalf("HashPath(%q) error = %v", path, err)
+		}
+		return result
+	}
+
+	unlimited := hashWithDepth(full, 0)
+	if deep := hashWithDepth(full, 4); !equal(deep.Hash, unlimited.Hash) {
+		t.Error("A depth limit at the tree's depth should not change the hash")
+	}
+
+	// Depth 3 keeps a/b/c and a/b/d (as empty directories) and drops the files inside them
+	limited := hashWithDepth(full, 3)
+	if equal(limited.Hash, unlimited.Hash) {
+		t.Error("Excluding the deepest level should change the hash")
+	}
+	for _, dir := range []string{"c", "d"} {
+		if err := os.MkdirAll(filepath.Join(pruned, "a", "b", dir), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	want := hashWithDepth(pruned, 0)
+	if !equal(limited.Hash, want.Hash) || limited.Size != want.Size {
+		t.Errorf("HashPath() with depth 3 = %x (size %d), want %x (size %d) of the tree without level 4",
+			limited.Hash, limited.Size, want.Hash, want.Size)
+	}
+
+	// The limit is an exclusion, so it is part of the exclusion fingerprint
+	engine := NewEngine()
+	before, err := engine.ExclusionFingerprint()
+	if err != nil {
+		t.Fatalf("ExclusionFingerprint() error = %v", err)
+	}
+	engine.SetExcludeDeeperThan(3)
+	after, err := engine.ExclusionFingerprint()
+	if err != nil {
+		t.Fatalf("ExclusionFingerprint() error = %v", err)
+	}
+	if before == after {
+		t.Error("The depth limit should change the exclusion fingerprint")
+	}
+}
+
+func TestKnownAnswerTest(t *testing.T) {
+	if err := KnownAnswerTest(); err != nil {
+		t.Fatalf("KnownAnswerTest() error = %v", err)
+	}
+
+	// The directory answers must match what the engine computes for the same tree on disk
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("abc"), 0644); err != nil {
+		t.Fatalf("Failed to create a.txt: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "b.txt"), nil, 0644); err != nil {
+		t.Fatalf("Failed to create b.txt: %v", err)
+	}
+	for _, ka := range knownAnswers {
+		engine := NewEngine()
+		engine.SetAlgorithm(ka.algorithm)
+		result, err := engine.HashPath(tmpDir)
+		if err != nil {
+			t.Fatalf("HashPath() with %s error = %v", ka.algorithm, err)
+		}
+		if got := fmt.Sprintf("%x", result.Hash); got != ka.dir {
+			t.Errorf("HashPath() with %s = %s, want known answer %s", ka.algorithm, got, ka.dir)
+		}
+	}
+	if len(knownAnswers) != len(Algorithms) {
+		t.Errorf("knownAnswers covers %d algorithms, want all %d", len(knownAnswers), len(Algorithms))
+	}
+}
+
+func TestEngine_HashFS(t *testing.T) {
+	files := map[string]string{
+		"README.md":         "# assets\n",
+		"css/site.css":      "body {}\n",
+		"js/app.js":         "console.log(1)\n",
+		"js/vendor/lib.js":  "// lib\n",
+		"img/empty.png":     "",
+		"node_modules/x.js": "excluded",
+	}
+	mapFS := fstest.MapFS{}
+	tmpDir := t.TempDir()
+	for name, content := range files {
+		mapFS[name] = &fstest.MapFile{Data: []byte(content), Mode: 0644}
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	compare := func(t *testing.T, configure func(*Engine)) {
+		t.Helper()
+		diskEngine, err := NewEngineWithExclusions(0, []string{"node_modules"}, tmpDir, false, "")
+		if err != nil {
+			t.Fatalf("NewEngineWithExclusions() error = %v", err)
+		}
+		fsEngine, err := NewEngineWithExclusions(0, []string{"node_modules"}, tmpDir, false, "")
+		if err != nil {
+			t.Fatalf("NewEngineWithExclusions() error = %v", err)
+		}
+		configure(diskEngine)
+		configure(fsEngine)
+
+		want, err := diskEngine.HashPath(tmpDir)
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		got, err := fsEngine.HashFS(mapFS, ".")
+		if err != nil {
+			t.Fatalf("HashFS() error = %v", err)
+		}
+		if !equal(got.Hash, want.Hash) || got.Size != want.Size {
+			t.Errorf("HashFS() = %x (size %d), want %x (size %d) as on disk", got.Hash, got.Size, want.Hash, want.Size)
+		}
+
+		dirFS, err := NewEngine().HashFS(os.DirFS(tmpDir), "js")
+		if err != nil {
+			t.Fatalf("HashFS(os.DirFS) error = %v", err)
+		}
+		js, err := NewEngine().HashPath(filepath.Join(tmpDir, "js"))
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		if !equal(dirFS.Hash, js.Hash) {
+			t.Errorf("HashFS(os.DirFS, \"js\") = %x, want %x", dirFS.Hash, js.Hash)
+		}
+	}
+
+	t.Run("default", func(t *testing.T) { compare(t, func(*Engine) {}) })
+	t.Run("sha256", func(t *testing.T) { compare(t, func(e *Engine) { e.SetAlgorithm(AlgorithmSHA256) }) })
+	t.Run("structure only", func(t *testing.T) { compare(t, func(e *Engine) { e.SetStructureOnly(true) }) })
+	t.Run("exclude empty files", func(t *testing.T) { compare(t, func(e *Engine) { e.SetExcludeEmptyFiles(true) }) })
+	t.Run("depth limit", func(t *testing.T) { compare(t, func(e *Engine) { e.SetExcludeDeeperThan(1) }) })
+	t.Run("head bytes", func(t *testing.T) { compare(t, func(e *Engine) { e.SetHeadBytes(4) }) })
+
+	file, err := NewEngine().HashFS(mapFS, "css/site.css")
+	if err != nil {
+		t.Fatalf("HashFS() on a file error = %v", err)
+	}
+	if want, _ := HashPath(filepath.Join(tmpDir, "css", "site.css")); !equal(file.Hash, want.Hash) {
+		t.Errorf("HashFS() on a file = %x, want %x", file.Hash, want.Hash)
+	}
+
+	// Without a way to read link targets, symlinks cannot be hashed
+	withLink := fstest.MapFS{"link": &fstest.MapFile{Data: []byte("target"), Mode: fs.ModeSymlink}}
+	if _, err := NewEngine().HashFS(struct{ fs.FS }{withLink}, "."); err == nil {
+		t.Error("HashFS() expected error for a symlink in a file system without ReadLink")
+	}
+	// File systems that can read link targets hash symlinks like HashPath does
+	linkDir := t.TempDir()
+	if err := os.Symlink("README.md", filepath.Join(linkDir, "link")); err == nil {
+		if _, ok := os.DirFS(linkDir).(readLinkFS); ok {
+			got, err := NewEngine().HashFS(os.DirFS(linkDir), ".")
+			if err != nil {
+				t.Fatalf("HashFS() with a symlink error = %v", err)
+			}
+			if want, _ := HashPath(linkDir); !equal(got.Hash, want.Hash) {
+				t.Errorf("HashFS() with a symlink = %x, want %x", got.Hash, want.Hash)
+			}
+		}
+	}
+	if _, err := NewEngine().HashFS(mapFS, "../outside"); err == nil {
+		t.Error("HashFS() expected error for an invalid path")
+	}
+}
+
+func TestEngineOptions(t *testing.T) {
+	classified := make(map[string]bool)
+	for _, option := range engineOptions {
+		if classified[option.field] {
+			t.Errorf("Engine field %s is classified twice", option.field)
+		}
+		classified[option.field] = true
+		if option.fsys != "" && option.enabled == nil {
+			t.Errorf("Engine field %s is rejected through a file system but has no enabled check", option.field)
+		}
+	}
+
+	fields := reflect.TypeOf(Engine{})
+	for i := range fields.NumField() {
+		name := fields.Field(i).Name
+		if !classified[name] {
+			t.Errorf("Engine field %s is missing from engineOptions: state how the fs.FS walk treats it", name)
+		}
+		delete(classified, name)
+	}
+	for name := range classified {
+		t.Errorf("engineOptions lists %s, which is not an Engine field", name)
+	}
+
+	// A default engine sets no rejected option
+	if err := NewEngine().checkFSOptions(); err != nil {
+		t.Errorf("checkFSOptions() on a default engine = %v, want nil", err)
+	}
+}
+
+func TestDiffFS(t *testing.T) {
+	a := fstest.MapFS{
+		"same.txt":     {Data: []byte("same")},
+		"changed.txt":  {Data: []byte("before")},
+		"sub/new.txt":  {Data: []byte("new")},
+		"sub/keep.txt": {Data: []byte("keep")},
+	}
+	b := fstest.MapFS{
+		"same.txt":     {Data: []byte("same")},
+		"changed.txt":  {Data: []byte("after")},
+		"old.txt":      {Data: []byte("old")},
+		"sub/keep.txt": {Data: []byte("keep")},
+	}
+
+	var lines []string
+	count, err := DiffFS(a, ".", b, ".", NewEngine(), NewEngine(), func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("DiffFS() error = %v", err)
+	}
+	want := []string{"modified: changed.txt", "deleted: old.txt", "added: sub/new.txt"}
+	if count != len(want) || strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("DiffFS() = %d %q, want %q", count, lines, want)
+	}
+
+	count, err = DiffFS(a, "sub", b, "sub", NewEngine(), NewEngine(), func(string) error { return nil })
+	if err != nil || count != 1 {
+		t.Errorf("DiffFS() on subdirectories = %d, %v; want 1 difference", count, err)
+	}
+}
+
+func TestEngine_OrderIsLocaleIndependent(t *testing.T) {
+	names := []string{"a", "B", "_x", "\u00e9", "Z10", "z2", "e\u0301", "I", "\u0131"}
+	tmpDir := t.TempDir()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file %q: %v", name, err)
+		}
+	}
+
+	// Entries are ordered by their bytes, whatever a locale's collation would say
+	sorted := append([]string(nil), names...)
+	sort.Slice(sorted, func(i, j int) bool { return NewEngine().nameLess(sorted[i], sorted[j]) })
+	want := []string{"B", "I", "Z10", "_x", "a", "e\u0301", "z2", "\u00e9", "\u0131"}
+	if strings.Join(sorted, "|") != strings.Join(want, "|") {
+		t.Errorf("nameLess order = %q, want bytewise %q", sorted, want)
+	}
+
+	base, err := HashPath(tmpDir)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	for _, locale := range []string{"tr_TR.UTF-8", "de_DE@collation=phonebook", "sv_SE.ISO-8859-1", "C"} {
+		t.Run(locale, func(t *testing.T) {
+			t.Setenv("LC_COLLATE", locale)
+			t.Setenv("LC_ALL", locale)
+			t.Setenv("LANG", locale)
+			got, err := HashPath(tmpDir)
+			if err != nil {
+				t.Fatalf("HashPath() error = %v", err)
+			}
+			if !equal(got.Hash, base.Hash) {
+				t.Errorf("HashPath() with locale %s = %x, want %x", locale, got.Hash, base.Hash)
+			}
+		})
+	}
+}
+
+func TestEngine_HeadBytes(t *testing.T) {
+	tmpDir := t.TempDir()
+	head := bytes.Repeat([]byte("h"), 1024)
+	write := func(name string, content []byte) string {
+		p := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(p, content, 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", name, err)
+		}
+		return p
+	}
+	a := write("a.bin", append(append([]byte(nil), head...), bytes.Repeat([]byte("a"), 64*1024)...))
+	b := write("b.bin", append(append([]byte(nil), head...), bytes.Repeat([]byte("b"), 64*1024)...))
+	longer := write("longer.bin", append(append([]byte(nil), head...), bytes.Repeat([]byte("a"), 64*1024+1)...))
+	small := write("small.txt", []byte("small"))
+
+	hash := func(headBytes int64, path string) []byte {
+		t.Helper()
+		e := NewEngine()
+		e.SetHeadBytes(headBytes)
+		result, err := e.HashPath(path)
+		if err != nil {
+			t.Fatalf("HashPath(%s) error = %v", path, err)
+		}
+		return result.Hash
+	}
+
+	if equal(hash(0, a), hash(0, b)) {
+		t.Fatal("Files differing after their head should hash differently in full")
+	}
+	n := int64(len(head))
+	if !equal(hash(n, a), hash(n, b)) {
+		t.Error("Files sharing their head and size should hash the same with SetHeadBytes")
+	}
+	if equal(hash(n, a), hash(n, longer)) {
+		t.Error("Files sharing their head but not their size should hash differently")
+	}
+	if !equal(hash(n, small), hash(0, small)) {
+		t.Error("Files no larger than the head should be hashed in full")
+	}
+
+	quick := NewEngine()
+	quick.SetHeadBytes(n)
+	if quick.ContentLeaves() {
+		t.Error("ContentLeaves() should be false with SetHeadBytes")
+	}
+	if result, err := quick.HashPath(a); err != nil || result.Size != n+64*1024 {
+		t.Errorf("HashPath() size = %d, %v; want the full file size", result.Size, err)
+	}
+}
+
+func TestEngine_StripBOM(t *testing.T) {
+	tmpDir := t.TempDir()
+	bom := "\xef\xbb\xbf"
+	files := map[string]string{
+		"plain/note.txt":      "hello\n",
+		"bom/note.txt":        bom + "hello\n",
+		"binary/data.bin":     bom + "hello\x00",
+		"binary/data-raw.bin": "hello\x00",
+	}
+	for name, content := range files {
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	hash := func(strip bool, name string) Result {
+		t.Helper()
+		e := NewEngine()
+		e.SetStripBOM(strip)
+		result, err := e.HashPath(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("HashPath(%s) error = %v", name, err)
+		}
+		return result
+	}
+
+	if equal(hash(false, "bom").Hash, hash(false, "plain").Hash) {
+		t.Fatal("A BOM should change the hash without SetStripBOM")
+	}
+	if got, want := hash(true, "bom"), hash(true, "plain"); !equal(got.Hash, want.Hash) {
+		t.Errorf("BOM-prefixed text hashes to %x, want %x like the file without it", got.Hash, want.Hash)
+	}
+	if got := hash(true, "bom/note.txt"); got.Size != int64(len(files["bom/note.txt"])) {
+		t.Errorf("HashPath() size = %d, want the full file size %d", got.Size, len(files["bom/note.txt"]))
+	}
+	if !equal(hash(true, "binary/data.bin").Hash, hash(false, "binary/data.bin").Hash) {
+		t.Error("Binary files should be hashed unchanged by SetStripBOM")
+	}
+	if !equal(hash(true, "plain").Hash, hash(false, "plain").Hash) {
+		t.Error("Files without a BOM should hash the same with SetStripBOM")
+	}
+
+	e := NewEngine()
+	e.SetStripBOM(true)
+	if e.ContentLeaves() {
+		t.Error("ContentLeaves() should be false with SetStripBOM")
+	}
+	viaFS, err := e.HashFS(os.DirFS(tmpDir), "bom")
+	if err != nil {
+		t.Fatalf("HashFS() error = %v", err)
+	}
+	if want := hash(true, "plain"); !equal(viaFS.Hash, want.Hash) {
+		t.Errorf("HashFS() = %x, want %x like HashPath", viaFS.Hash, want.Hash)
+	}
+}
+
+func TestEngine_StripBOMGitRef(t *testing.T) {
+	repo := initGitRepo(t, map[string]string{"note.txt": "\xef\xbb\xbfhello\n"})
+	if err := os.WriteFile(filepath.Join(repo, "note.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatalf("Failed to rewrite note.txt: %v", err)
+	}
+
+	diffs, err := NewEngine().CompareGitRef(repo, "HEAD")
+	if err != nil {
+		t.Fatalf("CompareGitRef() error = %v", err)
+	}
+	if len(diffs) == 0 || diffs[0] == noDifferencesMsg {
+		t.Fatalf("CompareGitRef() = %v, want the removed BOM reported without SetStripBOM", diffs)
+	}
+
+	e := NewEngine()
+	e.SetStripBOM(true)
+	diffs, err = e.CompareGitRef(repo, "HEAD")
+	if err != nil {
+		t.Fatalf("CompareGitRef() error = %v", err)
+	}
+	if len(diffs) != 1 || diffs[0] != noDifferencesMsg {
+		t.Errorf("CompareGitRef() with SetStripBOM = %v, want no differences", diffs)
+	}
+}
+
+func BenchmarkHashPath_DeepTree(b *testing.B) {
+	tmpDir := b.TempDir()
+	createDeepTree(b, tmpDir, 5, 3, 4)
+
+	for _, adaptive := range []bool{false, true} {
+		name := "sequential"
+		if adaptive {
+			name = "adaptive"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				engine := NewEngine()
+				engine.SetAdaptiveScheduling(adaptive)
+				if _, err := engine.HashPath(tmpDir); err != nil {
+					b.Fatalf("HashPath() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkStreamDiff(b *testing.B) {
+	base := b.TempDir()
+	treeA, treeB := filepath.Join(base, "a"), filepath.Join(base, "b")
+	if err := os.Mkdir(treeA, 0755); err != nil {
+		b.Fatalf("Failed to create directory: %v", err)
+	}
+	createDeepTree(b, treeA, 4, 3, 4)
+	if err := os.CopyFS(treeB, os.DirFS(treeA)); err != nil {
+		b.Fatalf("Failed to copy tree: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(treeB, "d1", "d1", "file2.txt"), []byte("changed"), 0644); err != nil {
+		b.Fatalf("Failed to modify file: %v", err)
+	}
+
+	b.Run("streaming", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := StreamDiff(treeA, treeB, NewEngine(), NewEngine(), func(string) error { return nil }); err != nil {
+				b.Fatalf("StreamDiff() error = %v", err)
+			}
+		}
+	})
+	b.Run("materialized", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			sets := make([]map[string]leafResult, 2)
+			for j, root := range []string{treeA, treeB} {
+				manifest, err := NewEngine().BuildManifest(root)
+				if err != nil {
+					b.Fatalf("BuildManifest() error = %v", err)
+				}
+				sets[j] = make(map[string]leafResult, len(manifest.Entries))
+				for _, entry := range manifest.Entries {
+					sets[j][entry.Path] = leafResult{Result: Result{Size: entry.Size, Hash: []byte(entry.Hash)}}
+				}
+			}
+			leafDrift(sets[0], sets[1])
+		}
+	})
+}
+
+// Helper functions
+func equal(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// createDeepTree populates root with a tree of the given depth in which every directory
+// holds the given number of files and fanout subdirectories named d0, d1, ...
+func createDeepTree(tb testing.TB, root string, depth, fanout, files int) {
+	tb.Helper()
+	for i := 0; i < files; i++ {
+		content := fmt.Sprintf("%s/file%d", root, i)
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("file%d.txt", i)), []byte(content), 0644); err != nil {
+			tb.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	if depth == 0 {
+		return
+	}
+	for i := 0; i < fanout; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("d%d", i))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			tb.Fatalf("Failed to create directory: %v", err)
+		}
+		createDeepTree(tb, dir, depth-1, fanout, files)
+	}
+}
+
+func TestEngine_OpenFilesLimit(t *testing.T) {
+	root := t.TempDir()
+	for i := range 4 {
+		dir := filepath.Join(root, fmt.Sprintf("dir%d", i), "nested")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+		for j := range 8 {
+			name := filepath.Join(dir, fmt.Sprintf("file%d.txt", j))
+			if err := os.WriteFile(name, []byte(name), 0644); err != nil {
+				t.Fatalf("Failed to create %s: %v", name, err)
+			}
+		}
+	}
+
+	modes := []struct {
+		name  string
+		apply func(e *Engine)
+	}{
+		{"default", func(e *Engine) {}},
+		{"adaptive", func(e *Engine) { e.SetAdaptiveScheduling(true) }},
+		{"text only", func(e *Engine) { e.SetContentClass(ContentTextOnly) }},
+	}
+	for _, mode := range modes {
+		t.Run(mode.name, func(t *testing.T) {
+			unlimited := NewEngineWithWorkers(8)
+			mode.apply(unlimited)
+			want, err := unlimited.HashPath(root)
+			if err != nil {
+				t.Fatalf("HashPath() error = %v", err)
+			}
+
+			engine := NewEngineWithWorkers(8)
+			engine.SetOpenFilesLimit(1)
+			mode.apply(engine)
+			got, err := engine.HashPath(root)
+			if err != nil {
+				t.Fatalf("HashPath() with one open file error = %v", err)
+			}
+			if !equal(got.Hash, want.Hash) {
+				t.Errorf("HashPath() with one open file = %x, want %x", got.Hash, want.Hash)
+			}
+		})
+	}
+}
+
+// quirkyReader returns its data one byte at a time, with a read returning no data and no
+// error before each byte, as the io.Reader contract allows.
+type quirkyReader struct {
+	data  []byte
+	empty bool
+}
+
+func (r *quirkyReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	if r.empty = !r.empty; r.empty {
+		return 0, nil
+	}
+	n := copy(p[:1], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// stuckReader never returns data nor an error.
+type stuckReader struct{}
+
+func (stuckReader) Read(p []byte) (int, error) {
+	return 0, nil
+}
+
+func TestEngine_HashReader(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := []byte("streamed content")
+	for name, data := range map[string][]byte{"content.txt": content, "empty.txt": nil} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	engine := NewEngine()
+
+	tests := []struct {
+		name   string
+		reader io.Reader
+		file   string
+	}{
+		{name: "quirky", reader: &quirkyReader{data: content}, file: "content.txt"},
+		{name: "empty", reader: bytes.NewReader(nil), file: "empty.txt"},
+		{name: "quirky empty", reader: &quirkyReader{}, file: "empty.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := HashPath(filepath.Join(tmpDir, tt.file))
+			if err != nil {
+				t.Fatalf("HashPath() error = %v", err)
+			}
+			got, err := engine.HashReader(tt.reader)
+			if err != nil {
+				t.Fatalf("HashReader() error = %v", err)
+			}
+			if !equal(got.Hash, want.Hash) || got.Size != want.Size {
+				t.Errorf("HashReader() = %x (size %d), want %x (size %d)", got.Hash, got.Size, want.Hash, want.Size)
+			}
+		})
+	}
+
+	t.Run("stuck", func(t *testing.T) {
+		if _, err := engine.HashReader(stuckReader{}); !errors.Is(err, io.ErrNoProgress) {
+			t.Errorf("HashReader() error = %v, want io.ErrNoProgress", err)
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		truncated := io.MultiReader(bytes.NewReader(content), iotest.ErrReader(io.ErrUnexpectedEOF))
+		if _, err := engine.HashReader(truncated); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("HashReader() error = %v, want io.ErrUnexpectedEOF", err)
+		}
+	})
 }
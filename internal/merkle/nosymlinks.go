@@ -0,0 +1,23 @@
+// Package merkle (nosymlinks.go) provides rejection of symbolic links.
+// A symlink is hashed from its target string, which is resolved differently across
+// platforms and is not even representable on some filesystems, so the hash of a tree
+// holding links can be ambiguous. For archival hashing, the engine can refuse them
+// instead, forcing them to be resolved or excluded.
+package merkle
+
+import "fmt"
+
+// SetNoSymlinks makes hashing fail as soon as a symlink is encountered, whether or not
+// links would be followed. Excluded links are never encountered, so excluding them is a
+// way out. A root given as a symlink and resolved before walking is not rejected.
+func (e *Engine) SetNoSymlinks(reject bool) {
+	e.noSymlinks = reject
+}
+
+// checkSymlink returns an error for the symlink at path if the engine rejects symlinks.
+func (e *Engine) checkSymlink(path string) error {
+	if e.noSymlinks {
+		return fmt.Errorf("symlink %q is not allowed (--no-symlinks); resolve or exclude it", path)
+	}
+	return nil
+}
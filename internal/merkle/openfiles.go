@@ -0,0 +1,42 @@
+// Package merkle (openfiles.go) provides a budget of concurrently open file descriptors.
+// The worker count bounds concurrent file hashing, but directory listings and content
+// sniffing open descriptors of their own, so a large worker count on a system with a low
+// descriptor limit can fail with "too many open files". The budget is acquired around
+// every open made while hashing, independently of the workers.
+package merkle
+
+// SetOpenFilesLimit caps the number of files and directories the engine holds open at
+// once while hashing. Zero or a negative limit selects the default, a safe fraction of the
+// process's soft descriptor limit, or no cap where that limit is unknown. Call it before
+// ShareWorkers, which shares the budget. Does not change the root hash.
+func (e *Engine) SetOpenFilesLimit(limit int) {
+	e.fds = newOpenFilesBudget(limit)
+}
+
+// newOpenFilesBudget returns a budget of limit descriptors, or of the default when limit
+// is not positive. A nil budget is unlimited.
+func newOpenFilesBudget(limit int) chan struct{} {
+	if limit < 1 {
+		limit = defaultOpenFilesLimit()
+	}
+	if limit < 1 {
+		return nil
+	}
+	return make(chan struct{}, limit)
+}
+
+// acquireFD takes one descriptor from the budget, blocking until one is free.
+// It must be paired with releaseFD once the descriptor is closed, and never be held
+// while acquiring the worker semaphore.
+func (e *Engine) acquireFD() {
+	if e.fds != nil {
+		e.fds <- struct{}{}
+	}
+}
+
+// releaseFD returns a descriptor taken by acquireFD to the budget.
+func (e *Engine) releaseFD() {
+	if e.fds != nil {
+		<-e.fds
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+// Package merkle (openfiles_other.go) provides the descriptor limit fallback for
+// platforms without Unix resource limits.
+package merkle
+
+// defaultOpenFilesLimit is unknown on this platform, so the default is no cap.
+func defaultOpenFilesLimit() int {
+	return 0
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+// Package merkle (openfiles_unix.go) reads the descriptor limit on Unix systems.
+package merkle
+
+import "syscall"
+
+// defaultOpenFilesLimit returns half the soft RLIMIT_NOFILE, leaving the rest for
+// standard streams, logs, external hashers and the rest of the process.
+//
+// Returns 0 (no cap) if the limit cannot be read or is unlimited.
+func defaultOpenFilesLimit() int {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 0
+	}
+	// RLIM_INFINITY is the largest value of Cur's type, so it is caught here too
+	cur := uint64(rl.Cur) //nolint:unconvert // Cur is not uint64 on every Unix
+	if cur > 1<<30 {
+		return 0
+	}
+	return max(int(cur/2), 1)
+}
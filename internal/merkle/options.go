@@ -0,0 +1,101 @@
+// Package merkle (options.go) lists where the engine's options apply.
+// A tree is walked either on disk (merkle.go), which honors every option, or through an
+// fs.FS (fsys.go). Every Engine field is classified here by how the fs.FS walk treats it,
+// and a test checks that none is missing, so an option added to the engine is either
+// honored or rejected by both walks instead of being silently ignored by one.
+package merkle
+
+import "errors"
+
+// engineOption describes how the walk through an fs.FS treats an Engine field.
+type engineOption struct {
+	// field is the name of the Engine field
+	field string
+	// fsys is empty if the walk through an fs.FS honors the field, or the field does not
+	// change what is hashed there; otherwise it is the reason the option is rejected
+	fsys string
+	// enabled reports whether the option is set; required when fsys is not empty
+	enabled func(e *Engine) bool
+}
+
+// engineOptions classifies every Engine field, rejected options first.
+var engineOptions = []engineOption{
+	// Options that need the operating system, rejected through a file system
+	{field: "includeXattr", fsys: "extended attributes cannot be hashed through a file system", enabled: func(e *Engine) bool { return e.includeXattr }},
+	{field: "includeHardlinks", fsys: "hardlinks cannot be detected through a file system", enabled: func(e *Engine) bool { return e.includeHardlinks }},
+	{field: "hasherCmd", fsys: "an external hasher cannot be used through a file system", enabled: func(e *Engine) bool { return e.hasherCmd != "" }},
+	{field: "assumed", fsys: "assumed hashes cannot be used through a file system", enabled: func(e *Engine) bool { return e.assumed != nil }},
+	{field: "byteBudget", fsys: "a byte budget cannot be used through a file system", enabled: func(e *Engine) bool { return e.byteBudget > 0 }},
+	{field: "followSymlinks", fsys: "symlinks cannot be followed through a file system", enabled: func(e *Engine) bool { return e.followSymlinks }},
+	{field: "resolveSymlinks", fsys: "symlinks cannot be resolved to real paths through a file system", enabled: func(e *Engine) bool { return e.resolveSymlinks }},
+
+	// Options honored by both walks
+	{field: "matcher"},
+	{field: "dockerMatcher"},
+	{field: "contentClass"},
+	{field: "limiter"},
+	{field: "chunkSize"},
+	{field: "normalizeUnicode"},
+	{field: "metrics"},
+	{field: "onFile"},
+	{field: "shallow"},
+	{field: "structureOnly"},
+	{field: "excludeEmptyFiles"},
+	{field: "algorithm"},
+	{field: "strictCase"},
+	{field: "noSymlinks"},
+	{field: "markerDirs"},
+	{field: "includeRootName"},
+	{field: "entriesLimit"},
+	{field: "truncateEntries"},
+	{field: "excludeDeeperThan"},
+	{field: "diagnostics"},
+	{field: "headBytes"},
+	{field: "excludeSize"},
+	{field: "stripBOM"},
+
+	// Options about paths on disk, which do not apply to names inside a file system
+	{field: "oneFilesystem"},
+	{field: "resolveRootLink"},
+	{field: "realpathRoot"},
+	{field: "ignoreVanished"},
+
+	// Options about scheduling and memory, which never change a root
+	{field: "maxWorkers"},
+	{field: "lowMemory"},
+	{field: "spawn"},
+
+	// Internal state, callbacks and the sources options were built from
+	{field: "bufferPool"},
+	{field: "sem"},
+	{field: "fds"},
+	{field: "ignorePatterns"},
+	{field: "loadIgnoreFile"},
+	{field: "customIgnoreFile"},
+	{field: "ignoreFileName"},
+	{field: "ignorePrecedence"},
+	{field: "dockerPatterns"},
+	{field: "rootPath"},
+	{field: "onDir"},
+	{field: "onDirMu"},
+	{field: "onFileMu"},
+	{field: "hardlinks"},
+	{field: "hardlinksOnce"},
+	{field: "rootDevOnce"},
+	{field: "rootDev"},
+	{field: "rootDevOK"},
+	{field: "budgetUsed"},
+	{field: "realRootOnce"},
+	{field: "realRoot"},
+}
+
+// checkFSOptions returns an error for the first option set on the engine that the walk
+// through an fs.FS cannot honor, or nil if it can honor them all.
+func (e *Engine) checkFSOptions() error {
+	for _, option := range engineOptions {
+		if option.fsys != "" && option.enabled(e) {
+			return errors.New(option.fsys)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+// Package merkle (proof.go) provides Merkle inclusion proofs.
+// A proof records, for every directory between an entry and the tree root, the hashes
+// of the entry's siblings, so a verifier holding only the root hash can confirm that
+// the entry's hash is part of the tree without access to the rest of the tree. Directory
+// hashes do not cover entry names, so a proof does not show where in the tree the entry is.
+package merkle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+)
+
+// Proof is a Merkle inclusion proof for a single entry of a tree.
+// All hashes are lowercase hexadecimal strings so proofs can be stored and exchanged as JSON.
+type Proof struct {
+	// Root is the Merkle root hash of the tree the proof was generated for.
+	Root string `json:"root"`
+	// Path is the slash-separated path of the entry relative to the tree root. It is
+	// informational: VerifyProof does not check it, as directory hashes do not cover names.
+	Path string `json:"path"`
+	// Leaf is the hash of the entry itself (file contents, symlink target or subtree root).
+	Leaf string `json:"leaf"`
+	// Type is the node type of the entry ("f", "d" or "l"), combined with Leaf in its parent.
+	Type string `json:"type"`
+	// Steps lists the sibling hashes at each level, from the entry's parent up to the root.
+	Steps []ProofStep `json:"steps"`
+	// Algorithm is the node hash algorithm; empty means BLAKE3.
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+// ProofStep holds the siblings of a node within its parent directory, each as its node
+// type byte followed by its hash, as they are combined into the parent. The parent's hash
+// is the hash of Before, the node's type and hash, and After concatenated in order.
+type ProofStep struct {
+	// Before are the entries sorted before the node.
+	Before []string `json:"before"`
+	// After are the entries sorted after the node.
+	After []string `json:"after"`
+}
+
+// Prove computes the Merkle root of root and an inclusion proof for target.
+// The tree is hashed once with the engine's configuration (exclusions included),
+// recording the entry hashes of every directory on the path from the root to target.
+//
+// Parameters:
+//   - root: The directory whose Merkle root the proof is anchored to
+//   - target: The file, symlink or directory inside root to prove
+//
+// Returns the proof, or an error if target is outside root, excluded, or hashing fails.
+// Options that make file hashes differ from plain digests (see ContentLeaves) are rejected,
+// as verify-proof could not reproduce the leaf from the file.
+func (e *Engine) Prove(root, target string) (*Proof, error) {
+	log := logger.WithOperation("prove", "root", root, "target", target)
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve root path: %w", err)
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve target path: %w", err)
+	}
+
+	relPath, err := filepath.Rel(absRoot, absTarget)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("path %q is not inside %q", target, root)
+	}
+	targetInfo, err := os.Lstat(absTarget)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat path %q: %w", absTarget, err)
+	}
+
+	var segments []string
+	if relPath != "." {
+		segments = strings.Split(relPath, string(filepath.Separator))
+	}
+	if e.includeRootName {
+		return nil, fmt.Errorf("inclusion proofs cannot be built with the root name included")
+	}
+	// verify-proof re-hashes files as plain digests, which these options would not match
+	if !e.ContentLeaves() {
+		return nil, fmt.Errorf("inclusion proofs cannot be built with chunking, extended attributes, hardlink groups, structure-only hashing, a byte budget, head-only hashing, BOM stripping or an external hasher, which make file hashes differ from plain digests")
+	}
+	if absRoot, err = e.resolveRoot(absRoot); err != nil {
+		return nil, err
+	}
+
+	// Record the children of every ancestor directory of the target
+	ancestors := make(map[string][]childResult, len(segments))
+	dir := absRoot
+	for _, seg := range segments {
+		ancestors[dir] = nil
+		dir = filepath.Join(dir, seg)
+	}
+	e.onDir = func(path string, children []childResult) {
+		if _, ok := ancestors[path]; ok {
+			ancestors[path] = children
+		}
+	}
+	defer func() { e.onDir = nil }()
+
+	if e.rootPath == "" {
+		e.rootPath = absRoot
+	}
+	rootResult, err := e.HashPath(absRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	proof := &Proof{
+		Root:  hex.EncodeToString(rootResult.Hash),
+		Path:  filepath.ToSlash(relPath),
+		Leaf:  hex.EncodeToString(rootResult.Hash),
+		Type:  NodeFile.String(),
+		Steps: []ProofStep{},
+	}
+	if targetInfo.IsDir() {
+		proof.Type = NodeDir.String()
+	}
+	if algorithm := e.Algorithm(); algorithm != AlgorithmBLAKE3 {
+		proof.Algorithm = string(algorithm)
+	}
+
+	// Walk from the deepest ancestor up to the root, collecting siblings
+	for i := len(segments) - 1; i >= 0; i-- {
+		parent := absRoot
+		if i > 0 {
+			parent = filepath.Join(absRoot, filepath.Join(segments[:i]...))
+		}
+
+		children := ancestors[parent]
+		idx := -1
+		for j, child := range children {
+			if child.name == segments[i] {
+				idx = j
+				break
+			}
+		}
+		if idx < 0 {
+			log.Error("Entry not part of the tree", "entry", segments[i], "parent", parent)
+			return nil, fmt.Errorf("path %q is not part of the tree (excluded or unreadable)", target)
+		}
+
+		if i == len(segments)-1 {
+			proof.Leaf = hex.EncodeToString(children[idx].result.Hash)
+			proof.Type = children[idx].nodeType().String()
+		}
+		step := ProofStep{Before: []string{}, After: []string{}}
+		for _, child := range children[:idx] {
+			step.Before = append(step.Before, proofEntry(child))
+		}
+		for _, child := range children[idx+1:] {
+			step.After = append(step.After, proofEntry(child))
+		}
+		proof.Steps = append(proof.Steps, step)
+	}
+
+	log.Debug("Proof generated", "steps", len(proof.Steps), "root_hash", proof.Root)
+	return proof, nil
+}
+
+// VerifyProof recomputes the root hash from the proof's leaf and sibling hashes
+// and checks that it matches the proof's root. This shows that the leaf is part of the
+// root, not that it is found at the proof's Path, which is not checked.
+//
+// Parameters:
+//   - p: The proof to verify
+//
+// Returns nil if the proof is valid, or an error describing why it is not.
+func VerifyProof(p *Proof) error {
+	if p == nil {
+		return fmt.Errorf("proof is nil")
+	}
+
+	current, err := hex.DecodeString(p.Leaf)
+	if err != nil {
+		return fmt.Errorf("invalid leaf hash %q: %w", p.Leaf, err)
+	}
+	root, err := hex.DecodeString(p.Root)
+	if err != nil {
+		return fmt.Errorf("invalid root hash %q: %w", p.Root, err)
+	}
+	algorithm, err := ParseAlgorithm(p.Algorithm)
+	if err != nil {
+		return err
+	}
+	nodeType, err := ParseNodeType(p.Type)
+	if err != nil {
+		return fmt.Errorf("invalid leaf type: %w", err)
+	}
+	if len(current) != algorithm.Size() {
+		return fmt.Errorf("invalid leaf hash %q: %d bytes, want %d for %s", p.Leaf, len(current), algorithm.Size(), algorithm)
+	}
+
+	for i, step := range p.Steps {
+		h := algorithm.New()
+		for _, sibling := range step.Before {
+			if err := writeSibling(h, sibling, algorithm); err != nil {
+				return fmt.Errorf("invalid sibling at step %d: %w", i, err)
+			}
+		}
+		if err := writeEntry(h, nodeType, current); err != nil {
+			return err
+		}
+		for _, sibling := range step.After {
+			if err := writeSibling(h, sibling, algorithm); err != nil {
+				return fmt.Errorf("invalid sibling at step %d: %w", i, err)
+			}
+		}
+		current, nodeType = h.Sum(nil), NodeDir
+	}
+
+	if !bytes.Equal(current, root) {
+		return fmt.Errorf("proof does not match root: computed %x, expected %s", current, p.Root)
+	}
+	return nil
+}
+
+// proofEntry returns a sibling of a proof step: its node type byte and hash, in hexadecimal.
+func proofEntry(child childResult) string {
+	return hex.EncodeToString(append([]byte{byte(child.nodeType())}, child.result.Hash...))
+}
+
+// writeSibling decodes a hexadecimal sibling, checks that it is a node type byte followed
+// by a hash of the algorithm's size, and writes it to the hasher.
+func writeSibling(h hash.Hash, s string, algorithm Algorithm) error {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("%q: %w", s, err)
+	}
+	if len(b) != 1+algorithm.Size() {
+		return fmt.Errorf("%q: %d bytes, want a type byte and a %d-byte %s hash", s, len(b), algorithm.Size(), algorithm)
+	}
+	if _, err := ParseNodeType(string(b[:1])); err != nil {
+		return fmt.Errorf("%q: %w", s, err)
+	}
+	if _, err := h.Write(b); err != nil {
+		return fmt.Errorf("failed to combine hashes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Package merkle (ratelimit.go) provides read bandwidth throttling.
+// A single token bucket is shared by every file read of an engine, so the
+// configured rate bounds the total bandwidth regardless of the worker count.
+package merkle
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket limiting the number of bytes read per second.
+// Tokens accumulate at rate bytes per second up to a burst of one second's worth.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter creates a limiter allowing bytesPerSec bytes per second.
+// The bucket starts empty so the rate also applies to the first reads.
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	return &rateLimiter{
+		rate: float64(bytesPerSec),
+		last: time.Now(),
+	}
+}
+
+// wait accounts for n bytes read and blocks until the bucket allows them.
+// Callers reserve tokens under the lock and sleep outside it, so concurrent
+// readers queue up fairly behind each other's reservations.
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
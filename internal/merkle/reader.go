@@ -0,0 +1,82 @@
+// Package merkle (reader.go) provides hashing of arbitrary streams.
+// Files are read in a loop that trusts the operating system to either return data, EOF or
+// an error. Generic readers such as pipes, network streams or decompressors may also
+// return no data and no error, which the io.Reader contract allows, or end early with
+// io.ErrUnexpectedEOF, so contents are copied defensively.
+package merkle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxEmptyReads is the number of consecutive reads returning neither data nor an error
+// tolerated before a reader is considered stuck, as in bufio.
+const maxEmptyReads = 100
+
+// HashReader computes the hash of everything read from r until EOF, as the leaf hash of a
+// regular file with the same contents, so a stream piped into the engine hashes like the
+// file it came from. Only the algorithm applies: options depending on a file's size or
+// metadata, such as chunking, head-only hashing or an external hasher, are not used.
+//
+// Parameters:
+//   - r: The stream to hash
+//
+// Returns the hash and the number of bytes read, or an error if reading fails, including
+// io.ErrUnexpectedEOF for a truncated stream and io.ErrNoProgress for a reader that keeps
+// returning no data.
+func (e *Engine) HashReader(r io.Reader) (Result, error) {
+	bufPtr, ok := e.bufferPool.get()
+	if !ok {
+		return Result{}, fmt.Errorf("failed to get buffer from pool")
+	}
+	defer e.bufferPool.put(bufPtr)
+
+	h := e.newHash()
+	size, err := e.readContents(h, r, *bufPtr, "stream")
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Hash: h.Sum(nil), Size: size}, nil
+}
+
+// readContents copies r into w through buf, throttled and counted like file contents.
+// Reads returning no data and no error are retried, up to maxEmptyReads in a row.
+//
+// Parameters:
+//   - w: The hasher the contents are written to
+//   - r: The reader the contents are read from
+//   - buf: The buffer used for each read
+//   - name: What is read, for error messages (e.g. `file "/tmp/a"`)
+//
+// Returns the number of bytes copied, and an error if reading or writing fails.
+func (e *Engine) readContents(w io.Writer, r io.Reader, buf []byte, name string) (int64, error) {
+	var copied int64
+	empty := 0
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			empty = 0
+			if e.limiter != nil {
+				e.limiter.wait(n)
+			}
+			e.metrics.AddBytesRead(int64(n))
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				return copied, fmt.Errorf("failed to hash %s content: %w", name, writeErr)
+			}
+			copied += int64(n)
+		} else if err == nil {
+			empty++
+			if empty >= maxEmptyReads {
+				return copied, fmt.Errorf("failed to read %s: %w", name, io.ErrNoProgress)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return copied, nil
+		}
+		if err != nil {
+			return copied, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+}
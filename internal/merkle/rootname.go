@@ -0,0 +1,46 @@
+// Package merkle (rootname.go) provides optional mixing of the root's name into its hash.
+// Entry names only order a directory's children, so two directories with identical
+// contents hash the same whatever they are called. With the root name included, the
+// final hash also covers the base name of the hashed path, so renaming the top-level
+// directory changes it; roots of differently named paths are then never equal.
+package merkle
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// SetIncludeRootName mixes the base name of the hashed path into the root returned by
+// HashPath, HashSubtrees, HashChunks, HashGitChanged and HashFS. Inner nodes are unaffected, so
+// inclusion proofs cannot be built with it. Changes the root hash.
+func (e *Engine) SetIncludeRootName(include bool) {
+	e.includeRootName = include
+}
+
+// withRootName returns result with the base name of path mixed into its hash: the hash
+// of the name, a NUL byte and the original hash. The size is unchanged.
+//
+// Parameters:
+//   - path: The hashed path, as given by the caller
+//   - result: The root result computed for path
+//
+// Returns the named result and any error encountered while resolving the name.
+func (e *Engine) withRootName(path string, result Result) (Result, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	return e.namedResult(filepath.Base(absPath), result)
+}
+
+// namedResult returns result with name mixed into its hash, as described for withRootName.
+func (e *Engine) namedResult(name string, result Result) (Result, error) {
+	h := e.newHash()
+	if _, err := io.WriteString(h, name); err != nil {
+		return Result{}, fmt.Errorf("failed to hash root name: %w", err)
+	}
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(result.Hash)
+	return Result{Hash: h.Sum(nil), Size: result.Size}, nil
+}
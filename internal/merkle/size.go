@@ -0,0 +1,213 @@
+// Package merkle (size.go) provides size-only traversal of a tree.
+// It applies the same exclusion rules as hashing but only inspects directory
+// entries, so the total size is known without reading any file contents.
+package merkle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+)
+
+// SizePath computes the total size in bytes of the files under path, exactly as
+// HashPath would report it, without hashing. Excluded entries, special files and
+// symlinks are skipped (symlinks have zero size), and directories are walked using
+// their entry information only, so no file is opened. When a content class is set,
+// files must be sniffed to be classified, so their first SniffSize bytes are read.
+//
+// Parameters:
+//   - path: The file or directory path to measure
+//
+// Returns the total size in bytes and any error encountered while walking the tree.
+func (e *Engine) SizePath(path string) (int64, error) {
+	path, err := e.resolveRoot(path)
+	if err != nil {
+		return 0, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	if e.rootPath == "" {
+		e.rootPath = absPath
+	}
+	log := logger.WithOperation("size_path", "path", absPath)
+	start := time.Now()
+
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat path %q: %w", absPath, err)
+	}
+	if e.isExcluded(absPath, info.IsDir()) || info.Mode()&os.ModeSymlink != 0 {
+		return 0, nil
+	}
+	if !info.IsDir() {
+		return info.Size(), nil
+	}
+
+	size, err := e.sizeDir(absPath)
+	if err != nil {
+		return 0, err
+	}
+	log.Debug("Size computed", "size", size, "duration", time.Since(start))
+	return size, nil
+}
+
+// sizeDir sums the sizes of the included files under a directory recursively.
+//
+// Parameters:
+//   - path: The absolute path to the directory to measure
+//
+// Returns the total size in bytes and any error encountered.
+func (e *Engine) sizeDir(path string) (int64, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read directory %q: %w", path, err)
+	}
+
+	var total int64
+	for _, entry := range entries {
+		// Special files and symlinks contribute no size to the hash
+		if entry.Type()&(os.ModeNamedPipe|os.ModeSocket|os.ModeDevice|os.ModeSymlink) != 0 {
+			continue
+		}
+		childPath := filepath.Join(path, entry.Name())
+		if e.isExcluded(childPath, entry.IsDir()) || e.onOtherDevice(entry) {
+			continue
+		}
+
+		if entry.IsDir() && e.shallow {
+			// Subdirectories are name-only leaves when not hashing recursively
+			continue
+		}
+		if entry.IsDir() {
+			size, err := e.sizeDir(childPath)
+			if err != nil {
+				return 0, fmt.Errorf("failed to measure entry %q in directory %q: %w", entry.Name(), path, err)
+			}
+			total += size
+			continue
+		}
+
+		if e.contentClass != ContentAll {
+			binary, err := e.isBinary(childPath)
+			if err != nil {
+				return 0, err
+			}
+			if binary != (e.contentClass == ContentBinaryOnly) {
+				continue
+			}
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get info for entry %q in directory %q: %w", entry.Name(), path, err)
+		}
+		if e.isExcludedBySize(info.Size()) {
+			continue
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
+// Estimate is the approximate extent of a tree, gathered from directory entries only.
+type Estimate struct {
+	// Files is the number of regular files found.
+	Files int64
+	// Bytes is the total size of those files.
+	Bytes int64
+	// Partial is true if the walk stopped early because Bytes exceeded the limit.
+	Partial bool
+}
+
+// EstimatePath quickly estimates how many files and bytes hashing path would cover.
+// Like SizePath it applies the exclusion rules and reads directory entries only, but it
+// never sniffs contents, so content classes are ignored. With a positive limit, the walk
+// stops as soon as the byte count exceeds it, which keeps estimates of huge trees cheap.
+//
+// Parameters:
+//   - path: The file or directory path to estimate
+//   - limit: The byte count after which to stop walking, or 0 for no limit
+//
+// Returns the estimate and any error encountered while walking the tree.
+func (e *Engine) EstimatePath(path string, limit int64) (Estimate, error) {
+	path, err := e.resolveRoot(path)
+	if err != nil {
+		return Estimate{}, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return Estimate{}, fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	if e.rootPath == "" {
+		e.rootPath = absPath
+	}
+
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return Estimate{}, fmt.Errorf("failed to stat path %q: %w", absPath, err)
+	}
+	if e.isExcluded(absPath, info.IsDir()) || info.Mode()&os.ModeSymlink != 0 {
+		return Estimate{}, nil
+	}
+	if !info.IsDir() {
+		return Estimate{Files: 1, Bytes: info.Size(), Partial: limit > 0 && info.Size() > limit}, nil
+	}
+
+	var est Estimate
+	if err := e.estimateDir(absPath, limit, &est); err != nil {
+		return est, err
+	}
+	return est, nil
+}
+
+// estimateDir adds the files of a directory to est, recursing into subdirectories,
+// until est.Bytes exceeds a positive limit.
+func (e *Engine) estimateDir(path string, limit int64, est *Estimate) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return fmt.Errorf("failed to read directory %q: %w", path, err)
+	}
+
+	for _, entry := range entries {
+		if entry.Type()&(os.ModeNamedPipe|os.ModeSocket|os.ModeDevice|os.ModeSymlink) != 0 {
+			continue
+		}
+		childPath := filepath.Join(path, entry.Name())
+		if e.isExcluded(childPath, entry.IsDir()) || e.onOtherDevice(entry) {
+			continue
+		}
+
+		if entry.IsDir() {
+			if e.shallow {
+				continue
+			}
+			if err := e.estimateDir(childPath, limit, est); err != nil {
+				return err
+			}
+			if est.Partial {
+				return nil
+			}
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to get info for entry %q in directory %q: %w", entry.Name(), path, err)
+		}
+		if e.isExcludedBySize(info.Size()) {
+			continue
+		}
+		est.Files++
+		est.Bytes += info.Size()
+		if limit > 0 && est.Bytes > limit {
+			est.Partial = true
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+// Package merkle (sizerule.go) provides size-based exclusion of files. Rules come from
+// SetExcludeSize (--exclude-size) and from "@size" patterns in ignore files, which the
+// exclusion matcher reports through ignore.SizeMatcher.
+package merkle
+
+import (
+	"github.com/lucho00cuba/mtc/internal/ignore"
+)
+
+// SetExcludeSize excludes regular files inside directories whose size matches any of the
+// given rules, in addition to the "@size" patterns of the engine's exclusion patterns.
+// Excluded files do not contribute to their directory's hash. A single file passed
+// directly to HashPath is always hashed. Nil removes the rules.
+//
+// Parameters:
+//   - rules: The size rules, as parsed by ignore.ParseSizeRule
+func (e *Engine) SetExcludeSize(rules []ignore.SizeRule) {
+	e.excludeSize = rules
+}
+
+// isExcludedBySize reports whether a regular file of the given size is excluded by a size
+// rule, whether set with SetExcludeSize or given as an "@size" exclusion pattern.
+func (e *Engine) isExcludedBySize(size int64) bool {
+	for _, rule := range e.excludeSize {
+		if rule.Match(size) {
+			return true
+		}
+	}
+	if sm, ok := e.matcher.(ignore.SizeMatcher); ok {
+		return sm.MatchSize(size)
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+// Package merkle (sparse.go) provides hole-aware reading of sparse files.
+// Large sparse files (VM images, preallocated databases) are mostly holes that read as
+// zeros. Where the platform can report holes, they are produced as zero-runs from memory
+// instead of being read from disk. The bytes handed to the hasher are unchanged, so
+// hashes are identical to reading the whole file.
+package merkle
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// sparseReader reads a file sequentially, skipping the disk reads of its holes.
+// It alternates between hole regions, which are filled with zeros, and data regions,
+// which are read from the file; regions are located lazily with SEEK_DATA and SEEK_HOLE.
+type sparseReader struct {
+	f    *os.File
+	size int64
+	pos  int64
+	// holeEnd is the end of the hole being produced (holeEnd <= pos means none)
+	holeEnd int64
+	// dataEnd is the end of the data region being read (dataEnd <= pos means none)
+	dataEnd int64
+}
+
+// newFileReader returns a reader over the size bytes of f, which skips reading holes
+// when the platform supports it and returns f itself otherwise.
+func newFileReader(f *os.File, size int64) io.Reader {
+	if !SparseSupported {
+		return f
+	}
+	return &sparseReader{f: f, size: size}
+}
+
+// Read fills p from the current hole or data region, locating the next region when
+// the current one is exhausted.
+func (r *sparseReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	if r.pos >= r.holeEnd && r.pos >= r.dataEnd {
+		r.locate()
+	}
+
+	if r.pos < r.holeEnd {
+		n := int(min(int64(len(p)), r.holeEnd-r.pos))
+		clear(p[:n])
+		r.pos += int64(n)
+		return n, nil
+	}
+
+	n, err := r.f.ReadAt(p[:min(int64(len(p)), r.dataEnd-r.pos)], r.pos)
+	r.pos += int64(n)
+	if err == io.EOF {
+		// The file shrank while being read; report the end of its contents
+		r.size = r.pos
+		if n > 0 {
+			err = nil
+		}
+	}
+	return n, err
+}
+
+// locate finds the region starting at the current position. If the platform or
+// filesystem cannot report holes, the rest of the file is treated as data.
+func (r *sparseReader) locate() {
+	r.dataEnd = r.size
+	data, err := r.f.Seek(r.pos, seekData)
+	switch {
+	case errors.Is(err, syscall.ENXIO):
+		// No data after pos: the rest of the file is a hole
+		r.holeEnd = r.size
+		return
+	case err != nil:
+		return
+	case data > r.pos:
+		r.holeEnd = min(data, r.size)
+		return
+	}
+	if hole, err := r.f.Seek(r.pos, seekHole); err == nil && hole > r.pos {
+		r.dataEnd = min(hole, r.size)
+	}
+}
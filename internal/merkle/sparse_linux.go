@@ -0,0 +1,13 @@
+//go:build linux
+
+// Package merkle (sparse_linux.go) locates holes in sparse files on Linux.
+package merkle
+
+// SparseSupported reports whether holes in sparse files are skipped instead of read on this platform.
+const SparseSupported = true
+
+// Whence values of lseek for locating data and holes.
+const (
+	seekData = 3 // SEEK_DATA
+	seekHole = 4 // SEEK_HOLE
+)
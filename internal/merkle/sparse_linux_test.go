@@ -0,0 +1,100 @@
+//go:build linux
+
+package merkle
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zeebo/blake3"
+)
+
+func TestEngine_SparseFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	sparseFile := filepath.Join(tmpDir, "disk.img")
+	f, err := os.Create(sparseFile)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	// 64 MiB with data at 1 MiB and 40 MiB, holes elsewhere (including the end)
+	if err := f.Truncate(64 << 20); err != nil {
+		t.Fatalf("Failed to truncate file: %v", err)
+	}
+	for _, offset := range []int64{1 << 20, 40 << 20} {
+		if _, err := f.WriteAt(bytes.Repeat([]byte("data"), 4096), offset); err != nil {
+			t.Fatalf("Failed to write data: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Failed to close file: %v", err)
+	}
+
+	content, err := os.ReadFile(sparseFile)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	want := blake3.Sum256(content)
+
+	result, err := NewEngine().HashPath(sparseFile)
+	if err != nil {
+		t.Fatalf("HashPath() error = %v", err)
+	}
+	if !equal(result.Hash, want[:]) {
+		t.Errorf("HashPath() sparse hash = %x, want full-read hash %x", result.Hash, want)
+	}
+	if result.Size != int64(len(content)) {
+		t.Errorf("HashPath() size = %d, want %d", result.Size, len(content))
+	}
+}
+
+func TestSparseReader(t *testing.T) {
+	tmpDir := t.TempDir()
+	tests := []struct {
+		name  string
+		setup func(f *os.File) error
+	}{
+		{name: "empty", setup: func(f *os.File) error { return nil }},
+		{name: "no holes", setup: func(f *os.File) error {
+			_, err := f.Write(bytes.Repeat([]byte{1, 2, 3}, 100000))
+			return err
+		}},
+		{name: "only hole", setup: func(f *os.File) error { return f.Truncate(8 << 20) }},
+		{name: "leading hole", setup: func(f *os.File) error {
+			_, err := f.WriteAt([]byte("tail"), 8<<20)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, tt.name)
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+			defer func() { _ = f.Close() }()
+			if err := tt.setup(f); err != nil {
+				t.Fatalf("Failed to set up file: %v", err)
+			}
+			info, err := f.Stat()
+			if err != nil {
+				t.Fatalf("Failed to stat file: %v", err)
+			}
+
+			got, err := io.ReadAll(newFileReader(f, info.Size()))
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("sparseReader produced %d bytes differing from the %d bytes on disk", len(got), len(want))
+			}
+		})
+	}
+}
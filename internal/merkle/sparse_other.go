@@ -0,0 +1,14 @@
+//go:build !linux
+
+// Package merkle (sparse_other.go) provides the sparse file fallback for platforms
+// where holes cannot be located; files are always read in full.
+package merkle
+
+// SparseSupported reports whether holes in sparse files are skipped instead of read on this platform.
+const SparseSupported = false
+
+// Whence values are never used on this platform.
+const (
+	seekData = 0
+	seekHole = 0
+)
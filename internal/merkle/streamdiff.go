@@ -0,0 +1,250 @@
+// Package merkle (streamdiff.go) provides a streaming per-file comparison of two trees.
+// Both trees are walked simultaneously in sorted path order and their leaves are
+// merge-joined on the fly, so differences are reported as they are found and memory
+// is bounded by the depth and width of the trees rather than by their number of files.
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// leafIterator walks the leaves (files and symlinks) of a tree in sorted path order,
+// hashing each one as it is reached. Only the listings of the directories on the path
+// to the current leaf are held in memory.
+type leafIterator struct {
+	engine  *Engine
+	root    string
+	visited *sync.Map
+	// stack holds the remaining entries of every directory being walked, innermost last
+	stack []*leafFrame
+	// single is the result of a root that is not a directory, returned once as "."
+	single *Result
+}
+
+// leafFrame is a directory being walked by a leafIterator.
+type leafFrame struct {
+	dir     string
+	entries []os.DirEntry
+}
+
+// leafEntry is a leaf returned by a leafIterator.
+type leafEntry struct {
+	// rel is the slash-separated path relative to the tree root
+	rel    string
+	result Result
+}
+
+// newLeafIterator prepares the walk of the tree at root. A root that is not a directory
+// is hashed immediately and returned as a single leaf named ".".
+func (e *Engine) newLeafIterator(root string) (*leafIterator, error) {
+	it := &leafIterator{engine: e, root: root, visited: &sync.Map{}}
+
+	info, err := os.Lstat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat path %q: %w", root, err)
+	}
+	if !info.IsDir() {
+		result, err := e.hashPath(root, it.visited)
+		if err != nil {
+			return nil, err
+		}
+		it.single = &result
+		return it, nil
+	}
+	if err := it.push(root); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// push lists a directory like hashing does, within the entries limit and the open files
+// budget, and adds it to the top of the stack. Entries are ordered so that walking them
+// depth-first yields leaves sorted by full path: a subdirectory walked into sorts as its
+// name followed by "/", exactly where its descendants' paths fall.
+func (it *leafIterator) push(dir string) error {
+	entries, err := it.engine.readDirEntries(dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return it.sortKey(entries[i]) < it.sortKey(entries[j])
+	})
+	it.stack = append(it.stack, &leafFrame{dir: dir, entries: entries})
+	return nil
+}
+
+// descends reports whether the walk enters a directory entry instead of returning it as a
+// leaf, which shallow hashing and marker directories do.
+func (it *leafIterator) descends(entry os.DirEntry) bool {
+	return entry.IsDir() && !it.engine.shallow && !it.engine.isMarkerDir(entry.Name())
+}
+
+// sortKey returns the key a directory entry is sorted by while walking leaves.
+func (it *leafIterator) sortKey(entry os.DirEntry) string {
+	if it.descends(entry) {
+		return entry.Name() + "/"
+	}
+	return entry.Name()
+}
+
+// next returns the next leaf in sorted path order, or false once the tree is exhausted.
+// Entries are filtered exactly as when hashing the tree (exclusions, special files,
+// content class, empty files), and with shallow hashing, subdirectories are leaves, as are
+// marker directories.
+func (it *leafIterator) next() (leafEntry, bool, error) {
+	if it.single != nil {
+		leaf := leafEntry{rel: ".", result: *it.single}
+		it.single = nil
+		return leaf, true, nil
+	}
+
+	e := it.engine
+	for len(it.stack) > 0 {
+		frame := it.stack[len(it.stack)-1]
+		if len(frame.entries) == 0 {
+			it.stack = it.stack[:len(it.stack)-1]
+			continue
+		}
+		entry := frame.entries[0]
+		frame.entries = frame.entries[1:]
+
+		childPath := filepath.Join(frame.dir, entry.Name())
+		if entry.Type()&(os.ModeNamedPipe|os.ModeSocket|os.ModeDevice) != 0 {
+			e.diagnostics.add(DiagnosticSpecialFile, childPath, entry.Type().String())
+			continue
+		}
+		if e.isExcluded(childPath, entry.IsDir()) || e.onOtherDevice(entry) {
+			continue
+		}
+
+		if it.descends(entry) {
+			if err := it.push(childPath); err != nil {
+				return leafEntry{}, false, err
+			}
+			continue
+		}
+
+		child, keep, err := e.hashEntry(frame.dir, entry, childPath, it.visited)
+		if err != nil {
+			return leafEntry{}, false, err
+		}
+		if !keep {
+			continue
+		}
+		rel, err := it.relPath(childPath)
+		if err != nil {
+			return leafEntry{}, false, err
+		}
+		return leafEntry{rel: rel, result: child.result}, true, nil
+	}
+	return leafEntry{}, false, nil
+}
+
+// relPath returns the slash-separated path of a leaf relative to the tree root, so the
+// same logical file is reported under the same path whichever tree it is found in.
+func (it *leafIterator) relPath(path string) (string, error) {
+	rel, err := filepath.Rel(it.root, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute relative path of %q: %w", path, err)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// StreamDiff compares the leaves of two trees file by file, walking both in sorted path
+// order at the same time and calling emit with an "added: <path>" (only in a),
+// "deleted: <path>" (only in b) or "modified: <path>" line for every difference as soon
+// as it is found. Paths are relative to the root of the tree the file was found in, so a
+// file present in both trees is reported once under the same path, and a file present in
+// only one of them under its path in that tree. Lines are emitted sorted by path.
+// Neither tree is loaded into memory; only the directory listings along the current
+// paths are kept.
+//
+// Directories themselves are not compared, so empty directories are never reported.
+// Callers are responsible for configuring both engines identically.
+//
+// Parameters:
+//   - a: The first path to compare (file or directory)
+//   - b: The second path to compare (file or directory)
+//   - engineA: The engine used to walk path a
+//   - engineB: The engine used to walk path b
+//   - emit: Called with each difference line; an error stops the comparison
+//
+// Returns the number of differences and any error encountered while walking, hashing
+// or emitting.
+func StreamDiff(a, b string, engineA, engineB *Engine, emit func(line string) error) (int, error) {
+	iterA, err := newStreamIterator(a, engineA)
+	if err != nil {
+		return 0, err
+	}
+	iterB, err := newStreamIterator(b, engineB)
+	if err != nil {
+		return 0, err
+	}
+
+	leafA, okA, err := iterA.next()
+	if err != nil {
+		return 0, err
+	}
+	leafB, okB, err := iterB.next()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for okA || okB {
+		var line string
+		advanceA, advanceB := false, false
+		switch {
+		case !okB || (okA && leafA.rel < leafB.rel):
+			line = "added: " + leafA.rel
+			advanceA = true
+		case !okA || leafB.rel < leafA.rel:
+			line = "deleted: " + leafB.rel
+			advanceB = true
+		default:
+			if !bytes.Equal(leafA.result.Hash, leafB.result.Hash) {
+				line = "modified: " + leafA.rel
+			}
+			advanceA, advanceB = true, true
+		}
+
+		if line != "" {
+			count++
+			if err := emit(line); err != nil {
+				return count, err
+			}
+		}
+		if advanceA {
+			if leafA, okA, err = iterA.next(); err != nil {
+				return count, err
+			}
+		}
+		if advanceB {
+			if leafB, okB, err = iterB.next(); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, nil
+}
+
+// newStreamIterator resolves a root argument like HashPath does and prepares its walk.
+func newStreamIterator(path string, engine *Engine) (*leafIterator, error) {
+	path, err := engine.resolveRoot(path)
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	if engine.rootPath == "" {
+		engine.rootPath = absPath
+	}
+	return engine.newLeafIterator(absPath)
+}
@@ -0,0 +1,37 @@
+// Package merkle (structure.go) provides structure-only hashing.
+// In structure-only mode, leaves are derived from entry names and types instead of
+// contents, so the root captures the shape of a tree (which files, symlinks and
+// directories exist where) and stays the same when file contents are edited.
+package merkle
+
+import "io"
+
+// Entry kinds mixed into structure-only leaves, so a file and a directory with the
+// same name hash differently.
+const (
+	structureFile    = 'f'
+	structureDir     = 'd'
+	structureSymlink = 'l'
+)
+
+// SetStructureOnly makes the engine hash only the tree's structure. Files hash to
+// their name, symlinks to their name and target, and directories to their name and
+// the structure root of their entries; file contents are never read. Reported sizes are
+// still the file sizes from directory entries. Changes the root hash.
+func (e *Engine) SetStructureOnly(structureOnly bool) {
+	e.structureOnly = structureOnly
+}
+
+// structureLeaf returns the structure-only hash of an entry: the hash of its
+// kind, a NUL byte, its name, and, for symlinks and directories, a NUL byte followed
+// by the link target or the directory's structure root.
+func (e *Engine) structureLeaf(kind byte, name string, extra []byte) []byte {
+	h := e.newHash()
+	_, _ = h.Write([]byte{kind, 0})
+	_, _ = io.WriteString(h, name)
+	if extra != nil {
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write(extra)
+	}
+	return h.Sum(nil)
+}
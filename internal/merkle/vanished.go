@@ -0,0 +1,35 @@
+// Package merkle (vanished.go) provides tolerance of entries vanishing mid-walk.
+// A directory is listed before its entries are hashed, so an entry removed in between
+// makes hashing fail with "no such file or directory". On a live tree, the engine can
+// instead treat such an entry as absent, as rsync does with vanished files.
+package merkle
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/lucho00cuba/mtc/internal/logger"
+)
+
+// SetIgnoreVanished makes the engine leave out entries that disappear between the listing
+// of their directory and their hashing, logging a warning, instead of failing. The root
+// then reflects the tree without them. Only the vanished entry itself is left out: an
+// error about a missing path elsewhere still fails.
+func (e *Engine) SetIgnoreVanished(ignore bool) {
+	e.ignoreVanished = ignore
+}
+
+// vanished reports whether err comes from the entry at path having disappeared, if the
+// engine ignores vanished entries, recording a diagnostic when it does.
+func (e *Engine) vanished(path string, err error) bool {
+	if !e.ignoreVanished || !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	if _, statErr := os.Lstat(path); !errors.Is(statErr, fs.ErrNotExist) {
+		return false
+	}
+	logger.WithOperation("hash_dir", "path", path).Warn("Entry vanished during walk, leaving it out", "error", err)
+	e.diagnostics.add(DiagnosticVanished, path, err.Error())
+	return true
+}
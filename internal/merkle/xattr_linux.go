@@ -0,0 +1,101 @@
+//go:build linux
+
+// Package merkle (xattr_linux.go) reads extended attributes on Linux.
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"syscall"
+)
+
+// XattrSupported reports whether extended attributes can be hashed on this platform.
+const XattrSupported = true
+
+// hashXattrs writes the extended attributes of path to h as name=value pairs,
+// sorted by name and each terminated by a NUL byte. Filesystems that do not
+// support extended attributes are treated as having none.
+//
+// Parameters:
+//   - h: The hasher to write the attributes to
+//   - path: The file whose attributes are read
+//
+// Returns any error encountered while reading the attributes.
+func hashXattrs(h hash.Hash, path string) error {
+	names, err := listXattrs(path)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, err := getXattr(path, name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(h, name+"="); err != nil {
+			return fmt.Errorf("failed to hash extended attribute %q: %w", name, err)
+		}
+		if _, err := h.Write(append(value, 0)); err != nil {
+			return fmt.Errorf("failed to hash extended attribute %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// listXattrs returns the names of the extended attributes set on path.
+func listXattrs(path string) ([]string, error) {
+	for {
+		size, err := syscall.Listxattr(path, nil)
+		if errors.Is(err, syscall.ENOTSUP) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list extended attributes of %q: %w", path, err)
+		}
+		if size == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, size)
+		n, err := syscall.Listxattr(path, buf)
+		if errors.Is(err, syscall.ERANGE) {
+			continue // Attributes changed between calls, retry with a new size
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list extended attributes of %q: %w", path, err)
+		}
+
+		var names []string
+		for _, name := range bytes.Split(buf[:n], []byte{0}) {
+			if len(name) > 0 {
+				names = append(names, string(name))
+			}
+		}
+		return names, nil
+	}
+}
+
+// getXattr returns the value of the named extended attribute of path.
+func getXattr(path, name string) ([]byte, error) {
+	for {
+		size, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read extended attribute %q of %q: %w", name, path, err)
+		}
+
+		buf := make([]byte, size)
+		n, err := syscall.Getxattr(path, name, buf)
+		if errors.Is(err, syscall.ERANGE) {
+			continue // Value changed between calls, retry with a new size
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read extended attribute %q of %q: %w", name, path, err)
+		}
+		return buf[:n], nil
+	}
+}
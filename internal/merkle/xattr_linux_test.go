@@ -0,0 +1,61 @@
+//go:build linux
+
+package merkle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestEngine_SetIncludeXattr(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "file.txt")
+	if err := os.WriteFile(testFile, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	hash := func(includeXattr bool) []byte {
+		t.Helper()
+		engine := NewEngine()
+		if err := engine.SetIncludeXattr(includeXattr); err != nil {
+			t.Fatalf("SetIncludeXattr() error = %v", err)
+		}
+		result, err := engine.HashPath(tmpDir)
+		if err != nil {
+			t.Fatalf("HashPath() error = %v", err)
+		}
+		return result.Hash
+	}
+
+	// Without attributes the flag has no effect
+	plain := hash(false)
+	if !equal(plain, hash(true)) {
+		t.Error("HashPath() with xattrs should not change the hash of a file without attributes")
+	}
+
+	err := syscall.Setxattr(testFile, "user.mtc.test", []byte("label"), 0)
+	if errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EPERM) {
+		t.Skipf("Extended attributes not supported on this filesystem: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Failed to set xattr: %v", err)
+	}
+
+	if !equal(plain, hash(false)) {
+		t.Error("HashPath() without xattrs should ignore extended attributes")
+	}
+	withXattr := hash(true)
+	if equal(plain, withXattr) {
+		t.Error("HashPath() with xattrs should change when an attribute is set")
+	}
+
+	if err := syscall.Setxattr(testFile, "user.mtc.test", []byte("other"), 0); err != nil {
+		t.Fatalf("Failed to update xattr: %v", err)
+	}
+	if equal(withXattr, hash(true)) {
+		t.Error("HashPath() with xattrs should change when an attribute value changes")
+	}
+}
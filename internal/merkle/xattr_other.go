@@ -0,0 +1,18 @@
+//go:build !linux
+
+// Package merkle (xattr_other.go) provides the extended attribute fallback for
+// platforms where reading them is not supported.
+package merkle
+
+import (
+	"fmt"
+	"hash"
+)
+
+// XattrSupported reports whether extended attributes can be hashed on this platform.
+const XattrSupported = false
+
+// hashXattrs is not supported on this platform.
+func hashXattrs(h hash.Hash, path string) error {
+	return fmt.Errorf("extended attributes are not supported on this platform")
+}
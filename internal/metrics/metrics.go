@@ -0,0 +1,176 @@
+// Package metrics provides a minimal registry of hashing statistics and an HTTP
+// endpoint exposing them in the Prometheus text exposition format. Counters are
+// updated atomically so workers can record events without locking.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// DurationBuckets are the upper bounds, in seconds, of the file hash duration histogram.
+var DurationBuckets = []float64{0.001, 0.01, 0.1, 1, 10, 60}
+
+// Registry holds the hashing statistics of a run.
+// All methods are safe for concurrent use and do nothing on a nil registry,
+// so callers can record events unconditionally.
+type Registry struct {
+	filesHashed atomic.Int64
+	bytesRead   atomic.Int64
+	errors      atomic.Int64
+	// durationCounts holds the (non-cumulative) count of each bucket, plus a final +Inf bucket
+	durationCounts []atomic.Int64
+	durationSumNs  atomic.Int64
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{durationCounts: make([]atomic.Int64, len(DurationBuckets)+1)}
+}
+
+// AddBytesRead records n bytes read from disk.
+func (r *Registry) AddBytesRead(n int64) {
+	if r == nil {
+		return
+	}
+	r.bytesRead.Add(n)
+}
+
+// ObserveFile records a successfully hashed file and how long it took.
+func (r *Registry) ObserveFile(d time.Duration) {
+	if r == nil {
+		return
+	}
+	r.filesHashed.Add(1)
+	r.durationSumNs.Add(int64(d))
+
+	seconds := d.Seconds()
+	bucket := len(DurationBuckets)
+	for i, bound := range DurationBuckets {
+		if seconds <= bound {
+			bucket = i
+			break
+		}
+	}
+	r.durationCounts[bucket].Add(1)
+}
+
+// IncErrors records a failure to hash a file.
+func (r *Registry) IncErrors() {
+	if r == nil {
+		return
+	}
+	r.errors.Add(1)
+}
+
+// WriteText writes the registry in the Prometheus text exposition format.
+//
+// Parameters:
+//   - w: The writer to write the metrics to
+//
+// Returns any error encountered while writing.
+func (r *Registry) WriteText(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+
+	var err error
+	write := func(format string, args ...any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	write("# HELP mtc_files_hashed_total Number of files hashed.\n")
+	write("# TYPE mtc_files_hashed_total counter\n")
+	write("mtc_files_hashed_total %d\n", r.filesHashed.Load())
+	write("# HELP mtc_bytes_read_total Number of bytes read from files.\n")
+	write("# TYPE mtc_bytes_read_total counter\n")
+	write("mtc_bytes_read_total %d\n", r.bytesRead.Load())
+	write("# HELP mtc_errors_total Number of files that failed to hash.\n")
+	write("# TYPE mtc_errors_total counter\n")
+	write("mtc_errors_total %d\n", r.errors.Load())
+
+	write("# HELP mtc_file_hash_duration_seconds Time taken to hash a single file.\n")
+	write("# TYPE mtc_file_hash_duration_seconds histogram\n")
+	var cumulative int64
+	for i, bound := range DurationBuckets {
+		cumulative += r.durationCounts[i].Load()
+		write("mtc_file_hash_duration_seconds_bucket{le=\"%g\"} %d\n", bound, cumulative)
+	}
+	cumulative += r.durationCounts[len(DurationBuckets)].Load()
+	write("mtc_file_hash_duration_seconds_bucket{le=\"+Inf\"} %d\n", cumulative)
+	write("mtc_file_hash_duration_seconds_sum %g\n", time.Duration(r.durationSumNs.Load()).Seconds())
+	write("mtc_file_hash_duration_seconds_count %d\n", cumulative)
+	return err
+}
+
+// Handler returns an HTTP handler serving the registry in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.WriteText(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Server is a running metrics endpoint.
+type Server struct {
+	srv      *http.Server
+	listener net.Listener
+	done     chan error
+}
+
+// Serve starts an HTTP server on addr exposing the registry at /metrics.
+//
+// Parameters:
+//   - addr: The listen address (e.g. ":9090"); port 0 picks a free port
+//   - r: The registry to expose
+//
+// Returns the running server, or an error if the address cannot be listened on.
+func Serve(addr string, r *Registry) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r.Handler())
+	s := &Server{
+		srv:      &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+		listener: listener,
+		done:     make(chan error, 1),
+	}
+	go func() {
+		err := s.srv.Serve(listener)
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		s.done <- err
+	}()
+	return s, nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server, waiting for in-flight requests to complete.
+//
+// Returns any error encountered while serving or shutting down.
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to stop metrics server: %w", err)
+	}
+	return <-s.done
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	r.AddBytesRead(1024)
+	r.AddBytesRead(512)
+	r.ObserveFile(5 * time.Millisecond)
+	r.ObserveFile(2 * time.Second)
+	r.IncErrors()
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	output := buf.String()
+
+	for _, want := range []string{
+		"# TYPE mtc_files_hashed_total counter",
+		"mtc_files_hashed_total 2\n",
+		"mtc_bytes_read_total 1536\n",
+		"mtc_errors_total 1\n",
+		"# TYPE mtc_file_hash_duration_seconds histogram",
+		"mtc_file_hash_duration_seconds_bucket{le=\"0.001\"} 0\n",
+		"mtc_file_hash_duration_seconds_bucket{le=\"0.01\"} 1\n",
+		"mtc_file_hash_duration_seconds_bucket{le=\"1\"} 1\n",
+		"mtc_file_hash_duration_seconds_bucket{le=\"10\"} 2\n",
+		"mtc_file_hash_duration_seconds_bucket{le=\"+Inf\"} 2\n",
+		"mtc_file_hash_duration_seconds_sum 2.005\n",
+		"mtc_file_hash_duration_seconds_count 2\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("WriteText() output missing %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestRegistry_Nil(t *testing.T) {
+	var r *Registry
+	r.AddBytesRead(1)
+	r.ObserveFile(time.Second)
+	r.IncErrors()
+	if err := r.WriteText(io.Discard); err != nil {
+		t.Errorf("WriteText() on nil registry error = %v", err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	r := NewRegistry()
+	r.ObserveFile(time.Millisecond)
+
+	server, err := Serve("127.0.0.1:0", r)
+	if err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+	defer func() {
+		if err := server.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+	}()
+
+	resp, err := http.Get("http://" + server.Addr() + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics error = %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /metrics status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", resp.Header.Get("Content-Type"))
+	}
+	for _, name := range []string{"mtc_files_hashed_total", "mtc_bytes_read_total", "mtc_errors_total", "mtc_file_hash_duration_seconds_bucket"} {
+		if !strings.Contains(string(body), name) {
+			t.Errorf("Metrics missing %s, got:\n%s", name, body)
+		}
+	}
+}
+
+func TestServe_InvalidAddr(t *testing.T) {
+	if _, err := Serve("invalid-address", NewRegistry()); err == nil {
+		t.Error("Serve() expected error for invalid address")
+	}
+}
@@ -0,0 +1,84 @@
+// Package units provides the parsing and formatting of byte sizes, as accepted on the
+// command line (e.g. --chunk-size 4M) and in size-based exclusion rules, and as printed
+// in human-readable output.
+package units
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseSize parses a byte count with an optional binary (1024-based) unit suffix.
+// Accepted suffixes are K, M, G and T, optionally followed by "B" or "iB" and matched
+// case-insensitively, so "50M", "50MB" and "50MiB" are all 50 * 1024 * 1024 bytes.
+//
+// Parameters:
+//   - s: The size string to parse (e.g. "512", "64K", "1.5G")
+//
+// Returns the size in bytes, or an error if the string is not a valid non-negative size.
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "IB"), "B")
+
+	multiplier := int64(1)
+	if value != "" {
+		switch value[len(value)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			value = value[:len(value)-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n < 0 || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid size %q (expected a number with an optional K, M, G or T suffix)", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// FormatSize formats a size in bytes to a human-readable string.
+// It automatically selects the most appropriate unit (B, KB, MB, GB, TB, PB, EB)
+// based on the size value. Uses binary (1024-based) units.
+//
+// The function uses 1 decimal place for MB and above, and shows integers for KB
+// when the decimal part is zero.
+//
+// Parameters:
+//   - bytes: The size in bytes to format
+//
+// Returns a formatted string like "1.5 MB" or "512 B".
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+	size := float64(bytes)
+	exp := 0
+
+	for size >= unit && exp < len(units)-1 {
+		size /= unit
+		exp++
+	}
+
+	// Use 1 decimal place for MB and above, but for KB show as integer if decimal is zero
+	if exp == 1 { // KB
+		if size == float64(int64(size)) {
+			return fmt.Sprintf("%.0f %s", size, units[exp])
+		}
+		return fmt.Sprintf("%.1f %s", size, units[exp])
+	}
+	// For MB and above, always show 1 decimal place
+	return fmt.Sprintf("%.1f %s", size, units[exp])
+}
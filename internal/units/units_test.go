@@ -0,0 +1,94 @@
+package units
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{input: "0", want: 0},
+		{input: "512", want: 512},
+		{input: "64K", want: 64 * 1024},
+		{input: "50M", want: 50 * 1024 * 1024},
+		{input: "50mb", want: 50 * 1024 * 1024},
+		{input: "2GiB", want: 2 * 1024 * 1024 * 1024},
+		{input: "1.5K", want: 1536},
+		{input: "1T", want: 1 << 40},
+		{input: "", wantErr: true},
+		{input: "-1", wantErr: true},
+		{input: "fast", wantErr: true},
+		{input: "NaN", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSize(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		name  string
+		bytes int64
+		want  string
+	}{
+		{
+			name:  "zero bytes",
+			bytes: 0,
+			want:  "0 B",
+		},
+		{
+			name:  "less than 1KB",
+			bytes: 512,
+			want:  "512 B",
+		},
+		{
+			name:  "exactly 1KB",
+			bytes: 1024,
+			want:  "1 KB",
+		},
+		{
+			name:  "1.5KB",
+			bytes: 1536,
+			want:  "1.5 KB",
+		},
+		{
+			name:  "1MB",
+			bytes: 1024 * 1024,
+			want:  "1.0 MB",
+		},
+		{
+			name:  "1.5MB",
+			bytes: 1024 * 1024 * 1.5,
+			want:  "1.5 MB",
+		},
+		{
+			name:  "1GB",
+			bytes: 1024 * 1024 * 1024,
+			want:  "1.0 GB",
+		},
+		{
+			name:  "large size",
+			bytes: 1024 * 1024 * 1024 * 5,
+			want:  "5.0 GB",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FormatSize(tt.bytes)
+			if got != tt.want {
+				t.Errorf("FormatSize(%d) = %q, want %q", tt.bytes, got, tt.want)
+			}
+		})
+	}
+}
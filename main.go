@@ -4,9 +4,21 @@ package main
 
 import (
 	"github.com/lucho00cuba/mtc/cmd"
+	_ "github.com/lucho00cuba/mtc/cmd/bench"
 	_ "github.com/lucho00cuba/mtc/cmd/calc"
+	_ "github.com/lucho00cuba/mtc/cmd/combine"
 	_ "github.com/lucho00cuba/mtc/cmd/diff"
+	_ "github.com/lucho00cuba/mtc/cmd/diffmanifest"
 	_ "github.com/lucho00cuba/mtc/cmd/hash"
+	_ "github.com/lucho00cuba/mtc/cmd/ignoredebug"
+	_ "github.com/lucho00cuba/mtc/cmd/manifest"
+	_ "github.com/lucho00cuba/mtc/cmd/prove"
+	_ "github.com/lucho00cuba/mtc/cmd/selftest"
+	_ "github.com/lucho00cuba/mtc/cmd/size"
+	_ "github.com/lucho00cuba/mtc/cmd/tree"
+	_ "github.com/lucho00cuba/mtc/cmd/verify"
+	_ "github.com/lucho00cuba/mtc/cmd/verifyproof"
+	_ "github.com/lucho00cuba/mtc/cmd/version"
 )
 
 // main is the entry point of the application.